@@ -0,0 +1,151 @@
+// Command wbattack recovers the AES key and external masks of a serialized white-box key. It reads the key's header to
+// tell which construction it is, runs the matching attack from cryptanalysis/, and prints what it recovered:
+//
+//	$ wbattack -key constr.txt
+//	construction: chow (10 rounds)
+//	key: 0123456789abcdeffedcba9876543210
+//	input mask: identity
+//	output mask: 5b1f...
+//
+// Masks are printed in the format of chow.SerializeMask, hex-encoded. The masks can only be recovered when one of them is
+// the identity; otherwise they're only determined up to each other, and wbattack says so. Keys of the full construction
+// are identified but not attacked, since no attack on it is implemented.
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"runtime"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/xiao"
+
+	chowattack "github.com/OpenWhiteBox/AES/cryptanalysis/chow"
+	xiaoattack "github.com/OpenWhiteBox/AES/cryptanalysis/xiao"
+)
+
+var (
+	keyFile  = flag.String("key", "", "The serialized white-box key to attack.")
+	workers  = flag.Int("workers", runtime.GOMAXPROCS(0), "The number of goroutines to run the attack on (chow only).")
+	progress = flag.Bool("progress", false, "Report the attack's progress on stderr (chow only).")
+)
+
+var (
+	// names are the names of the constructions, as printed.
+	names = map[common.ConstructionType]string{
+		common.ChowConstruction: "chow",
+		common.XiaoConstruction: "xiao",
+		common.FullConstruction: "full",
+		common.ToyConstruction:  "toy",
+	}
+
+	identity = encoding.NewBlockAffine(matrix.GenerateIdentity(128), [16]byte{})
+)
+
+// identify returns the header of the serialized key in.
+func identify(in []byte) (common.Header, error) {
+	for _, typ := range []common.ConstructionType{
+		common.ChowConstruction, common.XiaoConstruction, common.FullConstruction, common.ToyConstruction,
+	} {
+		if h, _, err := common.ParseHeader(in, typ); err == nil {
+			return h, nil
+		}
+	}
+
+	return common.Header{}, errors.New("Key doesn't have a valid header!")
+}
+
+// attack parses the key as the construction its header names and recovers the AES key. The construction is returned as
+// an encryption oracle for recovering the masks.
+func attack(h common.Header, in []byte) (cipher.Block, []byte, error) {
+	switch h.Type {
+	case common.ChowConstruction:
+		constr, err := chow.Parse(in)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		opts := chowattack.Opts{Workers: *workers}
+		if *progress {
+			opts.Progress = func(phase string, percent int) { log.Printf("%v: %v%%", phase, percent) }
+		}
+
+		key, err := chowattack.RecoverKeyCtx(context.Background(), &constr, opts)
+		return constr, key, err
+
+	case common.XiaoConstruction:
+		constr, err := xiao.Parse(in)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		key, err := xiaoattack.RecoverKey(&constr)
+		return constr, key, err
+
+	default:
+		return nil, nil, fmt.Errorf("No attack on the %v construction is implemented!", names[h.Type])
+	}
+}
+
+// masks recovers the external masks of constr, which is a white-box of key, and prints them.
+func masks(constr cipher.Block, key []byte) {
+	if inputMask, err := chowattack.RecoverInputMask(constr, key, identity); err == nil {
+		fmt.Printf("input mask: %v\n", format(inputMask))
+		fmt.Println("output mask: identity")
+	} else if outputMask, err := chowattack.RecoverOutputMask(constr, key, identity); err == nil {
+		fmt.Println("input mask: identity")
+		fmt.Printf("output mask: %v\n", format(outputMask))
+	} else {
+		fmt.Println("input mask: unknown (both masks are random, so they're only determined up to each other)")
+		fmt.Println("output mask: unknown")
+	}
+}
+
+// format returns "identity" if mask is the identity, and mask hex-encoded otherwise.
+func format(mask encoding.BlockAffine) string {
+	serialized := chow.SerializeMask(mask)
+	if bytes.Equal(serialized, chow.SerializeMask(identity)) {
+		return "identity"
+	}
+
+	return hex.EncodeToString(serialized)
+}
+
+func main() {
+	flag.Parse()
+	if *keyFile == "" {
+		flag.PrintDefaults()
+		os.Exit(2)
+	}
+
+	in, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	h, err := identify(in)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("construction: %v (%v rounds)\n", names[h.Type], h.Rounds)
+
+	constr, key, err := attack(h, in)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	fmt.Printf("key: %x\n", key)
+
+	masks(constr, key)
+}
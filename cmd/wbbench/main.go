@@ -0,0 +1,161 @@
+// Command wbbench compares the cost of the white-box constructions: how long generating a key takes, how big the
+// serialized key is, and how fast and allocation-free encryption is, for each construction under each choice of
+// external masks. It prints a table:
+//
+//	$ wbbench -masks identity
+//	construction  masks     keygen  size     encrypt     throughput    allocs/op  bytes/op
+//	chow          identity  80ms    770065   2.783601ms  0.00575 MB/s  1616       4832
+//	full          random    1.86s   1091195  1.216874ms  0.0131 MB/s   0          0
+//
+// Encrypt is the latency of one call to Encrypt, and throughput is that of EncryptBlocks on 4KB at a time. The full
+// construction always has random masks, so it's only measured with those. Xiao's keys take minutes to generate and are
+// 21MB, so it isn't in the default set of constructions.
+package main
+
+import (
+	"crypto/rand"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"testing"
+	"text/tabwriter"
+	"time"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/full"
+	"github.com/OpenWhiteBox/AES/constructions/xiao"
+)
+
+var (
+	constructionList = flag.String("constructions", "chow,full", "Comma-separated constructions to measure: chow, xiao, full.")
+	maskList         = flag.String("masks", "identity,random-input,random-output,random,random-affine", "Comma-separated mask options to measure.")
+)
+
+// maskOptions are the choices of external masks, by name.
+var maskOptions = map[string]common.KeyGenerationOpts{
+	"identity":      common.IndependentMasks{common.IdentityMask, common.IdentityMask},
+	"random-input":  common.IndependentMasks{common.RandomMask, common.IdentityMask},
+	"random-output": common.IndependentMasks{common.IdentityMask, common.RandomMask},
+	"random":        common.IndependentMasks{common.RandomMask, common.RandomMask},
+	"random-affine": common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask},
+}
+
+// construction is what's measured of a generated key.
+type construction interface {
+	Encrypt(dst, src []byte)
+	EncryptBlocks(dst, src []byte)
+	Serialize() []byte
+}
+
+// generators generate a construction of each type with the given masks. A nil opts means the construction's only
+// choice of masks.
+var generators = map[string]func(key, seed []byte, opts common.KeyGenerationOpts) construction{
+	"chow": func(key, seed []byte, opts common.KeyGenerationOpts) construction {
+		constr, _, _ := chow.GenerateEncryptionKeys(key, seed, opts)
+		return &constr
+	},
+	"xiao": func(key, seed []byte, opts common.KeyGenerationOpts) construction {
+		constr, _, _ := xiao.GenerateEncryptionKeys(key, seed, opts)
+		return &constr
+	},
+	"full": func(key, seed []byte, opts common.KeyGenerationOpts) construction {
+		constr, _, _ := full.GenerateKeys(key, seed)
+		return &constr
+	},
+}
+
+// result is one row of the table.
+type result struct {
+	construction, masks string
+
+	keygen     time.Duration
+	size       int
+	encrypt    testing.BenchmarkResult
+	throughput testing.BenchmarkResult
+}
+
+// measure generates a key and benchmarks it.
+func measure(name, masks string, opts common.KeyGenerationOpts) (res result) {
+	res.construction, res.masks = name, masks
+
+	key, seed := make([]byte, 16), make([]byte, 16)
+	rand.Read(key)
+	rand.Read(seed)
+
+	start := time.Now()
+	constr := generators[name](key, seed, opts)
+	res.keygen = time.Since(start)
+
+	res.size = len(constr.Serialize())
+
+	res.encrypt = testing.Benchmark(func(b *testing.B) {
+		block := make([]byte, 16)
+
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			constr.Encrypt(block, block)
+		}
+	})
+
+	res.throughput = testing.Benchmark(func(b *testing.B) {
+		buff := make([]byte, 4096)
+
+		b.SetBytes(int64(len(buff)))
+		for i := 0; i < b.N; i++ {
+			constr.EncryptBlocks(buff, buff)
+		}
+	})
+
+	return res
+}
+
+// mbPerSec returns the throughput of a benchmark that called SetBytes.
+func mbPerSec(res testing.BenchmarkResult) float64 {
+	if res.T <= 0 {
+		return 0
+	}
+
+	return float64(res.Bytes) * float64(res.N) / 1e6 / res.T.Seconds()
+}
+
+func main() {
+	flag.Parse()
+
+	var results []result
+
+	for _, name := range strings.Split(*constructionList, ",") {
+		if _, ok := generators[name]; !ok {
+			log.Fatalf("Unrecognized construction %q!", name)
+		}
+
+		if name == "full" {
+			results = append(results, measure(name, "random", nil))
+			continue
+		}
+
+		for _, masks := range strings.Split(*maskList, ",") {
+			opts, ok := maskOptions[masks]
+			if !ok {
+				log.Fatalf("Unrecognized mask option %q!", masks)
+			}
+
+			results = append(results, measure(name, masks, opts))
+		}
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "construction\tmasks\tkeygen\tsize\tencrypt\tthroughput\tallocs/op\tbytes/op")
+
+	for _, res := range results {
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%.3g MB/s\t%v\t%v\n",
+			res.construction, res.masks, res.keygen.Round(10*time.Millisecond), res.size,
+			time.Duration(res.encrypt.NsPerOp()), mbPerSec(res.throughput),
+			res.encrypt.AllocsPerOp(), res.encrypt.AllocedBytesPerOp(),
+		)
+	}
+
+	w.Flush()
+}
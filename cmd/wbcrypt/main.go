@@ -0,0 +1,186 @@
+// Command wbcrypt encrypts or decrypts data with a white-box key, like one written by wbgen. It reads the serialized
+// construction from -key, and the construction's external masks from the JSON sidecar next to it, and runs the data on
+// stdin (or -in) through it in the given mode:
+//
+//	$ wbgen -key 0123456789abcdeffedcba9876543210
+//	$ wbcrypt -key constr.key -mode ctr -iv 000102030405060708090a0b0c0d0e0f < plain.txt > cipher.bin
+//
+// The masks are removed at every call to the construction, so the output is what AES computes with the same key and IV,
+// and can be checked against any other implementation. In ecb mode, -raw skips that: the input is passed to the
+// construction as-is and its output is written as-is, to test a consumer that applies the masks itself.
+//
+// ctr mode works in both directions with an encryption construction. ecb and cbc decrypt only with a decryption
+// construction, and need input that's a multiple of 16 bytes long; no padding is added or removed.
+package main
+
+import (
+	"bytes"
+	"crypto/cipher"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/full"
+	"github.com/OpenWhiteBox/AES/constructions/xiao"
+	"github.com/OpenWhiteBox/AES/modes"
+)
+
+var (
+	keyFile  = flag.String("key", "constr.key", "The serialized construction, binary or hex-encoded.")
+	maskFile = flag.String("masks", "", "The JSON sidecar with the construction's masks. Defaults to -key plus \".json\".")
+
+	mode    = flag.String("mode", "ctr", "The mode of operation: ecb, ctr, or cbc.")
+	decrypt = flag.Bool("decrypt", false, "Decrypt instead of encrypt.")
+	hexIV   = flag.String("iv", "", "The hex-encoded IV (ctr and cbc only).")
+	raw     = flag.Bool("raw", false, "Don't remove the construction's masks (ecb only).")
+
+	in  = flag.String("in", "", "The file to read. Defaults to stdin.")
+	out = flag.String("out", "", "The file to write. Defaults to stdout.")
+)
+
+// sidecar is the JSON written by wbgen next to the construction.
+type sidecar struct {
+	Construction string `json:"construction"`
+	Decrypt      bool   `json:"decrypt"`
+
+	InputMask  []byte `json:"input_mask"`
+	OutputMask []byte `json:"output_mask"`
+}
+
+// load parses the construction and its masks.
+func load() (constr cipher.Block, side sidecar, inputMask, outputMask encoding.BlockAffine, err error) {
+	path := *maskFile
+	if path == "" {
+		path = *keyFile + ".json"
+	}
+
+	sideJSON, err := ioutil.ReadFile(path)
+	if err != nil {
+		return
+	} else if err = json.Unmarshal(sideJSON, &side); err != nil {
+		return
+	}
+
+	if inputMask, err = chow.ParseMask(side.InputMask); err != nil {
+		return
+	} else if outputMask, err = chow.ParseMask(side.OutputMask); err != nil {
+		return
+	}
+
+	serialized, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		return
+	} else if !common.HasHeader(serialized) {
+		if serialized, err = hex.DecodeString(string(bytes.TrimSpace(serialized))); err != nil {
+			return
+		}
+	}
+
+	switch side.Construction {
+	case "chow":
+		constr, err = chow.Parse(serialized)
+	case "xiao":
+		constr, err = xiao.Parse(serialized)
+	case "full":
+		constr, err = full.Parse(serialized)
+	default:
+		err = fmt.Errorf("Unrecognized construction %q!", side.Construction)
+	}
+
+	return
+}
+
+// crypt runs src through the construction in the chosen mode.
+func crypt(constr cipher.Block, side sidecar, inputMask, outputMask encoding.BlockAffine, src []byte) ([]byte, error) {
+	if *raw && *mode != "ecb" {
+		return nil, errors.New("-raw only works in ecb mode!")
+	} else if *mode != "ctr" && *decrypt != side.Decrypt {
+		return nil, errors.New("The construction computes the other direction!")
+	} else if *mode == "ctr" && side.Decrypt {
+		return nil, errors.New("ctr mode needs an encryption construction!")
+	} else if *mode != "ctr" && len(src)%16 != 0 {
+		return nil, errors.New("Input must be a multiple of 16 bytes long!")
+	}
+
+	var b cipher.Block = modes.NewBlock(constr, inputMask, outputMask)
+	if *raw {
+		b = constr
+	}
+
+	var iv []byte
+	if *mode != "ecb" {
+		var err error
+		if iv, err = hex.DecodeString(*hexIV); err != nil {
+			return nil, err
+		} else if len(iv) != 16 {
+			return nil, errors.New("IV must be 128 bits!")
+		}
+	}
+
+	dst := make([]byte, len(src))
+
+	switch *mode {
+	case "ecb":
+		for i := 0; i < len(src); i += 16 {
+			if *decrypt {
+				b.Decrypt(dst[i:], src[i:])
+			} else {
+				b.Encrypt(dst[i:], src[i:])
+			}
+		}
+	case "ctr":
+		modes.NewCTR(b.(modes.Block), iv).XORKeyStream(dst, src)
+	case "cbc":
+		if *decrypt {
+			modes.NewCBCDecrypter(b.(modes.Block), iv).CryptBlocks(dst, src)
+		} else {
+			modes.NewCBCEncrypter(b.(modes.Block), iv).CryptBlocks(dst, src)
+		}
+	default:
+		return nil, fmt.Errorf("Unrecognized mode %q!", *mode)
+	}
+
+	return dst, nil
+}
+
+func main() {
+	flag.Parse()
+
+	constr, side, inputMask, outputMask, err := load()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	var src []byte
+	if *in == "" {
+		src, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		src, err = ioutil.ReadFile(*in)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	dst, err := crypt(constr, side, inputMask, outputMask, src)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if *out == "" {
+		_, err = os.Stdout.Write(dst)
+	} else {
+		err = ioutil.WriteFile(*out, dst, 0644)
+	}
+	if err != nil {
+		log.Fatalln(err)
+	}
+}
@@ -0,0 +1,183 @@
+// Command wbgen generates a white-box key. The serialized construction is written to the file given by -out, and its
+// external masks to a JSON sidecar next to it, named by adding ".json":
+//
+//	$ wbgen -construction chow -key 0123456789abcdeffedcba9876543210 -input-mask random -output-mask identity
+//	$ ls
+//	constr.key  constr.key.json
+//
+// The sidecar has the same fields as a set of test vectors from constructions/vectors--the construction, its direction,
+// and both masks serialized with chow.SerializeMask and base64-encoded--but not the AES key or the seed. Keep it as
+// carefully as the AES key anyway: the construction is only useful with its masks. Unless a seed is given, it's drawn
+// from crypto/rand, and every run gives a different construction. Every construction is checked against crypto/aes
+// before it's written.
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/vectors"
+)
+
+var (
+	construction = flag.String("construction", "chow", "The construction to generate: chow, xiao, or full.")
+	direction    = flag.String("direction", "encrypt", "Whether the construction encrypts or decrypts: encrypt or decrypt.")
+
+	hexKey  = flag.String("key", "", "A hex-encoded 128-, 192-, or 256-bit AES key.")
+	keyFile = flag.String("keyfile", "", "A file holding the AES key, raw or hex-encoded, instead of -key.")
+	hexSeed = flag.String("seed", "", "A hex-encoded seed, for a reproducible construction. Random if not given.")
+
+	inputMask  = flag.String("input-mask", "random", "The input mask: identity, random, or random-affine (chow and xiao only).")
+	outputMask = flag.String("output-mask", "random", "The output mask: identity, random, or random-affine (chow and xiao only).")
+
+	format = flag.String("format", "binary", "How to write the construction: binary or hex.")
+	out    = flag.String("out", "constr.key", "Where to write the construction. The masks go to the same path plus \".json\".")
+)
+
+var (
+	constructions = map[string]common.ConstructionType{
+		"chow": common.ChowConstruction,
+		"xiao": common.XiaoConstruction,
+		"full": common.FullConstruction,
+	}
+
+	masks = map[string]common.MaskType{
+		"identity":      common.IdentityMask,
+		"random":        common.RandomMask,
+		"random-affine": common.RandomAffineMask,
+	}
+)
+
+// sidecar is the JSON written next to the construction.
+type sidecar struct {
+	Construction string `json:"construction"`
+	Decrypt      bool   `json:"decrypt"`
+
+	InputMask  []byte `json:"input_mask"`
+	OutputMask []byte `json:"output_mask"`
+}
+
+// readKey returns the AES key given by -key or -keyfile.
+func readKey() ([]byte, error) {
+	if (*hexKey == "") == (*keyFile == "") {
+		return nil, errors.New("Exactly one of -key and -keyfile must be given!")
+	} else if *hexKey != "" {
+		return hex.DecodeString(*hexKey)
+	}
+
+	raw, err := ioutil.ReadFile(*keyFile)
+	if err != nil {
+		return nil, err
+	} else if key, err := hex.DecodeString(string(bytes.TrimSpace(raw))); err == nil {
+		return key, nil
+	}
+
+	return raw, nil
+}
+
+// readSeed returns the seed given by -seed, or a random one.
+func readSeed() ([]byte, error) {
+	if *hexSeed != "" {
+		return hex.DecodeString(*hexSeed)
+	}
+
+	seed := make([]byte, 16)
+	_, err := rand.Read(seed)
+
+	return seed, err
+}
+
+// options returns the key generation options for the construction, from -input-mask and -output-mask.
+func options(typ common.ConstructionType) (common.KeyGenerationOpts, error) {
+	input, ok := masks[*inputMask]
+	if !ok {
+		return nil, fmt.Errorf("Unrecognized input mask %q!", *inputMask)
+	}
+	output, ok := masks[*outputMask]
+	if !ok {
+		return nil, fmt.Errorf("Unrecognized output mask %q!", *outputMask)
+	}
+
+	if typ == common.FullConstruction {
+		if input != common.RandomMask || output != common.RandomMask {
+			return nil, errors.New("The full construction's masks are always random!")
+		}
+
+		return nil, nil
+	}
+
+	return common.IndependentMasks{input, output}, nil
+}
+
+// generate generates the construction and checks it against crypto/aes. Key generation panics on options the
+// construction doesn't support, which is turned into an error.
+func generate(typ common.ConstructionType, decrypt bool, key, seed []byte, opts common.KeyGenerationOpts) (kv vectors.KeyVectors, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Key generation failed! %v", r)
+		}
+	}()
+
+	return vectors.Generate(typ, decrypt, key, seed, opts, 1)
+}
+
+func main() {
+	flag.Parse()
+
+	typ, ok := constructions[*construction]
+	if !ok {
+		log.Fatalf("Unrecognized construction %q!", *construction)
+	} else if *direction != "encrypt" && *direction != "decrypt" {
+		log.Fatalf("Unrecognized direction %q!", *direction)
+	} else if *format != "binary" && *format != "hex" {
+		log.Fatalf("Unrecognized format %q!", *format)
+	}
+
+	key, err := readKey()
+	if err != nil {
+		log.Fatalln(err)
+	} else if len(key) != 16 && len(key) != 24 && len(key) != 32 {
+		log.Fatalln("Key must be 128, 192, or 256 bits.")
+	} else if typ == common.FullConstruction && len(key) != 16 {
+		log.Fatalln("The full construction only supports 128-bit keys.")
+	}
+
+	seed, err := readSeed()
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	opts, err := options(typ)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	kv, err := generate(typ, *direction == "decrypt", key, seed, opts)
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	serialized := kv.Serialized
+	if *format == "hex" {
+		serialized = []byte(hex.EncodeToString(serialized) + "\n")
+	}
+
+	side, err := json.MarshalIndent(sidecar{kv.Construction, kv.Decrypt, kv.InputMask, kv.OutputMask}, "", "  ")
+	if err != nil {
+		log.Fatalln(err)
+	}
+
+	if err := ioutil.WriteFile(*out, serialized, 0600); err != nil {
+		log.Fatalln(err)
+	} else if err := ioutil.WriteFile(*out+".json", append(side, '\n'), 0600); err != nil {
+		log.Fatalln(err)
+	}
+}
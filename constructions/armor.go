@@ -0,0 +1,160 @@
+package constructions
+
+import (
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// The types of the PEM blocks written by ArmorKey and ArmorEncodings.
+const (
+	KeyBlock      = "WHITEBOX AES KEY"
+	EncodingBlock = "WHITEBOX AES ENCODING"
+)
+
+// ArmorKey PEM-encodes a serialized key, so that it survives being copied and pasted, emailed, or kept in a text-based
+// config system:
+//
+//	-----BEGIN WHITEBOX AES KEY-----
+//	Construction: chow
+//	Rounds: 10
+//	Version: 2
+//
+//	T1dCWAIBCgAAAAAAAAAAAAA...
+//	-----END WHITEBOX AES KEY-----
+//
+// The headers repeat what the key's own header says--the construction, its number of rounds, the format version, and
+// the metadata and integrity MAC if it has them--so that a reader can tell keys apart without parsing them. extra adds
+// headers of the caller's choosing, like the options the key was generated with. Only keys with a versioned header can
+// be armored.
+func ArmorKey(key []byte, extra map[string]string) ([]byte, error) {
+	if !common.HasHeader(key) {
+		return nil, errors.New("Key doesn't have a valid header!")
+	}
+
+	h, _, err := common.ParseHeader(key, common.PeekType(key))
+	if err != nil {
+		return nil, err
+	}
+
+	headers := make(map[string]string)
+	for name, value := range extra {
+		headers[name] = value
+	}
+
+	headers["Construction"] = h.Type.String()
+	headers["Rounds"] = strconv.Itoa(int(h.Rounds))
+	headers["Version"] = strconv.Itoa(int(h.Version))
+
+	if h.MAC {
+		headers["Integrity"] = "HMAC-SHA256"
+	}
+	if len(h.KeyID) > 0 {
+		headers["Key-ID"] = hex.EncodeToString(h.KeyID)
+	}
+	if !h.Created.IsZero() {
+		headers["Created"] = h.Created.Format(time.RFC3339)
+	}
+
+	out := pem.EncodeToMemory(&pem.Block{Type: KeyBlock, Headers: headers, Bytes: key})
+	if out == nil {
+		return nil, errors.New("Header names can't contain a colon!")
+	}
+
+	return out, nil
+}
+
+// DearmorKey decodes the first key armored by ArmorKey in in, skipping any other PEM blocks before it, and returns the
+// serialized key, the block's headers, and the rest of in. An error is returned if there's no key, or the headers
+// disagree with the key about its construction or number of rounds.
+func DearmorKey(in []byte) (key []byte, headers map[string]string, rest []byte, err error) {
+	block, rest := nextBlock(in, KeyBlock)
+	if block == nil {
+		return nil, nil, in, errors.New("No armored key found!")
+	} else if !common.HasHeader(block.Bytes) {
+		return nil, nil, in, errors.New("Key doesn't have a valid header!")
+	}
+
+	h, _, err := common.ParseHeader(block.Bytes, common.PeekType(block.Bytes))
+	if err != nil {
+		return nil, nil, in, err
+	} else if block.Headers["Construction"] != h.Type.String() || block.Headers["Rounds"] != strconv.Itoa(int(h.Rounds)) {
+		return nil, nil, in, errors.New("Armor headers disagree with the key!")
+	}
+
+	return block.Bytes, block.Headers, rest, nil
+}
+
+// ArmorEncodings PEM-encodes the external encodings of a construction, serialized with chow.SerializeMask, as two
+// blocks with an "Encoding" header of "input" or "output". extra adds headers of the caller's choosing to both, like
+// the ID of the key they go with. The encodings are as secret as the AES key, so they shouldn't be kept with the key.
+func ArmorEncodings(input, output encoding.BlockAffine, extra map[string]string) []byte {
+	var out []byte
+
+	for _, side := range []struct {
+		name string
+		mask encoding.BlockAffine
+	}{{"input", input}, {"output", output}} {
+		headers := map[string]string{"Encoding": side.name}
+		for name, value := range extra {
+			if name != "Encoding" {
+				headers[name] = value
+			}
+		}
+
+		out = append(out, pem.EncodeToMemory(&pem.Block{
+			Type: EncodingBlock, Headers: headers, Bytes: chow.SerializeMask(side.mask),
+		})...)
+	}
+
+	return out
+}
+
+// DearmorEncodings decodes encodings armored by ArmorEncodings from in, skipping any other PEM blocks, and returns the
+// input and output encodings and the rest of in, after the second of them. An error is returned if either is missing
+// or doesn't parse.
+func DearmorEncodings(in []byte) (input, output encoding.BlockAffine, rest []byte, err error) {
+	found, rest := make(map[string]encoding.BlockAffine), in
+
+	for len(found) < 2 {
+		var block *pem.Block
+		if block, rest = nextBlock(rest, EncodingBlock); block == nil {
+			return input, output, in, errors.New("Armored encodings are missing!")
+		}
+
+		side := block.Headers["Encoding"]
+		if side != "input" && side != "output" {
+			return input, output, in, fmt.Errorf("Unknown encoding %q!", side)
+		} else if _, ok := found[side]; ok {
+			return input, output, in, fmt.Errorf("Encoding %q is armored twice!", side)
+		}
+
+		if found[side], err = chow.ParseMask(block.Bytes); err != nil {
+			return input, output, in, err
+		}
+	}
+
+	return found["input"], found["output"], rest, nil
+}
+
+// nextBlock returns the next PEM block of the given type in in, and the rest of in after it, or nil if there isn't one.
+func nextBlock(in []byte, typ string) (*pem.Block, []byte) {
+	for {
+		block, rest := pem.Decode(in)
+		if block == nil {
+			return nil, in
+		} else if block.Type == typ {
+			return block, rest
+		}
+
+		in = rest
+	}
+}
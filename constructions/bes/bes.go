@@ -12,6 +12,9 @@
 package bes
 
 import (
+	"crypto/cipher"
+	"errors"
+
 	"github.com/OpenWhiteBox/primitives/gfmatrix"
 	"github.com/OpenWhiteBox/primitives/number"
 )
@@ -19,11 +22,32 @@ import (
 // Powers of x mod M(x).
 var powx = [16]byte{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x1b, 0x36, 0x6c, 0xd8, 0xab, 0x4d, 0x9a, 0x2f}
 
+// Construction is the BES block cipher, on 128-byte blocks. Each byte of a block is an element of GF(2^8). AES is BES
+// restricted to blocks and keys in the image of Expand, but Construction accepts any block and any key, so it can be
+// studied as a cipher of its own. It implements cipher.Block.
 type Construction struct {
 	// A 128-byte BES key.
 	Key gfmatrix.Row
 }
 
+// NewCipher returns the BES cipher with the given key. The key is either a 128-byte BES key, or a 16-byte AES key,
+// which is embedded with Expand.
+func NewCipher(key []byte) (cipher.Block, error) {
+	switch len(key) {
+	case 16:
+		return Construction{Key: Expand(key)}, nil
+	case 128:
+		out := gfmatrix.NewRow(128)
+		for pos, v := range key {
+			out[pos] = number.ByteFieldElem(v)
+		}
+
+		return Construction{Key: out}, nil
+	default:
+		return nil, errors.New("Invalid key size!")
+	}
+}
+
 // BlockSize returns the block size of BES. (Necessary to implement cipher.Block.)
 func (constr Construction) BlockSize() int { return 128 }
 
@@ -56,39 +80,53 @@ func (constr Construction) Decrypt(dst, src []byte) {
 }
 
 func (constr *Construction) encrypt(in gfmatrix.Row) gfmatrix.Row {
+	return constr.EncryptRounds(in)[10]
+}
+
+func (constr *Construction) decrypt(in gfmatrix.Row) gfmatrix.Row {
+	return constr.DecryptRounds(in)[10]
+}
+
+// EncryptRounds encrypts a BES state and returns the state after each round: out[0] is the state after the initial
+// AddRoundKey, out[i] is the state after round i, and out[10] is the ciphertext. If the input is Expand of an AES
+// block, every state is Expand of the corresponding AES state.
+func (constr *Construction) EncryptRounds(in gfmatrix.Row) (out [11]gfmatrix.Row) {
 	roundKeys := constr.StretchedKey()
 
-	state := in.Add(roundKeys[0])
+	out[0] = in.Add(roundKeys[0])
 
-	for i := 1; i <= 9; i++ {
-		state = constr.subBytes(state)
-		state = round.Mul(state)
-		state = state.Add(roundConst).Add(roundKeys[i])
-	}
+	for i := 1; i <= 10; i++ {
+		linear := round
+		if i == 10 {
+			linear = lastRound
+		}
 
-	state = constr.subBytes(state)
-	state = lastRound.Mul(state)
-	state = state.Add(roundConst).Add(roundKeys[10])
+		state := constr.subBytes(out[i-1])
+		out[i] = linear.Mul(state).Add(roundConst).Add(roundKeys[i])
+	}
 
-	return state
+	return
 }
 
-func (constr *Construction) decrypt(in gfmatrix.Row) gfmatrix.Row {
+// DecryptRounds decrypts a BES state and returns the state after each round of decryption. Decryption undoes the
+// rounds of encryption in reverse, so out[i] is the state EncryptRounds gives after round 9-i, and out[10] is the
+// plaintext.
+func (constr *Construction) DecryptRounds(in gfmatrix.Row) (out [11]gfmatrix.Row) {
 	roundKeys := constr.StretchedKey()
 
 	state := in.Add(roundConst).Add(roundKeys[10])
 	state = firstRound.Mul(state)
-	state = constr.subBytes(state)
+	out[0] = constr.subBytes(state)
 
 	for i := 9; i >= 1; i-- {
-		state = state.Add(roundConst).Add(roundKeys[i])
+		state = out[9-i].Add(roundConst).Add(roundKeys[i])
 		state = unRound.Mul(state)
-		state = constr.subBytes(state)
+		out[10-i] = constr.subBytes(state)
 	}
 
-	state = state.Add(roundKeys[0])
+	out[10] = out[9].Add(roundKeys[0])
 
-	return state
+	return
 }
 
 // StretchedKey implements BES' key schedule. It returns the 11 round keys derived from the master key.
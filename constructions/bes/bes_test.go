@@ -101,3 +101,111 @@ func TestDecrypt(t *testing.T) {
 		t.Fatal("BES Decrypt didn't agree with AES Decrypt!")
 	}
 }
+
+func TestRounds(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr1 := saes.Construction{Key: key}
+	constr2 := Construction{Key: Expand(key)}
+
+	in := make([]byte, 16)
+	rand.Read(in)
+
+	encStates := constr2.EncryptRounds(Expand(in))
+
+	// Step through AES by hand, comparing against the BES state after every round.
+	roundKeys, real := constr1.StretchedKey(), append([]byte{}, in...)
+	constr1.AddRoundKey(roundKeys[0], real)
+
+	for i := 0; i <= 10; i++ {
+		if i > 0 {
+			constr1.SubBytes(real)
+			constr1.ShiftRows(real)
+			if i < 10 {
+				constr1.MixColumns(real)
+			}
+			constr1.AddRoundKey(roundKeys[i], real)
+		}
+
+		if !IsEmbedded(encStates[i]) {
+			t.Fatalf("BES state after round %v isn't embedded!", i)
+		} else if !bytes.Equal(Contract(encStates[i]), real) {
+			t.Fatalf("BES state disagrees with AES state after round %v! %x != %x", i, Contract(encStates[i]), real)
+		}
+	}
+
+	decStates := constr2.DecryptRounds(encStates[10])
+
+	for i := 0; i < 10; i++ {
+		if !decStates[i].Equals(encStates[9-i]) {
+			t.Fatalf("Decryption state %v disagrees with encryption state %v!", i, 9-i)
+		}
+	}
+
+	if !bytes.Equal(Contract(decStates[10]), in) {
+		t.Fatalf("BES DecryptRounds didn't recover the plaintext! %x != %x", Contract(decStates[10]), in)
+	}
+
+	notEmbedded := Expand(in)
+	notEmbedded[1] ^= 1
+
+	if IsEmbedded(notEmbedded) {
+		t.Fatal("IsEmbedded accepted a state that isn't embedded!")
+	}
+}
+
+// rowBytes returns the bytes of a BES state, as Encrypt and Decrypt take them.
+func rowBytes(in gfmatrix.Row) []byte {
+	out := make([]byte, len(in))
+	for pos, v := range in {
+		out[pos] = byte(v)
+	}
+
+	return out
+}
+
+func TestCipher(t *testing.T) {
+	key, in := make([]byte, 16), make([]byte, 16)
+	rand.Read(key)
+	rand.Read(in)
+
+	real := make([]byte, 16)
+	saes.Construction{Key: key}.Encrypt(real, in)
+
+	block, err := NewCipher(key)
+	if err != nil {
+		t.Fatal(err)
+	} else if block.BlockSize() != 128 {
+		t.Fatalf("BES has the wrong block size! %v != 128", block.BlockSize())
+	}
+
+	// On embedded blocks, BES is AES.
+	cand := make([]byte, 128)
+	block.Encrypt(cand, rowBytes(Expand(in)))
+
+	if !bytes.Equal(cand, rowBytes(Expand(real))) {
+		t.Fatalf("BES Encrypt didn't agree with AES Encrypt! %x != %x", cand, rowBytes(Expand(real)))
+	}
+
+	// On any other block, Decrypt still inverts Encrypt, with a BES key that isn't embedded either.
+	besKey, arbitrary := make([]byte, 128), make([]byte, 128)
+	rand.Read(besKey)
+	rand.Read(arbitrary)
+
+	block, err = NewCipher(besKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block.Encrypt(cand, arbitrary)
+	block.Decrypt(cand, cand)
+
+	if !bytes.Equal(cand, arbitrary) {
+		t.Fatalf("BES Decrypt didn't invert Encrypt! %x != %x", cand, arbitrary)
+	}
+
+	if _, err := NewCipher(make([]byte, 24)); err == nil {
+		t.Fatal("NewCipher accepted a key of the wrong size!")
+	}
+}
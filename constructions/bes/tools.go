@@ -31,3 +31,9 @@ func Contract(in gfmatrix.Row) []byte {
 
 	return out
 }
+
+// IsEmbedded returns true if a BES state is the image of an AES state under Expand, meaning that Contract doesn't lose
+// any information. BES maps embedded states to embedded states with embedded keys, and only those correspond to AES.
+func IsEmbedded(in gfmatrix.Row) bool {
+	return len(in)%8 == 0 && Expand(Contract(in)).Equals(in)
+}
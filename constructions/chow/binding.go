@@ -0,0 +1,114 @@
+package chow
+
+import (
+	"crypto/sha256"
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/random"
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// DeviceBinding ties a construction to one device (see Opts). The caller sets Fingerprint, and key generation writes the
+// Activation that goes with it.
+type DeviceBinding struct {
+	Fingerprint []byte     // Any identifier of the device that it can compute for itself, like a hash of its hardware IDs.
+	Activation  Activation // The table the device needs to evaluate the construction. Written by key generation.
+}
+
+// Activation is delivered to a device separately from its key, which only evaluates correctly once activated with both
+// the activation and the device's fingerprint (see Construction.Activate). It's one byte bijection for each byte of the
+// state, 4KB in all.
+type Activation [16][256]byte
+
+// Serialize returns the activation as 4096 bytes.
+func (a *Activation) Serialize() []byte {
+	out := make([]byte, 0, 16*256)
+	for pos := range a {
+		out = append(out, a[pos][:]...)
+	}
+
+	return out
+}
+
+// errBound is returned by the exporters for activated constructions. Their output has nowhere to put Binding, so it
+// would compute garbage.
+var errBound = errors.New("Construction is activated, and its binding can't be exported!")
+
+// ParseActivation parses an activation serialized with Serialize.
+func ParseActivation(in []byte) (a Activation, err error) {
+	if len(in) != 16*256 {
+		return a, errors.New("Activation is the wrong size!")
+	}
+
+	for pos := range a {
+		copy(a[pos][:], in[256*pos:])
+	}
+
+	return a, nil
+}
+
+// deviceKey is the mask a device's fingerprint puts on each byte of the state before it goes through the activation.
+func deviceKey(fingerprint []byte) (out [16]byte) {
+	h := sha256.Sum256(fingerprint)
+	copy(out[:], h[:])
+
+	return
+}
+
+// bindDevice generates the byte bijections that bind a construction to a device, mixing a secret from rs with the
+// device's fingerprint, and composes the inverse of each onto the input of the T-Boxes of the first round. The device's
+// activation is the bijections after its fingerprint's mask.
+func bindDevice(rs *random.Source, out *Construction, device *DeviceBinding) {
+	secret := make([]byte, 16)
+	rs.Stream(common.Label("DB")).Read(secret)
+
+	bs := random.NewSource("Chow Device Binding", append(secret, device.Fingerprint...))
+	mask := deviceKey(device.Fingerprint)
+
+	for pos := 0; pos < 16; pos++ {
+		perm := bytePermutation(&bs, pos)
+
+		var inv table.ParsedByte = make([]byte, 256)
+		for x := 0; x < 256; x++ {
+			inv[perm[x]] = byte(x)
+			device.Activation[pos][x] = perm[byte(x)^mask[pos]]
+		}
+
+		out.TBoxTyiTable[0][pos] = table.ComposedToWord{inv, out.TBoxTyiTable[0][pos]}
+	}
+}
+
+// bytePermutation returns a random permutation of the bytes, with a Fisher-Yates shuffle of the stream labeled by pos.
+func bytePermutation(rs *random.Source, pos int) (out [256]byte) {
+	for i := range out {
+		out[i] = byte(i)
+	}
+
+	stream, buff := rs.Stream(common.Label("DP", pos)), make([]byte, 2)
+	for i := 255; i > 0; i-- {
+		stream.Read(buff)
+		j := (int(buff[0]) | int(buff[1])<<8) % (i + 1)
+		out[i], out[j] = out[j], out[i]
+	}
+
+	return
+}
+
+// Activate readies a construction generated with Opts.Device for use on the device with the given fingerprint, given
+// the activation key generation wrote for it. With the wrong activation or fingerprint, the construction still runs,
+// but computes garbage.
+//
+// The activation, with the fingerprint folded in, is kept in Binding. It isn't serialized, so a bound key has to be
+// activated again every time it's parsed. An activated construction can't be rerandomized or exported.
+func (constr *Construction) Activate(activation *Activation, fingerprint []byte) {
+	mask := deviceKey(fingerprint)
+
+	constr.Binding = new([16][256]byte)
+	for pos := 0; pos < 16; pos++ {
+		for x := 0; x < 256; x++ {
+			constr.Binding[pos][x] = activation[pos][byte(x)^mask[pos]]
+		}
+	}
+}
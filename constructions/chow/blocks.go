@@ -0,0 +1,64 @@
+package chow
+
+import (
+	"runtime"
+	"sync"
+)
+
+// minBlocksPerWorker is the smallest batch worth handing to its own goroutine. Below this, the cost of scheduling
+// outweighs the ~50µs it takes to push a block through the tables.
+const minBlocksPerWorker = 16
+
+// EncryptBlocks encrypts every block in src into dst. The length of src must be a multiple of the block size and dst
+// must be at least as long as src. Dst and src may point at the same memory. Large batches are split across up to
+// GOMAXPROCS goroutines.
+func (constr Construction) EncryptBlocks(dst, src []byte) {
+	constr.cryptBlocks(dst, src, constr.shiftRows)
+}
+
+// DecryptBlocks decrypts every block in src into dst, with the same requirements as EncryptBlocks.
+func (constr Construction) DecryptBlocks(dst, src []byte) {
+	constr.cryptBlocks(dst, src, constr.unShiftRows)
+}
+
+// cryptBlocks splits src into contiguous runs of blocks and calls crypt on each block, with one goroutine per run.
+func (constr *Construction) cryptBlocks(dst, src []byte, shift func([]byte)) {
+	bs := constr.BlockSize()
+	if len(src)%bs != 0 {
+		panic("Input not full blocks!")
+	} else if len(dst) < len(src) {
+		panic("Output smaller than input!")
+	}
+
+	blocks := len(src) / bs
+
+	workers := runtime.GOMAXPROCS(0)
+	if max := blocks / minBlocksPerWorker; max < workers {
+		workers = max
+	}
+
+	if workers <= 1 {
+		for i := 0; i < len(src); i += bs {
+			constr.crypt(dst[i:i+bs], src[i:i+bs], shift)
+		}
+
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		lo, hi := bs*(w*blocks/workers), bs*((w+1)*blocks/workers)
+
+		go func(lo, hi int) {
+			defer wg.Done()
+
+			for i := lo; i < hi; i += bs {
+				constr.crypt(dst[i:i+bs], src[i:i+bs], shift)
+			}
+		}(lo, hi)
+	}
+
+	wg.Wait()
+}
@@ -13,60 +13,135 @@ import (
 	"github.com/OpenWhiteBox/AES/constructions/common"
 )
 
+// Construction is a white-boxed AES key. The middle tables have one entry for every round of AES but the last, so
+// there are 9 for AES-128, 11 for AES-192, and 13 for AES-256, plus one for every dummy round (see Opts).
+//
+// A Construction may be used from any number of goroutines at once: Encrypt, Decrypt, EncryptBlocks, and DecryptBlocks
+// only read the tables and keep their scratch space on the stack, so no locking is needed. Methods that replace or wipe
+// tables, like Precompute and Destroy, must not run concurrently with anything else.
 type Construction struct {
 	InputMask      [16]table.Block // [round]
 	InputXORTables common.NibbleXORTables
 
-	TBoxTyiTable [9][16]table.Word      // [round][position]
-	HighXORTable [9][32][3]table.Nibble // [round][nibble-wise position][gate number]
+	TBoxTyiTable [][16]table.Word      // [round][position]
+	HighXORTable [][32][3]table.Nibble // [round][nibble-wise position][gate number]
+
+	MBInverseTable [][16]table.Word      // [round][position]
+	LowXORTable    [][32][3]table.Nibble // [round][nibble-wise position][gate number]
+
+	// HighWideXORTable and LowWideXORTable are nil unless WidenXORTables has been called. They're computed from
+	// HighXORTable and LowXORTable, and aren't serialized.
+	HighWideXORTable [][16][3]table.DoubleToByte // [round][byte-wise position][gate number]
+	LowWideXORTable  [][16][3]table.DoubleToByte // [round][byte-wise position][gate number]
 
-	MBInverseTable [9][16]table.Word      // [round][position]
-	LowXORTable    [9][32][3]table.Nibble // [round][nibble-wise position][gate number]
+	// unpacked is nil unless UnpackXORTables has been called.
+	unpacked *unpackedXORTables
 
 	TBoxOutputMask  [16]table.Block // [position]
 	OutputXORTables common.NibbleXORTables
+
+	// Binding is nil unless Activate has been called, for constructions bound to a device. Encrypt and Decrypt pass each
+	// byte of the state through it before the first round. It isn't serialized.
+	Binding *[16][256]byte
+
+	// RoundOrder is nil if the middle tables are stored in the order of the rounds they compute. Otherwise, the tables of
+	// each round are stored at index RoundOrder[round] (see Opts).
+	RoundOrder []int
+
+	// KeyLength is the length in bytes of the AES key the construction computes, or 0 if it isn't known. Key generation
+	// sets it and it's recorded in the header, because with dummy rounds, it can't always be read off the number of
+	// rounds. See KeySize.
+	KeyLength int
+
+	// Metadata is saved in the header of the serialized construction. Key generation leaves it empty, so that
+	// constructions stay a deterministic function of the key and seed; set it before serializing.
+	Metadata common.Metadata
 }
 
 // BlockSize returns the block size of AES. (Necessary to implement cipher.Block.)
 func (constr Construction) BlockSize() int { return 16 }
 
+// Rounds returns the number of rounds of AES this construction computes--10, 12, or 14--plus its number of dummy rounds.
+func (constr Construction) Rounds() int { return len(constr.TBoxTyiTable) + 1 }
+
 // Encrypt encrypts the first block in src into dst. Dst and src may point at the same memory.
 func (constr Construction) Encrypt(dst, src []byte) {
 	constr.crypt(dst, src, constr.shiftRows)
 }
 
 // Decrypt decrypts the first block in src into dst. Dst and src may point at the same memory.
+//
+// Neither Encrypt nor Decrypt allocate when the construction's tables are parsed from a serialized key, eagerly or with
+// ParseReaderAt; all scratch space lives on the stack (or, for lazy tables, in a pool), which is what makes a single
+// Construction safe to share between goroutines.
 func (constr Construction) Decrypt(dst, src []byte) {
 	constr.crypt(dst, src, constr.unShiftRows)
 }
 
 // crypt pushes the first block in src through the lookup tables (which may compute encryption or decryption) and writes
 // the result to dst. shift is the permutation to apply to the state matrix before each round.
-func (constr Construction) crypt(dst, src []byte, shift func([]byte)) {
+func (constr *Construction) crypt(dst, src []byte, shift func([]byte)) {
+	var stretched [16][16]byte
+	constr.cryptWith(&stretched, dst, src, shift)
+}
+
+// cryptWith is crypt, with the scratch space to expand blocks into given by the caller.
+func (constr *Construction) cryptWith(stretched *[16][16]byte, dst, src []byte, shift func([]byte)) {
 	copy(dst, src[:constr.BlockSize()])
 
 	// Remove input encoding.
-	stretched := constr.expandBlock(constr.InputMask, dst)
-	constr.InputXORTables.SquashBlocks(stretched, dst)
+	u := constr.unpacked
+
+	constr.expandBlock(stretched, constr.InputMask, dst)
+	if u != nil {
+		squashBlock(&u.input, stretched, dst)
+	} else {
+		constr.InputXORTables.SquashBlocks(*stretched, dst)
+	}
 
-	for round := 0; round < 9; round++ {
+	wide := constr.HighWideXORTable != nil
+
+	for round := 0; round < len(constr.TBoxTyiTable); round++ {
+		slot := constr.Slot(round)
 		shift(dst)
 
+		if round == 0 && constr.Binding != nil {
+			for pos := 0; pos < 16; pos++ {
+				dst[pos] = constr.Binding[pos][dst[pos]]
+			}
+		}
+
 		// Apply the T-Boxes and Tyi Tables to each column of the state matrix.
 		for pos := 0; pos < 16; pos += 4 {
-			stretched := constr.ExpandWord(constr.TBoxTyiTable[round][pos:pos+4], dst[pos:pos+4])
-			constr.SquashWords(constr.HighXORTable[round][2*pos:2*pos+8], stretched, dst[pos:pos+4])
-
-			stretched = constr.ExpandWord(constr.MBInverseTable[round][pos:pos+4], dst[pos:pos+4])
-			constr.SquashWords(constr.LowXORTable[round][2*pos:2*pos+8], stretched, dst[pos:pos+4])
+			word := constr.ExpandWord(constr.TBoxTyiTable[slot][pos:pos+4], dst[pos:pos+4])
+			if wide {
+				constr.SquashWordsWide(constr.HighWideXORTable[slot][pos:pos+4], word, dst[pos:pos+4])
+			} else if u != nil {
+				squashWord(&u.high[slot], pos, word, dst[pos:pos+4])
+			} else {
+				constr.SquashWords(constr.HighXORTable[slot][2*pos:2*pos+8], word, dst[pos:pos+4])
+			}
+
+			word = constr.ExpandWord(constr.MBInverseTable[slot][pos:pos+4], dst[pos:pos+4])
+			if wide {
+				constr.SquashWordsWide(constr.LowWideXORTable[slot][pos:pos+4], word, dst[pos:pos+4])
+			} else if u != nil {
+				squashWord(&u.low[slot], pos, word, dst[pos:pos+4])
+			} else {
+				constr.SquashWords(constr.LowXORTable[slot][2*pos:2*pos+8], word, dst[pos:pos+4])
+			}
 		}
 	}
 
 	shift(dst)
 
 	// Apply the final T-Box transformation and add the output encoding.
-	stretched = constr.expandBlock(constr.TBoxOutputMask, dst)
-	constr.OutputXORTables.SquashBlocks(stretched, dst)
+	constr.expandBlock(stretched, constr.TBoxOutputMask, dst)
+	if u != nil {
+		squashBlock(&u.output, stretched, dst)
+	} else {
+		constr.OutputXORTables.SquashBlocks(*stretched, dst)
+	}
 }
 
 // shiftRows permutes the bytes of the first block of block, according to AES' ShiftRows operation.
@@ -105,11 +180,9 @@ func (constr *Construction) SquashWords(xorTable [][3]table.Nibble, words [4][4]
 	}
 }
 
-// ExpandBlock expands the entire state matrix into sixteen blocks.
-func (constr *Construction) expandBlock(mask [16]table.Block, block []byte) (out [16][16]byte) {
+// expandBlock expands the entire state matrix into sixteen blocks, written into out.
+func (constr *Construction) expandBlock(out *[16][16]byte, mask [16]table.Block, block []byte) {
 	for i := 0; i < 16; i++ {
 		out[i] = mask[i].Get(block[i])
 	}
-
-	return
 }
@@ -2,12 +2,27 @@ package chow
 
 import (
 	"bytes"
+	"context"
 	"crypto/aes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
-	"github.com/OpenWhiteBox/primitives/matrix"
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/random"
+	"github.com/OpenWhiteBox/primitives/table"
 
 	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/saes"
 
 	test_vectors "github.com/OpenWhiteBox/AES/constructions/test"
 )
@@ -52,16 +67,14 @@ func TestMaskedEncrypt(t *testing.T) {
 	// Calculate the candidate output.
 	constr, inputMask, outputMask := GenerateEncryptionKeys(key, seed, common.MatchingMasks{})
 
-	inputInv, _ := inputMask.Invert()
-	outputInv, _ := outputMask.Invert()
-
 	in := make([]byte, 16)
-	copy(in, inputInv.Mul(matrix.Row(input))) // Apply input encoding.
+	copy(in, input)
+	MaskInput(inputMask, in) // Apply input encoding.
 
 	constr.Encrypt(cand, in)
 	constr.Encrypt(cand, cand)
 
-	copy(cand, outputInv.Mul(matrix.Row(cand))) // Remove output encoding.
+	UnmaskOutput(outputMask, cand) // Remove output encoding.
 
 	// Calculate the real output.
 	c, _ := aes.NewCipher(key)
@@ -79,16 +92,14 @@ func TestEncrypt(t *testing.T) {
 			vec.Key, vec.Key, common.IndependentMasks{common.RandomMask, common.RandomMask},
 		)
 
-		inputInv, _ := inputMask.Invert()
-		outputInv, _ := outputMask.Invert()
-
 		in, out := make([]byte, 16), make([]byte, 16)
 
-		copy(in, inputInv.Mul(matrix.Row(vec.In))) // Apply input encoding.
+		copy(in, vec.In)
+		MaskInput(inputMask, in) // Apply input encoding.
 
 		constr.Encrypt(out, in)
 
-		copy(out, outputInv.Mul(matrix.Row(out))) // Remove output encoding.
+		UnmaskOutput(outputMask, out) // Remove output encoding.
 
 		if !bytes.Equal(vec.Out, out) {
 			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.Out, out)
@@ -102,16 +113,14 @@ func TestDecrypt(t *testing.T) {
 			vec.Key, vec.Key, common.IndependentMasks{common.RandomMask, common.RandomMask},
 		)
 
-		inputInv, _ := inputMask.Invert()
-		outputInv, _ := outputMask.Invert()
-
 		in, out := make([]byte, 16), make([]byte, 16)
 
-		copy(in, inputInv.Mul(matrix.Row(vec.Out))) // Apply input encoding.
+		copy(in, vec.Out)
+		MaskInput(inputMask, in) // Apply input encoding.
 
 		constr.Decrypt(out, in)
 
-		copy(out, outputInv.Mul(matrix.Row(out))) // Remove output encoding.
+		UnmaskOutput(outputMask, out) // Remove output encoding.
 
 		if !bytes.Equal(vec.In, out) {
 			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.In, out)
@@ -119,59 +128,2108 @@ func TestDecrypt(t *testing.T) {
 	}
 }
 
-func TestPersistence(t *testing.T) {
-	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+func TestEncrypt192(t *testing.T) {
+	key192 := append(append([]byte{}, key...), seed[:8]...)
+
+	constr, inputMask, outputMask := GenerateEncryptionKeys(
+		key192, seed, common.IndependentMasks{common.RandomMask, common.RandomMask},
+	)
+
+	if constr.Rounds() != 12 {
+		t.Fatalf("AES-192 construction has wrong number of rounds! %v != 12", constr.Rounds())
+	}
+
+	cand, real := make([]byte, 16), make([]byte, 16)
+
+	copy(cand, input)
+	MaskInput(inputMask, cand) // Apply input encoding.
+	constr.Encrypt(cand, cand)
+	UnmaskOutput(outputMask, cand) // Remove output encoding.
+
+	c, _ := aes.NewCipher(key192)
+	c.Encrypt(real, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestEncrypt256(t *testing.T) {
+	key256 := append(append([]byte{}, key...), seed...)
+
+	constr, inputMask, outputMask := GenerateEncryptionKeys(
+		key256, seed, common.IndependentMasks{common.RandomMask, common.RandomMask},
+	)
+
+	cand, real := make([]byte, 16), make([]byte, 16)
+
+	copy(cand, input)
+	MaskInput(inputMask, cand) // Apply input encoding.
+	constr.Encrypt(cand, cand)
+	UnmaskOutput(outputMask, cand) // Remove output encoding.
+
+	c, _ := aes.NewCipher(key256)
+	c.Encrypt(real, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestDecrypt256(t *testing.T) {
+	key256 := append(append([]byte{}, key...), seed...)
+
+	constr, inputMask, outputMask := GenerateDecryptionKeys(
+		key256, seed, common.IndependentMasks{common.RandomMask, common.RandomMask},
+	)
+
+	cand, real := make([]byte, 16), make([]byte, 16)
+
+	copy(cand, input)
+	MaskInput(inputMask, cand) // Apply input encoding.
+	constr.Decrypt(cand, cand)
+	UnmaskOutput(outputMask, cand) // Remove output encoding.
+
+	c, _ := aes.NewCipher(key256)
+	c.Decrypt(real, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestSpecifiedMasks(t *testing.T) {
+	rs := random.NewSource("Specified Mask", seed)
+	mask := encoding.NewBlockAffine(rs.Matrix(make([]byte, 16), 128), [16]byte{1, 2, 3, 4, 5, 6, 7, 8})
+
+	constr, inputMask, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{
+		common.SpecifiedMask{mask.Forwards, [16]byte(mask.BlockAdditive)},
+		common.IdentityMask,
+	})
+
+	if !bytes.Equal(inputMask.Forwards[0], mask.Forwards[0]) {
+		t.Fatalf("Returned input mask isn't the one specified!")
+	}
+
+	real, cand := make([]byte, 16), [16]byte{}
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+
+	copy(cand[:], input)
+	cand = mask.Decode(cand) // Apply input encoding.
+
+	constr.Encrypt(cand[:], cand[:])
+
+	if !bytes.Equal(real, cand[:]) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestAffineMasks(t *testing.T) {
+	constr, inputMask, outputMask := GenerateEncryptionKeys(
+		key, seed, common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask},
+	)
+
+	if inputMask.BlockAdditive == (encoding.BlockAdditive{}) || outputMask.BlockAdditive == (encoding.BlockAdditive{}) {
+		t.Fatalf("Affine masks don't have a constant!")
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+
+	copy(cand, input)
+	MaskInput(inputMask, cand) // Apply input encoding.
+
+	constr.Encrypt(cand, cand)
+
+	UnmaskOutput(outputMask, cand) // Remove output encoding.
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestMaskHelpers(t *testing.T) {
+	_, inputMask, outputMask := GenerateEncryptionKeys(
+		key, seed, common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask},
+	)
+
+	block := make([]byte, 16)
+	copy(block, input)
+
+	MaskInput(inputMask, block)
+	if bytes.Equal(input, block) {
+		t.Fatalf("MaskInput didn't change the block!")
+	}
+
+	UnmaskInput(inputMask, block)
+	if !bytes.Equal(input, block) {
+		t.Fatalf("UnmaskInput didn't undo MaskInput! %x != %x", input, block)
+	}
+
+	MaskOutput(outputMask, block)
+	UnmaskOutput(outputMask, block)
+	if !bytes.Equal(input, block) {
+		t.Fatalf("UnmaskOutput didn't undo MaskOutput! %x != %x", input, block)
+	}
+}
+
+func TestGenerateKeysFrom(t *testing.T) {
+	opts := common.IndependentMasks{common.RandomMask, common.RandomMask}
+
+	constr1, _, _, err := GenerateEncryptionKeysFrom(key, bytes.NewReader(common.DeriveSeed(seed, input)), opts)
+	if err != nil {
+		t.Fatalf("GenerateEncryptionKeysFrom returned error: %v", err)
+	}
+
+	constr2, _, _ := GenerateEncryptionKeys(key, common.DeriveSeed(seed, input), opts)
+	if constr1.Fingerprint() != constr2.Fingerprint() {
+		t.Fatalf("Construction disagrees with one generated from the same seed!")
+	}
+
+	if _, _, _, err := GenerateDecryptionKeysFrom(key, bytes.NewReader(seed[:4]), opts); err == nil {
+		t.Fatalf("GenerateDecryptionKeysFrom accepted a short read!")
+	}
+}
+
+func TestSelfTest(t *testing.T) {
+	opts := Opts{Masks: common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask}, SelfTest: 8}
+
+	constr, inputMask, outputMask, err := GenerateDecryptionKeysFrom(key, bytes.NewReader(common.DeriveSeed(seed, input)), opts)
+	if err != nil {
+		t.Fatalf("Self-test of a correct construction failed: %v", err)
+	}
+
+	if err := constr.SelfTest(key, false, inputMask, outputMask, 8); err == nil {
+		t.Fatalf("Self-test accepted a decryption construction as an encryption construction!")
+	} else if err := constr.SelfTest(seed, true, inputMask, outputMask, 8); err == nil {
+		t.Fatalf("Self-test accepted the wrong key!")
+	}
+}
+
+func TestGenerateKeysRandom(t *testing.T) {
+	opts := common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask}
+
+	constr1, inputMask, outputMask, err := GenerateEncryptionKeysRandom(key, opts)
+	if err != nil {
+		t.Fatalf("GenerateEncryptionKeysRandom returned error: %v", err)
+	}
+
+	constr2, _, _, err := GenerateEncryptionKeysRandom(key, opts)
+	if err != nil {
+		t.Fatalf("GenerateEncryptionKeysRandom returned error: %v", err)
+	} else if constr1.Fingerprint() == constr2.Fingerprint() {
+		t.Fatalf("Two random constructions are the same!")
+	}
+
+	input1, err := ParseMask(inputMask)
+	if err != nil {
+		t.Fatalf("ParseMask returned error: %v", err)
+	}
+
+	output1, err := ParseMask(outputMask)
+	if err != nil {
+		t.Fatalf("ParseMask returned error: %v", err)
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+
+	copy(cand, input)
+	MaskInput(input1, cand)
+	constr1.Encrypt(cand, cand)
+	UnmaskOutput(output1, cand)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	if _, err := ParseMask(inputMask[1:]); err == nil {
+		t.Fatalf("ParseMask accepted a truncated mask!")
+	}
+}
+
+func TestKeyPair(t *testing.T) {
+	encrypt, decrypt, inputMask, outputMask := GenerateKeyPair(
+		key, seed, common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask},
+	)
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+
+	// Masked plaintexts should round-trip through both constructions without any masks being removed.
+	encrypt.Encrypt(cand, input)
+	decrypt.Decrypt(cand, cand)
+
+	if !bytes.Equal(input, cand) {
+		t.Fatalf("Decryption disagrees with original! %x != %x", input, cand)
+	}
+
+	copy(cand, input)
+	MaskInput(inputMask, cand)
+	encrypt.Encrypt(cand, cand)
+	UnmaskOutput(outputMask, cand)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	opts := common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask}
+
+	encrypt, encInput, encOutput := GenerateEncryptionKeys(key, seed, opts)
+	decrypt, decInput, decOutput := GenerateDecryptionKeys(key, seed, opts)
+
+	parsed, err := Parse(encrypt.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	} else if !encrypt.Equal(&parsed) {
+		t.Fatalf("Construction isn't equal to itself after serialization!")
+	} else if encrypt.Equal(&decrypt) {
+		t.Fatalf("Encryption construction is equal to decryption construction!")
+	}
+
+	if !Compatible(&encrypt, &decrypt, encInput, encOutput, decInput, decOutput, 8) {
+		t.Fatalf("Constructions for the same key aren't compatible!")
+	} else if Compatible(&encrypt, &decrypt, encInput, encOutput, decOutput, decInput, 8) {
+		t.Fatalf("Constructions are compatible under the wrong masks!")
+	}
+
+	other, otherInput, otherOutput := GenerateDecryptionKeys(seed, seed, opts)
+	if Compatible(&encrypt, &other, encInput, encOutput, otherInput, otherOutput, 8) {
+		t.Fatalf("Constructions for different keys are compatible!")
+	}
+}
+
+func TestDummyRounds(t *testing.T) {
+	opts := Opts{Masks: common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask}, DummyRounds: 8}
+	encrypt, decrypt, inputMask, outputMask := GenerateKeyPair(key, seed, opts)
+
+	if encrypt.Rounds() != 18 || decrypt.Rounds() != 18 {
+		t.Fatalf("Construction has wrong number of rounds! %v, %v != 18", encrypt.Rounds(), decrypt.Rounds())
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+
+	copy(cand, input)
+	MaskInput(inputMask, cand)
+	encrypt.Encrypt(cand, cand)
+	UnmaskOutput(outputMask, cand)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	encrypt.Encrypt(cand, input)
+	decrypt.Decrypt(cand, cand)
+
+	if !bytes.Equal(input, cand) {
+		t.Fatalf("Decryption disagrees with original! %x != %x", input, cand)
+	}
+
+	serialized := encrypt.Serialize()
+
+	// 18 rounds could be AES-128 or AES-256, so the header records which.
+	parsed, err := Parse(serialized)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	} else if parsed.Fingerprint() != encrypt.Fingerprint() {
+		t.Fatalf("Parsed fingerprint disagrees! %x != %x", parsed.Fingerprint(), encrypt.Fingerprint())
+	} else if parsed.KeyLength != 16 {
+		t.Fatalf("Parsed key length is wrong! %v != 16", parsed.KeyLength)
+	}
+
+	// A header's key size has to agree with its number of rounds.
+	serialized[7] = 2 << 2
+	if _, err := Parse(serialized); err == nil {
+		t.Fatalf("Parsed AES-128 key with an AES-192 header!")
+	}
+}
+
+func TestShuffleRounds(t *testing.T) {
+	opts := Opts{Masks: common.SameMasks(common.IdentityMask), DummyRounds: 4, ShuffleRounds: true}
+	constr1, inputMask, outputMask := GenerateEncryptionKeys(key, seed, opts)
+
+	shuffled := false
+	for round, slot := range constr1.RoundOrder {
+		shuffled = shuffled || round != slot
+	}
+
+	if !shuffled {
+		t.Fatalf("Middle rounds weren't shuffled! %v", constr1.RoundOrder)
+	}
+
+	real := make([]byte, 16)
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
 
 	serialized := constr1.Serialize()
-	constr2, err := Parse(serialized)
-	t.Logf("Serialized white-box size: %v bytes", len(serialized))
 
+	constr2, err := Parse(serialized)
 	if err != nil {
 		t.Fatalf("Parse returned error: %v", err)
 	}
 
-	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+	constr3, err := ReadConstruction(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatalf("ReadConstruction returned error: %v", err)
+	}
 
-	constr1.Encrypt(cand1, input)
-	constr2.Encrypt(cand2, input)
+	constr4, err := ParseReaderAt(bytes.NewReader(serialized), int64(len(serialized)))
+	if err != nil {
+		t.Fatalf("ParseReaderAt returned error: %v", err)
+	}
 
-	if !bytes.Equal(cand1, cand2) {
-		t.Fatalf("Real disagrees with parsed! %x != %x", cand1, cand2)
+	constr5, inputMask5, outputMask5 := constr1.Rerandomize(seed, inputMask, outputMask)
+
+	for n, constr := range []Construction{constr1, constr2, constr3, constr4} {
+		cand := make([]byte, 16)
+		constr.Encrypt(cand, input)
+
+		if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with result of construction %v! %x != %x", n, real, cand)
+		}
+	}
+
+	cand := make([]byte, 16)
+
+	copy(cand, input)
+	MaskInput(inputMask5, cand)
+	constr5.Encrypt(cand, cand)
+	UnmaskOutput(outputMask5, cand)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with rerandomized result! %x != %x", real, cand)
+	}
+
+	// A shuffled key's order is part of its fingerprint.
+	constr2.RoundOrder = nil
+	if constr2.Fingerprint() == constr1.Fingerprint() {
+		t.Fatalf("Fingerprint doesn't depend on the order of the rounds!")
 	}
 }
 
-func BenchmarkGenerateEncryptionKeys(b *testing.B) {
-	for i := 0; i < b.N; i++ {
-		constr, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
-		constr.Serialize()
+func TestMixingBijections(t *testing.T) {
+	real := make([]byte, 16)
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+
+	fingerprints := make(map[[32]byte]bool)
+
+	for _, mbs := range []MixingBijections{
+		BothMixingBijections, WideMixingBijections, NarrowMixingBijections, NoMixingBijections,
+	} {
+		opts := Opts{Masks: common.SameMasks(common.IdentityMask), MixingBijections: mbs}
+		constr, _, _ := GenerateEncryptionKeys(key, seed, opts)
+
+		cand := make([]byte, 16)
+		constr.Encrypt(cand, input)
+
+		if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with result for mixing bijections %v! %x != %x", mbs, real, cand)
+		}
+
+		fingerprints[constr.Fingerprint()] = true
+	}
+
+	if len(fingerprints) != 4 {
+		t.Fatalf("Mixing bijection options don't all give different constructions!")
 	}
 }
 
-// A "Live" Encryption is one based on table abstractions, so many computations are performed on-demand.
-func BenchmarkLiveEncrypt(b *testing.B) {
-	constr, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+func TestNaked(t *testing.T) {
+	constr, inputMask, outputMask := GenerateEncryptionKeys(key, seed, Opts{Naked: true})
 
-	out := make([]byte, 16)
+	real, cand := make([]byte, 16), make([]byte, 16)
 
-	b.ResetTimer()
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
 
-	for i := 0; i < b.N; i++ {
-		constr.Encrypt(out, input)
+	copy(cand, input)
+	MaskInput(inputMask, cand)
+	constr.Encrypt(cand, cand)
+	UnmaskOutput(outputMask, cand)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	constr.Encrypt(cand, input)
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Naked construction has external encodings! %x != %x", real, cand)
+	}
+
+	// The first round's tables should be bare T-Boxes composed with Tyi Tables.
+	plain := saes.Construction{key}
+	roundKey := plain.StretchedKey()[0]
+	plain.ShiftRows(roundKey)
+
+	for pos := 0; pos < 16; pos++ {
+		wide := table.ComposedToWord{common.TBox{Constr: plain, KeyByte1: roundKey[pos]}, common.TyiTable(pos % 4)}
+
+		for x := 0; x < 256; x++ {
+			if real, cand := wide.Get(byte(x)), constr.TBoxTyiTable[0][pos].Get(byte(x)); real != cand {
+				t.Fatalf("Table at position %v disagrees with T-Box/Tyi Table at %x! %x != %x", pos, x, real, cand)
+			}
+		}
 	}
 }
 
-// A "Dead" Encryption is one based on serialized tables, like we'd have in a real use case.
-func BenchmarkDeadEncrypt(b *testing.B) {
-	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+func TestExportC(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping C compilation in short mode.")
+	}
 
-	serialized := constr1.Serialize()
-	constr2, _ := Parse(serialized)
+	cc, err := exec.LookPath("cc")
+	if err != nil {
+		t.Skip("No C compiler found.")
+	}
 
-	out := make([]byte, 16)
+	dir, err := ioutil.TempDir("", "chow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
 
-	b.ResetTimer()
+	opts := Opts{Masks: common.SameMasks(common.IdentityMask), ShuffleRounds: true}
+	constr, _, _ := GenerateEncryptionKeys(key, seed, opts)
 
-	for i := 0; i < b.N; i++ {
-		constr2.Encrypt(out, input)
+	source, header := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := constr.ExportC(source, "wb"); err != nil {
+		t.Fatalf("ExportC returned error: %v", err)
+	} else if err := ExportCHeader(header, "wb"); err != nil {
+		t.Fatalf("ExportCHeader returned error: %v", err)
+	}
+
+	main := `#include <stdio.h>
+#include "wb.h"
+
+int main(void) {
+	uint8_t block[16];
+	int i;
+
+	for (i = 0; i < 16; i++) {
+		if (scanf("%2hhx", &block[i]) != 1) return 1;
 	}
+
+	wb_encrypt(block, block);
+
+	for (i = 0; i < 16; i++) printf("%02x", block[i]);
+	return 0;
+}
+`
+
+	ioutil.WriteFile(dir+"/wb.c", source.Bytes(), 0600)
+	ioutil.WriteFile(dir+"/wb.h", header.Bytes(), 0600)
+	ioutil.WriteFile(dir+"/main.c", []byte(main), 0600)
+
+	if out, err := exec.Command(cc, "-Wall", "-Werror", "-o", dir+"/wb", dir+"/wb.c", dir+"/main.c").CombinedOutput(); err != nil {
+		t.Fatalf("Compiling exported construction failed: %v\n%s", err, out)
+	}
+
+	cmd := exec.Command(dir + "/wb")
+	cmd.Stdin = strings.NewReader(hex.EncodeToString(input))
+
+	out, err := cmd.Output()
+	if err != nil {
+		t.Fatalf("Running exported construction failed: %v", err)
+	}
+
+	real := make([]byte, 16)
+	constr.Encrypt(real, input)
+
+	if cand := string(out); cand != hex.EncodeToString(real) {
+		t.Fatalf("Real disagrees with result! %x != %v", real, cand)
+	}
+
+	if err := constr.ExportC(ioutil.Discard, "not valid"); err == nil {
+		t.Fatalf("ExportC accepted an invalid prefix!")
+	}
+}
+
+func TestExportGo(t *testing.T) {
+	if testing.Short() {
+		t.Skip("Skipping Go compilation in short mode.")
+	}
+
+	gobin, err := exec.LookPath("go")
+	if err != nil {
+		t.Skip("No Go toolchain found.")
+	}
+
+	dir, err := ioutil.TempDir("", "chow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Opts{Masks: common.SameMasks(common.IdentityMask), ShuffleRounds: true}
+	constr, _, _ := GenerateDecryptionKeys(key, seed, opts)
+
+	source := &bytes.Buffer{}
+	if err := constr.ExportGo(source, "main"); err != nil {
+		t.Fatalf("ExportGo returned error: %v", err)
+	}
+
+	main := `package main
+
+import (
+	"encoding/hex"
+	"fmt"
+	"os"
+)
+
+func main() {
+	block, _ := hex.DecodeString(os.Args[1])
+	Decrypt(block, block)
+	fmt.Print(hex.EncodeToString(block))
+}
+`
+
+	ioutil.WriteFile(dir+"/tables.go", source.Bytes(), 0600)
+	ioutil.WriteFile(dir+"/main.go", []byte(main), 0600)
+
+	cmd := exec.Command(gobin, "run", "tables.go", "main.go", hex.EncodeToString(input))
+	cmd.Dir = dir
+
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("Running exported construction failed: %v\n%s", err, out)
+	}
+
+	real := make([]byte, 16)
+	constr.Decrypt(real, input)
+
+	if cand := string(out); cand != hex.EncodeToString(real) {
+		t.Fatalf("Real disagrees with result! %x != %v", real, cand)
+	}
+
+	if err := constr.ExportGo(ioutil.Discard, "not valid"); err == nil {
+		t.Fatalf("ExportGo accepted an invalid package name!")
+	}
+}
+
+func TestExportJS(t *testing.T) {
+	node, err := exec.LookPath("node")
+	if err != nil {
+		t.Skip("No JavaScript runtime found.")
+	}
+
+	dir, err := ioutil.TempDir("", "chow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	opts := Opts{Masks: common.SameMasks(common.IdentityMask), ShuffleRounds: true}
+	constr, _, _ := GenerateEncryptionKeys(key, seed, opts)
+
+	blob, runtime := &bytes.Buffer{}, &bytes.Buffer{}
+	if err := constr.ExportJSBlob(blob); err != nil {
+		t.Fatalf("ExportJSBlob returned error: %v", err)
+	} else if err := ExportJSRuntime(runtime); err != nil {
+		t.Fatalf("ExportJSRuntime returned error: %v", err)
+	}
+
+	main := `var fs = require("fs"), chowWhiteBox = require("./runtime.js");
+var wb = chowWhiteBox(new Uint8Array(fs.readFileSync(__dirname + "/key.bin")));
+var block = new Uint8Array(Buffer.from(process.argv[2], "hex"));
+wb.encrypt(block);
+process.stdout.write(Buffer.from(block).toString("hex"));
+`
+
+	ioutil.WriteFile(dir+"/key.bin", blob.Bytes(), 0600)
+	ioutil.WriteFile(dir+"/runtime.js", runtime.Bytes(), 0600)
+	ioutil.WriteFile(dir+"/main.js", []byte(main), 0600)
+
+	out, err := exec.Command(node, dir+"/main.js", hex.EncodeToString(input)).CombinedOutput()
+	if err != nil {
+		t.Fatalf("Running exported construction failed: %v\n%s", err, out)
+	}
+
+	real := make([]byte, 16)
+	constr.Encrypt(real, input)
+
+	if cand := string(out); cand != hex.EncodeToString(real) {
+		t.Fatalf("Real disagrees with result! %x != %v", real, cand)
+	}
+}
+
+func TestDestroy(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+	serialized := constr1.Serialize()
+
+	constr2, err := Parse(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constr1.Destroy()
+	constr2.Destroy()
+
+	if constr1.TBoxTyiTable != nil || constr2.TBoxTyiTable != nil || constr2.InputMask[0] != nil {
+		t.Fatalf("Destroy didn't drop the construction's tables!")
+	}
+
+	// Everything after the header should be wiped.
+	tables := serialized[len(serialized)-fullSize(10):]
+	if !bytes.Equal(tables, make([]byte, len(tables))) {
+		t.Fatalf("Destroy didn't wipe the parsed tables!")
+	}
+}
+
+func TestWideXORTables(t *testing.T) {
+	opts := Opts{Masks: common.IndependentMasks{common.RandomMask, common.RandomMask}, ShuffleRounds: true}
+
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, opts)
+
+	opts.WideXORTables = true
+	constr2, _, _ := GenerateEncryptionKeys(key, seed, opts)
+
+	if constr2.HighWideXORTable == nil {
+		t.Fatalf("Construction wasn't generated with wide XOR tables!")
+	} else if !constr1.Equal(&constr2) {
+		t.Fatalf("Wide XOR tables changed the serialized construction!")
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+	constr1.Encrypt(real, input)
+	constr2.Encrypt(cand, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestUnpackedXORTables(t *testing.T) {
+	opts := Opts{Masks: common.IndependentMasks{common.RandomMask, common.RandomMask}, ShuffleRounds: true, DummyRounds: 4}
+
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, opts)
+	constr2, _, _ := GenerateDecryptionKeys(key, seed, opts)
+
+	constr3, constr4 := constr1, constr2
+	constr3.UnpackXORTables()
+	constr4.UnpackXORTables()
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+	for i := 0; i < 64; i++ {
+		block := sha256.Sum256([]byte{byte(i)})
+
+		constr1.Encrypt(real, block[:16])
+		constr3.Encrypt(cand, block[:16])
+		if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		}
+
+		constr2.Decrypt(real, block[:16])
+		constr4.Decrypt(cand, block[:16])
+		if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		}
+	}
+}
+
+func TestDeviceBinding(t *testing.T) {
+	c, _ := aes.NewCipher(key)
+	real := make([]byte, 16)
+
+	for _, decrypt := range []bool{false, true} {
+		device := &DeviceBinding{Fingerprint: []byte("device 1")}
+		opts := Opts{Masks: common.SameMasks(common.IdentityMask), ShuffleRounds: true, Device: device}
+
+		generate, expected := GenerateEncryptionKeys, c.Encrypt
+		if decrypt {
+			generate, expected = GenerateDecryptionKeys, c.Decrypt
+		}
+		expected(real, input)
+
+		constr, _, _ := generate(key, seed, opts)
+
+		crypt := func(constr *Construction) []byte {
+			cand := make([]byte, 16)
+			if decrypt {
+				constr.Decrypt(cand, input)
+			} else {
+				constr.Encrypt(cand, input)
+			}
+
+			return cand
+		}
+
+		if cand := crypt(&constr); bytes.Equal(real, cand) {
+			t.Fatalf("Construction computed AES before it was activated!")
+		}
+
+		constr.Activate(&device.Activation, []byte("device 2"))
+		if cand := crypt(&constr); bytes.Equal(real, cand) {
+			t.Fatalf("Construction computed AES when activated with the wrong fingerprint!")
+		}
+
+		// The key and activation are delivered separately.
+		parsed, err := Parse(constr.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+		activation, err := ParseActivation(device.Activation.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		parsed.Activate(&activation, []byte("device 1"))
+		if cand := crypt(&parsed); !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		}
+
+		// Nothing that drops the binding accepts an activated construction.
+		if err := parsed.ExportC(ioutil.Discard, "wb"); err == nil {
+			t.Fatalf("ExportC exported an activated construction!")
+		} else if err := parsed.ExportGo(ioutil.Discard, "wb"); err == nil {
+			t.Fatalf("ExportGo exported an activated construction!")
+		} else if err := parsed.ExportJSBlob(ioutil.Discard); err == nil {
+			t.Fatalf("ExportJSBlob exported an activated construction!")
+		}
+
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Fatalf("Rerandomize accepted an activated construction!")
+				}
+			}()
+
+			parsed.Rerandomize(seed, encoding.BlockAffine{}, encoding.BlockAffine{})
+		}()
+
+		// A key generated for another device doesn't work with this device's activation.
+		opts.Device = &DeviceBinding{Fingerprint: []byte("device 2")}
+		other, _, _ := generate(key, seed, opts)
+		other.Activate(&activation, []byte("device 1"))
+		if cand := crypt(&other); bytes.Equal(real, cand) {
+			t.Fatalf("Construction computed AES with another device's activation!")
+		}
+	}
+
+	if _, err := ParseActivation(make([]byte, 4095)); err == nil {
+		t.Fatalf("Truncated activation was parsed!")
+	}
+}
+
+func TestDeviceBindingSelfTest(t *testing.T) {
+	for _, decrypt := range []bool{false, true} {
+		device := &DeviceBinding{Fingerprint: []byte("device 1")}
+		opts := Opts{Masks: common.IndependentMasks{common.RandomMask, common.RandomMask}, Device: device, SelfTest: 8}
+
+		generate := GenerateEncryptionKeysCtx
+		if decrypt {
+			generate = GenerateDecryptionKeysCtx
+		}
+
+		constr, _, _, err := generate(context.Background(), key, seed, opts, nil)
+		if err != nil {
+			t.Fatalf("Self-test of a bound construction failed: %v", err)
+		} else if constr.Binding != nil {
+			t.Fatalf("Self-test left the construction activated!")
+		}
+	}
+}
+
+func TestWatermark(t *testing.T) {
+	mark := []byte("Licensee #42")
+	opts := Opts{Masks: common.IndependentMasks{common.RandomMask, common.RandomMask}, DummyRounds: 4}
+
+	plain, inputMask, outputMask := GenerateEncryptionKeys(key, seed, opts)
+
+	opts.Watermark = mark
+	marked, _, _ := GenerateEncryptionKeys(key, seed, opts)
+
+	if plain.Equal(&marked) {
+		t.Fatalf("Watermark didn't change the construction!")
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+	plain.Encrypt(real, input)
+	marked.Encrypt(cand, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	parsed, err := Parse(marked.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if extracted, err := ExtractWatermark(&parsed, seed, false); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(mark, extracted) {
+		t.Fatalf("Real disagrees with result! %x != %x", mark, extracted)
+	}
+
+	if extracted, err := ExtractWatermark(&plain, seed, false); err != nil {
+		t.Fatal(err)
+	} else if len(extracted) != 0 {
+		t.Fatalf("Extracted a watermark from an unmarked construction! %x", extracted)
+	}
+
+	decrypt, _, _ := GenerateDecryptionKeys(key, seed, Opts{Masks: opts.Masks, Watermark: mark})
+	if extracted, err := ExtractWatermark(&decrypt, seed, true); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(mark, extracted) {
+		t.Fatalf("Real disagrees with result! %x != %x", mark, extracted)
+	}
+
+	if _, err := ExtractWatermark(&marked, key, false); err == nil {
+		t.Fatalf("Extracted a watermark with the wrong seed!")
+	}
+
+	rerandomized, _, _ := marked.Rerandomize(seed, inputMask, outputMask)
+	if _, err := ExtractWatermark(&rerandomized, seed, false); err == nil {
+		t.Fatalf("Extracted a watermark from a rerandomized construction!")
+	}
+
+	long := Opts{Masks: opts.Masks, Watermark: make([]byte, MaxWatermark)}
+	for i := range long.Watermark {
+		long.Watermark[i] = 0xff
+	}
+	longMarked, _, _ := GenerateEncryptionKeys(key, seed, long)
+	if extracted, err := ExtractWatermark(&longMarked, seed, false); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(long.Watermark, extracted) {
+		t.Fatalf("Real disagrees with result! %x != %x", long.Watermark, extracted)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Key generation accepted a watermark that's too long!")
+		}
+	}()
+	long.Watermark = append(long.Watermark, 0)
+	GenerateEncryptionKeys(key, seed, long)
+}
+
+func TestPack(t *testing.T) {
+	opts := Opts{Masks: common.IndependentMasks{common.RandomMask, common.RandomMask}, ShuffleRounds: true}
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, opts)
+
+	constr2, err := Parse(constr1.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+	constr2.Pack()
+
+	if !constr1.Equal(&constr2) {
+		t.Fatalf("Packed construction serializes differently than original!")
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+	constr1.Encrypt(real, input)
+	constr2.Encrypt(cand, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestRerandomize(t *testing.T) {
+	opts := common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask}
+	encrypt, inputMask, outputMask := GenerateEncryptionKeys(key, seed, opts)
+	decrypt, decInputMask, decOutputMask := GenerateDecryptionKeys(key, seed, opts)
+
+	encrypt2, inputMask2, outputMask2 := encrypt.Rerandomize(input, inputMask, outputMask)
+	decrypt2, decInputMask2, decOutputMask2 := decrypt.Rerandomize(input, decInputMask, decOutputMask)
+
+	if bytes.Equal(inputMask.Forwards[0], inputMask2.Forwards[0]) {
+		t.Fatalf("Rerandomize didn't change the input mask!")
+	}
+
+	old, new := encrypt.Serialize(), encrypt2.Serialize()
+	for i := len(old) - fullSize(10); i+stepTableSize <= len(old); i += stepTableSize {
+		if bytes.Equal(old[i:i+stepTableSize], new[i:i+stepTableSize]) {
+			t.Fatalf("Rerandomize left the tables at offset %v unchanged!", i)
+		}
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+
+	copy(cand, input)
+	MaskInput(inputMask2, cand)
+	encrypt2.Encrypt(cand, cand)
+	UnmaskOutput(outputMask2, cand)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	MaskInput(decInputMask2, cand)
+	decrypt2.Decrypt(cand, cand)
+	UnmaskOutput(decOutputMask2, cand)
+
+	if !bytes.Equal(input, cand) {
+		t.Fatalf("Decryption disagrees with original! %x != %x", input, cand)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	serialized := constr1.Serialize()
+	constr2, err := Parse(serialized)
+	t.Logf("Serialized white-box size: %v bytes", len(serialized))
+
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	} else if len(serialized) != constr1.Size() {
+		t.Fatalf("Size disagrees with serialized construction! %v != %v", constr1.Size(), len(serialized))
+	}
+
+	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+
+	constr1.Encrypt(cand1, input)
+	constr2.Encrypt(cand2, input)
+
+	if !bytes.Equal(cand1, cand2) {
+		t.Fatalf("Real disagrees with parsed! %x != %x", cand1, cand2)
+	}
+}
+
+func TestStreamingPersistence(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	buff := &bytes.Buffer{}
+	n, err := constr1.WriteTo(buff)
+	if err != nil {
+		t.Fatalf("WriteTo returned error: %v", err)
+	} else if n != int64(buff.Len()) {
+		t.Fatalf("WriteTo reported wrong length! %v != %v", n, buff.Len())
+	} else if !bytes.Equal(buff.Bytes(), constr1.Serialize()) {
+		t.Fatalf("WriteTo disagrees with Serialize!")
+	}
+
+	// Put something after the key to make sure ReadConstruction stops at the end of it.
+	buff.Write([]byte("trailer"))
+
+	constr2, err := ReadConstruction(buff)
+	if err != nil {
+		t.Fatalf("ReadConstruction returned error: %v", err)
+	} else if buff.String() != "trailer" {
+		t.Fatalf("ReadConstruction read past the end of the key!")
+	}
+
+	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+
+	constr1.Encrypt(cand1, input)
+	constr2.Encrypt(cand2, input)
+
+	if !bytes.Equal(cand1, cand2) {
+		t.Fatalf("Real disagrees with parsed! %x != %x", cand1, cand2)
+	}
+
+	if _, err := ReadConstruction(bytes.NewReader(constr1.Serialize()[:1000])); err == nil {
+		t.Fatalf("ReadConstruction accepted a truncated key!")
+	}
+}
+
+func TestCompressed(t *testing.T) {
+	opts := Opts{Masks: common.IndependentMasks{common.RandomMask, common.RandomMask}, DummyRounds: 4, ShuffleRounds: true}
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, opts)
+
+	serialized, compressed := constr1.Serialize(), constr1.SerializeCompressed()
+	if 2*len(compressed) > len(serialized) {
+		t.Fatalf("Compressed key is too large! %v > %v/2", len(compressed), len(serialized))
+	}
+
+	// Nibble functions that aren't of the form canonicalize looks for, like those of the T-Box/Tyi tables, are stored as
+	// they are.
+	for i := 0; i < 8; i++ {
+		f := getFunction(table.SerializeWord(constr1.TBoxTyiTable[0][0]), recordWord, i)
+		if _, ok := canonicalize(&f); ok {
+			t.Fatalf("Canonicalized a nibble of a T-Box/Tyi table!")
+		}
+	}
+
+	constr2, err := Parse(compressed)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	} else if !constr1.Equal(&constr2) || constr2.Fingerprint() != constr1.Fingerprint() {
+		t.Fatalf("Parsed compressed construction disagrees!")
+	}
+
+	loaded, err := common.Load(compressed)
+	if err != nil {
+		t.Fatal(err)
+	} else if loaded.KeySize() != 16 {
+		t.Fatalf("Loaded compressed construction has a %v byte key!", loaded.KeySize())
+	}
+
+	// A MultiReader can't be read a byte at a time, so ReadConstruction has to make sure the decompressor doesn't read
+	// past the end of the key.
+	r := io.MultiReader(bytes.NewReader(compressed), strings.NewReader("trailer"))
+
+	constr3, err := ReadConstruction(r)
+	if err != nil {
+		t.Fatalf("ReadConstruction returned error: %v", err)
+	} else if rest, _ := ioutil.ReadAll(r); string(rest) != "trailer" {
+		t.Fatalf("ReadConstruction read past the end of the key!")
+	} else if !constr1.Equal(&constr3) {
+		t.Fatalf("Read compressed construction disagrees!")
+	}
+
+	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+
+	constr1.Encrypt(cand1, input)
+	constr3.Encrypt(cand2, input)
+
+	if !bytes.Equal(cand1, cand2) {
+		t.Fatalf("Real disagrees with parsed! %x != %x", cand1, cand2)
+	}
+
+	// Corrupted or truncated compressed tables are rejected.
+	corrupted := append([]byte{}, compressed...)
+	corrupted[len(corrupted)/2] ^= 0xff
+
+	for _, bad := range [][]byte{corrupted, compressed[:len(compressed)-10]} {
+		if _, err := Parse(bad); err == nil {
+			t.Fatalf("Parse accepted a corrupted compressed key!")
+		} else if _, err := ReadConstruction(bytes.NewReader(bad)); err == nil {
+			t.Fatalf("ReadConstruction accepted a corrupted compressed key!")
+		}
+	}
+
+	if _, err := Parse(append(compressed, 0)); err == nil {
+		t.Fatalf("Parse accepted a compressed key with trailing data!")
+	}
+
+	if _, err := ParseReaderAt(bytes.NewReader(compressed), int64(len(compressed))); err == nil {
+		t.Fatalf("ParseReaderAt accepted a compressed key!")
+	}
+}
+
+func TestOpenConstruction(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+
+	f, err := ioutil.TempFile("", "chow")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+
+	f.Write(constr1.Serialize())
+	f.Close()
+
+	constr2, closer, err := OpenConstruction(f.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+
+	constr1.Encrypt(cand1, input)
+	constr2.Encrypt(cand2, input)
+
+	if !bytes.Equal(cand1, cand2) {
+		t.Fatalf("Lazily loaded construction disagrees with original! %x != %x", cand1, cand2)
+	}
+
+	if _, err := ParseReaderAt(bytes.NewReader(constr1.Serialize()[:1000]), 1000); err == nil {
+		t.Fatalf("ParseReaderAt accepted a truncated key!")
+	}
+}
+
+func TestPersistenceVersioning(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	serialized := constr1.Serialize()
+
+	// Keys serialized before the header existed should still parse.
+	constr2, err := Parse(serialized[len(serialized)-fullSize(10):])
+	if err != nil {
+		t.Fatalf("Parse returned error on headerless key: %v", err)
+	}
+
+	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+
+	constr1.Encrypt(cand1, input)
+	constr2.Encrypt(cand2, input)
+
+	if !bytes.Equal(cand1, cand2) {
+		t.Fatalf("Real disagrees with parsed! %x != %x", cand1, cand2)
+	}
+
+	// Keys from the future, or for other constructions, should not.
+	future := append([]byte{}, serialized...)
+	future[4] = common.CurrentVersion + 1
+
+	if _, err := Parse(future); err == nil {
+		t.Fatalf("Parse accepted a key with an unsupported version!")
+	}
+
+	other := append([]byte{}, serialized...)
+	other[5] = byte(common.XiaoConstruction)
+
+	if _, err := Parse(other); err == nil {
+		t.Fatalf("Parse accepted a key for a different construction!")
+	}
+
+	if _, err := Parse(serialized[:len(serialized)-1]); err == nil {
+		t.Fatalf("Parse accepted a truncated key!")
+	}
+}
+
+func TestMetadata(t *testing.T) {
+	constr1, inputMask, outputMask := GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	constr1.Metadata = common.Metadata{Created: time.Unix(1234567890, 0).UTC(), KeyID: []byte("test key")}
+
+	serialized := constr1.Serialize()
+
+	constr2, err := Parse(serialized)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	constr3, err := ReadConstruction(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatalf("ReadConstruction returned error: %v", err)
+	}
+
+	constr4, err := ParseReaderAt(bytes.NewReader(serialized), int64(len(serialized)))
+	if err != nil {
+		t.Fatalf("ParseReaderAt returned error: %v", err)
+	}
+
+	for _, constr := range []Construction{constr2, constr3, constr4} {
+		if !constr.Metadata.Created.Equal(constr1.Metadata.Created) {
+			t.Fatalf("Parsed creation time disagrees! %v != %v", constr.Metadata.Created, constr1.Metadata.Created)
+		} else if !bytes.Equal(constr.Metadata.KeyID, constr1.Metadata.KeyID) {
+			t.Fatalf("Parsed key ID disagrees! %q != %q", constr.Metadata.KeyID, constr1.Metadata.KeyID)
+		} else if constr.Fingerprint() != constr1.Fingerprint() {
+			t.Fatalf("Parsed fingerprint disagrees! %x != %x", constr.Fingerprint(), constr1.Fingerprint())
+		}
+	}
+
+	// The fingerprint only depends on the tables.
+	constr2.Metadata = common.Metadata{}
+	if constr2.Fingerprint() != constr1.Fingerprint() {
+		t.Fatalf("Fingerprint changed with the metadata!")
+	}
+
+	constr5, _, _ := constr1.Rerandomize(seed, inputMask, outputMask)
+	if constr5.Fingerprint() == constr1.Fingerprint() {
+		t.Fatalf("Rerandomized construction has the same fingerprint!")
+	}
+
+	// Keys with a version 1 header, which has no metadata, should still parse.
+	v1 := append([]byte{}, serialized[:common.HeaderSize]...)
+	v1[4], v1[7] = 1, 0
+	v1 = append(v1, serialized[len(serialized)-fullSize(10):]...)
+
+	constr6, err := Parse(v1)
+	if err != nil {
+		t.Fatalf("Parse returned error on version 1 key: %v", err)
+	} else if constr6.Fingerprint() != constr1.Fingerprint() {
+		t.Fatalf("Version 1 fingerprint disagrees! %x != %x", constr6.Fingerprint(), constr1.Fingerprint())
+	}
+}
+
+func TestIntegrity(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	serialized := constr1.SerializeWithMAC(seed)
+
+	if err := VerifyIntegrity(bytes.NewReader(serialized), seed); err != nil {
+		t.Fatalf("VerifyIntegrity returned error: %v", err)
+	} else if err := VerifyIntegrity(bytes.NewReader(serialized), key); err == nil {
+		t.Fatalf("VerifyIntegrity accepted the wrong MAC key!")
+	} else if err := VerifyIntegrity(bytes.NewReader(constr1.Serialize()), seed); err == nil {
+		t.Fatalf("VerifyIntegrity accepted a key without a MAC!")
+	}
+
+	for _, i := range []int{len(serialized) / 2, len(serialized) - 1} {
+		tampered := append([]byte{}, serialized...)
+		tampered[i] ^= 0x01
+
+		if err := VerifyIntegrity(bytes.NewReader(tampered), seed); err == nil {
+			t.Fatalf("VerifyIntegrity accepted a key modified at offset %v!", i)
+		}
+	}
+
+	// Every byte of the header is covered by the MAC: type, rounds, flags, and metadata.
+	constr1.Metadata = common.Metadata{Created: time.Unix(1234567890, 0).UTC(), KeyID: []byte("test key")}
+	serialized = constr1.SerializeWithMAC(seed)
+
+	for i := 0; i < constr1.header().Size(); i++ {
+		tampered := append([]byte{}, serialized...)
+		tampered[i] ^= 0x01
+
+		if err := VerifyIntegrity(bytes.NewReader(tampered), seed); err == nil {
+			t.Fatalf("VerifyIntegrity accepted a key with its header modified at offset %v!", i)
+		}
+	}
+
+	// Without a MAC, a modified header goes unnoticed.
+	tampered := constr1.Serialize()
+	tampered[constr1.header().Size()-1] ^= 0x01
+
+	if constr2, err := Parse(tampered); err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	} else if string(constr2.Metadata.KeyID) != "test kex" {
+		t.Fatalf("Parsed key ID disagrees! %q != %q", constr2.Metadata.KeyID, "test kex")
+	}
+
+	// Keys with a MAC should parse with every parser.
+	constr2, err := Parse(serialized)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	constr3, err := ReadConstruction(bytes.NewReader(serialized))
+	if err != nil {
+		t.Fatalf("ReadConstruction returned error: %v", err)
+	}
+
+	constr4, err := ParseReaderAt(bytes.NewReader(serialized), int64(len(serialized)))
+	if err != nil {
+		t.Fatalf("ParseReaderAt returned error: %v", err)
+	}
+
+	for _, constr := range []Construction{constr2, constr3, constr4} {
+		if constr.Fingerprint() != constr1.Fingerprint() {
+			t.Fatalf("Parsed fingerprint disagrees! %x != %x", constr.Fingerprint(), constr1.Fingerprint())
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+
+	loaded, err := common.Load(constr1.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	} else if loaded.Type() != common.ChowConstruction || loaded.KeySize() != 16 {
+		t.Fatalf("Loaded construction is a %v with a %v byte key!", loaded.Type(), loaded.KeySize())
+	}
+
+	constr2, ok := loaded.(*Construction)
+	if !ok {
+		t.Fatalf("Loaded construction is a %T!", loaded)
+	} else if !constr1.Equal(constr2) {
+		t.Fatalf("Loaded construction disagrees!")
+	}
+
+	// The header records the length of the key, which dummy rounds would otherwise hide when it's ambiguous.
+	for _, test := range []struct{ key, dummies, size int }{{16, 4, 0}, {24, 4, 24}, {32, 0, 0}} {
+		constr, _, _ := GenerateEncryptionKeys(make([]byte, test.key), seed, Opts{Naked: true, DummyRounds: test.dummies})
+
+		parsed, err := Parse(constr.Serialize())
+		if err != nil {
+			t.Fatal(err)
+		} else if size := parsed.KeySize(); size != test.key {
+			t.Fatalf("Key size of AES-%v with %v dummy rounds is wrong! %v != %v", 8*test.key, test.dummies, size, test.key)
+		}
+
+		// Keys serialized before the header recorded it only have their number of rounds to go on.
+		parsed.KeyLength = 0
+		if size := parsed.KeySize(); size != test.size {
+			t.Fatalf("Key size of AES-%v with %v dummy rounds is wrong! %v != %v", 8*test.key, test.dummies, size, test.size)
+		}
+	}
+
+	if _, err := common.Load(input); err == nil {
+		t.Fatalf("Loaded a key without a header!")
+	}
+}
+
+func TestPersistence192(t *testing.T) {
+	key192 := append(append([]byte{}, key...), seed[:8]...)
+	constr1, _, _ := GenerateEncryptionKeys(key192, seed, common.SameMasks(common.IdentityMask))
+
+	constr2, err := Parse(constr1.Serialize())
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	} else if constr2.Rounds() != 12 {
+		t.Fatalf("Parsed construction has wrong number of rounds! %v != 12", constr2.Rounds())
+	}
+
+	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+
+	constr1.Encrypt(cand1, input)
+	constr2.Encrypt(cand2, input)
+
+	if !bytes.Equal(cand1, cand2) {
+		t.Fatalf("Real disagrees with parsed! %x != %x", cand1, cand2)
+	}
+}
+
+// isAffine returns true if the nibble bijection f is an affine function.
+func isAffine(f func(byte) byte) bool {
+	for a := byte(0); a < 16; a++ {
+		for b := byte(0); b < 16; b++ {
+			if f(a^b)^f(0) != f(a)^f(b) {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+func TestInternalEncodingsNonlinear(t *testing.T) {
+	rs := random.NewSource("Chow Encryption", seed)
+
+	for round := 0; round < 9; round++ {
+		for pos := 0; pos < 16; pos++ {
+			if isAffine(tyiEncoding(&rs, round, pos, 0).Encode) {
+				t.Fatalf("Tyi encoding in round %v at position %v is affine!", round, pos)
+			} else if isAffine(mbInverseEncoding(&rs, round, pos, 0).Encode) {
+				t.Fatalf("MB^(-1) encoding in round %v at position %v is affine!", round, pos)
+			} else if isAffine(roundEncoding(&rs, round, common.Inside, common.NoShift)(2 * pos).Encode) {
+				t.Fatalf("Round encoding in round %v at position %v is affine!", round, pos)
+			}
+		}
+	}
+}
+
+func TestEncryptBlocks(t *testing.T) {
+	opts := common.IndependentMasks{common.IdentityMask, common.IdentityMask}
+	encConstr, _, _ := GenerateEncryptionKeys(key, seed, opts)
+	decConstr, _, _ := GenerateDecryptionKeys(key, seed, opts)
+
+	src := make([]byte, 16*100)
+	for i := range src {
+		src[i] = byte(i)
+	}
+
+	real := make([]byte, len(src))
+	for i := 0; i < len(src); i += 16 {
+		encConstr.Encrypt(real[i:i+16], src[i:i+16])
+	}
+
+	cand := make([]byte, len(src))
+	encConstr.EncryptBlocks(cand, src)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	decConstr.DecryptBlocks(cand, cand)
+
+	if !bytes.Equal(src, cand) {
+		t.Fatalf("Decryption disagrees with original! %x != %x", src, cand)
+	}
+}
+
+func TestPrecompute(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+	constr2, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	constr2.Precompute(4)
+
+	if !bytes.Equal(constr1.Serialize(), constr2.Serialize()) {
+		t.Fatalf("Precomputed construction serializes differently than original!")
+	}
+}
+
+func TestGenerateKeysCtx(t *testing.T) {
+	opts := common.IndependentMasks{common.RandomMask, common.RandomMask}
+
+	calls, last := 0, 0
+	constr, inputMask, outputMask, err := GenerateEncryptionKeysCtx(
+		context.Background(), key, seed, opts, func(done, total int) { calls, last = calls+1, total },
+	)
+	if err != nil {
+		t.Fatal(err)
+	} else if calls == 0 || calls != last {
+		t.Fatalf("Progress was reported %v times, for %v tables!", calls, last)
+	}
+
+	cand, real := make([]byte, 16), make([]byte, 16)
+
+	copy(cand, input)
+	MaskInput(inputMask, cand)
+	constr.Encrypt(cand, cand)
+	UnmaskOutput(outputMask, cand)
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, _, _, err = GenerateEncryptionKeysCtx(ctx, key, seed, opts, func(done, total int) { cancel() })
+	if err != context.Canceled {
+		t.Fatalf("Cancelled key generation returned %v!", err)
+	}
+}
+
+func TestNewCipher(t *testing.T) {
+	c, _ := aes.NewCipher(key)
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	// Without options, the block is a drop-in for crypto/aes.
+	block, _, err := NewCipher(key, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Encrypt(real, input)
+	block.Encrypt(cand, input)
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	block, _, err = NewDecipher(key, seed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Decrypt(real, input)
+	block.Decrypt(cand, input)
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	// With masks, the block computes AES under the returned encodings.
+	block, encodings, err := NewCipher(key, seed, WithMasks(common.IndependentMasks{common.RandomMask, common.RandomMask}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c.Encrypt(real, input)
+
+	copy(cand, input)
+	MaskInput(encodings.Input, cand)
+	block.Encrypt(cand, cand)
+	UnmaskOutput(encodings.Output, cand)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestEncodingsJSON(t *testing.T) {
+	_, encodings, err := NewCipher(key, seed, WithMasks(common.IndependentMasks{common.RandomAffineMask, common.RandomMask}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	marshaled, err := json.Marshal(encodings)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Contains(marshaled, []byte(`"alg":"GF2-AFFINE-128"`)) {
+		t.Fatalf("Marshaled encodings have no algorithm label! %s", marshaled[:64])
+	}
+
+	cand := Encodings{}
+	if err := json.Unmarshal(marshaled, &cand); err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(SerializeMask(cand.Input), SerializeMask(encodings.Input)) {
+		t.Fatalf("Unmarshaled input encoding disagrees!")
+	} else if !bytes.Equal(SerializeMask(cand.Output), SerializeMask(encodings.Output)) {
+		t.Fatalf("Unmarshaled output encoding disagrees!")
+	}
+
+	if err := json.Unmarshal([]byte(`{"input": {"alg": "GF2-AFFINE-128"}}`), &cand); err == nil {
+		t.Fatalf("Unmarshaled encodings that are missing!")
+	}
+}
+
+func TestNewCipherValidation(t *testing.T) {
+	invalid := []struct {
+		key, seed []byte
+		opts      []Option
+	}{
+		{key[:15], seed, nil},
+		{key, seed[:8], nil},
+		{key, seed, []Option{WithMasks(nil)}},
+		{key, seed, []Option{WithMasks(common.IndependentMasks{common.RandomMask, nil})}},
+		{key, seed, []Option{WithMasks(common.IndependentMasks{common.SpecifiedMask{}, common.RandomMask})}},
+		{key, seed, []Option{WithOpts(Opts{Masks: common.MatchingMasks{}, DummyRounds: 3})}},
+		{key, seed, []Option{WithOpts(Opts{Masks: common.MatchingMasks{}, Watermark: make([]byte, MaxWatermark+1)})}},
+		{key, seed, []Option{WithOpts(Opts{Masks: common.MatchingMasks{}, Device: &DeviceBinding{}})}},
+	}
+
+	for i, test := range invalid {
+		if block, encodings, err := NewCipher(test.key, test.seed, test.opts...); err == nil {
+			t.Fatalf("Invalid arguments %v were accepted!", i)
+		} else if block != nil || encodings != nil {
+			t.Fatalf("Invalid arguments %v returned a cipher!", i)
+		}
+	}
+
+	// Naked constructions ignore their masks.
+	if _, _, err := NewCipher(key, seed, WithOpts(Opts{Naked: true})); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSharedOptions(t *testing.T) {
+	opts := common.NewOptions(
+		common.WithInputMask(common.RandomMask), common.WithOutputMask(common.RandomMask), common.WithDummyRounds(4),
+	)
+
+	constr, inputMask, outputMask := GenerateEncryptionKeys(key, seed, opts)
+	if constr.Rounds() != 14 {
+		t.Fatalf("Construction has the wrong number of rounds! %v != 14", constr.Rounds())
+	}
+
+	c, _ := aes.NewCipher(key)
+	real, cand := make([]byte, 16), make([]byte, 16)
+	c.Encrypt(real, input)
+
+	copy(cand, input)
+	MaskInput(inputMask, cand)
+	constr.Encrypt(cand, cand)
+	UnmaskOutput(outputMask, cand)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	// Without nonlinear encodings, the XOR tables compute a plain XOR.
+	constr, _, _ = GenerateEncryptionKeys(key, seed, common.NewOptions(common.WithNonlinearEncodings(false)))
+	if x := constr.HighXORTable[0][0][0].Get(0x35); x != 0x06 {
+		t.Fatalf("XOR table is encoded! %x != 06", x)
+	}
+
+	// NewCipher reads its seed from the RNG.
+	a, _, err := NewCipher(key, nil, Shared(common.WithRNG(bytes.NewReader(make([]byte, common.SeedSize)))))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, _, err := NewCipher(key, make([]byte, common.SeedSize))
+	if err != nil {
+		t.Fatal(err)
+	} else if !a.(*Construction).Equal(b.(*Construction)) {
+		t.Fatalf("Seed wasn't read from the RNG!")
+	}
+
+	if _, _, err := NewCipher(key, nil, Shared(common.WithRNG(bytes.NewReader(nil)))); err == nil {
+		t.Fatalf("Reading from an exhausted RNG succeeded!")
+	}
+}
+
+func TestEncryptAllocations(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	serialized := constr1.Serialize()
+	constr2, err := Parse(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	constr3, err := ParseReaderAt(bytes.NewReader(serialized), int64(len(serialized)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := make([]byte, 16)
+	allocs := testing.AllocsPerRun(100, func() {
+		constr2.Encrypt(out, input)
+		constr2.Decrypt(out, out)
+	})
+
+	if allocs != 0 {
+		t.Fatalf("Encrypt and Decrypt allocated! %v allocations per run", allocs)
+	}
+
+	allocs = testing.AllocsPerRun(100, func() { constr3.Encrypt(out, input) })
+	if allocs != 0 {
+		t.Fatalf("Lazily parsed Encrypt allocated! %v allocations per run", allocs)
+	}
+}
+
+func TestEncrypter(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	constr2, err := Parse(constr1.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src := make([]byte, 16*8)
+	for i := range src {
+		src[i] = byte(i)
+	}
+
+	real, cand := make([]byte, len(src)), make([]byte, len(src))
+	constr2.EncryptBlocks(real, src)
+
+	e := constr2.NewEncrypter()
+	e.EncryptBlocks(cand, src)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	} else if e.Blocks != 8 {
+		t.Fatalf("Encrypter counted the wrong number of blocks! %v != 8", e.Blocks)
+	}
+
+	out := make([]byte, 16)
+	allocs := testing.AllocsPerRun(100, func() { e.Encrypt(out, input) })
+	if allocs != 0 {
+		t.Fatalf("Encrypter allocated! %v allocations per run", allocs)
+	}
+}
+
+func TestConstantTime(t *testing.T) {
+	opts := Opts{Masks: common.IndependentMasks{common.RandomMask, common.RandomMask}, DummyRounds: 4, ShuffleRounds: true}
+	encrypt, decrypt, _, _ := GenerateKeyPair(key, seed, opts)
+
+	constr, err := Parse(encrypt.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctEncrypt, ctDecrypt := constr.NewConstantTime(), decrypt.NewConstantTime()
+	constr.Destroy()
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+	encrypt.Encrypt(real, input)
+	ctEncrypt.Encrypt(cand, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	ctDecrypt.Decrypt(cand, cand)
+	if !bytes.Equal(input, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", input, cand)
+	}
+
+	allocs := testing.AllocsPerRun(10, func() { ctEncrypt.Encrypt(cand, input) })
+	if allocs != 0 {
+		t.Fatalf("ConstantTime allocated! %v allocations per run", allocs)
+	}
+}
+
+// TestConcurrentEncrypt shares one construction between many goroutines. Run with -race to check that they don't
+// interfere.
+func TestConcurrentEncrypt(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	constr2, err := Parse(constr1.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	real := make([]byte, 16)
+	constr2.Encrypt(real, input)
+
+	var wg sync.WaitGroup
+	errs := make(chan string, 16)
+
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			cand := make([]byte, 16)
+			for j := 0; j < 100; j++ {
+				constr2.Encrypt(cand, input)
+
+				if !bytes.Equal(real, cand) {
+					errs <- fmt.Sprintf("Real disagrees with result! %x != %x", real, cand)
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	if msg, ok := <-errs; ok {
+		t.Fatal(msg)
+	}
+}
+
+func BenchmarkGenerateEncryptionKeys(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		constr, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+		constr.Serialize()
+	}
+}
+
+// A "Live" Encryption is one based on table abstractions, so many computations are performed on-demand.
+func BenchmarkPrecompute(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		constr, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+		b.StartTimer()
+
+		constr.Precompute(0)
+	}
+}
+
+func BenchmarkLiveEncrypt(b *testing.B) {
+	constr, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	out := make([]byte, 16)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		constr.Encrypt(out, input)
+	}
+}
+
+// A "Dead" Encryption is one based on serialized tables, like we'd have in a real use case.
+func BenchmarkDeadEncrypt(b *testing.B) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	serialized := constr1.Serialize()
+	constr2, _ := Parse(serialized)
+
+	out := make([]byte, 16)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		constr2.Encrypt(out, input)
+	}
+}
+
+func BenchmarkDeadEncryptPacked(b *testing.B) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	serialized := constr1.Serialize()
+	constr2, _ := Parse(serialized)
+	constr2.Pack()
+
+	out := make([]byte, 16)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		constr2.Encrypt(out, input)
+	}
+}
+
+func BenchmarkDeadEncryptWide(b *testing.B) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	serialized := constr1.Serialize()
+	constr2, _ := Parse(serialized)
+	constr2.WidenXORTables()
+
+	out := make([]byte, 16)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		constr2.Encrypt(out, input)
+	}
+}
+
+func BenchmarkDeadEncryptUnpacked(b *testing.B) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	serialized := constr1.Serialize()
+	constr2, _ := Parse(serialized)
+	constr2.UnpackXORTables()
+
+	out := make([]byte, 16)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		constr2.Encrypt(out, input)
+	}
+}
+
+// BenchmarkSquashWords and BenchmarkSquashWordsUnpacked compare the XOR networks of one column of one round on their
+// own, without the rest of the round.
+func BenchmarkSquashWords(b *testing.B) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+	constr2, _ := Parse(constr1.Serialize())
+
+	word, out := [4][4]byte{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}, {13, 14, 15, 16}}, make([]byte, 4)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		constr2.SquashWords(constr2.HighXORTable[0][0:8], word, out)
+	}
+}
+
+func BenchmarkSquashWordsUnpacked(b *testing.B) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+	constr2, _ := Parse(constr1.Serialize())
+	constr2.UnpackXORTables()
+
+	word, out := [4][4]byte{{1, 2, 3, 4}, {5, 6, 7, 8}, {9, 10, 11, 12}, {13, 14, 15, 16}}, make([]byte, 4)
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		squashWord(&constr2.unpacked.high[0], 0, word, out)
+	}
+}
+
+func BenchmarkConstantTimeEncrypt(b *testing.B) {
+	constr, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+	ct := constr.NewConstantTime()
+
+	out := make([]byte, 16)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		ct.Encrypt(out, input)
+	}
+}
+
+// BenchmarkEncryptParallel encrypts with one construction shared between GOMAXPROCS goroutines, like a server handling
+// many streams at once with the same key.
+func BenchmarkEncryptParallel(b *testing.B) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	serialized := constr1.Serialize()
+	constr2, _ := Parse(serialized)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		out := make([]byte, 16)
+
+		for pb.Next() {
+			constr2.Encrypt(out, input)
+		}
+	})
+}
+
+func BenchmarkDeadEncryptBlocks(b *testing.B) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	serialized := constr1.Serialize()
+	constr2, _ := Parse(serialized)
+
+	buf := make([]byte, 16*1024)
+
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		constr2.EncryptBlocks(buf, buf)
+	}
+}
+
+// TestReproducible checks that a construction can be regenerated exactly from its seed. The stream labels of key
+// generation are part of the serialization format (see common.Label), so this digest must never change.
+func TestReproducible(t *testing.T) {
+	constr, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomAffineMask, common.RandomMask})
+
+	real := "7dfd6e514c4ced20529d988ff9928c329f4a853678920959d86f1dfae28b6cf6"
+	if cand := fmt.Sprintf("%x", sha256.Sum256(constr.Serialize())); real != cand {
+		t.Fatalf("Real disagrees with result! %v != %v", real, cand)
+	}
+}
+
+func TestTracedConstruction(t *testing.T) {
+	constr, _, _ := GenerateEncryptionKeys(key, seed, Opts{
+		Masks: common.IndependentMasks{common.RandomMask, common.RandomMask}, DummyRounds: 4, ShuffleRounds: true,
+	})
+	traced := NewTracedConstruction(&constr)
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+	constr.Encrypt(real, input)
+	traced.Encrypt(cand, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	// 16 lookups in each mask, 15 XORs of 32 nibbles after each, and 2 lookups of 16 words and 96 XORs in every round.
+	trace := traced.Trace()
+	if len(trace) != 2*(16+15*32)+len(constr.TBoxTyiTable)*2*(16+96) {
+		t.Fatalf("Trace has the wrong length! %v", len(trace))
+	} else if first := trace[16+15*32]; first.Table != (TableID{TBoxTyiTable, 0, 0, 0}) {
+		t.Fatalf("Trace doesn't start the middle rounds with the first T-Box! %v", first.Table)
+	}
+
+	parsed, err := ParseTrace(trace.Serialize())
+	if err != nil {
+		t.Fatal(err)
+	} else if len(parsed) != len(trace) {
+		t.Fatalf("Parsed trace has the wrong length! %v != %v", len(parsed), len(trace))
+	}
+	for i := range trace {
+		if parsed[i] != trace[i] {
+			t.Fatalf("Parsed trace disagrees with trace at lookup %v! %v != %v", i, parsed[i], trace[i])
+		}
+	}
+
+	if _, err := ParseTrace(trace.Serialize()[:5]); err == nil {
+		t.Fatalf("Truncated trace was parsed!")
+	}
+
+	traced.Encrypt(cand, input)
+	if len(traced.Trace()) != len(trace) {
+		t.Fatalf("Trace wasn't reset between encryptions!")
+	}
+}
+
+func TestGraph(t *testing.T) {
+	constr, _, _ := GenerateEncryptionKeys(key, seed, Opts{
+		Masks: common.IndependentMasks{common.RandomMask, common.RandomMask}, DummyRounds: 4, ShuffleRounds: true,
+	})
+
+	for _, wide := range []bool{false, true} {
+		if wide {
+			constr.WidenXORTables()
+		}
+
+		traced := NewTracedConstruction(&constr)
+		traced.Encrypt(make([]byte, 16), input)
+		trace := traced.Trace()
+
+		// The nodes between the bytes of the input and output are the tables, in the order they're looked up.
+		g := constr.Graph(false)
+		if len(g.Nodes) != len(trace)+32 {
+			t.Fatalf("Graph has the wrong number of nodes! %v != %v", len(g.Nodes), len(trace)+32)
+		}
+		for i, l := range trace {
+			if g.Nodes[16+i] != l.Table {
+				t.Fatalf("Graph disagrees with trace at lookup %v! %v != %v", i, g.Nodes[16+i], l.Table)
+			}
+		}
+
+		// Every XOR table has two wires in. Tables that read a byte of the state have one wire in from each of the two
+		// tables that wrote its nibbles, or one from a mask or wide XOR table that wrote both.
+		rounds := len(constr.TBoxTyiTable)
+		wires := (16 + 2*15*32) + rounds*2*(32+2*96) + (32 + 2*15*32 + 32)
+		if wide {
+			// The first round still reads nibbles written by the input XOR tables.
+			wires = (16 + 2*15*32) + 16 + rounds*2*(16+2*48) + (16 + 2*15*32 + 32)
+		}
+		if len(g.Wires) != wires {
+			t.Fatalf("Graph has the wrong number of wires! %v != %v", len(g.Wires), wires)
+		}
+	}
+
+	// ShiftRows moves byte 5 of the state to position 1 before the first round, and the inverse moves byte 13.
+	for decrypt, src := range map[bool]int{false: 5, true: 13} {
+		g, to := constr.Graph(decrypt), TableID{TBoxTyiTable, 0, 1, 0}
+
+		real := []TableID{{InputXORTable, 0, byte(2 * src), 14}, {InputXORTable, 0, byte(2*src + 1), 14}}
+		cand := []TableID{}
+		for _, wire := range g.Wires {
+			if wire.To == to {
+				cand = append(cand, wire.From)
+			}
+		}
+
+		if fmt.Sprint(real) != fmt.Sprint(cand) {
+			t.Fatalf("Real disagrees with result! %v != %v", real, cand)
+		}
+	}
+
+	g := constr.Graph(false)
+
+	dot := &bytes.Buffer{}
+	if err := g.WriteDOT(dot); err != nil {
+		t.Fatal(err)
+	} else if !strings.HasPrefix(dot.String(), "digraph") {
+		t.Fatalf("DOT output doesn't start with a digraph!")
+	} else if !strings.Contains(dot.String(), `"InputMask[3]" -> "InputXORTables[7][2]";`) {
+		t.Fatalf("DOT output is missing a wire!")
+	}
+
+	js := &bytes.Buffer{}
+	if err := g.WriteJSON(js); err != nil {
+		t.Fatal(err)
+	}
+
+	var parsed struct {
+		Nodes []string
+		Wires []struct{ From, To string }
+	}
+	if err := json.Unmarshal(js.Bytes(), &parsed); err != nil {
+		t.Fatal(err)
+	} else if len(parsed.Nodes) != len(g.Nodes) || len(parsed.Wires) != len(g.Wires) {
+		t.Fatalf("JSON output has the wrong size! %v, %v", len(parsed.Nodes), len(parsed.Wires))
+	} else if parsed.Wires[0].From != "Input[0]" || parsed.Wires[0].To != "InputMask[0]" {
+		t.Fatalf("JSON output has the wrong first wire! %v", parsed.Wires[0])
+	}
+}
+
+// fuzzKey is the serialized construction that the fuzz targets corrupt. Its rounds are shuffled, so that the round order
+// gets parsed too.
+func fuzzKey() []byte {
+	constr, _, _ := GenerateEncryptionKeys(key, seed, Opts{Masks: common.SameMasks(common.IdentityMask), ShuffleRounds: true})
+	return constr.Serialize()
+}
+
+func FuzzParse(f *testing.F) {
+	serialized := fuzzKey()
+
+	f.Add([]byte{})
+	f.Add(serialized[:common.HeaderSize])
+	f.Add(serialized[:common.HeaderSize+20])
+	f.Add(serialized[:1000])
+
+	f.Fuzz(func(t *testing.T, in []byte) {
+		if constr, err := Parse(in); err == nil {
+			constr.Encrypt(make([]byte, 16), input)
+		}
+
+		if constr, err := ReadConstruction(bytes.NewReader(in)); err == nil {
+			constr.Encrypt(make([]byte, 16), input)
+		}
+	})
+}
+
+// FuzzCorrupt overwrites part of a valid key with arbitrary bytes, and possibly cuts it short. Whatever tables come out
+// of that, parsing must fail cleanly or give a construction that can be evaluated without panicking.
+func FuzzCorrupt(f *testing.F) {
+	serialized := fuzzKey()
+
+	f.Add(uint32(0), []byte{0xff}, uint32(0), input)
+	f.Add(uint32(8), []byte{0x00, 0x00}, uint32(0), input)
+	f.Add(uint32(20), []byte{0xff, 0xff, 0xff}, uint32(0), input)
+	f.Add(uint32(5000), []byte{0xff}, uint32(0), input)
+	f.Add(uint32(0), []byte{}, uint32(100), input)
+
+	f.Fuzz(func(t *testing.T, offset uint32, patch []byte, cut uint32, block []byte) {
+		in := append([]byte{}, serialized...)
+		copy(in[int(offset)%len(in):], patch)
+		in = in[:len(in)-int(cut)%len(in)]
+
+		if len(block) < 16 {
+			block = append(block, make([]byte, 16-len(block))...)
+		}
+		dst := make([]byte, 16)
+
+		if constr, err := Parse(in); err == nil {
+			constr.Encrypt(dst, block)
+			constr.Decrypt(dst, block)
+		}
+
+		if constr, err := ReadConstruction(bytes.NewReader(in)); err == nil {
+			constr.Encrypt(dst, block)
+		}
+
+		if constr, err := ParseReaderAt(bytes.NewReader(in), int64(len(in))); err == nil {
+			constr.Encrypt(dst, block)
+		}
+	})
 }
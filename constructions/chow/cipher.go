@@ -0,0 +1,201 @@
+package chow
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// Encodings are the external encodings of a construction from NewCipher or NewDecipher: it computes
+// Output(AES(Input(x))). With the default options, both are the identity.
+type Encodings struct {
+	Input, Output encoding.BlockAffine
+}
+
+// MarshalJSON encodes the encodings as a common.EncodingsDescriptor, the documented format for handing them to code in
+// other languages.
+func (e Encodings) MarshalJSON() ([]byte, error) {
+	return json.Marshal(common.DescribeEncodings(e.Input, e.Output))
+}
+
+// UnmarshalJSON decodes encodings marshaled by MarshalJSON, or any common.EncodingsDescriptor.
+func (e *Encodings) UnmarshalJSON(in []byte) error {
+	desc := common.EncodingsDescriptor{}
+	if err := json.Unmarshal(in, &desc); err != nil {
+		return err
+	}
+
+	input, output, err := desc.Affine()
+	if err != nil {
+		return err
+	}
+	e.Input, e.Output = input, output
+
+	return nil
+}
+
+// Option is a setting for NewCipher and NewDecipher. Options are applied in order, starting from identity masks and no
+// hardening.
+type Option func(*settings)
+
+// settings are the options of NewCipher and NewDecipher: the Opts passed to key generation, and where a seed is read
+// from if none is given.
+type settings struct {
+	opts Opts
+	rng  io.Reader
+}
+
+// WithMasks sets the input and output masks, which should be in common.{IndependentMasks, SameMasks, MatchingMasks}.
+func WithMasks(masks common.KeyGenerationOpts) Option {
+	return func(s *settings) { s.opts.Masks = masks }
+}
+
+// WithOpts replaces every hardening option, masks included, with opts.
+func WithOpts(opts Opts) Option {
+	return func(s *settings) { s.opts = opts }
+}
+
+// Shared applies the settings shared by every construction (see common.Options), like
+// Shared(common.WithInputMask(common.RandomMask), common.WithDummyRounds(4)). Settings that aren't given take their
+// defaults, so the masks, nonlinear encodings, and dummy rounds set by earlier options are replaced. The hardening
+// options that aren't shared are kept.
+func Shared(opts ...common.Option) Option {
+	shared := common.NewOptions(opts...)
+	hardening := FromOptions(shared)
+
+	return func(s *settings) {
+		s.opts.Masks, s.opts.DummyRounds = hardening.Masks, hardening.DummyRounds
+		s.opts.LinearEncodings, s.rng = hardening.LinearEncodings, shared.RNG
+	}
+}
+
+// NewCipher creates a white-boxed version of AES with the given key for encryption, like GenerateEncryptionKeys, but
+// checks its arguments first and returns an error instead of panicking or generating a broken construction. The key
+// must be 16, 24, or 32 bytes long, and the seed at least 16, or nil to read a fresh one from the RNG set with
+// common.WithRNG (crypto/rand by default). The construction's Decrypt doesn't undo Encrypt: white-boxes only compute
+// one direction, so decryption needs a construction from NewDecipher.
+//
+// Without options, the construction has no masks, so the returned block computes exactly AES and can stand in for one
+// from crypto/aes.
+func NewCipher(key, seed []byte, opts ...Option) (cipher.Block, *Encodings, error) {
+	return newCipher(key, seed, false, opts)
+}
+
+// NewDecipher is like NewCipher, but creates a construction for decryption, like GenerateDecryptionKeys. Its Encrypt
+// doesn't undo Decrypt.
+func NewDecipher(key, seed []byte, opts ...Option) (cipher.Block, *Encodings, error) {
+	return newCipher(key, seed, true, opts)
+}
+
+func newCipher(key, seed []byte, decrypt bool, opts []Option) (cipher.Block, *Encodings, error) {
+	s := settings{opts: Opts{Masks: common.SameMasks(common.IdentityMask)}, rng: rand.Reader}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	hardening := s.opts
+
+	if seed == nil {
+		var err error
+		if seed, err = common.ReadSeed(s.rng); err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := validate(key, seed, hardening); err != nil {
+		return nil, nil, err
+	}
+
+	generate := GenerateEncryptionKeys
+	if decrypt {
+		generate = GenerateDecryptionKeys
+	}
+
+	constr, inputMask, outputMask := generate(key, seed, hardening)
+	if err := selfTest(&constr, key, decrypt, hardening, inputMask, outputMask); err != nil {
+		return nil, nil, err
+	}
+
+	return &constr, &Encodings{inputMask, outputMask}, nil
+}
+
+// validate returns an error if key generation would panic or misbehave on the given arguments.
+func validate(key, seed []byte, opts Opts) error {
+	rounds := 0
+	switch len(key) {
+	case 16, 24, 32:
+		rounds = len(key)/4 + 6
+	default:
+		return errors.New("Key must be 16, 24, or 32 bytes long!")
+	}
+
+	if len(seed) < 16 {
+		return errors.New("Seed must be at least 16 bytes long!")
+	}
+
+	if !opts.Naked {
+		masks := opts.Masks
+		if shared, ok := masks.(common.Options); ok {
+			masks = shared.Masks()
+		}
+
+		switch masks := masks.(type) {
+		case common.IndependentMasks:
+			if err := validateMask(masks.Input); err != nil {
+				return err
+			} else if err := validateMask(masks.Output); err != nil {
+				return err
+			}
+		case common.SameMasks, common.MatchingMasks:
+		default:
+			return errors.New("Unrecognized mask options!")
+		}
+	}
+
+	if opts.DummyRounds < 0 || opts.DummyRounds%4 != 0 {
+		return errors.New("Dummy rounds must come in groups of four!")
+	} else if rounds+opts.DummyRounds > 255 {
+		return errors.New("Too many dummy rounds!")
+	}
+
+	if len(opts.Watermark) > MaxWatermark {
+		return errors.New("Watermark is too long!")
+	}
+
+	if opts.Device != nil && len(opts.Device.Fingerprint) == 0 {
+		return errors.New("Device has no fingerprint!")
+	}
+
+	return nil
+}
+
+// validateMask returns an error if mask can't be used as an input or output mask.
+func validateMask(mask common.Mask) error {
+	switch mask := mask.(type) {
+	case nil:
+		return errors.New("Mask is missing!")
+	case common.SpecifiedMask:
+		if h, w := mask.Linear.Size(); h != 128 || w != 128 {
+			return errors.New("Mask is the wrong size!")
+		} else if _, ok := mask.Linear.Invert(); !ok {
+			return errors.New("Mask isn't invertible!")
+		}
+	case *common.ChainedMasks:
+		if len(mask.Parties) == 0 {
+			return errors.New("Chained mask has no parties!")
+		}
+
+		for _, party := range mask.Parties {
+			if err := validateMask(party); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,42 @@
+package chow
+
+import (
+	"bytes"
+	"crypto/rand"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+)
+
+// Equal returns whether constr and other have the same tables, stored in the same order. Metadata is ignored, as it is by
+// Fingerprint.
+func (constr *Construction) Equal(other *Construction) bool {
+	return constr.Fingerprint() == other.Fingerprint()
+}
+
+// Compatible returns whether the encryption construction encrypt and the decryption construction decrypt compute
+// inverse functions of the same AES key, once the given external masks are removed. It's checked on n random blocks:
+// each is encrypted and unmasked, then masked again and decrypted, and must come back unchanged.
+//
+// The masks are the ones returned by key generation for each construction.
+func Compatible(encrypt, decrypt *Construction, encInput, encOutput, decInput, decOutput encoding.Block, n int) bool {
+	in, block := make([]byte, 16), make([]byte, 16)
+
+	for i := 0; i < n; i++ {
+		rand.Read(in)
+		copy(block, in)
+
+		MaskInput(encInput, block)
+		encrypt.Encrypt(block, block)
+		UnmaskOutput(encOutput, block)
+
+		MaskInput(decInput, block)
+		decrypt.Decrypt(block, block)
+		UnmaskOutput(decOutput, block)
+
+		if !bytes.Equal(in, block) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,453 @@
+package chow
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"errors"
+	"io"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// SerializeCompressed is Serialize, but flags the header and compresses everything after it, for shipping keys where
+// every byte counts, like in mobile apps. Parse, ReadConstruction, and common.Load decompress keys transparently.
+// ParseReaderAt reads tables in place, so it can't.
+//
+// The encodings leave nothing for a general-purpose compressor to find in the bytes of the tables, but most tables are
+// far from random as functions: every output nibble of an XOR table, of a mask's block tables, and of an MB^(-1) table is
+// some nibble bijection of the XOR of functions of its two input nibbles. Each such nibble is stored as those three
+// functions, put in a canonical form that depends only on the table, which takes 24 bytes instead of 128 and reveals
+// nothing that the table doesn't. Only the T-Box/Tyi tables, with the S-boxes inside them, are stored as they are. The
+// result is then compressed with zlib, whose checksum catches corrupted keys. An AES-128 key with random masks shrinks
+// from 770KB to about 320KB.
+func (constr *Construction) SerializeCompressed() []byte {
+	buff := &bytes.Buffer{}
+	constr.WriteToCompressed(buff)
+
+	return buff.Bytes()
+}
+
+// WriteToCompressed writes the same output as SerializeCompressed to w. The tables are compressed in memory first.
+func (constr *Construction) WriteToCompressed(w io.Writer) (int64, error) {
+	body := &bytes.Buffer{}
+	fw, _ := zlib.NewWriterLevel(body, flate.BestCompression) // Only fails on an invalid level.
+
+	tw := &common.StreamWriter{W: canonicalWriter{fw}}
+	constr.writeTables(tw)
+	if tw.Err != nil {
+		return 0, tw.Err
+	} else if err := fw.Close(); err != nil {
+		return 0, err
+	}
+
+	h := constr.header()
+	h.Compressed = true
+
+	sw := &common.StreamWriter{W: w}
+	sw.WriteHeader(h)
+	sw.Write(body.Bytes())
+
+	return sw.N, sw.Err
+}
+
+// Kinds of records in the stream of tables that's compressed. Each record is one write of writeTables: either raw bytes,
+// prefixed by their length, or a table of 256 entries of the given width, one nibble function at a time.
+const (
+	recordRaw    = iota
+	recordNibble // A nibble table: 256 entries of half a byte.
+	recordWord   // 256 entries of 4 bytes.
+	recordBlock  // 256 entries of 16 bytes.
+)
+
+// Ways a nibble function is stored.
+const (
+	functionRaw       = iota // 256 nibbles, packed two to a byte.
+	functionCanonical        // The canonical form from canonicalize.
+)
+
+// recordSizes is the size of a table of each kind of record, and recordFunctions is its number of nibble functions.
+var (
+	recordSizes     = [...]int{recordNibble: 128, recordWord: 1024, recordBlock: 4096}
+	recordFunctions = [...]int{recordNibble: 1, recordWord: 8, recordBlock: 32}
+)
+
+// nibbleFunction is a function from bytes to nibbles, like one output nibble of a table.
+type nibbleFunction [256]byte
+
+// getFunction returns the i-th nibble function of a table of the given kind: the nibble table itself, or the high (even
+// i) or low (odd i) nibble of byte i/2 of every entry.
+func getFunction(t []byte, kind, i int) (f nibbleFunction) {
+	if kind == recordNibble {
+		for x := 0; x < 256; x += 2 {
+			f[x], f[x+1] = t[x/2]>>4, t[x/2]&0x0f
+		}
+
+		return
+	}
+
+	width := recordSizes[kind] / 256
+	for x := range f {
+		if i%2 == 0 {
+			f[x] = t[width*x+i/2] >> 4
+		} else {
+			f[x] = t[width*x+i/2] & 0x0f
+		}
+	}
+
+	return
+}
+
+// setFunction is the inverse of getFunction: it writes f into the i-th nibble function of t.
+func setFunction(t []byte, kind, i int, f *nibbleFunction) {
+	if kind == recordNibble {
+		for x := 0; x < 256; x += 2 {
+			t[x/2] = f[x]<<4 | f[x+1]
+		}
+
+		return
+	}
+
+	width := recordSizes[kind] / 256
+	for x := range f {
+		if i%2 == 0 {
+			t[width*x+i/2] = t[width*x+i/2]&0x0f | f[x]<<4
+		} else {
+			t[width*x+i/2] = t[width*x+i/2]&0xf0 | f[x]
+		}
+	}
+}
+
+// packNibbles packs nibbles two to a byte, high nibble first.
+func packNibbles(in []byte) []byte {
+	out := make([]byte, len(in)/2)
+	for i := range out {
+		out[i] = in[2*i]<<4 | in[2*i+1]
+	}
+
+	return out
+}
+
+// unpackNibbles is the inverse of packNibbles.
+func unpackNibbles(in []byte) []byte {
+	out := make([]byte, 2*len(in))
+	for i, b := range in {
+		out[2*i], out[2*i+1] = b>>4, b&0x0f
+	}
+
+	return out
+}
+
+// canonicalize finds u, v, and p with f(h<<4|l) = p[u[h] ^ v[l]] for every pair of nibbles h and l, and returns them
+// packed into 24 bytes. It returns false if f doesn't have that form, or if no form was found.
+//
+// Such a triple is unique up to a linear map on the nibbles between u, v, and p, and canonicalize picks it by solving for
+// the map from f's values to those nibbles, psi: psi(f(h<<4|l)) = psi(f(h<<4)) ^ psi(f(l)) for every h and l. These
+// equations are linear, so psi's four bits are a basis of their solutions; then u[h] = psi(f(h<<4)), v[l] = psi(f(l)),
+// and p inverts psi. The result is computed from f alone, and determines f, so it holds exactly what f does.
+func canonicalize(f *nibbleFunction) ([]byte, bool) {
+	// The values f takes, and the equations psi satisfies over them, one bit per value.
+	var used uint16
+	for _, y := range f {
+		used |= 1 << y
+	}
+
+	var rows [16]uint16 // rows[i] is zero or the equation whose highest set bit is i.
+	for x, y := range f {
+		eq := uint16(1)<<y ^ uint16(1)<<f[x&0xf0] ^ uint16(1)<<f[x&0x0f]
+
+		for i := 15; i >= 0 && eq != 0; i-- {
+			if eq>>uint(i)&1 == 0 {
+				continue
+			} else if rows[i] == 0 {
+				rows[i] = eq
+				break
+			}
+			eq ^= rows[i]
+		}
+	}
+
+	// Reduce the equations, and read a basis of their solutions off the values without one: setting one of them to 1
+	// and the rest to 0 fixes every other value of psi's bit.
+	for i := 0; i < 16; i++ {
+		for j := i + 1; j < 16; j++ {
+			if rows[i] != 0 && rows[j]>>uint(i)&1 == 1 {
+				rows[j] ^= rows[i]
+			}
+		}
+	}
+
+	var basis []uint16
+	for free := 0; free < 16; free++ {
+		if rows[free] != 0 || used>>uint(free)&1 == 0 {
+			continue
+		}
+
+		solution := uint16(1) << uint(free)
+		for i, row := range rows {
+			if row != 0 && row>>uint(free)&1 == 1 {
+				solution |= 1 << uint(i)
+			}
+		}
+		basis = append(basis, solution&used)
+	}
+	if len(basis) > 8 {
+		return nil, false
+	} else if len(basis) > 4 {
+		basis = narrow(basis, used)
+	}
+
+	var psi [16]byte
+	for bit, solution := range basis {
+		for y := range psi {
+			psi[y] |= byte(solution>>uint(y)&1) << uint(bit)
+		}
+	}
+
+	var u, v, p [16]byte
+	for i := 0; i < 16; i++ {
+		u[i], v[i] = psi[f[i<<4]], psi[f[i]]
+	}
+	for y := 15; y >= 0; y-- {
+		if used>>uint(y)&1 == 1 {
+			p[psi[y]] = byte(y)
+		}
+	}
+
+	for x, y := range f {
+		if p[u[x>>4]^v[x&0x0f]] != y {
+			return nil, false
+		}
+	}
+
+	return packNibbles(append(append(u[:], v[:]...), p[:]...)), true
+}
+
+// narrow picks four of the solutions spanned by basis, for when f's values are too few to pin psi down to four bits. Any
+// four that tell all of f's values apart will do, so it searches the combinations of the basis for them, backtracking
+// whenever more of f's values look alike than the bits left can tell apart. It returns basis if there are none.
+func narrow(basis []uint16, used uint16) []uint16 {
+	solutions := make([]uint16, 0, 1<<uint(len(basis)))
+	for combo := 1; combo < 1<<uint(len(basis)); combo++ {
+		var solution uint16
+		for i, b := range basis {
+			if combo>>uint(i)&1 == 1 {
+				solution ^= b
+			}
+		}
+		solutions = append(solutions, solution)
+	}
+
+	out := make([]uint16, 0, 4)
+
+	var search func(start int, psi [16]byte) bool
+	search = func(start int, psi [16]byte) bool {
+		bit := uint(len(out))
+		if bit == 4 {
+			return true
+		}
+
+		for i := start; i < len(solutions); i++ {
+			next, sizes := psi, [16]int{}
+			for y := range next {
+				if used>>uint(y)&1 == 1 {
+					next[y] |= byte(solutions[i]>>uint(y)&1) << bit
+					sizes[next[y]]++
+				}
+			}
+
+			fits := true
+			for _, size := range sizes {
+				fits = fits && size <= 1<<(3-bit)
+			}
+
+			if out = append(out, solutions[i]); fits && search(i+1, next) {
+				return true
+			}
+			out = out[:bit]
+		}
+
+		return false
+	}
+
+	if search(0, [16]byte{}) {
+		return out
+	}
+	return basis
+}
+
+// uncanonicalize is the inverse of canonicalize.
+func uncanonicalize(in []byte) (f nibbleFunction) {
+	nibbles := unpackNibbles(in)
+	u, v, p := nibbles[0:16], nibbles[16:32], nibbles[32:48]
+
+	for x := range f {
+		f[x] = p[u[x>>4]^v[x&0x0f]]
+	}
+
+	return
+}
+
+// canonicalWriter rewrites every table written to it in canonical form, as a record, and writes the records to W.
+type canonicalWriter struct {
+	W io.Writer
+}
+
+func (cw canonicalWriter) Write(t []byte) (int, error) {
+	kind := recordRaw
+	for k := recordNibble; k <= recordBlock; k++ {
+		if len(t) == recordSizes[k] {
+			kind = k
+		}
+	}
+
+	var out []byte
+	if kind == recordRaw {
+		if len(t) > 255 {
+			return 0, errors.New("Write is too long to compress!")
+		}
+		out = append([]byte{recordRaw, byte(len(t))}, t...)
+	} else {
+		out = []byte{byte(kind)}
+
+		for i := 0; i < recordFunctions[kind]; i++ {
+			f := getFunction(t, kind, i)
+
+			if packed, ok := canonicalize(&f); ok {
+				out = append(append(out, functionCanonical), packed...)
+			} else {
+				out = append(append(out, functionRaw), packNibbles(f[:])...)
+			}
+		}
+	}
+
+	if _, err := cw.W.Write(out); err != nil {
+		return 0, err
+	}
+
+	return len(t), nil
+}
+
+// canonicalReader reads the records written by a canonicalWriter from R, and returns the tables they hold.
+type canonicalReader struct {
+	R    io.Reader
+	buff []byte
+}
+
+func (cr *canonicalReader) Read(p []byte) (int, error) {
+	for len(cr.buff) == 0 {
+		if err := cr.next(); err != nil {
+			return 0, err
+		}
+	}
+
+	n := copy(p, cr.buff)
+	cr.buff = cr.buff[n:]
+
+	return n, nil
+}
+
+// next reads the next record into buff. It returns io.EOF if R ends before it.
+func (cr *canonicalReader) next() error {
+	kind := [1]byte{}
+	if _, err := io.ReadFull(cr.R, kind[:]); err != nil {
+		return err
+	}
+
+	if kind[0] == recordRaw {
+		size := [1]byte{}
+		if _, err := io.ReadFull(cr.R, size[:]); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+
+		cr.buff = make([]byte, size[0])
+		if _, err := io.ReadFull(cr.R, cr.buff); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+
+		return nil
+	} else if kind[0] > recordBlock {
+		return errors.New("Decompressing the key failed!")
+	}
+
+	k := int(kind[0])
+	t := make([]byte, recordSizes[k])
+	packed := make([]byte, 1+128)
+
+	for i := 0; i < recordFunctions[k]; i++ {
+		if _, err := io.ReadFull(cr.R, packed[:1]); err != nil {
+			return io.ErrUnexpectedEOF
+		}
+
+		var f nibbleFunction
+		switch packed[0] {
+		case functionRaw:
+			if _, err := io.ReadFull(cr.R, packed[1:129]); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			copy(f[:], unpackNibbles(packed[1:129]))
+		case functionCanonical:
+			if _, err := io.ReadFull(cr.R, packed[1:25]); err != nil {
+				return io.ErrUnexpectedEOF
+			}
+			f = uncanonicalize(packed[1:25])
+		default:
+			return errors.New("Decompressing the key failed!")
+		}
+
+		setFunction(t, k, i, &f)
+	}
+
+	cr.buff = t
+	return nil
+}
+
+// maxTablesSize is the size of the decompressed tables of a construction with the given number of rounds, if they're
+// shuffled. Decompression stops there, so that a corrupted key can't inflate without bound.
+func maxTablesSize(rounds int) int {
+	return rounds - 1 + fullSize(rounds)
+}
+
+// decompress inflates the compressed tables of a key with the given number of rounds. in must hold exactly one zlib
+// stream.
+func decompress(in []byte, rounds int) ([]byte, error) {
+	br := bytes.NewReader(in)
+	zr, err := zlib.NewReader(br)
+	if err != nil {
+		return nil, errors.New("Decompressing the key failed!")
+	}
+	cr := &canonicalReader{R: zr}
+
+	out, err := io.ReadAll(io.LimitReader(cr, int64(maxTablesSize(rounds)+1)))
+	if err != nil || len(out) > maxTablesSize(rounds) || br.Len() != 0 {
+		return nil, errors.New("Decompressing the key failed!")
+	}
+
+	return out, nil
+}
+
+// byteReader reads one byte at a time, so that the decompressor doesn't read past the end of the construction.
+type byteReader struct {
+	io.Reader
+}
+
+func (br byteReader) ReadByte() (byte, error) {
+	b := [1]byte{}
+	_, err := io.ReadFull(br.Reader, b[:])
+
+	return b[0], err
+}
+
+// newDecompressor returns a reader of the compressed tables at the front of r, which doesn't read anything after them.
+func newDecompressor(r io.Reader) (io.Reader, error) {
+	if _, ok := r.(io.ByteReader); !ok {
+		r = byteReader{r}
+	}
+
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, errors.New("Decompressing the key failed!")
+	}
+
+	return &canonicalReader{R: zr}, nil
+}
@@ -0,0 +1,219 @@
+package chow
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// ConstantTime is a copy of a construction for deployments where the attacker only watches the white-box from the
+// outside, through cache timing or another side-channel, instead of reading its memory. Every lookup reads every entry
+// of its table and keeps the right one with a mask, so neither the time Encrypt and Decrypt take nor the memory they
+// touch depends on the data. There are no branches or indices on secret values, though Go itself promises nothing about
+// timing.
+//
+// The price is that every lookup costs as much as 256 of them: a block takes most of a millisecond instead of about 20
+// microseconds, roughly 35 times as long (compare BenchmarkConstantTimeEncrypt with BenchmarkDeadEncrypt). The copy
+// also holds every table uncompressed, about 1.1MB for AES-128. None of this helps against an attacker who has the
+// white-box itself, who can read the tables directly.
+type ConstantTime struct {
+	inputMask, tBoxOutputMask [16][256][2]uint64
+	inputXOR, outputXOR       [32][15][256]byte
+
+	// The middle tables are stored in the order of the rounds they compute, whatever the construction's RoundOrder.
+	tBoxTyi, mbInverse [][16][256]uint32
+	highXOR, lowXOR    [][32][3][256]byte
+
+	binding *[16][256]byte
+}
+
+// NewConstantTime copies every table of constr into a ConstantTime. A construction bound to a device must be activated
+// first. The copy shares no memory with constr, which may be modified or destroyed afterwards.
+func (constr *Construction) NewConstantTime() *ConstantTime {
+	ct := &ConstantTime{}
+	rounds := len(constr.TBoxTyiTable)
+
+	for pos := 0; pos < 16; pos++ {
+		copyBlock(&ct.inputMask[pos], constr.InputMask[pos])
+		copyBlock(&ct.tBoxOutputMask[pos], constr.TBoxOutputMask[pos])
+	}
+
+	for pos := 0; pos < 32; pos++ {
+		for gate := 0; gate < 15; gate++ {
+			copyNibble(&ct.inputXOR[pos][gate], constr.InputXORTables[pos][gate])
+			copyNibble(&ct.outputXOR[pos][gate], constr.OutputXORTables[pos][gate])
+		}
+	}
+
+	ct.tBoxTyi, ct.mbInverse = make([][16][256]uint32, rounds), make([][16][256]uint32, rounds)
+	ct.highXOR, ct.lowXOR = make([][32][3][256]byte, rounds), make([][32][3][256]byte, rounds)
+
+	for round := 0; round < rounds; round++ {
+		slot := constr.Slot(round)
+
+		for pos := 0; pos < 16; pos++ {
+			copyWord(&ct.tBoxTyi[round][pos], constr.TBoxTyiTable[slot][pos])
+			copyWord(&ct.mbInverse[round][pos], constr.MBInverseTable[slot][pos])
+		}
+
+		for pos := 0; pos < 32; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				copyNibble(&ct.highXOR[round][pos][gate], constr.HighXORTable[slot][pos][gate])
+				copyNibble(&ct.lowXOR[round][pos][gate], constr.LowXORTable[slot][pos][gate])
+			}
+		}
+	}
+
+	if constr.Binding != nil {
+		binding := *constr.Binding
+		ct.binding = &binding
+	}
+
+	return ct
+}
+
+// BlockSize returns the block size of AES. (Necessary to implement cipher.Block.)
+func (ct *ConstantTime) BlockSize() int { return 16 }
+
+// Encrypt encrypts the first block in src into dst, like Construction.Encrypt. Dst and src may point at the same
+// memory.
+func (ct *ConstantTime) Encrypt(dst, src []byte) {
+	ct.crypt(dst, src, (*Construction)(nil).shiftRows)
+}
+
+// Decrypt decrypts the first block in src into dst, like Construction.Decrypt. Dst and src may point at the same
+// memory.
+func (ct *ConstantTime) Decrypt(dst, src []byte) {
+	ct.crypt(dst, src, (*Construction)(nil).unShiftRows)
+}
+
+// crypt is Construction.cryptWith with every lookup replaced by a scan of the whole table. The permutation between
+// rounds moves the same bytes whatever they hold, so it's shared with Construction.
+func (ct *ConstantTime) crypt(dst, src []byte, shift func([]byte)) {
+	copy(dst, src[:ct.BlockSize()])
+
+	squashBlocks(&ct.inputMask, &ct.inputXOR, dst)
+
+	for round := range ct.tBoxTyi {
+		shift(dst)
+
+		if round == 0 && ct.binding != nil {
+			for pos := 0; pos < 16; pos++ {
+				dst[pos] = lookupByte(&ct.binding[pos], dst[pos])
+			}
+		}
+
+		for pos := 0; pos < 16; pos += 4 {
+			word := expandWord(ct.tBoxTyi[round][pos:pos+4], dst[pos:pos+4])
+			squashWords(ct.highXOR[round][2*pos:2*pos+8], word, dst[pos:pos+4])
+
+			word = expandWord(ct.mbInverse[round][pos:pos+4], dst[pos:pos+4])
+			squashWords(ct.lowXOR[round][2*pos:2*pos+8], word, dst[pos:pos+4])
+		}
+	}
+
+	shift(dst)
+
+	squashBlocks(&ct.tBoxOutputMask, &ct.outputXOR, dst)
+}
+
+// expandWord is Construction.ExpandWord.
+func expandWord(t [][256]uint32, word []byte) (out [4]uint32) {
+	for i := 0; i < 4; i++ {
+		out[i] = lookupWord(&t[i], word[i])
+	}
+
+	return
+}
+
+// squashWords is Construction.SquashWords.
+func squashWords(xorTable [][3][256]byte, words [4]uint32, dst []byte) {
+	binary.LittleEndian.PutUint32(dst, words[0])
+
+	for i := 1; i < 4; i++ {
+		for pos := 0; pos < 4; pos++ {
+			b := byte(words[i] >> uint(8*pos))
+
+			aPartial := dst[pos]&0xf0 | (b&0xf0)>>4
+			bPartial := (dst[pos]&0x0f)<<4 | b&0x0f
+
+			dst[pos] = lookupByte(&xorTable[2*pos+0][i-1], aPartial)<<4 | lookupByte(&xorTable[2*pos+1][i-1], bPartial)
+		}
+	}
+}
+
+// squashBlocks is Construction.expandBlock followed by NibbleXORTables.SquashBlocks.
+func squashBlocks(mask *[16][256][2]uint64, xorTables *[32][15][256]byte, dst []byte) {
+	var blocks [16][16]byte
+	for i := 0; i < 16; i++ {
+		block := lookupBlock(&mask[i], dst[i])
+		binary.LittleEndian.PutUint64(blocks[i][0:8], block[0])
+		binary.LittleEndian.PutUint64(blocks[i][8:16], block[1])
+	}
+
+	copy(dst, blocks[0][:])
+
+	for i := 1; i < 16; i++ {
+		for pos := 0; pos < 16; pos++ {
+			aPartial := dst[pos]&0xf0 | (blocks[i][pos]&0xf0)>>4
+			bPartial := (dst[pos]&0x0f)<<4 | blocks[i][pos]&0x0f
+
+			dst[pos] = lookupByte(&xorTables[2*pos+0][i-1], aPartial)<<4 | lookupByte(&xorTables[2*pos+1][i-1], bPartial)
+		}
+	}
+}
+
+// selectMask returns all ones if a == b and all zeros otherwise, without branching.
+func selectMask(a, b byte) uint64 {
+	return -uint64(subtle.ConstantTimeByteEq(a, b))
+}
+
+// lookupByte returns t[i], after reading every entry of t.
+func lookupByte(t *[256]byte, i byte) (out byte) {
+	for j := 0; j < 256; j++ {
+		out |= t[j] & byte(selectMask(byte(j), i))
+	}
+
+	return
+}
+
+// lookupWord returns t[i], after reading every entry of t.
+func lookupWord(t *[256]uint32, i byte) (out uint32) {
+	for j := 0; j < 256; j++ {
+		out |= t[j] & uint32(selectMask(byte(j), i))
+	}
+
+	return
+}
+
+// lookupBlock returns t[i], after reading every entry of t.
+func lookupBlock(t *[256][2]uint64, i byte) (out [2]uint64) {
+	for j := 0; j < 256; j++ {
+		mask := selectMask(byte(j), i)
+		out[0] |= t[j][0] & mask
+		out[1] |= t[j][1] & mask
+	}
+
+	return
+}
+
+func copyBlock(dst *[256][2]uint64, t table.Block) {
+	for i := 0; i < 256; i++ {
+		block := t.Get(byte(i))
+		dst[i] = [2]uint64{binary.LittleEndian.Uint64(block[0:8]), binary.LittleEndian.Uint64(block[8:16])}
+	}
+}
+
+func copyWord(dst *[256]uint32, t table.Word) {
+	for i := 0; i < 256; i++ {
+		word := t.Get(byte(i))
+		dst[i] = binary.LittleEndian.Uint32(word[:])
+	}
+}
+
+func copyNibble(dst *[256]byte, t table.Nibble) {
+	for i := 0; i < 256; i++ {
+		dst[i] = t.Get(byte(i))
+	}
+}
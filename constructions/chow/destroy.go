@@ -0,0 +1,87 @@
+package chow
+
+import (
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// Destroy overwrites every precomputed table of the construction with zeros and then resets it to the zero
+// Construction, so that the key can't be scraped from memory or core dumps after it's unloaded. The construction can't
+// be used afterwards.
+//
+// Tables parsed with Parse point into the buffer they were parsed from, so Destroy wipes that buffer too. Tables that are
+// still computed on every lookup (those of a freshly generated construction that hasn't been precomputed) hold the AES
+// key inside values Destroy can't reach, and tables loaded lazily with ParseReaderAt never leave the file; in both cases
+// Destroy only drops the construction's references to them. Encrypt and Decrypt keep their scratch space on the stack,
+// so there are no other buffers to wipe.
+func (constr *Construction) Destroy() {
+	for pos := range constr.InputMask {
+		wipe(constr.InputMask[pos])
+		wipe(constr.TBoxOutputMask[pos])
+	}
+
+	for i := range constr.InputXORTables {
+		for j := range constr.InputXORTables[i] {
+			wipe(constr.InputXORTables[i][j])
+			wipe(constr.OutputXORTables[i][j])
+		}
+	}
+
+	for round := range constr.TBoxTyiTable {
+		for pos := 0; pos < 16; pos++ {
+			wipe(constr.TBoxTyiTable[round][pos])
+			wipe(constr.MBInverseTable[round][pos])
+		}
+
+		for pos := 0; pos < 32; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				wipe(constr.HighXORTable[round][pos][gate])
+				wipe(constr.LowXORTable[round][pos][gate])
+			}
+		}
+	}
+
+	for round := range constr.HighWideXORTable {
+		for pos := 0; pos < 16; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				wipe(constr.HighWideXORTable[round][pos][gate])
+				wipe(constr.LowWideXORTable[round][pos][gate])
+			}
+		}
+	}
+
+	if constr.unpacked != nil {
+		constr.unpacked.wipe()
+	}
+
+	if constr.Binding != nil {
+		*constr.Binding = [16][256]byte{}
+	}
+
+	for i := range constr.RoundOrder {
+		constr.RoundOrder[i] = 0
+	}
+
+	*constr = Construction{}
+}
+
+// wipe zeroes the contents of t, if it's a precomputed table.
+func wipe(t interface{}) {
+	var data []byte
+
+	switch t := t.(type) {
+	case table.ParsedBlock:
+		data = t
+	case table.ParsedWord:
+		data = t
+	case table.ParsedNibble:
+		data = t
+	case table.ParsedDoubleToByte:
+		data = t
+	default:
+		return
+	}
+
+	for i := range data {
+		data[i] = 0
+	}
+}
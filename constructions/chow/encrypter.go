@@ -0,0 +1,57 @@
+package chow
+
+// Encrypter is a handle on a construction for one goroutine, or one stream, at a time. It owns the scratch space that
+// Encrypt and Decrypt would otherwise put on the stack, and counts the blocks pushed through it. Any number of
+// Encrypters can share a construction.
+type Encrypter struct {
+	constr    *Construction
+	stretched [16][16]byte
+
+	// Blocks is the number of blocks encrypted or decrypted through this handle.
+	Blocks uint64
+}
+
+// NewEncrypter returns a new handle on constr. The construction must outlive the handle and must not be modified while
+// it's in use.
+func (constr *Construction) NewEncrypter() *Encrypter {
+	return &Encrypter{constr: constr}
+}
+
+// BlockSize returns the block size of AES. (Necessary to implement cipher.Block.)
+func (e *Encrypter) BlockSize() int { return 16 }
+
+// Encrypt encrypts the first block in src into dst, like Construction.Encrypt.
+func (e *Encrypter) Encrypt(dst, src []byte) {
+	e.constr.cryptWith(&e.stretched, dst, src, e.constr.shiftRows)
+	e.Blocks++
+}
+
+// Decrypt decrypts the first block in src into dst, like Construction.Decrypt.
+func (e *Encrypter) Decrypt(dst, src []byte) {
+	e.constr.cryptWith(&e.stretched, dst, src, e.constr.unShiftRows)
+	e.Blocks++
+}
+
+// EncryptBlocks encrypts every block in src into dst, like Construction.EncryptBlocks, but on the calling goroutine
+// only.
+func (e *Encrypter) EncryptBlocks(dst, src []byte) {
+	e.cryptBlocks(dst, src, e.Encrypt)
+}
+
+// DecryptBlocks decrypts every block in src into dst, like EncryptBlocks.
+func (e *Encrypter) DecryptBlocks(dst, src []byte) {
+	e.cryptBlocks(dst, src, e.Decrypt)
+}
+
+func (e *Encrypter) cryptBlocks(dst, src []byte, crypt func(dst, src []byte)) {
+	bs := e.BlockSize()
+	if len(src)%bs != 0 {
+		panic("Input not full blocks!")
+	} else if len(dst) < len(src) {
+		panic("Output smaller than input!")
+	}
+
+	for i := 0; i < len(src); i += bs {
+		crypt(dst[i:i+bs], src[i:i+bs])
+	}
+}
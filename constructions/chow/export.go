@@ -0,0 +1,80 @@
+package chow
+
+import (
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// flatTables holds every table of a construction in flat byte slices, for the exporters to other languages. Block and
+// Word tables are stored entry by entry; Nibble tables are packed two entries to a byte, with the even entry in the high
+// nibble. The middle tables are stored in the construction's storage order, and RoundOrder maps rounds to slots.
+type flatTables struct {
+	Rounds     int
+	RoundOrder []byte
+
+	InputMask, InputXOR   []byte
+	TBoxTyi, HighXOR      []byte
+	MBInverse, LowXOR     []byte
+	OutputMask, OutputXOR []byte
+}
+
+func (constr *Construction) flatten() (out flatTables) {
+	out.Rounds = constr.Rounds()
+
+	for round := 0; round < out.Rounds-1; round++ {
+		out.RoundOrder = append(out.RoundOrder, byte(constr.Slot(round)))
+	}
+
+	for pos := 0; pos < 16; pos++ {
+		out.InputMask = appendBlock(out.InputMask, constr.InputMask[pos])
+		out.OutputMask = appendBlock(out.OutputMask, constr.TBoxOutputMask[pos])
+	}
+
+	for pos := 0; pos < 32; pos++ {
+		for gate := 0; gate < 15; gate++ {
+			out.InputXOR = appendNibble(out.InputXOR, constr.InputXORTables[pos][gate])
+			out.OutputXOR = appendNibble(out.OutputXOR, constr.OutputXORTables[pos][gate])
+		}
+	}
+
+	for slot := range constr.TBoxTyiTable {
+		for pos := 0; pos < 16; pos++ {
+			out.TBoxTyi = appendWord(out.TBoxTyi, constr.TBoxTyiTable[slot][pos])
+			out.MBInverse = appendWord(out.MBInverse, constr.MBInverseTable[slot][pos])
+		}
+
+		for pos := 0; pos < 32; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				out.HighXOR = appendNibble(out.HighXOR, constr.HighXORTable[slot][pos][gate])
+				out.LowXOR = appendNibble(out.LowXOR, constr.LowXORTable[slot][pos][gate])
+			}
+		}
+	}
+
+	return
+}
+
+func appendBlock(dst []byte, t table.Block) []byte {
+	for i := 0; i < 256; i++ {
+		out := t.Get(byte(i))
+		dst = append(dst, out[:]...)
+	}
+
+	return dst
+}
+
+func appendWord(dst []byte, t table.Word) []byte {
+	for i := 0; i < 256; i++ {
+		out := t.Get(byte(i))
+		dst = append(dst, out[:]...)
+	}
+
+	return dst
+}
+
+func appendNibble(dst []byte, t table.Nibble) []byte {
+	for i := 0; i < 256; i += 2 {
+		dst = append(dst, t.Get(byte(i))<<4|t.Get(byte(i+1))&0x0f)
+	}
+
+	return dst
+}
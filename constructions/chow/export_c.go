@@ -0,0 +1,213 @@
+package chow
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"text/template"
+)
+
+var cIdentifier = regexp.MustCompile("^[A-Za-z_][A-Za-z0-9_]*$")
+
+// ExportC writes a self-contained C source file to w that implements the construction, with every table embedded as a
+// static array. It defines two functions, <prefix>_encrypt and <prefix>_decrypt, which take a 16-byte output and input
+// buffer like Encrypt and Decrypt; only the one matching the construction computes anything useful. ExportCHeader
+// writes the matching header.
+//
+// The generated code is portable C with no dependencies beyond <stdint.h> and <string.h>. The external masks aren't
+// exported, so they have to be handled by the caller, as in Go. Neither is a device binding, so an activated
+// construction can't be exported.
+func (constr *Construction) ExportC(w io.Writer, prefix string) error {
+	if !cIdentifier.MatchString(prefix) {
+		return errors.New("Prefix isn't a valid C identifier!")
+	} else if constr.Binding != nil {
+		return errBound
+	}
+
+	bw := bufio.NewWriter(w)
+	if err := cSource.Execute(bw, cExport{prefix, constr.flatten()}); err != nil {
+		return err
+	}
+
+	return bw.Flush()
+}
+
+// ExportCHeader writes the C header declaring the functions defined by ExportC with the same prefix.
+func ExportCHeader(w io.Writer, prefix string) error {
+	if !cIdentifier.MatchString(prefix) {
+		return errors.New("Prefix isn't a valid C identifier!")
+	}
+
+	return cHeader.Execute(w, cExport{Prefix: prefix})
+}
+
+type cExport struct {
+	Prefix string
+	flatTables
+}
+
+// cArray formats a byte slice as the body of a C array initializer, 16 bytes to a line.
+func cArray(in []byte) string {
+	out := make([]byte, 0, 6*len(in))
+
+	for i, x := range in {
+		if i%16 == 0 {
+			out = append(out, "\n\t"...)
+		}
+
+		out = append(out, fmt.Sprintf("0x%2.2x,", x)...)
+	}
+
+	return string(out)
+}
+
+var cHeader = template.Must(template.New("header").Parse(`/* Generated by chow.ExportCHeader. */
+#ifndef {{.Prefix}}_H
+#define {{.Prefix}}_H
+
+#include <stdint.h>
+
+void {{.Prefix}}_encrypt(uint8_t dst[16], const uint8_t src[16]);
+void {{.Prefix}}_decrypt(uint8_t dst[16], const uint8_t src[16]);
+
+#endif
+`))
+
+var cSource = template.Must(template.New("source").Funcs(template.FuncMap{"array": cArray}).Parse(`/* Generated by chow.ExportC. Every table of a white-boxed AES key; treat this file as secret. */
+#include <stdint.h>
+#include <string.h>
+
+#define ROUNDS {{.Rounds}}
+
+static const uint8_t round_order[ROUNDS - 1] = { {{- array .RoundOrder}}
+};
+
+static const uint8_t input_mask[16 * 256 * 16] = { {{- array .InputMask}}
+};
+
+static const uint8_t input_xor[32 * 15 * 128] = { {{- array .InputXOR}}
+};
+
+static const uint8_t tbox_tyi[(ROUNDS - 1) * 16 * 256 * 4] = { {{- array .TBoxTyi}}
+};
+
+static const uint8_t high_xor[(ROUNDS - 1) * 32 * 3 * 128] = { {{- array .HighXOR}}
+};
+
+static const uint8_t mb_inverse[(ROUNDS - 1) * 16 * 256 * 4] = { {{- array .MBInverse}}
+};
+
+static const uint8_t low_xor[(ROUNDS - 1) * 32 * 3 * 128] = { {{- array .LowXOR}}
+};
+
+static const uint8_t output_mask[16 * 256 * 16] = { {{- array .OutputMask}}
+};
+
+static const uint8_t output_xor[32 * 15 * 128] = { {{- array .OutputXOR}}
+};
+
+static const uint8_t shift_rows[16] = {0, 5, 10, 15, 4, 9, 14, 3, 8, 13, 2, 7, 12, 1, 6, 11};
+static const uint8_t unshift_rows[16] = {0, 13, 10, 7, 4, 1, 14, 11, 8, 5, 2, 15, 12, 9, 6, 3};
+
+/* nibble looks up entry i of a packed Nibble table. */
+static uint8_t nibble(const uint8_t *t, uint8_t i) {
+	return (uint8_t) ((t[i >> 1] >> ((i & 1) ? 0 : 4)) & 0x0f);
+}
+
+/* xor_partial XORs the nibbles of a and b with the two Nibble tables at xor_a and xor_b. */
+static uint8_t xor_partial(const uint8_t *xor_a, const uint8_t *xor_b, uint8_t a, uint8_t b) {
+	uint8_t high = (uint8_t) ((a & 0xf0) | (b >> 4));
+	uint8_t low = (uint8_t) ((a << 4) | (b & 0x0f));
+
+	return (uint8_t) ((nibble(xor_a, high) << 4) | nibble(xor_b, low));
+}
+
+/* block_stage applies the Block tables in mask to the state, and squashes the result with the XOR tables in xor. */
+static void block_stage(const uint8_t *mask, const uint8_t *xor, uint8_t state[16]) {
+	uint8_t stretched[16][16];
+	int i, pos;
+
+	for (i = 0; i < 16; i++) {
+		memcpy(stretched[i], &mask[(i * 256 + state[i]) * 16], 16);
+	}
+
+	memcpy(state, stretched[0], 16);
+
+	for (i = 1; i < 16; i++) {
+		for (pos = 0; pos < 16; pos++) {
+			state[pos] = xor_partial(
+				&xor[((2 * pos + 0) * 15 + i - 1) * 128], &xor[((2 * pos + 1) * 15 + i - 1) * 128],
+				state[pos], stretched[i][pos]
+			);
+		}
+	}
+}
+
+/* word_stage applies the Word tables in step to the column of the state starting at pos, and squashes the result with
+ * the XOR tables in xor. */
+static void word_stage(const uint8_t *step, const uint8_t *xor, uint8_t state[16], int pos) {
+	uint8_t words[4][4];
+	int i, j;
+
+	for (i = 0; i < 4; i++) {
+		memcpy(words[i], &step[((pos + i) * 256 + state[pos + i]) * 4], 4);
+	}
+
+	memcpy(&state[pos], words[0], 4);
+
+	for (i = 1; i < 4; i++) {
+		for (j = 0; j < 4; j++) {
+			state[pos + j] = xor_partial(
+				&xor[((2 * (pos + j) + 0) * 3 + i - 1) * 128], &xor[((2 * (pos + j) + 1) * 3 + i - 1) * 128],
+				state[pos + j], words[i][j]
+			);
+		}
+	}
+}
+
+/* shift permutes the bytes of the state with ShiftRows or its inverse. */
+static void shift(const uint8_t perm[16], uint8_t state[16]) {
+	uint8_t temp[16];
+	int i;
+
+	for (i = 0; i < 16; i++) {
+		temp[i] = state[perm[i]];
+	}
+
+	memcpy(state, temp, 16);
+}
+
+/* lookup pushes a block through the tables, like Construction.crypt in Go. */
+static void lookup(uint8_t dst[16], const uint8_t src[16], const uint8_t perm[16]) {
+	uint8_t state[16];
+	int round, slot, pos;
+
+	memcpy(state, src, 16);
+	block_stage(input_mask, input_xor, state);
+
+	for (round = 0; round < ROUNDS - 1; round++) {
+		slot = round_order[round];
+		shift(perm, state);
+
+		for (pos = 0; pos < 16; pos += 4) {
+			word_stage(&tbox_tyi[slot * 16 * 256 * 4], &high_xor[slot * 32 * 3 * 128], state, pos);
+			word_stage(&mb_inverse[slot * 16 * 256 * 4], &low_xor[slot * 32 * 3 * 128], state, pos);
+		}
+	}
+
+	shift(perm, state);
+	block_stage(output_mask, output_xor, state);
+
+	memcpy(dst, state, 16);
+}
+
+void {{.Prefix}}_encrypt(uint8_t dst[16], const uint8_t src[16]) {
+	lookup(dst, src, shift_rows);
+}
+
+void {{.Prefix}}_decrypt(uint8_t dst[16], const uint8_t src[16]) {
+	lookup(dst, src, unshift_rows);
+}
+`))
@@ -0,0 +1,182 @@
+package chow
+
+import (
+	"bytes"
+	"errors"
+	"go/format"
+	"go/token"
+	"io"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// ExportGo writes a Go source file to w, in the package with the given name, that implements the construction with its
+// tables compiled in as string constants. The file defines two functions, Encrypt and Decrypt, with the same signatures
+// as the construction's methods; only the one matching the construction computes anything useful.
+//
+// This lets a white-boxed key be built into a client binary instead of loaded at runtime. The external masks aren't
+// exported, so they have to be handled by the caller. Neither is a device binding, so an activated construction can't be
+// exported.
+func (constr *Construction) ExportGo(w io.Writer, pkg string) error {
+	if !token.IsIdentifier(pkg) {
+		return errors.New("Package name isn't a valid Go identifier!")
+	} else if constr.Binding != nil {
+		return errBound
+	}
+
+	buff := &bytes.Buffer{}
+	if err := goSource.Execute(buff, goExport{pkg, constr.flatten()}); err != nil {
+		return err
+	}
+
+	out, err := format.Source(buff.Bytes())
+	if err != nil {
+		return err
+	}
+
+	_, err = w.Write(out)
+	return err
+}
+
+type goExport struct {
+	Package string
+	flatTables
+}
+
+// goString formats a byte slice as a Go string constant expression, 32 bytes to a line.
+func goString(in []byte) string {
+	lines := make([]string, 0, len(in)/32+1)
+
+	for i := 0; i < len(in); i += 32 {
+		end := i + 32
+		if end > len(in) {
+			end = len(in)
+		}
+
+		lines = append(lines, strconv.Quote(string(in[i:end])))
+	}
+
+	if len(lines) == 0 {
+		return `""`
+	}
+
+	return strings.Join(lines, " +\n\t")
+}
+
+var goSource = template.Must(template.New("source").Funcs(template.FuncMap{"str": goString}).Parse(`// Code generated by chow.ExportGo. DO NOT EDIT.
+
+// Every table of a white-boxed AES key; treat this file as secret.
+
+package {{.Package}}
+
+const rounds = {{.Rounds}}
+
+const (
+	roundOrder = {{str .RoundOrder}}
+
+	inputMask = {{str .InputMask}}
+
+	inputXOR = {{str .InputXOR}}
+
+	tboxTyi = {{str .TBoxTyi}}
+
+	highXOR = {{str .HighXOR}}
+
+	mbInverse = {{str .MBInverse}}
+
+	lowXOR = {{str .LowXOR}}
+
+	outputMask = {{str .OutputMask}}
+
+	outputXOR = {{str .OutputXOR}}
+)
+
+var (
+	shiftRows   = [16]int{0, 5, 10, 15, 4, 9, 14, 3, 8, 13, 2, 7, 12, 1, 6, 11}
+	unShiftRows = [16]int{0, 13, 10, 7, 4, 1, 14, 11, 8, 5, 2, 15, 12, 9, 6, 3}
+)
+
+// Encrypt encrypts the first block in src into dst. Dst and src may point at the same memory.
+func Encrypt(dst, src []byte) { lookup(dst, src, &shiftRows) }
+
+// Decrypt decrypts the first block in src into dst. Dst and src may point at the same memory.
+func Decrypt(dst, src []byte) { lookup(dst, src, &unShiftRows) }
+
+// nibble looks up entry i of the packed Nibble table starting at off in t.
+func nibble(t string, off int, i byte) byte {
+	return t[off+int(i>>1)] >> (4 * (1 - i&1)) & 0x0f
+}
+
+// xorPartial XORs the nibbles of a and b with the two Nibble tables at offA and offB in t.
+func xorPartial(t string, offA, offB int, a, b byte) byte {
+	return nibble(t, offA, a&0xf0|b>>4)<<4 | nibble(t, offB, a<<4|b&0x0f)
+}
+
+// blockStage applies the Block tables in mask to the state, and squashes the result with the XOR tables in xor.
+func blockStage(mask, xor string, state *[16]byte) {
+	var stretched [16][16]byte
+
+	for i := 0; i < 16; i++ {
+		copy(stretched[i][:], mask[(i*256+int(state[i]))*16:])
+	}
+
+	*state = stretched[0]
+
+	for i := 1; i < 16; i++ {
+		for pos := 0; pos < 16; pos++ {
+			state[pos] = xorPartial(xor, ((2*pos+0)*15+i-1)*128, ((2*pos+1)*15+i-1)*128, state[pos], stretched[i][pos])
+		}
+	}
+}
+
+// wordStage applies the Word tables of the given slot in step to the column of the state starting at pos, and squashes
+// the result with the XOR tables of the same slot in xor.
+func wordStage(step, xor string, slot int, state *[16]byte, pos int) {
+	var words [4][4]byte
+
+	for i := 0; i < 4; i++ {
+		copy(words[i][:], step[((slot*16+pos+i)*256+int(state[pos+i]))*4:])
+	}
+
+	copy(state[pos:pos+4], words[0][:])
+
+	for i := 1; i < 4; i++ {
+		for j := 0; j < 4; j++ {
+			offA, offB := ((slot*32+2*(pos+j)+0)*3+i-1)*128, ((slot*32+2*(pos+j)+1)*3+i-1)*128
+			state[pos+j] = xorPartial(xor, offA, offB, state[pos+j], words[i][j])
+		}
+	}
+}
+
+// lookup pushes a block through the tables, like Construction.crypt in the chow package.
+func lookup(dst, src []byte, perm *[16]int) {
+	var state [16]byte
+	copy(state[:], src[:16])
+
+	blockStage(inputMask, inputXOR, &state)
+
+	for round := 0; round < rounds-1; round++ {
+		slot := int(roundOrder[round])
+		shift(perm, &state)
+
+		for pos := 0; pos < 16; pos += 4 {
+			wordStage(tboxTyi, highXOR, slot, &state, pos)
+			wordStage(mbInverse, lowXOR, slot, &state, pos)
+		}
+	}
+
+	shift(perm, &state)
+	blockStage(outputMask, outputXOR, &state)
+
+	copy(dst, state[:])
+}
+
+// shift permutes the bytes of the state with ShiftRows or its inverse.
+func shift(perm *[16]int, state *[16]byte) {
+	temp := *state
+	for i := 0; i < 16; i++ {
+		state[i] = temp[perm[i]]
+	}
+}
+`))
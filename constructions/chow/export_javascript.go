@@ -0,0 +1,167 @@
+package chow
+
+import (
+	"io"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// ExportJSBlob writes the construction's tables to w as a compact blob, for the JavaScript runtime written by
+// ExportJSRuntime. The blob is laid out as one byte holding the number of rounds, the order of the middle rounds (one
+// byte per round), then the tables: InputMask, InputXORTables, TBoxTyiTable, HighXORTable, MBInverseTable, LowXORTable,
+// TBoxOutputMask, and OutputXORTables. Nibble tables are packed two entries to a byte. An activated construction can't
+// be exported.
+func (constr *Construction) ExportJSBlob(w io.Writer) error {
+	if constr.Binding != nil {
+		return errBound
+	}
+
+	flat := constr.flatten()
+
+	sw := &common.StreamWriter{W: w}
+	sw.Write([]byte{byte(flat.Rounds)})
+
+	for _, part := range [][]byte{
+		flat.RoundOrder,
+		flat.InputMask, flat.InputXOR,
+		flat.TBoxTyi, flat.HighXOR, flat.MBInverse, flat.LowXOR,
+		flat.OutputMask, flat.OutputXOR,
+	} {
+		sw.Write(part)
+	}
+
+	return sw.Err
+}
+
+// ExportJSRuntime writes a small, dependency-free JavaScript runtime to w that evaluates blobs written by ExportJSBlob,
+// so that content protected with a white-boxed key can be decrypted in a browser. It defines chowWhiteBox(blob), which
+// takes the blob as a Uint8Array and returns an object with encrypt(block) and decrypt(block) methods that transform a
+// 16-byte Uint8Array in place. As in Go, only the method matching the construction computes anything useful, and the
+// external masks have to be handled by the caller.
+func ExportJSRuntime(w io.Writer) error {
+	_, err := io.WriteString(w, jsRuntime)
+	return err
+}
+
+const jsRuntime = `// Generated by chow.ExportJSRuntime. Evaluates white-boxed AES keys exported by chow.ExportJSBlob.
+(function (root) {
+  "use strict";
+
+  var shiftRows = [0, 5, 10, 15, 4, 9, 14, 3, 8, 13, 2, 7, 12, 1, 6, 11];
+  var unShiftRows = [0, 13, 10, 7, 4, 1, 14, 11, 8, 5, 2, 15, 12, 9, 6, 3];
+
+  function chowWhiteBox(blob) {
+    var rounds = blob[0], middle = rounds - 1, off = 1;
+
+    function take(size) {
+      var out = blob.subarray(off, off + size);
+      off += size;
+      return out;
+    }
+
+    var order = take(middle);
+    var inputMask = take(16 * 256 * 16), inputXOR = take(32 * 15 * 128);
+    var tboxTyi = take(middle * 16 * 256 * 4), highXOR = take(middle * 32 * 3 * 128);
+    var mbInverse = take(middle * 16 * 256 * 4), lowXOR = take(middle * 32 * 3 * 128);
+    var outputMask = take(16 * 256 * 16), outputXOR = take(32 * 15 * 128);
+
+    if (off !== blob.length) {
+      throw new Error("White-box blob has the wrong length!");
+    }
+
+    // nibble looks up entry i of the packed Nibble table starting at off in t.
+    function nibble(t, off, i) {
+      return (t[off + (i >> 1)] >> ((i & 1) ? 0 : 4)) & 0x0f;
+    }
+
+    // xorPartial XORs the nibbles of a and b with the two Nibble tables at offA and offB in t.
+    function xorPartial(t, offA, offB, a, b) {
+      return (nibble(t, offA, (a & 0xf0) | (b >> 4)) << 4) | nibble(t, offB, ((a << 4) & 0xf0) | (b & 0x0f));
+    }
+
+    // blockStage applies the Block tables in mask to the state, and squashes the result with the XOR tables in xor.
+    function blockStage(mask, xor, state) {
+      var stretched = [], i, pos;
+
+      for (i = 0; i < 16; i++) {
+        stretched.push(mask.subarray((i * 256 + state[i]) * 16, (i * 256 + state[i] + 1) * 16));
+      }
+
+      state.set(stretched[0]);
+
+      for (i = 1; i < 16; i++) {
+        for (pos = 0; pos < 16; pos++) {
+          state[pos] = xorPartial(
+            xor, ((2 * pos + 0) * 15 + i - 1) * 128, ((2 * pos + 1) * 15 + i - 1) * 128, state[pos], stretched[i][pos]
+          );
+        }
+      }
+    }
+
+    // wordStage applies the Word tables of the given slot in step to the column of the state starting at pos, and
+    // squashes the result with the XOR tables of the same slot in xor.
+    function wordStage(step, xor, slot, state, pos) {
+      var words = [], i, j;
+
+      for (i = 0; i < 4; i++) {
+        var loc = ((slot * 16 + pos + i) * 256 + state[pos + i]) * 4;
+        words.push(step.subarray(loc, loc + 4));
+      }
+
+      state.set(words[0], pos);
+
+      for (i = 1; i < 4; i++) {
+        for (j = 0; j < 4; j++) {
+          state[pos + j] = xorPartial(
+            xor, ((slot * 32 + 2 * (pos + j) + 0) * 3 + i - 1) * 128, ((slot * 32 + 2 * (pos + j) + 1) * 3 + i - 1) * 128,
+            state[pos + j], words[i][j]
+          );
+        }
+      }
+    }
+
+    // shift permutes the bytes of the state with ShiftRows or its inverse.
+    function shift(perm, state) {
+      var temp = state.slice(), i;
+
+      for (i = 0; i < 16; i++) {
+        state[i] = temp[perm[i]];
+      }
+    }
+
+    // lookup pushes a block through the tables, like Construction.crypt in Go.
+    function lookup(block, perm) {
+      var state = new Uint8Array(16), round, slot, pos;
+      state.set(block.subarray(0, 16));
+
+      blockStage(inputMask, inputXOR, state);
+
+      for (round = 0; round < middle; round++) {
+        slot = order[round];
+        shift(perm, state);
+
+        for (pos = 0; pos < 16; pos += 4) {
+          wordStage(tboxTyi, highXOR, slot, state, pos);
+          wordStage(mbInverse, lowXOR, slot, state, pos);
+        }
+      }
+
+      shift(perm, state);
+      blockStage(outputMask, outputXOR, state);
+
+      block.set(state);
+    }
+
+    return {
+      encrypt: function (block) { lookup(block, shiftRows); },
+      decrypt: function (block) { lookup(block, unShiftRows); }
+    };
+  }
+
+  if (typeof module !== "undefined" && module.exports) {
+    module.exports = chowWhiteBox;
+  } else {
+    root.chowWhiteBox = chowWhiteBox;
+  }
+})(this);
+`
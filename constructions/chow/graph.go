@@ -0,0 +1,251 @@
+package chow
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Input and Output aren't tables, but stand for the bytes of the block going into and coming out of a construction in a
+// Graph, with the byte's index as Position.
+const (
+	Input  TableKind = 0xfe
+	Output TableKind = 0xff
+)
+
+var kindNames = map[TableKind]string{
+	InputMaskTable:      "InputMask",
+	InputXORTable:       "InputXORTables",
+	TBoxTyiTable:        "TBoxTyiTable",
+	HighXORTable:        "HighXORTable",
+	MBInverseTable:      "MBInverseTable",
+	LowXORTable:         "LowXORTable",
+	HighWideXORTable:    "HighWideXORTable",
+	LowWideXORTable:     "LowWideXORTable",
+	TBoxOutputMaskTable: "TBoxOutputMask",
+	OutputXORTable:      "OutputXORTables",
+	Input:               "Input",
+	Output:              "Output",
+}
+
+// String returns the name of the Construction field that holds tables of this kind.
+func (tk TableKind) String() string {
+	if name, ok := kindNames[tk]; ok {
+		return name
+	}
+
+	return fmt.Sprintf("TableKind(%d)", byte(tk))
+}
+
+// String names the table like the expression that indexes it in a Construction, except that middle tables are indexed
+// by round instead of by slot. For example, "HighXORTable[3][12][1]" is gate 1 of nibble 12 in the fourth round.
+func (id TableID) String() string {
+	switch id.Kind {
+	case Input, Output, InputMaskTable, TBoxOutputMaskTable:
+		return fmt.Sprintf("%v[%v]", id.Kind, id.Position)
+	case InputXORTable, OutputXORTable:
+		return fmt.Sprintf("%v[%v][%v]", id.Kind, id.Position, id.Gate)
+	case TBoxTyiTable, MBInverseTable:
+		return fmt.Sprintf("%v[%v][%v]", id.Kind, id.Round, id.Position)
+	default:
+		return fmt.Sprintf("%v[%v][%v][%v]", id.Kind, id.Round, id.Position, id.Gate)
+	}
+}
+
+// MarshalText encodes the table's ID as its name, so that it's readable in JSON. (See String.)
+func (id TableID) MarshalText() ([]byte, error) { return []byte(id.String()), nil }
+
+// Wire is an edge in a Graph: part of the output of one table is part of the input of another.
+type Wire struct {
+	From TableID `json:"from"`
+	To   TableID `json:"to"`
+}
+
+// Graph is the dataflow of a construction: every table, and which tables' outputs feed into which tables' inputs.
+type Graph struct {
+	Nodes []TableID `json:"nodes"` // In the order they're looked up, starting with the bytes of the input.
+	Wires []Wire    `json:"wires"`
+}
+
+// graphState is the nibbles of the state matrix, as the tables that last wrote them.
+type graphState [32]TableID
+
+// Graph returns the dataflow of the construction as it encrypts, or decrypts if decrypt is true. The direction only
+// changes which bytes of the state are routed to which tables between rounds, by ShiftRows or its inverse. The graph
+// follows the wide XOR tables instead of the nibble ones if WidenXORTables has been called.
+//
+// Tables are identified the way NewTracedConstruction identifies them, so a graph can be used to make sense of a trace.
+func (constr *Construction) Graph(decrypt bool) (g Graph) {
+	perm := [16]int{0, 5, 10, 15, 4, 9, 14, 3, 8, 13, 2, 7, 12, 1, 6, 11}
+	if decrypt {
+		perm = [16]int{0, 13, 10, 7, 4, 1, 14, 11, 8, 5, 2, 15, 12, 9, 6, 3}
+	}
+
+	var state graphState
+	for pos := 0; pos < 16; pos++ {
+		id := TableID{Kind: Input, Position: byte(pos)}
+		g.Nodes = append(g.Nodes, id)
+		state[2*pos+0], state[2*pos+1] = id, id
+	}
+
+	g.blockStage(&state, InputMaskTable, InputXORTable)
+
+	wide := constr.HighWideXORTable != nil
+	high, low := HighXORTable, LowXORTable
+	if wide {
+		high, low = HighWideXORTable, LowWideXORTable
+	}
+
+	for round := 0; round < len(constr.TBoxTyiTable); round++ {
+		state.shift(perm)
+
+		for pos := 0; pos < 16; pos += 4 {
+			g.wordStage(&state, byte(round), pos, TBoxTyiTable, high)
+			g.wordStage(&state, byte(round), pos, MBInverseTable, low)
+		}
+	}
+
+	state.shift(perm)
+	g.blockStage(&state, TBoxOutputMaskTable, OutputXORTable)
+
+	for pos := 0; pos < 16; pos++ {
+		g.read(&state, TableID{Kind: Output, Position: byte(pos)}, pos)
+	}
+
+	return
+}
+
+// read adds a table that reads one byte of the state to the graph.
+func (g *Graph) read(state *graphState, id TableID, pos int) {
+	g.Nodes = append(g.Nodes, id)
+
+	g.Wires = append(g.Wires, Wire{state[2*pos+0], id})
+	if state[2*pos+1] != state[2*pos+0] {
+		g.Wires = append(g.Wires, Wire{state[2*pos+1], id})
+	}
+}
+
+// blockStage adds the tables that expand every byte of the state into a block and squash the blocks back together, like
+// expandBlock and common.NibbleXORTables.SquashBlocks.
+func (g *Graph) blockStage(state *graphState, mask, xor TableKind) {
+	var blocks [16]TableID
+	for pos := 0; pos < 16; pos++ {
+		blocks[pos] = TableID{Kind: mask, Position: byte(pos)}
+		g.read(state, blocks[pos], pos)
+	}
+
+	for nibble := 0; nibble < 32; nibble++ {
+		state[nibble] = blocks[0]
+	}
+
+	for i := 1; i < 16; i++ {
+		for nibble := 0; nibble < 32; nibble++ {
+			id := TableID{Kind: xor, Position: byte(nibble), Gate: byte(i - 1)}
+			g.Nodes = append(g.Nodes, id)
+			g.Wires = append(g.Wires, Wire{state[nibble], id}, Wire{blocks[i], id})
+
+			state[nibble] = id
+		}
+	}
+}
+
+// wordStage adds the tables that expand one column of the state into four words and squash the words back together,
+// like ExpandWord and SquashWords, or SquashWordsWide if xor is a kind of wide table.
+func (g *Graph) wordStage(state *graphState, round byte, pos int, step, xor TableKind) {
+	var words [4]TableID
+	for i := 0; i < 4; i++ {
+		words[i] = TableID{step, round, byte(pos + i), 0}
+		g.read(state, words[i], pos+i)
+	}
+
+	for nibble := 2 * pos; nibble < 2*pos+8; nibble++ {
+		state[nibble] = words[0]
+	}
+
+	for i := 1; i < 4; i++ {
+		for nibble := 2 * pos; nibble < 2*pos+8; nibble++ {
+			id := TableID{xor, round, byte(nibble), byte(i - 1)}
+			if xor == HighWideXORTable || xor == LowWideXORTable {
+				// One wide table squashes both nibbles of a byte.
+				id.Position = byte(nibble / 2)
+
+				if nibble%2 == 1 {
+					state[nibble] = id
+					continue
+				}
+			}
+
+			g.Nodes = append(g.Nodes, id)
+			g.Wires = append(g.Wires, Wire{state[nibble], id}, Wire{words[i], id})
+
+			state[nibble] = id
+		}
+	}
+}
+
+// shift permutes the bytes of the state matrix like shiftRows or unShiftRows, given the permutation they apply.
+func (state *graphState) shift(perm [16]int) {
+	old := *state
+	for pos, src := range perm {
+		state[2*pos+0], state[2*pos+1] = old[2*src+0], old[2*src+1]
+	}
+}
+
+// WriteDOT writes the graph to w in Graphviz's DOT language, with the tables of each round grouped into a cluster. Render
+// it with, for example, `dot -Tsvg`.
+func (g Graph) WriteDOT(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	fmt.Fprintln(bw, "digraph construction {")
+	fmt.Fprintln(bw, "\trankdir=LR;")
+	fmt.Fprintln(bw, "\tnode [shape=box];")
+
+	cluster := -1
+	for _, id := range g.Nodes {
+		round := -1
+		switch id.Kind {
+		case TBoxTyiTable, HighXORTable, MBInverseTable, LowXORTable, HighWideXORTable, LowWideXORTable:
+			round = int(id.Round)
+		}
+
+		if round != cluster {
+			if cluster != -1 {
+				fmt.Fprintln(bw, "\t}")
+			}
+			if round != -1 {
+				fmt.Fprintf(bw, "\tsubgraph cluster_round%v {\n", round)
+				fmt.Fprintf(bw, "\t\tlabel=\"Round %v\";\n", round)
+			}
+			cluster = round
+		}
+
+		shape := ""
+		if id.Kind == Input || id.Kind == Output {
+			shape = " [shape=ellipse]"
+		}
+
+		if cluster != -1 {
+			bw.WriteByte('\t')
+		}
+		fmt.Fprintf(bw, "\t%q%v;\n", id.String(), shape)
+	}
+	if cluster != -1 {
+		fmt.Fprintln(bw, "\t}")
+	}
+
+	for _, wire := range g.Wires {
+		fmt.Fprintf(bw, "\t%q -> %q;\n", wire.From.String(), wire.To.String())
+	}
+
+	fmt.Fprintln(bw, "}")
+
+	return bw.Flush()
+}
+
+// WriteJSON writes the graph to w as a JSON object, with every table named as by TableID.String:
+//
+//	{"nodes": ["Input[0]", ...], "wires": [{"from": "Input[0]", "to": "InputMask[0]"}, ...]}
+func (g Graph) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(g)
+}
@@ -1,6 +1,10 @@
 package chow
 
 import (
+	"context"
+	"crypto/rand"
+	"io"
+
 	"github.com/OpenWhiteBox/primitives/encoding"
 	"github.com/OpenWhiteBox/primitives/matrix"
 	"github.com/OpenWhiteBox/primitives/random"
@@ -10,103 +14,275 @@ import (
 	"github.com/OpenWhiteBox/AES/constructions/saes"
 )
 
-func generateKeys(rs *random.Source, opts common.KeyGenerationOpts, out *Construction, inputMask, outputMask *matrix.Matrix, shift func(int) int, skinny func(int) table.Byte, wide func(int, int) table.Word) {
-	// Generate input and output encodings.
-	common.GenerateMasks(rs, opts, inputMask, outputMask)
+// Opts adds hardening options specific to Chow's construction to the mask options of a key, which should be in
+// common.{IndependentMasks, SameMasks, MatchingMasks}. It can be passed as the opts of any key generation function in
+// this package.
+type Opts struct {
+	Masks common.KeyGenerationOpts
+
+	// DummyRounds is the number of dummy rounds to add to the construction, which must be a multiple of four. A dummy
+	// round is built exactly like a real one, but computes only ShiftRows, so every group of four cancels out. The groups
+	// are inserted between random rounds, which makes it harder to locate the tables of a given round of AES.
+	DummyRounds int
+
+	// ShuffleRounds stores the middle tables of each round at a random index, instead of in order. The construction
+	// records the order in RoundOrder, so this only hides the structure from someone reading raw memory, not from someone
+	// parsing the key.
+	ShuffleRounds bool
+
+	// MixingBijections selects which of the internal mixing bijections are used. The rest are replaced by the identity.
+	MixingBijections MixingBijections
+
+	// Naked replaces every encoding in the construction with the identity: the external masks (Masks is ignored), the
+	// mixing bijections, and the nibble encodings. The tables then hold bare T-Boxes and Tyi Tables, so the state after
+	// each round can be read straight off of them. Naked constructions offer no protection at all; they're only useful
+	// for teaching and for testing attacks.
+	Naked bool
+
+	// LinearEncodings leaves out the nonlinear nibble encodings, so that every encoding in the construction is linear:
+	// the masks and the mixing bijections. Like Naked, it's only useful for studying attacks.
+	LinearEncodings bool
+
+	// SelfTest is the number of random blocks to check the new construction against crypto/aes on (see
+	// Construction.SelfTest), or zero to skip the check. Only the key generation functions that return an error run
+	// it--GenerateEncryptionKeysFrom, GenerateEncryptionKeysRandom, GenerateEncryptionKeysCtx, and their decryption
+	// counterparts--and they return an error if the construction disagrees with AES. A construction bound to a Device is
+	// tested as activated on that device.
+	SelfTest int
+
+	// WideXORTables merges the XOR tables of the middle rounds into byte-wide tables after generation (see
+	// Construction.WidenXORTables), trading a lot of memory for half as many lookups.
+	WideXORTables bool
+
+	// Device binds the construction to one device: the input of the first round's tables is encoded with a byte
+	// bijection on each byte, derived from the seed and the device's fingerprint, and the construction only computes AES
+	// once it's been activated with the device's fingerprint and the Activation written to Device (see
+	// Construction.Activate). A key copied to another device is useless without that device's activation, and an
+	// activation is useless with any other key. Bound constructions can't be rerandomized, and the exports don't
+	// include the activation.
+	Device *DeviceBinding
+
+	// Watermark is embedded in the encodings between the input XOR tables, without changing what the construction
+	// computes, so that a leaked key can be traced back to whoever it was issued to with ExtractWatermark. It's at most
+	// MaxWatermark bytes. The watermark is only visible with the seed, but it doesn't survive Rerandomize.
+	Watermark []byte
+}
+
+// MixingBijections selects which of the internal mixing bijections a construction uses: the 8-bit L bijections on the
+// input and output of every round, the 32-bit MB bijections between the Tyi Tables and the MB^(-1) Tables, or both.
+type MixingBijections int
+
+const (
+	BothMixingBijections   MixingBijections = iota // The L and MB bijections, as in Chow's paper. (The default.)
+	WideMixingBijections                           // Only the 32-bit MB bijections.
+	NarrowMixingBijections                         // Only the 8-bit L bijections.
+	NoMixingBijections                             // Neither, leaving only the nibble encodings.
+)
+
+func (mbs MixingBijections) narrow() bool {
+	return mbs == BothMixingBijections || mbs == NarrowMixingBijections
+}
+
+func (mbs MixingBijections) wide() bool {
+	return mbs == BothMixingBijections || mbs == WideMixingBijections
+}
+
+// FromOptions returns the Opts that apply the settings shared by every construction: the masks, the nonlinear
+// encodings, and the dummy rounds. A common.Options passed to any key generation function in this package is converted
+// with it.
+func FromOptions(opts common.Options) Opts {
+	return Opts{Masks: opts.Masks(), DummyRounds: opts.DummyRounds, LinearEncodings: !opts.NonlinearEncodings}
+}
+
+// parseOpts splits opts into the mask options and the hardening options of a key.
+func parseOpts(opts common.KeyGenerationOpts) (common.KeyGenerationOpts, Opts) {
+	switch o := opts.(type) {
+	case Opts:
+		return o.Masks, o
+	case common.Options:
+		hardening := FromOptions(o)
+		return hardening.Masks, hardening
+	}
+
+	return opts, Opts{Masks: opts}
+}
+
+// roundLayout returns the round of AES computed by each of the middle rounds of a construction, or -1 for dummy rounds.
+// Groups of four dummy rounds are put before random rounds, where round rounds-1 is the last round's TBoxOutputMask.
+func roundLayout(rs *random.Source, rounds, dummies int) (layout []int) {
+	if dummies < 0 || dummies%4 != 0 {
+		panic("Dummy rounds must come in groups of four!")
+	} else if rounds+dummies > 255 {
+		panic("Too many dummy rounds!")
+	}
+
+	stream, buff := rs.Stream(common.Label("DR")), make([]byte, 1)
+
+	groups := make([]int, rounds)
+	for i := 0; i < dummies/4; i++ {
+		stream.Read(buff)
+		groups[int(buff[0])%rounds]++
+	}
+
+	for round := 0; round < rounds; round++ {
+		for i := 0; i < 4*groups[round]; i++ {
+			layout = append(layout, -1)
+		}
+
+		if round < rounds-1 {
+			layout = append(layout, round)
+		}
+	}
+
+	return
+}
+
+// generateKeys builds every table of a construction with the given number of rounds. skinny(pos) is the T-Box of the
+// last round at the given position and wide(round, pos) is the T-Box composed with a Tyi Table for every other round.
+func generateKeys(rs *random.Source, opts common.KeyGenerationOpts, rounds int, out *Construction, inputMask, outputMask *encoding.BlockAffine, shift func(int) int, skinny func(int) table.Byte, wide func(int, int) table.Word) {
+	masks, hardening := parseOpts(opts)
+
+	var nibbles nibbleSource = rs
+	if hardening.LinearEncodings {
+		nibbles = identityNibbles{}
+	}
+	if hardening.Naked {
+		nibbles, masks = identityNibbles{}, common.SameMasks(common.IdentityMask)
+		hardening.MixingBijections = NoMixingBijections
+	}
+
+	out.KeyLength = common.KeySize(rounds)
+
+	// Add the dummy rounds. From here on, rounds counts them.
+	layout := roundLayout(rs, rounds, hardening.DummyRounds)
+	rounds = len(layout) + 1
+
+	step := func(round, pos int) table.Word {
+		if layout[round] < 0 {
+			return dummyTable(pos % 4)
+		}
+
+		return wide(layout[round], pos)
+	}
+
+	// Generate input and output encodings. The constant part of each mask is added by the tables at position 0.
+	common.GenerateAffineMasks(rs, masks, inputMask, outputMask)
 
 	// Generate the Input Mask slices and XOR tables.
 	for pos := 0; pos < 16; pos++ {
+		mask := common.BlockMatrix{Linear: inputMask.Forwards, Position: pos}
+		if pos == 0 {
+			mask.Constant = inputMask.BlockAdditive
+		}
+
 		out.InputMask[pos] = encoding.BlockTable{
 			encoding.IdentityByte{},
-			blockMaskEncoding(rs, pos, common.Inside, shift),
-			common.BlockMatrix{Linear: *inputMask, Position: pos},
+			blockMaskEncoding(rs, nibbles, pos, common.Inside, shift, hardening.MixingBijections),
+			mask,
 		}
 	}
 
 	out.InputXORTables = common.BlockNibbleXORTables(
-		maskEncoding(rs, common.Inside),
-		xorEncoding(rs, 10, common.Inside),
-		roundEncoding(rs, -1, common.Outside, shift),
+		maskEncoding(nibbles, common.Inside),
+		watermarkedXOREncoding(nibbles, xorEncoding(nibbles, rounds, common.Inside), hardening.Watermark),
+		roundEncoding(nibbles, -1, common.Outside, shift),
 	)
 
 	// Generate round material.
-	for round := 0; round < 9; round++ {
+	out.TBoxTyiTable = make([][16]table.Word, rounds-1)
+	out.MBInverseTable = make([][16]table.Word, rounds-1)
+
+	for round := 0; round < rounds-1; round++ {
 		for pos := 0; pos < 16; pos++ {
 			// Generate a word-sized mixing bijection and stick it on the end of the T-Box/Tyi Table.
-			mb := common.MixingBijection(rs, 32, round, pos/4)
+			mb := mixingBijection(rs, hardening.MixingBijections, 32, round, pos/4)
 
 			// Build the T-Box and Tyi Table for this round and position in the state matrix.
 			out.TBoxTyiTable[round][pos] = encoding.WordTable{
 				encoding.ComposedBytes{
-					encoding.NewByteLinear(common.MixingBijection(rs, 8, round-1, pos)),
-					byteRoundEncoding(rs, round-1, pos, common.Outside, common.NoShift),
+					encoding.NewByteLinear(mixingBijection(rs, hardening.MixingBijections, 8, round-1, pos)),
+					byteRoundEncoding(nibbles, round-1, pos, common.Outside, common.NoShift),
 				},
 				encoding.ComposedWords{
 					encoding.ConcatenatedWord{
-						encoding.NewByteLinear(common.MixingBijection(rs, 8, round, shift(pos/4*4+0))),
-						encoding.NewByteLinear(common.MixingBijection(rs, 8, round, shift(pos/4*4+1))),
-						encoding.NewByteLinear(common.MixingBijection(rs, 8, round, shift(pos/4*4+2))),
-						encoding.NewByteLinear(common.MixingBijection(rs, 8, round, shift(pos/4*4+3))),
+						encoding.NewByteLinear(mixingBijection(rs, hardening.MixingBijections, 8, round, shift(pos/4*4+0))),
+						encoding.NewByteLinear(mixingBijection(rs, hardening.MixingBijections, 8, round, shift(pos/4*4+1))),
+						encoding.NewByteLinear(mixingBijection(rs, hardening.MixingBijections, 8, round, shift(pos/4*4+2))),
+						encoding.NewByteLinear(mixingBijection(rs, hardening.MixingBijections, 8, round, shift(pos/4*4+3))),
 					},
 					encoding.NewWordLinear(mb),
-					wordStepEncoding(rs, round, pos, common.Inside),
+					wordStepEncoding(nibbles, round, pos, common.Inside),
 				},
-				wide(round, pos),
+				step(round, pos),
 			}
 
 			// Encode the inverse of the mixing bijection from above in the MB^(-1) table for this round and position.
 			mbInv, _ := mb.Invert()
 
 			out.MBInverseTable[round][pos] = encoding.WordTable{
-				byteRoundEncoding(rs, round, pos, common.Inside, common.NoShift),
-				wordStepEncoding(rs, round, pos, common.Outside),
+				byteRoundEncoding(nibbles, round, pos, common.Inside, common.NoShift),
+				wordStepEncoding(nibbles, round, pos, common.Outside),
 				mbInverseTable{mbInv, uint(pos) % 4},
 			}
 		}
 	}
 
 	// Generate the High and Low XOR Tables for reach round.
-	out.HighXORTable = xorTables(rs, common.Inside, common.NoShift)
-	out.LowXORTable = xorTables(rs, common.Outside, shift)
+	out.HighXORTable = xorTables(nibbles, rounds, common.Inside, common.NoShift)
+	out.LowXORTable = xorTables(nibbles, rounds, common.Outside, shift)
 
-	// Generate the 10th T-Box/Output Mask slices and XOR tables.
+	// Generate the last round's T-Box/Output Mask slices and XOR tables.
 	for pos := 0; pos < 16; pos++ {
+		mask := common.BlockMatrix{Linear: outputMask.Forwards, Position: pos}
+		if pos == 0 {
+			mask.Constant = outputMask.BlockAdditive
+		}
+
 		out.TBoxOutputMask[pos] = encoding.BlockTable{
 			encoding.ComposedBytes{
-				encoding.NewByteLinear(common.MixingBijection(rs, 8, 8, pos)),
-				byteRoundEncoding(rs, 8, pos, common.Outside, common.NoShift),
+				encoding.NewByteLinear(mixingBijection(rs, hardening.MixingBijections, 8, rounds-2, pos)),
+				byteRoundEncoding(nibbles, rounds-2, pos, common.Outside, common.NoShift),
 			},
-			blockMaskEncoding(rs, pos, common.Outside, shift),
+			blockMaskEncoding(rs, nibbles, pos, common.Outside, shift, hardening.MixingBijections),
 			table.ComposedToBlock{
 				Heads: skinny(pos),
-				Tails: common.BlockMatrix{Linear: *outputMask, Position: pos},
+				Tails: mask,
 			},
 		}
 	}
 
 	out.OutputXORTables = common.BlockNibbleXORTables(
-		maskEncoding(rs, common.Outside),
-		xorEncoding(rs, 10, common.Outside),
+		maskEncoding(nibbles, common.Outside),
+		xorEncoding(nibbles, rounds, common.Outside),
 		func(position int) encoding.Nibble { return encoding.IdentityByte{} },
 	)
+
+	if hardening.Device != nil {
+		bindDevice(rs, out, hardening.Device)
+	}
+
+	if hardening.ShuffleRounds {
+		out.shuffleRounds(randomRoundOrder(rs, rounds))
+	}
+
+	if hardening.WideXORTables {
+		out.WidenXORTables()
+	}
 }
 
 // GenerateEncryptionKeys creates a white-boxed version of AES with given key for encryption, with any non-determinism
-// generated by seed. Opts specifies what type of input and output masks we put on the construction and should be in
-// common.{IndependentMasks, SameMasks, MatchingMasks}.
-func GenerateEncryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask matrix.Matrix) {
+// generated by seed. The key may be 16, 24, or 32 bytes long, for AES-128, AES-192, or AES-256 respectively. Opts
+// specifies what type of input and output masks we put on the construction and should be in
+// common.{IndependentMasks, SameMasks, MatchingMasks}, an Opts wrapping one of those, or a common.Options. The
+// construction computes outputMask(AES(inputMask(x))).
+func GenerateEncryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine) {
 	rs := random.NewSource("Chow Encryption", seed)
 
 	constr := saes.Construction{key}
-	roundKeys := constr.StretchedKey()
-
-	// Apply ShiftRows to round keys 0 to 9.
-	for k := 0; k < 10; k++ {
-		constr.ShiftRows(roundKeys[k])
-	}
+	roundKeys, rounds := common.EncryptionRoundKeys(key), constr.Rounds()
 
 	skinny := func(pos int) table.Byte {
-		return common.TBox{constr, roundKeys[9][pos], roundKeys[10][pos]}
+		return common.TBox{constr, roundKeys[rounds-1][pos], roundKeys[rounds][pos]}
 	}
 
 	wide := func(round, pos int) table.Word {
@@ -116,22 +292,21 @@ func GenerateEncryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (ou
 		}
 	}
 
-	generateKeys(&rs, opts, &out, &inputMask, &outputMask, common.ShiftRows, skinny, wide)
+	generateKeys(&rs, opts, rounds, &out, &inputMask, &outputMask, common.ShiftRows, skinny, wide)
 
 	return
 }
 
 // GenerateDecryptionKeys creates a white-boxed version of AES with given key for decryption, with any non-determinism
-// generated by seed. Opts specifies what type of input and output masks we put on the construction and should be in
-// common.{IndependentMasks, SameMasks, MatchingMasks}.
-func GenerateDecryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask matrix.Matrix) {
+// generated by seed. The key may be 16, 24, or 32 bytes long, for AES-128, AES-192, or AES-256 respectively. Opts
+// specifies what type of input and output masks we put on the construction and should be in
+// common.{IndependentMasks, SameMasks, MatchingMasks}, an Opts wrapping one of those, or a common.Options. The
+// construction computes outputMask(AES(inputMask(x))).
+func GenerateDecryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine) {
 	rs := random.NewSource("Chow Decryption", seed)
 
 	constr := saes.Construction{key}
-	roundKeys := constr.StretchedKey()
-
-	// Last key needs to be unshifted for decryption to work right.
-	constr.UnShiftRows(roundKeys[10])
+	roundKeys, rounds := common.DecryptionRoundKeys(key), constr.Rounds()
 
 	skinny := func(pos int) table.Byte {
 		return common.InvTBox{constr, 0x00, roundKeys[0][pos]}
@@ -140,18 +315,137 @@ func GenerateDecryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (ou
 	wide := func(round, pos int) table.Word {
 		if round == 0 {
 			return table.ComposedToWord{
-				common.InvTBox{Constr: constr, KeyByte1: roundKeys[10][pos], KeyByte2: roundKeys[9][pos]},
+				common.InvTBox{Constr: constr, KeyByte1: roundKeys[rounds][pos], KeyByte2: roundKeys[rounds-1][pos]},
 				common.InvTyiTable(pos % 4),
 			}
 		} else {
 			return table.ComposedToWord{
-				common.InvTBox{Constr: constr, KeyByte2: roundKeys[9-round][pos]},
+				common.InvTBox{Constr: constr, KeyByte2: roundKeys[rounds-1-round][pos]},
 				common.InvTyiTable(pos % 4),
 			}
 		}
 	}
 
-	generateKeys(&rs, opts, &out, &inputMask, &outputMask, common.UnShiftRows, skinny, wide)
+	generateKeys(&rs, opts, rounds, &out, &inputMask, &outputMask, common.UnShiftRows, skinny, wide)
 
 	return
 }
+
+// GenerateVariantKeys builds Chow's table network around the tables of a variant of the construction, which computes
+// each round differently from AES's tables, like the dual ciphers of constructions/karroumi. The seed is expanded into a
+// random.Source with the given name, and decrypt is true if the tables compute decryption, so that the construction is
+// evaluated with Decrypt. skinny(pos) is the table of the last round at the given position, and wide(round, pos) is the
+// table of every other round, which takes a byte of the state to its contribution to its column. Opts are as in
+// GenerateEncryptionKeys.
+func GenerateVariantKeys(name string, seed []byte, opts common.KeyGenerationOpts, rounds int, decrypt bool, skinny func(int) table.Byte, wide func(int, int) table.Word) (out Construction, inputMask, outputMask encoding.BlockAffine) {
+	rs := random.NewSource(name, seed)
+
+	shift := common.ShiftRows
+	if decrypt {
+		shift = common.UnShiftRows
+	}
+
+	generateKeys(&rs, opts, rounds, &out, &inputMask, &outputMask, shift, skinny, wide)
+
+	return
+}
+
+// GenerateEncryptionKeysFrom is like GenerateEncryptionKeys, but reads its seed from rng (see common.ReadSeed). With
+// crypto/rand.Reader, every call generates a different construction. An error is returned if reading from rng fails,
+// or if the self-test requested in opts fails.
+func GenerateEncryptionKeysFrom(key []byte, rng io.Reader, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine, err error) {
+	seed, err := common.ReadSeed(rng)
+	if err != nil {
+		return
+	}
+
+	out, inputMask, outputMask = GenerateEncryptionKeys(key, seed, opts)
+	err = selfTest(&out, key, false, opts, inputMask, outputMask)
+	return
+}
+
+// GenerateDecryptionKeysFrom is like GenerateDecryptionKeys, but reads its seed from rng, like
+// GenerateEncryptionKeysFrom.
+func GenerateDecryptionKeysFrom(key []byte, rng io.Reader, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine, err error) {
+	seed, err := common.ReadSeed(rng)
+	if err != nil {
+		return
+	}
+
+	out, inputMask, outputMask = GenerateDecryptionKeys(key, seed, opts)
+	err = selfTest(&out, key, true, opts, inputMask, outputMask)
+	return
+}
+
+// GenerateEncryptionKeysRandom is like GenerateEncryptionKeys, but takes all of its randomness from crypto/rand, so that
+// no two calls generate the same construction and nothing can be regenerated later. The masks are returned serialized
+// (see SerializeMask), ready to be stored next to the key.
+func GenerateEncryptionKeysRandom(key []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask []byte, err error) {
+	out, input, output, err := GenerateEncryptionKeysFrom(key, rand.Reader, opts)
+	if err != nil {
+		return
+	}
+
+	return out, SerializeMask(input), SerializeMask(output), nil
+}
+
+// GenerateDecryptionKeysRandom is like GenerateDecryptionKeys, but takes all of its randomness from crypto/rand, like
+// GenerateEncryptionKeysRandom.
+func GenerateDecryptionKeysRandom(key []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask []byte, err error) {
+	out, input, output, err := GenerateDecryptionKeysFrom(key, rand.Reader, opts)
+	if err != nil {
+		return
+	}
+
+	return out, SerializeMask(input), SerializeMask(output), nil
+}
+
+// GenerateEncryptionKeysCtx is like GenerateEncryptionKeys, but also precomputes every table (see Precompute), which is
+// where nearly all of the time goes. progress, if non-nil, is called after each table is finished with the number of
+// tables done so far and the total. If ctx is cancelled first, generation stops and ctx's error is returned.
+func GenerateEncryptionKeysCtx(ctx context.Context, key, seed []byte, opts common.KeyGenerationOpts, progress func(done, total int)) (out Construction, inputMask, outputMask encoding.BlockAffine, err error) {
+	out, inputMask, outputMask = GenerateEncryptionKeys(key, seed, opts)
+	if err = out.precompute(ctx, 0, progress); err != nil {
+		return Construction{}, inputMask, outputMask, err
+	}
+
+	err = selfTest(&out, key, false, opts, inputMask, outputMask)
+	return
+}
+
+// GenerateDecryptionKeysCtx is like GenerateDecryptionKeys, but also precomputes every table, reporting progress and
+// respecting cancellation like GenerateEncryptionKeysCtx.
+func GenerateDecryptionKeysCtx(ctx context.Context, key, seed []byte, opts common.KeyGenerationOpts, progress func(done, total int)) (out Construction, inputMask, outputMask encoding.BlockAffine, err error) {
+	out, inputMask, outputMask = GenerateDecryptionKeys(key, seed, opts)
+	if err = out.precompute(ctx, 0, progress); err != nil {
+		return Construction{}, inputMask, outputMask, err
+	}
+
+	err = selfTest(&out, key, true, opts, inputMask, outputMask)
+	return
+}
+
+// GenerateKeyPair creates white-boxed versions of AES with the given key for both encryption and decryption, with any
+// non-determinism generated by seed. Opts specifies the masks on the encryption construction, as in
+// GenerateEncryptionKeys, and inputMask and outputMask are those masks. Hardening options in Opts apply to both.
+//
+// The decryption construction's masks are chosen to be the inverses of the encryption construction's, so the two
+// interoperate without either mask being removed: decrypt.Decrypt(encrypt.Encrypt(x)) = x.
+func GenerateKeyPair(key, seed []byte, opts common.KeyGenerationOpts) (encrypt, decrypt Construction, inputMask, outputMask encoding.BlockAffine) {
+	encrypt, inputMask, outputMask = GenerateEncryptionKeys(key, seed, opts)
+
+	_, hardening := parseOpts(opts)
+	hardening.Masks = common.IndependentMasks{inverseMask(outputMask), inverseMask(inputMask)}
+
+	decrypt, _, _ = GenerateDecryptionKeys(key, seed, hardening)
+
+	return
+}
+
+// inverseMask returns the mask that undoes mask.
+func inverseMask(mask encoding.BlockAffine) common.SpecifiedMask {
+	constant := [16]byte{}
+	copy(constant[:], mask.Backwards.Mul(matrix.Row(mask.BlockAdditive[:])))
+
+	return common.SpecifiedMask{mask.Backwards, constant}
+}
@@ -25,17 +25,50 @@ func (mbinv mbInverseTable) Get(i byte) (out [4]byte) {
 	return
 }
 
+// dummyTable takes the place of a T-Box composed with a Tyi Table in a dummy round. It puts its input in the given row
+// of a word, so that the round only computes ShiftRows. It implements table.Word.
+type dummyTable uint
+
+func (dt dummyTable) Get(i byte) (out [4]byte) {
+	out[dt] = i
+	return
+}
+
+// nibbleSource generates the nibble encodings of a construction. It's implemented by *random.Source, and by
+// identityNibbles for naked constructions.
+type nibbleSource interface {
+	Shuffle(label []byte) encoding.Shuffle
+}
+
+// identityNibbles is the nibbleSource of naked constructions: every nibble encoding is the identity.
+type identityNibbles struct{}
+
+func (identityNibbles) Shuffle(label []byte) (out encoding.Shuffle) {
+	for i := byte(0); i < 16; i++ {
+		out.EncKey[i], out.DecKey[i] = i, i
+	}
+
+	return
+}
+
+// mixingBijection returns the mixing bijection of the given size for the given round and position, or the identity if
+// mbs leaves out mixing bijections of that size.
+func mixingBijection(rs *random.Source, mbs MixingBijections, size, round, position int) matrix.Matrix {
+	if (size == 8 && !mbs.narrow()) || (size == 32 && !mbs.wide()) {
+		return matrix.GenerateIdentity(size)
+	}
+
+	return common.MixingBijection(rs, size, round, position)
+}
+
 // maskEncoding produces encodings for the outputs of the InputMask and OutputMask. All randomness is derived from the
 // random source; surface is common.Inside if these will be the masks between InputMask and InputXORTables or
 // common.Outside if they'll be between TBoxOutputMask and OutputXORTables.
 //
 // See constructions/common/keygen_tools.go for information on the function returned.
-func maskEncoding(rs *random.Source, surface common.Surface) func(int, int) encoding.Nibble {
+func maskEncoding(rs nibbleSource, surface common.Surface) func(int, int) encoding.Nibble {
 	return func(position, subPosition int) encoding.Nibble {
-		label := make([]byte, 16)
-		label[0], label[1], label[2], label[3], label[4] = 'M', 'E', byte(position), byte(subPosition), byte(surface)
-
-		return rs.Shuffle(label)
+		return rs.Shuffle(common.Label("ME", position, subPosition, int(surface)))
 	}
 }
 
@@ -55,12 +88,9 @@ func maskEncoding(rs *random.Source, surface common.Surface) func(int, int) enco
 //     OutputXORTables (from TBoxOutputMask).
 //
 // See constructions/common/keygen_tools.go for information on the function returned.
-func xorEncoding(rs *random.Source, round int, surface common.Surface) func(int, int) encoding.Nibble {
+func xorEncoding(rs nibbleSource, round int, surface common.Surface) func(int, int) encoding.Nibble {
 	return func(position, gate int) encoding.Nibble {
-		label := make([]byte, 16)
-		label[0], label[1], label[2], label[3], label[4] = 'X', byte(round), byte(position), byte(gate), byte(surface)
-
-		return rs.Shuffle(label)
+		return rs.Shuffle(common.Label("X", round, position, gate, int(surface)))
 	}
 }
 
@@ -74,14 +104,11 @@ func xorEncoding(rs *random.Source, round int, surface common.Surface) func(int,
 // TBoxTyiTable.
 //
 // See constructions/common/keygen_tools.go for information on the function returned.
-func roundEncoding(rs *random.Source, round int, surface common.Surface, shift func(int) int) func(int) encoding.Nibble {
+func roundEncoding(rs nibbleSource, round int, surface common.Surface, shift func(int) int) func(int) encoding.Nibble {
 	return func(position int) encoding.Nibble {
 		position = 2*shift(position/2) + position%2
 
-		label := make([]byte, 16)
-		label[0], label[1], label[2], label[3] = 'R', byte(round), byte(position), byte(surface)
-
-		return rs.Shuffle(label)
+		return rs.Shuffle(common.Label("R", round, position, int(surface)))
 	}
 }
 
@@ -89,19 +116,20 @@ func roundEncoding(rs *random.Source, round int, surface common.Surface, shift f
 // it can easily be put on the output of one of the Block tables.
 //
 // position is the index of the Block table and shift is the permutation that will be applied between this round and the
-// next or noshift if this is an input encoding; the other parameters are explained in MaskEncoding documentation.
-func blockMaskEncoding(rs *random.Source, position int, surface common.Surface, shift func(int) int) encoding.Block {
+// next or noshift if this is an input encoding; mbs selects whether the mixing bijection is used; the nibble encodings
+// come from nibbles; the other parameters are explained in MaskEncoding documentation.
+func blockMaskEncoding(rs *random.Source, nibbles nibbleSource, position int, surface common.Surface, shift func(int) int, mbs MixingBijections) encoding.Block {
 	out := encoding.ConcatenatedBlock{}
 
 	for i := 0; i < 16; i++ {
 		out[i] = encoding.ConcatenatedByte{
-			maskEncoding(rs, surface)(position, 2*i+0),
-			maskEncoding(rs, surface)(position, 2*i+1),
+			maskEncoding(nibbles, surface)(position, 2*i+0),
+			maskEncoding(nibbles, surface)(position, 2*i+1),
 		}
 
 		if surface == common.Inside {
 			out[i] = encoding.ComposedBytes{
-				encoding.NewByteLinear(common.MixingBijection(rs, 8, -1, shift(i))),
+				encoding.NewByteLinear(mixingBijection(rs, mbs, 8, -1, shift(i))),
 				out[i],
 			}
 		}
@@ -115,7 +143,7 @@ func blockMaskEncoding(rs *random.Source, position int, surface common.Surface,
 //
 // All randomness is derived from the random source. round is the current round; position is the byte-wise position in
 // the state matrix that's being stretched; subPosition is the nibble-wise position in the Word table's output.
-func stepEncoding(rs *random.Source, round, position, subPosition int, surface common.Surface) encoding.Nibble {
+func stepEncoding(rs nibbleSource, round, position, subPosition int, surface common.Surface) encoding.Nibble {
 	if surface == common.Inside {
 		return tyiEncoding(rs, round, position, subPosition)
 	} else {
@@ -125,7 +153,7 @@ func stepEncoding(rs *random.Source, round, position, subPosition int, surface c
 
 // wordStepEncoding concatenates all the step encodings for the full output of a Word table in TBoxTyiTable or
 // MBInverseTable. Function parameters are explained in the StepEncoding documentation.
-func wordStepEncoding(rs *random.Source, round, position int, surface common.Surface) encoding.Word {
+func wordStepEncoding(rs nibbleSource, round, position int, surface common.Surface) encoding.Word {
 	out := encoding.ConcatenatedWord{}
 
 	for i := 0; i < 4; i++ {
@@ -142,27 +170,21 @@ func wordStepEncoding(rs *random.Source, round, position int, surface common.Sur
 //
 // All randomness is derived from the random source; round is the current round; position is the byte-wise position in
 // the state matrix being stretched; subPosition is the nibble-wise position in the Word table's output.
-func tyiEncoding(rs *random.Source, round, position, subPosition int) encoding.Nibble {
-	label := make([]byte, 16)
-	label[0], label[1], label[2], label[3] = 'T', byte(round), byte(position), byte(subPosition)
-
-	return rs.Shuffle(label)
+func tyiEncoding(rs nibbleSource, round, position, subPosition int) encoding.Nibble {
+	return rs.Shuffle(common.Label("T", round, position, subPosition))
 }
 
 // mbInverseEncoding encodes the output of a MB^(-1) Table / the input of a LowXORTable.
 //
 // All randomness is derived from the random source; round is the current round; position is the byte-wise position in
 // the state matrix being stretched; subPosition is the nibble-wise position in the Word table's output.
-func mbInverseEncoding(rs *random.Source, round, position, subPosition int) encoding.Nibble {
-	label := make([]byte, 16)
-	label[0], label[1], label[2], label[3], label[4] = 'M', 'I', byte(round), byte(position), byte(subPosition)
-
-	return rs.Shuffle(label)
+func mbInverseEncoding(rs nibbleSource, round, position, subPosition int) encoding.Nibble {
+	return rs.Shuffle(common.Label("MI", round, position, subPosition))
 }
 
 // byteRoundEncoding concatenates all the round encodings for a single byte. Function parameters are explained in
 // RoundEncoding documentation.
-func byteRoundEncoding(rs *random.Source, round, position int, surface common.Surface, shift func(int) int) encoding.Byte {
+func byteRoundEncoding(rs nibbleSource, round, position int, surface common.Surface, shift func(int) int) encoding.Byte {
 	return encoding.ConcatenatedByte{
 		roundEncoding(rs, round, surface, shift)(2*position + 0),
 		roundEncoding(rs, round, surface, shift)(2*position + 1),
@@ -2,15 +2,17 @@ package chow
 
 import (
 	"github.com/OpenWhiteBox/primitives/encoding"
-	"github.com/OpenWhiteBox/primitives/random"
 	"github.com/OpenWhiteBox/primitives/table"
 
 	"github.com/OpenWhiteBox/AES/constructions/common"
 )
 
-// xorTables generates the XOR Tables for squashing the result of a Tyi Table or MB^(-1) Table.
-func xorTables(rs *random.Source, surface common.Surface, shift func(int) int) (out [9][32][3]table.Nibble) {
-	for round := 0; round < 9; round++ {
+// xorTables generates the XOR Tables for squashing the result of a Tyi Table or MB^(-1) Table, for each of the first
+// rounds-1 rounds.
+func xorTables(rs nibbleSource, rounds int, surface common.Surface, shift func(int) int) (out [][32][3]table.Nibble) {
+	out = make([][32][3]table.Nibble, rounds-1)
+
+	for round := 0; round < rounds-1; round++ {
 		for pos := 0; pos < 32; pos++ {
 			out[round][pos][0] = encoding.NibbleTable{
 				encoding.ConcatenatedByte{
@@ -0,0 +1,71 @@
+package chow
+
+import (
+	"github.com/OpenWhiteBox/primitives/random"
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// Slot returns the index in the middle tables (TBoxTyiTable, HighXORTable, MBInverseTable, and LowXORTable) where the
+// tables of the given round are stored.
+func (constr *Construction) Slot(round int) int {
+	if constr.RoundOrder == nil {
+		return round
+	}
+
+	return constr.RoundOrder[round]
+}
+
+// shuffleRounds moves the middle tables of each round, which must be in their natural order, to the slot given by order.
+func (constr *Construction) shuffleRounds(order []int) {
+	tboxtyi, high := make([][16]table.Word, len(order)), make([][32][3]table.Nibble, len(order))
+	mbinv, low := make([][16]table.Word, len(order)), make([][32][3]table.Nibble, len(order))
+
+	for round, slot := range order {
+		tboxtyi[slot], high[slot] = constr.TBoxTyiTable[round], constr.HighXORTable[round]
+		mbinv[slot], low[slot] = constr.MBInverseTable[round], constr.LowXORTable[round]
+	}
+
+	constr.TBoxTyiTable, constr.HighXORTable = tboxtyi, high
+	constr.MBInverseTable, constr.LowXORTable = mbinv, low
+	constr.RoundOrder = order
+}
+
+// randomRoundOrder returns a random permutation of the middle rounds of a construction with the given number of rounds.
+func randomRoundOrder(rs *random.Source, rounds int) []int {
+	stream, buff := rs.Stream(common.Label("LO")), make([]byte, 2)
+
+	order := make([]int, rounds-1)
+	for i := range order {
+		order[i] = i
+	}
+
+	for i := len(order) - 1; i > 0; i-- {
+		stream.Read(buff)
+		j := (int(buff[0])<<8 | int(buff[1])) % (i + 1)
+
+		order[i], order[j] = order[j], order[i]
+	}
+
+	return order
+}
+
+// parseRoundOrder parses the order of the middle rounds of a construction with the given number of rounds, as written by
+// writeTables. It returns nil if in isn't a permutation.
+func parseRoundOrder(in []byte, rounds int) []int {
+	if len(in) != rounds-1 {
+		return nil
+	}
+
+	order, seen := make([]int, rounds-1), make([]bool, rounds-1)
+	for round, slot := range in {
+		if int(slot) >= rounds-1 || seen[slot] {
+			return nil
+		}
+
+		order[round], seen[slot] = int(slot), true
+	}
+
+	return order
+}
@@ -0,0 +1,119 @@
+package chow
+
+import (
+	"errors"
+	"io"
+	"os"
+
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// ParseReaderAt parses the serialized construction in the first size bytes of r without loading its tables into memory.
+// Instead, table entries are read from r as they're needed, which is slow but lets a key be used on devices that can't
+// hold one in RAM. Compressed keys (see SerializeCompressed) can't be parsed this way.
+//
+// r must stay open and unchanged for as long as the construction is used. A failed read during encryption or decryption
+// panics, because table lookups can't return errors.
+func ParseReaderAt(r io.ReaderAt, size int64) (constr Construction, err error) {
+	head := make([]byte, common.MaxHeaderSize)
+	if size < int64(len(head)) {
+		head = head[:size]
+	}
+	if _, err = r.ReadAt(head, 0); err != nil {
+		return
+	}
+
+	rounds, off := 0, int64(0)
+	if common.HasHeader(head) {
+		var h common.Header
+		if h, _, err = common.ParseHeader(head, common.ChowConstruction); err != nil {
+			return
+		} else if h.Compressed {
+			return constr, errors.New("Compressed keys can't be parsed lazily!")
+		}
+
+		rounds, off = int(h.Rounds), int64(h.Size())
+		size -= int64(h.TrailerSize())
+		constr.Metadata, constr.KeyLength = h.Metadata, h.KeySize
+
+		if h.Shuffled && validRounds(rounds, h.KeySize) {
+			order := make([]byte, rounds-1)
+			if _, err = r.ReadAt(order, off); err != nil {
+				return
+			} else if constr.RoundOrder = parseRoundOrder(order, rounds); constr.RoundOrder == nil {
+				return constr, errors.New("Parsing the key failed!")
+			}
+
+			off += int64(len(order))
+		}
+	} else {
+		rounds = legacyRounds(size)
+	}
+
+	if !validRounds(rounds, constr.KeyLength) || size-off != int64(fullSize(rounds)) {
+		return constr, errors.New("Parsing the key failed!")
+	}
+
+	lr := &common.LazyReader{R: r, Off: off}
+
+	constr.InputMask, constr.InputXORTables = lr.BlockNibbleMatrix()
+
+	constr.TBoxTyiTable = lazyStepTables(lr, rounds-1)
+	constr.HighXORTable = lazyXORTables(lr, rounds-1)
+
+	constr.MBInverseTable = lazyStepTables(lr, rounds-1)
+	constr.LowXORTable = lazyXORTables(lr, rounds-1)
+
+	constr.TBoxOutputMask, constr.OutputXORTables = lr.BlockNibbleMatrix()
+
+	return constr, nil
+}
+
+// OpenConstruction opens the key file at path and parses it with ParseReaderAt. The file is left open for the
+// construction to read from; close it with the returned io.Closer once the construction is no longer needed.
+func OpenConstruction(path string) (constr Construction, closer io.Closer, err error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	constr, err = ParseReaderAt(f, info.Size())
+	if err != nil {
+		f.Close()
+		return
+	}
+
+	return constr, f, nil
+}
+
+func lazyStepTables(lr *common.LazyReader, rounds int) (out [][16]table.Word) {
+	out = make([][16]table.Word, rounds)
+	for i := 0; i < rounds; i++ {
+		for j := 0; j < 16; j++ {
+			out[i][j] = lr.Word()
+		}
+	}
+
+	return out
+}
+
+func lazyXORTables(lr *common.LazyReader, rounds int) (out [][32][3]table.Nibble) {
+	out = make([][32][3]table.Nibble, rounds)
+	for i := 0; i < rounds; i++ {
+		for j := 0; j < 32; j++ {
+			for k := 0; k < 3; k++ {
+				out[i][j][k] = lr.Nibble()
+			}
+		}
+	}
+
+	return out
+}
@@ -0,0 +1,78 @@
+package chow
+
+import (
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+)
+
+const maskSerializedSize = 2064 // = 128*16 + 16, the size of a serialized affine mask.
+
+// A construction computes outputMask(AES(inputMask(x))), for the masks returned by key generation. The functions below
+// move the first block of a slice, in place, between the masked and unmasked sides of a construction. They work the same
+// for encryption and decryption constructions.
+
+// MaskInput prepares a plaintext block (or ciphertext block, for decryption constructions) to be passed to the
+// construction. The construction applies inputMask to whatever it's given, so the block is passed through its inverse.
+func MaskInput(inputMask encoding.Block, block []byte) { decodeBlock(inputMask, block) }
+
+// UnmaskInput undoes MaskInput, recovering the unmasked block that a construction's input corresponds to.
+func UnmaskInput(inputMask encoding.Block, block []byte) { encodeBlock(inputMask, block) }
+
+// UnmaskOutput removes the output mask from a block returned by the construction, giving the real AES output.
+func UnmaskOutput(outputMask encoding.Block, block []byte) { decodeBlock(outputMask, block) }
+
+// MaskOutput undoes UnmaskOutput, adding the output mask to a real AES output so that it matches what the construction
+// would have returned.
+func MaskOutput(outputMask encoding.Block, block []byte) { encodeBlock(outputMask, block) }
+
+func encodeBlock(enc encoding.Block, block []byte) {
+	temp := [16]byte{}
+	copy(temp[:], block)
+
+	temp = enc.Encode(temp)
+	copy(block, temp[:])
+}
+
+func decodeBlock(enc encoding.Block, block []byte) {
+	temp := [16]byte{}
+	copy(temp[:], block)
+
+	temp = enc.Decode(temp)
+	copy(block, temp[:])
+}
+
+// SerializeMask serializes an affine mask returned by key generation: the 128 rows of its linear part, followed by its
+// constant. The mask is needed to use the construction, so it should be stored as carefully as the AES key.
+func SerializeMask(mask encoding.BlockAffine) []byte {
+	out := make([]byte, 0, maskSerializedSize)
+
+	for _, row := range mask.Forwards {
+		out = append(out, row...)
+	}
+
+	return append(out, mask.BlockAdditive[:]...)
+}
+
+// ParseMask parses a mask serialized by SerializeMask. It returns an error if the byte slice is the wrong length or the
+// linear part isn't invertible.
+func ParseMask(in []byte) (mask encoding.BlockAffine, err error) {
+	if len(in) != maskSerializedSize {
+		return mask, errors.New("Parsing the mask failed!")
+	}
+
+	linear := matrix.Matrix{}
+	for i := 0; i < 128; i++ {
+		linear = append(linear, matrix.Row(append([]byte{}, in[16*i:16*(i+1)]...)))
+	}
+
+	if _, ok := linear.Invert(); !ok {
+		return mask, errors.New("Mask isn't invertible!")
+	}
+
+	constant := [16]byte{}
+	copy(constant[:], in[128*16:])
+
+	return encoding.NewBlockAffine(linear, constant), nil
+}
@@ -0,0 +1,81 @@
+package chow
+
+import (
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// Pack copies every table of the construction into one contiguous slice, laid out in the order Encrypt and Decrypt read
+// them: the input mask, then each round column by column, then the output mask. Each table is replaced by a view into
+// that slice. A parsed key is already contiguous, but grouped by kind of table, so one round touches tables spread
+// across the whole key; after packing, the tables of one column of one round sit next to each other.
+//
+// Tables that aren't precomputed are computed along the way. The wide XOR tables from WidenXORTables, if any, aren't
+// moved.
+func (constr *Construction) Pack() {
+	p := packer{make([]byte, 0, fullSize(constr.Rounds()))}
+
+	for pos := 0; pos < 16; pos++ {
+		constr.InputMask[pos] = p.block(constr.InputMask[pos])
+	}
+	p.nibbles(constr.InputXORTables[:])
+
+	for round := 0; round < len(constr.TBoxTyiTable); round++ {
+		slot := constr.Slot(round)
+
+		for pos := 0; pos < 16; pos += 4 {
+			p.words(constr.TBoxTyiTable[slot][pos : pos+4])
+			p.xorTables(constr.HighXORTable[slot][2*pos : 2*pos+8])
+
+			p.words(constr.MBInverseTable[slot][pos : pos+4])
+			p.xorTables(constr.LowXORTable[slot][2*pos : 2*pos+8])
+		}
+	}
+
+	for pos := 0; pos < 16; pos++ {
+		constr.TBoxOutputMask[pos] = p.block(constr.TBoxOutputMask[pos])
+	}
+	p.nibbles(constr.OutputXORTables[:])
+}
+
+// packer appends tables to a slice that's allocated up front, so that the views it returns never move.
+type packer struct {
+	buf []byte
+}
+
+func (p *packer) view(start int) []byte { return p.buf[start:len(p.buf):len(p.buf)] }
+
+func (p *packer) block(t table.Block) table.Block {
+	start := len(p.buf)
+	p.buf = appendBlock(p.buf, t)
+	return table.ParsedBlock(p.view(start))
+}
+
+func (p *packer) words(t []table.Word) {
+	for i := range t {
+		start := len(p.buf)
+		p.buf = appendWord(p.buf, t[i])
+		t[i] = table.ParsedWord(p.view(start))
+	}
+}
+
+func (p *packer) nibble(t table.Nibble) table.Nibble {
+	start := len(p.buf)
+	p.buf = appendNibble(p.buf, t)
+	return table.ParsedNibble(p.view(start))
+}
+
+func (p *packer) nibbles(t [][15]table.Nibble) {
+	for i := range t {
+		for j := range t[i] {
+			t[i][j] = p.nibble(t[i][j])
+		}
+	}
+}
+
+func (p *packer) xorTables(t [][3]table.Nibble) {
+	for i := range t {
+		for j := range t[i] {
+			t[i][j] = p.nibble(t[i][j])
+		}
+	}
+}
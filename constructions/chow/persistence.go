@@ -1,7 +1,10 @@
 package chow
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
+	"io"
 
 	"github.com/OpenWhiteBox/primitives/table"
 
@@ -9,45 +12,248 @@ import (
 )
 
 const (
-	fullSize = 770048
+	maskSize  = 126976 // = common.SlicesSize + 61440, the size of an input or output mask and its XOR tables.
+	roundSize = 57344  // = 2*16*stepTableSize + 2*32*3*xorTableSize, the size of one round's tables.
 
 	maskTableSize = 256 * 16
 	stepTableSize = 256 * 4
 	xorTableSize  = 256 / 2
 )
 
-// Serialize serializes a white-box construction into a byte slice.
+// fullSize returns the size of the tables of a serialized construction with the given number of AES rounds, not
+// counting the header.
+func fullSize(rounds int) int {
+	return 2*maskSize + (rounds-1)*roundSize
+}
+
+// Serialize serializes a white-box construction into a byte slice. The output starts with a common.Header recording the
+// format version, the number of rounds, and the construction's metadata, followed by every table in a fixed order.
 func (constr *Construction) Serialize() []byte {
-	out, base := make([]byte, fullSize), 0
+	buff := bytes.NewBuffer(make([]byte, 0, constr.Size()))
+	constr.WriteTo(buff)
+
+	return buff.Bytes()
+}
+
+// Size returns the number of bytes in the serialized construction, header included, without serializing it.
+func (constr *Construction) Size() int {
+	return constr.header().Size() + len(constr.RoundOrder) + fullSize(constr.Rounds())
+}
+
+// WriteTo writes the serialized construction to w one table at a time, so that the whole key never has to be buffered
+// in memory. The output is the same as Serialize's. (Implements io.WriterTo.)
+func (constr *Construction) WriteTo(w io.Writer) (int64, error) {
+	sw := &common.StreamWriter{W: w}
+
+	sw.WriteHeader(constr.header())
+	constr.writeTables(sw)
+
+	return sw.N, sw.Err
+}
+
+// SerializeWithMAC is Serialize, but flags the header and appends an HMAC-SHA256 of the whole key under macKey, so that
+// loaders can detect modified keys with VerifyIntegrity. The MAC is ignored by the parsers.
+func (constr *Construction) SerializeWithMAC(macKey []byte) []byte {
+	h := constr.header()
+
+	buff := bytes.NewBuffer(make([]byte, 0, h.Size()+len(constr.RoundOrder)+fullSize(constr.Rounds())+common.MACSize))
+	constr.WriteToWithMAC(buff, macKey)
+
+	return buff.Bytes()
+}
+
+// WriteToWithMAC writes the same output as SerializeWithMAC to w, one table at a time.
+func (constr *Construction) WriteToWithMAC(w io.Writer, macKey []byte) (int64, error) {
+	mac := common.NewMAC(macKey)
+	sw := &common.StreamWriter{W: io.MultiWriter(w, mac)}
+
+	h := constr.header()
+	h.MAC = true
+
+	sw.WriteHeader(h)
+	constr.writeTables(sw)
+
+	sw.W = w
+	sw.Write(mac.Sum(nil))
+
+	return sw.N, sw.Err
+}
+
+// VerifyIntegrity reads a serialized construction from r, up to EOF, and checks that it was written by SerializeWithMAC
+// (or WriteToWithMAC) with the same macKey and hasn't been modified since. It returns an error if the key doesn't have a
+// MAC or the MAC doesn't match.
+func VerifyIntegrity(r io.Reader, macKey []byte) error {
+	return common.VerifyIntegrity(r, common.ChowConstruction, macKey)
+}
+
+// Fingerprint returns the SHA-256 hash of the construction's serialized tables. It identifies the key material, and
+// doesn't change when the key is re-serialized in another format version or its metadata changes.
+func (constr *Construction) Fingerprint() (out [sha256.Size]byte) {
+	h := sha256.New()
+	constr.writeTables(&common.StreamWriter{W: h})
+
+	copy(out[:], h.Sum(nil))
+	return
+}
+
+func (constr *Construction) header() common.Header {
+	return common.Header{
+		Version:  common.CurrentVersion,
+		Type:     common.ChowConstruction,
+		Rounds:   byte(constr.Rounds()),
+		Shuffled: constr.RoundOrder != nil,
+		KeySize:  constr.KeySize(),
+		Metadata: constr.Metadata,
+	}
+}
+
+// writeTables writes every table of the construction to sw, in the order Parse expects them. If the middle tables are
+// shuffled, their order comes first, one byte per round.
+func (constr *Construction) writeTables(sw *common.StreamWriter) {
+	if constr.RoundOrder != nil {
+		order := make([]byte, len(constr.RoundOrder))
+		for round, slot := range constr.RoundOrder {
+			order[round] = byte(slot)
+		}
+
+		sw.Write(order)
+	}
 
 	// Input Mask
-	base += common.SerializeBlockMatrix(out[base:], constr.InputMask, constr.InputXORTables)
+	sw.WriteBlockMatrix(constr.InputMask, constr.InputXORTables)
 
 	// First half of round
-	base += serializeStepTables(out[base:], constr.TBoxTyiTable)
-	base += serializeXORTables(out[base:], constr.HighXORTable)
+	writeStepTables(sw, constr.TBoxTyiTable)
+	writeXORTables(sw, constr.HighXORTable)
 
 	// Second half of round
-	base += serializeStepTables(out[base:], constr.MBInverseTable)
-	base += serializeXORTables(out[base:], constr.LowXORTable)
+	writeStepTables(sw, constr.MBInverseTable)
+	writeXORTables(sw, constr.LowXORTable)
 
 	// Output Mask
-	common.SerializeBlockMatrix(out[base:], constr.TBoxOutputMask, constr.OutputXORTables)
+	sw.WriteBlockMatrix(constr.TBoxOutputMask, constr.OutputXORTables)
+}
 
-	return out
+// ReadConstruction reads one serialized construction from r, one table at a time. Unlike Parse, it requires a versioned
+// header, and it doesn't read past the end of the construction. Compressed keys are decompressed as they're read.
+func ReadConstruction(r io.Reader) (constr Construction, err error) {
+	sr := &common.StreamReader{R: r}
+
+	h := sr.ReadHeader(common.ChowConstruction)
+	if sr.Err != nil {
+		return constr, sr.Err
+	}
+
+	rounds := int(h.Rounds)
+	if !validRounds(rounds, h.KeySize) {
+		return constr, errors.New("Parsing the key failed!")
+	}
+	constr.Metadata, constr.KeyLength = h.Metadata, h.KeySize
+
+	var decompressor io.Reader
+	if h.Compressed {
+		if decompressor, err = newDecompressor(r); err != nil {
+			return constr, err
+		}
+		sr.R = decompressor
+	}
+
+	if h.Shuffled {
+		if constr.RoundOrder = parseRoundOrder(sr.Next(rounds-1), rounds); constr.RoundOrder == nil {
+			if sr.Err != nil {
+				return Construction{}, sr.Err
+			}
+
+			return Construction{}, errors.New("Parsing the key failed!")
+		}
+	}
+
+	constr.InputMask, constr.InputXORTables = sr.ReadBlockNibbleMatrix()
+
+	constr.TBoxTyiTable = readStepTables(sr, rounds-1)
+	constr.HighXORTable = readXORTables(sr, rounds-1)
+
+	constr.MBInverseTable = readStepTables(sr, rounds-1)
+	constr.LowXORTable = readXORTables(sr, rounds-1)
+
+	constr.TBoxOutputMask, constr.OutputXORTables = sr.ReadBlockNibbleMatrix()
+
+	// The compressed stream has to end with the tables.
+	if decompressor != nil && sr.Err == nil {
+		if _, err := decompressor.Read(make([]byte, 1)); err != io.EOF {
+			return Construction{}, errors.New("Decompressing the key failed!")
+		}
+		sr.R = r
+	}
+
+	sr.Next(h.TrailerSize())
+
+	if sr.Err != nil {
+		return Construction{}, sr.Err
+	}
+
+	return constr, nil
 }
 
-// Parse parses a byte array into a white-box construction. It returns an error if the byte array isn't long enough.
+// Parse parses a byte array into a white-box construction. It returns an error if the header is invalid or the byte
+// array is the wrong length.
+//
+// Keys serialized without a header (version 0) are still accepted, and their number of rounds is inferred from their
+// length. Compressed keys are decompressed. A MAC at the end of the key is skipped, not checked; use VerifyIntegrity for
+// that.
 func Parse(in []byte) (constr Construction, err error) {
 	var rest []byte
 
+	rounds, shuffled, compressed := 0, false, false
+	if common.HasHeader(in) {
+		var h common.Header
+		h, in, err = common.ParseHeader(in, common.ChowConstruction)
+		if err != nil {
+			return
+		}
+
+		if len(in) < h.TrailerSize() {
+			return constr, errors.New("Parsing the key failed!")
+		}
+
+		rounds, shuffled, compressed = int(h.Rounds), h.Shuffled, h.Compressed
+		constr.Metadata, constr.KeyLength = h.Metadata, h.KeySize
+		in = in[:len(in)-h.TrailerSize()]
+	} else {
+		rounds = legacyRounds(int64(len(in)))
+	}
+
+	if !validRounds(rounds, constr.KeyLength) {
+		return constr, errors.New("Parsing the key failed!")
+	}
+
+	if compressed {
+		if in, err = decompress(in, rounds); err != nil {
+			return constr, err
+		}
+	}
+
+	if shuffled {
+		if len(in) < rounds-1 {
+			return constr, errors.New("Parsing the key failed!")
+		} else if constr.RoundOrder = parseRoundOrder(in[:rounds-1], rounds); constr.RoundOrder == nil {
+			return constr, errors.New("Parsing the key failed!")
+		}
+
+		in = in[rounds-1:]
+	}
+
+	if len(in) != fullSize(rounds) {
+		return constr, errors.New("Parsing the key failed!")
+	}
+
 	constr.InputMask, constr.InputXORTables, rest = common.ParseBlockNibbleMatrix(in)
 
-	constr.TBoxTyiTable, rest = parseStepTables(rest)
-	constr.HighXORTable, rest = parseXORTables(rest)
+	constr.TBoxTyiTable, rest = parseStepTables(rest, rounds-1)
+	constr.HighXORTable, rest = parseXORTables(rest, rounds-1)
 
-	constr.MBInverseTable, rest = parseStepTables(rest)
-	constr.LowXORTable, rest = parseXORTables(rest)
+	constr.MBInverseTable, rest = parseStepTables(rest, rounds-1)
+	constr.LowXORTable, rest = parseXORTables(rest, rounds-1)
 
 	constr.TBoxOutputMask, constr.OutputXORTables, rest = common.ParseBlockNibbleMatrix(rest)
 
@@ -58,51 +264,95 @@ func Parse(in []byte) (constr Construction, err error) {
 	return
 }
 
-func serializeStepTables(dst []byte, t [9][16]table.Word) int {
-	base := 0
+// validRounds returns true if a construction of an AES key of the given size may have the given number of rounds: 10,
+// 12, or 14, plus any dummy rounds, which come in groups of four. If the key size is 0 (unknown), that's any even number
+// from 10 on.
+func validRounds(rounds, keySize int) bool {
+	if keySize == 0 {
+		return rounds >= 10 && rounds%2 == 0
+	}
+
+	base := keySize/4 + 6
+	return rounds >= base && (rounds-base)%4 == 0
+}
+
+// legacyRounds returns the number of rounds of a key serialized without a header, given its size, or 0 if the size
+// doesn't match any number of rounds.
+func legacyRounds(size int64) int {
+	for _, rounds := range []int{10, 12, 14} {
+		if size == int64(fullSize(rounds)) {
+			return rounds
+		}
+	}
+
+	return 0
+}
+
+func writeStepTables(sw *common.StreamWriter, t [][16]table.Word) {
 	for _, round := range t {
 		for _, pos := range round {
-			base += copy(dst[base:], table.SerializeWord(pos))
+			sw.Write(table.SerializeWord(pos))
 		}
 	}
+}
 
-	return base
+func readStepTables(sr *common.StreamReader, rounds int) (out [][16]table.Word) {
+	out = make([][16]table.Word, rounds)
+	for i := 0; i < rounds; i++ {
+		for j := 0; j < 16; j++ {
+			out[i][j] = table.ParsedWord(sr.Next(stepTableSize))
+		}
+	}
+
+	return out
 }
 
-func parseStepTables(in []byte) (out [9][16]table.Word, rest []byte) {
-	if in == nil || len(in) < stepTableSize*9*16 {
+func parseStepTables(in []byte, rounds int) (out [][16]table.Word, rest []byte) {
+	if in == nil || len(in) < stepTableSize*rounds*16 {
 		return
 	}
 
-	for i := 0; i < 9; i++ {
+	out = make([][16]table.Word, rounds)
+	for i := 0; i < rounds; i++ {
 		for j := 0; j < 16; j++ {
 			loc := 16*i + j
 			out[i][j] = table.ParsedWord(in[stepTableSize*loc : stepTableSize*(loc+1)])
 		}
 	}
 
-	return out, in[stepTableSize*9*16:]
+	return out, in[stepTableSize*rounds*16:]
 }
 
-func serializeXORTables(dst []byte, t [9][32][3]table.Nibble) int {
-	base := 0
+func writeXORTables(sw *common.StreamWriter, t [][32][3]table.Nibble) {
 	for _, round := range t {
 		for _, pos := range round {
 			for _, gate := range pos {
-				base += copy(dst[base:], table.SerializeNibble(gate))
+				sw.Write(table.SerializeNibble(gate))
+			}
+		}
+	}
+}
+
+func readXORTables(sr *common.StreamReader, rounds int) (out [][32][3]table.Nibble) {
+	out = make([][32][3]table.Nibble, rounds)
+	for i := 0; i < rounds; i++ {
+		for j := 0; j < 32; j++ {
+			for k := 0; k < 3; k++ {
+				out[i][j][k] = table.ParsedNibble(sr.Next(xorTableSize))
 			}
 		}
 	}
 
-	return base
+	return out
 }
 
-func parseXORTables(in []byte) (out [9][32][3]table.Nibble, rest []byte) {
-	if in == nil || len(in) < xorTableSize*9*32*3 {
+func parseXORTables(in []byte, rounds int) (out [][32][3]table.Nibble, rest []byte) {
+	if in == nil || len(in) < xorTableSize*rounds*32*3 {
 		return
 	}
 
-	for i := 0; i < 9; i++ {
+	out = make([][32][3]table.Nibble, rounds)
+	for i := 0; i < rounds; i++ {
 		for j := 0; j < 32; j++ {
 			for k := 0; k < 3; k++ {
 				loc := 32*3*i + 3*j + k
@@ -111,5 +361,41 @@ func parseXORTables(in []byte) (out [9][32][3]table.Nibble, rest []byte) {
 		}
 	}
 
-	return out, in[xorTableSize*9*32*3:]
+	return out, in[xorTableSize*rounds*32*3:]
+}
+
+func init() {
+	parse := func(in []byte) (common.Construction, error) {
+		constr, err := Parse(in)
+		if err != nil {
+			return nil, err
+		}
+
+		return &constr, nil
+	}
+
+	common.Register(common.ChowConstruction, parse)
+	common.RegisterLegacy(common.ChowConstruction, parse) // Parse also reads keys serialized without a header.
+}
+
+// Type returns common.ChowConstruction. (Necessary to implement common.Construction.)
+func (constr Construction) Type() common.ConstructionType { return common.ChowConstruction }
+
+// KeySize returns the length of the AES key the construction computes. It's KeyLength if that's known. Otherwise, for
+// keys serialized before the header recorded it, it's read off the number of rounds: dummy rounds come in groups of
+// four, so 14 rounds or any other number 2 more than a multiple of four could be AES-256, or AES-128 with dummy rounds,
+// and KeySize returns 0 for those.
+func (constr Construction) KeySize() int {
+	if constr.KeyLength != 0 {
+		return constr.KeyLength
+	}
+
+	switch rounds := constr.Rounds(); {
+	case rounds == 10:
+		return 16
+	case rounds%4 == 0:
+		return 24
+	default:
+		return 0
+	}
 }
@@ -0,0 +1,121 @@
+package chow
+
+import (
+	"context"
+	"runtime"
+	"sync"
+
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// Precompute evaluates every table of the construction and replaces it with its precomputed form, spreading the work
+// over the given number of goroutines (or GOMAXPROCS, if workers < 1).
+//
+// The tables returned by key generation are computed on every lookup, so nearly all of the cost of generating a key is
+// paid later, by Serialize, and live constructions are slow to encrypt with. Precompute pays it once, up front, in
+// parallel.
+func (constr *Construction) Precompute(workers int) {
+	constr.precompute(context.Background(), workers, nil)
+}
+
+// precompute is Precompute, but stops early with ctx's error if ctx is cancelled, and calls progress (if non-nil) after
+// each table is finished. progress is never called concurrently.
+func (constr *Construction) precompute(ctx context.Context, workers int, progress func(done, total int)) error {
+	if workers < 1 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+
+	jobs := constr.precomputeJobs()
+	queue := make(chan func(), len(jobs))
+	for _, job := range jobs {
+		queue <- job
+	}
+	close(queue)
+
+	finished := make(chan struct{}, len(jobs))
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		go func() {
+			defer wg.Done()
+
+			for job := range queue {
+				if ctx.Err() != nil {
+					return
+				}
+
+				job()
+				finished <- struct{}{}
+			}
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	done := 0
+	for range finished {
+		done++
+
+		if progress != nil {
+			progress(done, len(jobs))
+		}
+	}
+
+	if done < len(jobs) {
+		return ctx.Err()
+	}
+
+	return nil
+}
+
+// precomputeJobs returns one job for every table in the construction, which replaces that table with its precomputed
+// form.
+func (constr *Construction) precomputeJobs() (jobs []func()) {
+	for pos := range constr.InputMask {
+		jobs = append(jobs, precomputeBlock(&constr.InputMask[pos]), precomputeBlock(&constr.TBoxOutputMask[pos]))
+	}
+
+	for i := range constr.InputXORTables {
+		for j := range constr.InputXORTables[i] {
+			jobs = append(jobs,
+				precomputeNibble(&constr.InputXORTables[i][j]), precomputeNibble(&constr.OutputXORTables[i][j]),
+			)
+		}
+	}
+
+	for round := range constr.TBoxTyiTable {
+		for pos := 0; pos < 16; pos++ {
+			jobs = append(jobs,
+				precomputeWord(&constr.TBoxTyiTable[round][pos]), precomputeWord(&constr.MBInverseTable[round][pos]),
+			)
+		}
+
+		for pos := 0; pos < 32; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				jobs = append(jobs,
+					precomputeNibble(&constr.HighXORTable[round][pos][gate]),
+					precomputeNibble(&constr.LowXORTable[round][pos][gate]),
+				)
+			}
+		}
+	}
+
+	return
+}
+
+func precomputeBlock(t *table.Block) func() {
+	return func() { *t = table.ParsedBlock(table.SerializeBlock(*t)) }
+}
+
+func precomputeWord(t *table.Word) func() {
+	return func() { *t = table.ParsedWord(table.SerializeWord(*t)) }
+}
+
+func precomputeNibble(t *table.Nibble) func() {
+	return func() { *t = table.ParsedNibble(table.SerializeNibble(*t)) }
+}
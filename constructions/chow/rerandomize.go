@@ -0,0 +1,243 @@
+package chow
+
+import (
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/random"
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// Rerandomize returns a new construction that computes the same function as constr, up to fresh external masks, without
+// needing the AES key. inputMask and outputMask are constr's masks, and newInputMask and newOutputMask are the masks of
+// the new construction. All randomness is derived from seed.
+//
+// Every nibble passed between two tables gets a fresh random encoding, on top of the one it already had. The exceptions
+// are the nibbles passed between rounds: a construction doesn't record whether it encrypts or decrypts, so it isn't
+// known which byte of one round feeds which byte of the next, only that they're in the same row. Those nibbles share one
+// fresh encoding per row. The external masks are refreshed with a random affine transformation on each input byte and
+// each output nibble.
+//
+// The mixing bijections are hidden under the nibble encodings and can't be refreshed without the AES key. Rerandomize
+// panics if constr has been activated (see Activate), since the new construction would drop its binding.
+func (constr *Construction) Rerandomize(seed []byte, inputMask, outputMask encoding.BlockAffine) (out Construction, newInputMask, newOutputMask encoding.BlockAffine) {
+	if constr.Binding != nil {
+		panic("Can't rerandomize an activated construction!")
+	}
+
+	rs := random.NewSource("Chow Rerandomization", seed)
+	rounds := constr.Rounds()
+
+	// Refresh the external encodings.
+	inputRefresh, outputRefresh := encoding.ConcatenatedBlock{}, encoding.ConcatenatedBlock{}
+	for pos := 0; pos < 16; pos++ {
+		inputRefresh[pos] = affineByte(&rs, pos)
+		outputRefresh[pos] = encoding.ConcatenatedByte{affineNibble(&rs, 2*pos+0), affineNibble(&rs, 2*pos+1)}
+	}
+
+	// The Input Mask tables decode their input with inputRefresh, so the new input mask is inputMask after its inverse.
+	newInputMask, _ = encoding.DecomposeBlockAffine(encoding.ComposedBlocks{encoding.InverseBlock{inputRefresh}, inputMask})
+	newOutputMask, _ = encoding.DecomposeBlockAffine(encoding.ComposedBlocks{outputMask, outputRefresh})
+
+	// cross is the encoding of the nibble at nibble-wise position pos passed into the given round (where round = rounds-1
+	// is the output mask) from the one before it. crossByte concatenates the encodings of the byte at pos.
+	cross := func(round, pos int) encoding.Nibble { return wire(&rs, 'C', round, pos/2%4, pos%2) }
+	crossByte := func(round, pos int) encoding.Byte {
+		return encoding.ConcatenatedByte{cross(round, 2*pos+0), cross(round, 2*pos+1)}
+	}
+
+	// Input Mask
+	for pos := 0; pos < 16; pos++ {
+		out.InputMask[pos] = encoding.BlockTable{
+			inputRefresh[pos],
+			wireBlock(&rs, 'I', pos),
+			constr.InputMask[pos],
+		}
+	}
+
+	out.InputXORTables = rerandomizeBlockXORTables(&rs, 'I', constr.InputXORTables,
+		func(pos int) encoding.Nibble { return cross(0, pos) },
+	)
+
+	// Rounds
+	out.TBoxTyiTable = make([][16]table.Word, rounds-1)
+	out.HighXORTable = make([][32][3]table.Nibble, rounds-1)
+	out.MBInverseTable = make([][16]table.Word, rounds-1)
+	out.LowXORTable = make([][32][3]table.Nibble, rounds-1)
+
+	for round := 0; round < rounds-1; round++ {
+		slot := constr.Slot(round)
+
+		for pos := 0; pos < 16; pos++ {
+			out.TBoxTyiTable[round][pos] = encoding.WordTable{
+				crossByte(round, pos),
+				wireWord(&rs, 'T', round, pos),
+				constr.TBoxTyiTable[slot][pos],
+			}
+
+			out.MBInverseTable[round][pos] = encoding.WordTable{
+				encoding.ConcatenatedByte{wire(&rs, 'H', round, 2*pos+0, 2), wire(&rs, 'H', round, 2*pos+1, 2)},
+				wireWord(&rs, 'M', round, pos),
+				constr.MBInverseTable[slot][pos],
+			}
+		}
+
+		out.HighXORTable[round] = rerandomizeWordXORTables(&rs, 'T', 'H', round, constr.HighXORTable[slot],
+			func(pos int) encoding.Nibble { return wire(&rs, 'H', round, pos, 2) },
+		)
+
+		out.LowXORTable[round] = rerandomizeWordXORTables(&rs, 'M', 'L', round, constr.LowXORTable[slot],
+			func(pos int) encoding.Nibble { return cross(round+1, pos) },
+		)
+	}
+
+	// Output Mask
+	for pos := 0; pos < 16; pos++ {
+		out.TBoxOutputMask[pos] = encoding.BlockTable{
+			crossByte(rounds-1, pos),
+			wireBlock(&rs, 'O', pos),
+			constr.TBoxOutputMask[pos],
+		}
+	}
+
+	out.OutputXORTables = rerandomizeBlockXORTables(&rs, 'O', constr.OutputXORTables,
+		func(pos int) encoding.Nibble { return affineNibble(&rs, pos) },
+	)
+
+	if constr.RoundOrder != nil {
+		out.shuffleRounds(append([]int{}, constr.RoundOrder...))
+	}
+	out.KeyLength = constr.KeyLength
+
+	out.Precompute(0)
+
+	return
+}
+
+// rerandomizeBlockXORTables re-encodes the XOR tables that squash the output of the Block tables whose outputs were
+// given fresh encodings by wireBlock(rs, kind, ·). result(pos) is the new encoding of the final result at nibble-wise
+// position pos.
+func rerandomizeBlockXORTables(rs *random.Source, kind byte, xor [32][15]table.Nibble, result func(int) encoding.Nibble) (out [32][15]table.Nibble) {
+	gate := kind + 'a' - 'A'
+
+	for pos := 0; pos < 32; pos++ {
+		for i := 0; i < 15; i++ {
+			var acc encoding.Nibble
+			if i == 0 {
+				acc = wire(rs, kind, 0, pos, 0)
+			} else {
+				acc = wire(rs, gate, pos, i-1, 0)
+			}
+
+			var res encoding.Nibble
+			if i < 14 {
+				res = wire(rs, gate, pos, i, 0)
+			} else {
+				res = result(pos)
+			}
+
+			out[pos][i] = encoding.NibbleTable{
+				encoding.ConcatenatedByte{acc, wire(rs, kind, i+1, pos, 0)},
+				res,
+				xor[pos][i],
+			}
+		}
+	}
+
+	return
+}
+
+// rerandomizeWordXORTables re-encodes the XOR tables of one round that squash the output of the Word tables whose
+// outputs were given fresh encodings by wireWord(rs, in, round, ·). Intermediate values get fresh encodings labeled
+// with kind, and the final result at nibble-wise position pos is encoded with result(pos).
+func rerandomizeWordXORTables(rs *random.Source, in, kind byte, round int, xor [32][3]table.Nibble, result func(int) encoding.Nibble) (out [32][3]table.Nibble) {
+	for pos := 0; pos < 32; pos++ {
+		col, sub := pos/8*4, pos%8
+
+		for i := 0; i < 3; i++ {
+			var acc encoding.Nibble
+			if i == 0 {
+				acc = wire(rs, in, round, col, sub)
+			} else {
+				acc = wire(rs, kind, round, pos, i-1)
+			}
+
+			var res encoding.Nibble
+			if i < 2 {
+				res = wire(rs, kind, round, pos, i)
+			} else {
+				res = result(pos)
+			}
+
+			out[pos][i] = encoding.NibbleTable{
+				encoding.ConcatenatedByte{acc, wire(rs, in, round, col+i+1, sub)},
+				res,
+				xor[pos][i],
+			}
+		}
+	}
+
+	return
+}
+
+// wire returns a fresh encoding for one of the nibbles passed between two tables, identified by a kind and position.
+func wire(rs *random.Source, kind byte, a, b, c int) encoding.Nibble {
+	return rs.Shuffle(common.Label("W"+string(kind), a, b, c))
+}
+
+// wireWord concatenates the fresh encodings of the output of a Word table at the given round and position.
+func wireWord(rs *random.Source, kind byte, round, pos int) encoding.Word {
+	out := encoding.ConcatenatedWord{}
+
+	for i := 0; i < 4; i++ {
+		out[i] = encoding.ConcatenatedByte{wire(rs, kind, round, pos, 2*i+0), wire(rs, kind, round, pos, 2*i+1)}
+	}
+
+	return out
+}
+
+// wireBlock concatenates the fresh encodings of the output of the Block table at the given position.
+func wireBlock(rs *random.Source, kind byte, pos int) encoding.Block {
+	out := encoding.ConcatenatedBlock{}
+
+	for i := 0; i < 16; i++ {
+		out[i] = encoding.ConcatenatedByte{wire(rs, kind, pos, 2*i+0, 0), wire(rs, kind, pos, 2*i+1, 0)}
+	}
+
+	return out
+}
+
+// affineByte returns a random affine transformation of the input byte at the given position.
+func affineByte(rs *random.Source, pos int) encoding.Byte {
+	constant := make([]byte, 1)
+	rs.Stream(common.Label("AB", pos)).Read(constant)
+
+	return encoding.ByteAffine{encoding.NewByteLinear(rs.Matrix(common.Label("AL", pos), 8)), encoding.ByteAdditive(constant[0])}
+}
+
+// affineNibble returns a random affine transformation of the output nibble at the given position.
+func affineNibble(rs *random.Source, pos int) encoding.Nibble {
+	stream := rs.Stream(common.Label("AN", pos))
+	buff := make([]byte, 5)
+
+	for {
+		stream.Read(buff)
+
+		out, seen := encoding.Shuffle{}, 0
+		for x := byte(0); x < 16; x++ {
+			y := buff[4] & 0x0f
+			for bit := uint(0); bit < 4; bit++ {
+				if x>>bit&1 == 1 {
+					y ^= buff[bit] & 0x0f
+				}
+			}
+
+			out.EncKey[x], out.DecKey[y] = y, x
+			seen |= 1 << y
+		}
+
+		if seen == 0xffff { // The linear part is invertible.
+			return out
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package chow
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// SelfTest checks the construction against crypto/aes on n random blocks. Each block is masked with inputMask, pushed
+// through the construction (decrypting if decrypt is set), unmasked with outputMask, and compared to the output of AES
+// under key. An error is returned on the first mismatch, which means a bug in table generation or a corrupted key.
+func (constr *Construction) SelfTest(key []byte, decrypt bool, inputMask, outputMask encoding.Block, n int) error {
+	real, err := aes.NewCipher(key)
+	if err != nil {
+		return err
+	}
+
+	crypt, realCrypt := constr.Encrypt, real.Encrypt
+	if decrypt {
+		crypt, realCrypt = constr.Decrypt, real.Decrypt
+	}
+
+	in, cand, out := make([]byte, 16), make([]byte, 16), make([]byte, 16)
+
+	for i := 0; i < n; i++ {
+		if _, err := rand.Read(in); err != nil {
+			return err
+		}
+		realCrypt(out, in)
+
+		copy(cand, in)
+		MaskInput(inputMask, cand)
+		crypt(cand, cand)
+		UnmaskOutput(outputMask, cand)
+
+		if !bytes.Equal(out, cand) {
+			return errors.New("Construction disagrees with AES!")
+		}
+	}
+
+	return nil
+}
+
+// selfTest runs the self-test requested by opts, if any, on a freshly generated construction. A construction bound to a
+// device only computes AES once it's activated, so a copy of it is activated for the device and tested instead.
+func selfTest(constr *Construction, key []byte, decrypt bool, opts common.KeyGenerationOpts, inputMask, outputMask encoding.BlockAffine) error {
+	_, hardening := parseOpts(opts)
+	if hardening.SelfTest <= 0 {
+		return nil
+	}
+
+	if device := hardening.Device; device != nil {
+		activated := *constr
+		activated.Activate(&device.Activation, device.Fingerprint)
+
+		return activated.SelfTest(key, decrypt, inputMask, outputMask, hardening.SelfTest)
+	}
+
+	return constr.SelfTest(key, decrypt, inputMask, outputMask, hardening.SelfTest)
+}
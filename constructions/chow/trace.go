@@ -0,0 +1,256 @@
+package chow
+
+import (
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// TableKind is one of the families of tables in a Construction, as named by its fields.
+type TableKind byte
+
+const (
+	InputMaskTable TableKind = iota
+	InputXORTable
+	TBoxTyiTable
+	HighXORTable
+	MBInverseTable
+	LowXORTable
+	HighWideXORTable
+	LowWideXORTable
+	TBoxOutputMaskTable
+	OutputXORTable
+)
+
+// indexSize returns the number of bytes of input that tables of this kind take.
+func (tk TableKind) indexSize() int {
+	if tk == HighWideXORTable || tk == LowWideXORTable {
+		return 2
+	}
+
+	return 1
+}
+
+// outputSize returns the number of bytes of output that tables of this kind give.
+func (tk TableKind) outputSize() int {
+	switch tk {
+	case InputMaskTable, TBoxOutputMaskTable:
+		return 16
+	case TBoxTyiTable, MBInverseTable:
+		return 4
+	default:
+		return 1
+	}
+}
+
+// TableID identifies one table of a construction. Round is the round of the middle tables, counted in the order they're
+// computed (so dummy rounds included, and regardless of RoundOrder), and is zero for the tables on the input and output.
+// Position and Gate are the table's indices in its field, with Gate zero for tables that don't have one.
+type TableID struct {
+	Kind                  TableKind
+	Round, Position, Gate byte
+}
+
+// Lookup is one read from a table: which table, the index read, and the value it gave.
+type Lookup struct {
+	Table  TableID
+	Index  [2]byte  // Only the first byte is used, except by wide XOR tables.
+	Output [16]byte // Only as many bytes as the table outputs are used.
+}
+
+// Value returns the part of Output the table actually wrote.
+func (l Lookup) Value() []byte { return l.Output[:l.Table.Kind.outputSize()] }
+
+// Trace is every table lookup made by one encryption or decryption, in order.
+type Trace []Lookup
+
+// Serialize encodes the trace compactly: every lookup is the four bytes of its TableID, followed by only the bytes of
+// its index and output that the kind of table uses.
+func (t Trace) Serialize() []byte {
+	out := make([]byte, 0, 6*len(t))
+
+	for _, l := range t {
+		id := l.Table
+		out = append(out, byte(id.Kind), id.Round, id.Position, id.Gate)
+		out = append(out, l.Index[:id.Kind.indexSize()]...)
+		out = append(out, l.Value()...)
+	}
+
+	return out
+}
+
+// ParseTrace parses a trace serialized with Serialize.
+func ParseTrace(in []byte) (Trace, error) {
+	out := Trace{}
+
+	for len(in) > 0 {
+		if len(in) < 4 || TableKind(in[0]) > OutputXORTable {
+			return nil, errors.New("Parsing the trace failed!")
+		}
+
+		l := Lookup{Table: TableID{TableKind(in[0]), in[1], in[2], in[3]}}
+		in = in[4:]
+
+		indexSize, outputSize := l.Table.Kind.indexSize(), l.Table.Kind.outputSize()
+		if len(in) < indexSize+outputSize {
+			return nil, errors.New("Parsing the trace failed!")
+		}
+
+		copy(l.Index[:], in[:indexSize])
+		copy(l.Output[:], in[indexSize:indexSize+outputSize])
+		in = in[indexSize+outputSize:]
+
+		out = append(out, l)
+	}
+
+	return out, nil
+}
+
+// TracedConstruction computes the same thing as the construction it was made from, and records a Trace of every
+// encryption and decryption. It's the substrate for side-channel analyses like cryptanalysis/dca, which see a white-box
+// the way a debugger attached to it would.
+//
+// A TracedConstruction must not be used from more than one goroutine at a time: the trace is kept in the
+// TracedConstruction, not on the stack.
+type TracedConstruction struct {
+	constr Construction
+	trace  *Trace
+}
+
+// NewTracedConstruction returns a TracedConstruction over a copy of constr's tables. constr isn't modified.
+func NewTracedConstruction(constr *Construction) *TracedConstruction {
+	tc := &TracedConstruction{constr: *constr, trace: &Trace{}}
+	c, t := &tc.constr, tc.trace
+
+	// The unpacked XOR tables would bypass the traced ones.
+	c.unpacked = nil
+
+	for pos := 0; pos < 16; pos++ {
+		c.InputMask[pos] = tracedBlock{c.InputMask[pos], TableID{InputMaskTable, 0, byte(pos), 0}, t}
+		c.TBoxOutputMask[pos] = tracedBlock{c.TBoxOutputMask[pos], TableID{TBoxOutputMaskTable, 0, byte(pos), 0}, t}
+	}
+	for pos := 0; pos < 32; pos++ {
+		for gate := 0; gate < 15; gate++ {
+			c.InputXORTables[pos][gate] = tracedNibble{c.InputXORTables[pos][gate], TableID{InputXORTable, 0, byte(pos), byte(gate)}, t}
+			c.OutputXORTables[pos][gate] = tracedNibble{c.OutputXORTables[pos][gate], TableID{OutputXORTable, 0, byte(pos), byte(gate)}, t}
+		}
+	}
+
+	c.TBoxTyiTable = append([][16]table.Word(nil), c.TBoxTyiTable...)
+	c.MBInverseTable = append([][16]table.Word(nil), c.MBInverseTable...)
+	c.HighXORTable = append([][32][3]table.Nibble(nil), c.HighXORTable...)
+	c.LowXORTable = append([][32][3]table.Nibble(nil), c.LowXORTable...)
+	if c.HighWideXORTable != nil {
+		c.HighWideXORTable = append([][16][3]table.DoubleToByte(nil), c.HighWideXORTable...)
+		c.LowWideXORTable = append([][16][3]table.DoubleToByte(nil), c.LowWideXORTable...)
+	}
+
+	for round := range c.TBoxTyiTable {
+		slot, r := c.Slot(round), byte(round)
+
+		for pos := 0; pos < 16; pos++ {
+			c.TBoxTyiTable[slot][pos] = tracedWord{c.TBoxTyiTable[slot][pos], TableID{TBoxTyiTable, r, byte(pos), 0}, t}
+			c.MBInverseTable[slot][pos] = tracedWord{c.MBInverseTable[slot][pos], TableID{MBInverseTable, r, byte(pos), 0}, t}
+		}
+
+		for pos := 0; pos < 32; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				id := TableID{HighXORTable, r, byte(pos), byte(gate)}
+				c.HighXORTable[slot][pos][gate] = tracedNibble{c.HighXORTable[slot][pos][gate], id, t}
+
+				id.Kind = LowXORTable
+				c.LowXORTable[slot][pos][gate] = tracedNibble{c.LowXORTable[slot][pos][gate], id, t}
+			}
+		}
+
+		if c.HighWideXORTable == nil {
+			continue
+		}
+		for pos := 0; pos < 16; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				id := TableID{HighWideXORTable, r, byte(pos), byte(gate)}
+				c.HighWideXORTable[slot][pos][gate] = tracedDoubleToByte{c.HighWideXORTable[slot][pos][gate], id, t}
+
+				id.Kind = LowWideXORTable
+				c.LowWideXORTable[slot][pos][gate] = tracedDoubleToByte{c.LowWideXORTable[slot][pos][gate], id, t}
+			}
+		}
+	}
+
+	return tc
+}
+
+// BlockSize returns the block size of AES. (Necessary to implement cipher.Block.)
+func (tc *TracedConstruction) BlockSize() int { return 16 }
+
+// Encrypt encrypts the first block in src into dst, and records its trace. Dst and src may point at the same memory.
+func (tc *TracedConstruction) Encrypt(dst, src []byte) {
+	*tc.trace = (*tc.trace)[:0]
+	tc.constr.Encrypt(dst, src)
+}
+
+// Decrypt decrypts the first block in src into dst, and records its trace. Dst and src may point at the same memory.
+func (tc *TracedConstruction) Decrypt(dst, src []byte) {
+	*tc.trace = (*tc.trace)[:0]
+	tc.constr.Decrypt(dst, src)
+}
+
+// Trace returns a copy of the trace of the last call to Encrypt or Decrypt.
+func (tc *TracedConstruction) Trace() Trace {
+	return append(Trace(nil), *tc.trace...)
+}
+
+type tracedNibble struct {
+	table.Nibble
+	id    TableID
+	trace *Trace
+}
+
+func (tn tracedNibble) Get(i byte) byte {
+	out := tn.Nibble.Get(i)
+	*tn.trace = append(*tn.trace, Lookup{Table: tn.id, Index: [2]byte{i}, Output: [16]byte{out}})
+
+	return out
+}
+
+type tracedWord struct {
+	table.Word
+	id    TableID
+	trace *Trace
+}
+
+func (tw tracedWord) Get(i byte) [4]byte {
+	out := tw.Word.Get(i)
+
+	l := Lookup{Table: tw.id, Index: [2]byte{i}}
+	copy(l.Output[:], out[:])
+	*tw.trace = append(*tw.trace, l)
+
+	return out
+}
+
+type tracedBlock struct {
+	table.Block
+	id    TableID
+	trace *Trace
+}
+
+func (tb tracedBlock) Get(i byte) [16]byte {
+	out := tb.Block.Get(i)
+	*tb.trace = append(*tb.trace, Lookup{Table: tb.id, Index: [2]byte{i}, Output: out})
+
+	return out
+}
+
+type tracedDoubleToByte struct {
+	table.DoubleToByte
+	id    TableID
+	trace *Trace
+}
+
+func (td tracedDoubleToByte) Get(i [2]byte) byte {
+	out := td.DoubleToByte.Get(i)
+	*td.trace = append(*td.trace, Lookup{Table: td.id, Index: i, Output: [16]byte{out}})
+
+	return out
+}
@@ -0,0 +1,119 @@
+package chow
+
+import (
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/random"
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// MaxWatermark is the longest watermark a construction can carry, in bytes. The watermark and a byte of its length take
+// one bit per wire between the input XOR tables, of which there are 32*14.
+const MaxWatermark = 32*14/8 - 1
+
+// composedNibble applies First and then Second.
+type composedNibble struct{ First, Second encoding.Nibble }
+
+func (cn composedNibble) Encode(i byte) byte { return cn.Second.Encode(cn.First.Encode(i)) }
+func (cn composedNibble) Decode(i byte) byte { return cn.First.Decode(cn.Second.Decode(i)) }
+
+// watermarkBit returns bit i of the watermark's payload: its length and then the watermark, most significant bit first.
+func watermarkBit(mark []byte, i int) bool {
+	if i < 8 {
+		return (len(mark)>>uint(7-i))&1 == 1
+	} else if i/8-1 < len(mark) {
+		return (mark[i/8-1]>>uint(7-i%8))&1 == 1
+	}
+
+	return false
+}
+
+// watermarkEncoding is the encoding a set bit of a watermark adds to the wire after the given gate of the input XOR
+// tables.
+func watermarkEncoding(rs nibbleSource, position, gate int) encoding.Nibble {
+	return rs.Shuffle(common.Label("WM", position, gate))
+}
+
+// watermarkedXOREncoding is xor, the encodings of the wires between the input XOR tables, with mark embedded in them.
+// Each bit of the payload chooses whether one wire's encoding is composed with an extra random bijection. The tables on
+// both ends of the wire get the same encoding, so the construction computes the same function either way.
+func watermarkedXOREncoding(rs nibbleSource, xor func(int, int) encoding.Nibble, mark []byte) func(int, int) encoding.Nibble {
+	if len(mark) > MaxWatermark {
+		panic("Watermark is too long!")
+	}
+
+	return func(position, gate int) encoding.Nibble {
+		if watermarkBit(mark, 14*position+gate) {
+			return composedNibble{xor(position, gate), watermarkEncoding(rs, position, gate)}
+		}
+
+		return xor(position, gate)
+	}
+}
+
+// ExtractWatermark recovers the watermark embedded in a construction by Opts.Watermark, given the seed it was generated
+// from and whether it's a decryption key. The AES key isn't needed. It returns an error if the input XOR tables don't
+// match what the seed would generate, because the construction came from another seed or has been rerandomized.
+//
+// Every licensee's key generated from the same key and seed is identical except for the watermark, so two licensees who
+// compare their keys can find and change the bits they disagree on. Tracing colluders is up to the choice of watermarks.
+func ExtractWatermark(constr *Construction, seed []byte, decrypt bool) ([]byte, error) {
+	rs := random.NewSource("Chow Encryption", seed)
+	if decrypt {
+		rs = random.NewSource("Chow Decryption", seed)
+	}
+
+	slice := maskEncoding(&rs, common.Inside)
+	xor := xorEncoding(&rs, constr.Rounds(), common.Inside)
+
+	payload := make([]byte, 1+MaxWatermark)
+	size := len(payload)
+
+	for i := 0; i < 8*size; i++ {
+		pos, gate := i/14, i%14
+
+		var in encoding.Nibble = slice(0, pos)
+		if gate > 0 {
+			in = xor(pos, gate-1)
+			if payload[(i-1)/8]&(0x80>>uint((i-1)%8)) != 0 {
+				in = composedNibble{in, watermarkEncoding(&rs, pos, gate-1)}
+			}
+		}
+
+		real := constr.InputXORTables[pos][gate]
+		plain := encoding.NibbleTable{encoding.ConcatenatedByte{in, slice(gate+1, pos)}, xor(pos, gate), common.NibbleXORTable{}}
+		marked := plain
+		marked.Out = composedNibble{plain.Out, watermarkEncoding(&rs, pos, gate)}
+
+		switch {
+		case equalNibbleTables(real, plain):
+		case equalNibbleTables(real, marked):
+			payload[i/8] |= 0x80 >> uint(i%8)
+		default:
+			return nil, errors.New("Construction wasn't generated from this seed!")
+		}
+
+		if i == 7 {
+			if int(payload[0]) > MaxWatermark {
+				return nil, errors.New("Watermark is too long!")
+			}
+			size = 1 + int(payload[0])
+		}
+	}
+
+	return payload[1:size], nil
+}
+
+// equalNibbleTables returns whether a and b agree on every input.
+func equalNibbleTables(a, b table.Nibble) bool {
+	for x := 0; x < 256; x++ {
+		if a.Get(byte(x)) != b.Get(byte(x)) {
+			return false
+		}
+	}
+
+	return true
+}
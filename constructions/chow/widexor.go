@@ -0,0 +1,47 @@
+package chow
+
+import (
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// WidenXORTables merges each pair of nibble XOR tables in the middle rounds that squash the same byte into one table
+// with two bytes of input and one byte of output, stored in HighWideXORTable and LowWideXORTable. Encrypt and Decrypt
+// use the wide tables when they're present, which halves the number of XOR table lookups in each round.
+//
+// The wide tables are computed from the nibble tables, under the same encodings, so they add nothing an attacker
+// doesn't already have. They aren't serialized or carried over by Rerandomize; call WidenXORTables again after parsing.
+// They're also big: 64KB each, which is 6MB for every round, or 54MB for AES-128, against 750KB for the whole serialized
+// key. Unless the wide tables fit in cache, the extra misses cost more than the lookups saved, so compare
+// BenchmarkDeadEncryptWide with BenchmarkDeadEncrypt before turning them on.
+func (constr *Construction) WidenXORTables() {
+	constr.HighWideXORTable = widenXORTables(constr.HighXORTable)
+	constr.LowWideXORTable = widenXORTables(constr.LowXORTable)
+}
+
+// widenXORTables merges the XOR tables of each round in t, for WidenXORTables.
+func widenXORTables(t [][32][3]table.Nibble) (out [][16][3]table.DoubleToByte) {
+	out = make([][16][3]table.DoubleToByte, len(t))
+
+	for round := range t {
+		for pos := 0; pos < 16; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				out[round][pos][gate] = common.WidenXORTable(t[round][2*pos+0][gate], t[round][2*pos+1][gate])
+			}
+		}
+	}
+
+	return
+}
+
+// SquashWordsWide is SquashWords with the merged XOR tables from WidenXORTables: one lookup per byte of each XOR.
+func (constr *Construction) SquashWordsWide(xorTable [][3]table.DoubleToByte, words [4][4]byte, dst []byte) {
+	copy(dst, words[0][:])
+
+	for i := 1; i < 4; i++ {
+		for pos := 0; pos < 4; pos++ {
+			dst[pos] = xorTable[pos][i-1].Get([2]byte{dst[pos], words[i][pos]})
+		}
+	}
+}
@@ -1,7 +1,17 @@
 package common
 
 import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"testing"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+	"github.com/OpenWhiteBox/primitives/random"
+
+	"github.com/OpenWhiteBox/AES/constructions/saes"
 )
 
 func TestTyiTable(t *testing.T) {
@@ -24,3 +34,349 @@ func TestTyiTable(t *testing.T) {
 		t.Fatalf("Real disagrees with result! %v != %v", out, cand)
 	}
 }
+
+func TestDeriveSeed(t *testing.T) {
+	// RFC 5869, test case 3, with the output truncated to one block.
+	ikm, _ := hex.DecodeString("0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b0b")
+	out, _ := hex.DecodeString("8da4e775a563c18f715f802a063c5a31b8a11f5c5ee1879ec3454e5f3c738d2d")
+
+	if cand := DeriveSeed(ikm, nil); !bytes.Equal(out, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", out, cand)
+	}
+
+	if bytes.Equal(DeriveSeed(ikm, []byte("key 1")), DeriveSeed(ikm, []byte("key 2"))) {
+		t.Fatalf("Different contexts gave the same seed!")
+	}
+}
+
+// bytePermutationMask is a mask that reverses the bytes of a block, to check that masks other than the built-in ones
+// can be plugged into key generation.
+type bytePermutationMask struct{}
+
+func (bytePermutationMask) Generate(rs *random.Source, surface Surface, size int) (matrix.Matrix, matrix.Row) {
+	linear := matrix.GenerateEmpty(size, size)
+	for i := 0; i < size; i++ {
+		linear[i].SetBit(size-8*(i/8+1)+i%8, true)
+	}
+
+	return linear, matrix.NewRow(size)
+}
+
+func TestCustomMask(t *testing.T) {
+	rs := random.NewSource("Custom Mask", make([]byte, 16))
+
+	var inputMask, outputMask matrix.Matrix
+	GenerateMasks(&rs, IndependentMasks{bytePermutationMask{}, IdentityMask}, &inputMask, &outputMask)
+
+	in := make([]byte, 16)
+	for i := range in {
+		in[i] = byte(i)
+	}
+
+	cand := inputMask.Mul(matrix.Row(in))
+	for i := range in {
+		if cand[i] != in[15-i] {
+			t.Fatalf("Custom mask wasn't used! %x", cand)
+		}
+	}
+
+	if !outputMask.Mul(matrix.Row(in)).Equals(matrix.Row(in)) {
+		t.Fatalf("Identity mask isn't the identity!")
+	}
+}
+
+func TestChainedMasks(t *testing.T) {
+	rs := random.NewSource("Chained Masks", make([]byte, 16))
+
+	chained := &ChainedMasks{Parties: []Mask{RandomAffineMask, RandomAffineMask, bytePermutationMask{}}}
+	inputMask, outputMask := encoding.BlockAffine{}, encoding.BlockAffine{}
+	GenerateAffineMasks(&rs, IndependentMasks{chained, IdentityMask}, &inputMask, &outputMask)
+
+	if len(chained.Shares) != 3 {
+		t.Fatalf("Wrong number of shares! %v", len(chained.Shares))
+	} else if chained.Shares[0].Linear.Equals(chained.Shares[1].Linear) {
+		t.Fatalf("Parties with the same type of mask got the same share!")
+	}
+
+	// Applying each party's share in turn should give the full mask.
+	in := [16]byte{99, 83, 224, 140, 9, 96, 225, 4, 205, 112, 183, 81, 186, 202, 208, 231}
+
+	cand := in
+	for _, share := range chained.Shares {
+		cand = encoding.NewBlockAffine(share.Linear, share.Constant).Encode(cand)
+	}
+
+	if real := inputMask.Encode(in); real != cand {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestRoundKeys(t *testing.T) {
+	key := []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	constr := saes.Construction{key}
+
+	real, enc, dec := constr.StretchedKey(), EncryptionRoundKeys(key), DecryptionRoundKeys(key)
+	for k := range real {
+		shifted, unshifted := append([]byte{}, real[k]...), append([]byte{}, real[k]...)
+		if k < 10 {
+			constr.ShiftRows(shifted)
+		} else {
+			constr.UnShiftRows(unshifted)
+		}
+
+		if !bytes.Equal(shifted, enc[k]) {
+			t.Fatalf("Real disagrees with result in encryption round key %v! %x != %x", k, shifted, enc[k])
+		} else if !bytes.Equal(unshifted, dec[k]) {
+			t.Fatalf("Real disagrees with result in decryption round key %v! %x != %x", k, unshifted, dec[k])
+		}
+	}
+
+	rs := random.NewSource("Round Keys", make([]byte, 16))
+	encoded := EncodeRoundKeys(enc, RoundKeyEncoding(&rs))
+
+	if bytes.Equal(encoded.Keys[0], enc[0]) {
+		t.Fatalf("Round keys weren't encoded!")
+	}
+
+	for k, roundKey := range encoded.Decode() {
+		if !bytes.Equal(roundKey, enc[k]) {
+			t.Fatalf("Real disagrees with result in round key %v! %x != %x", k, enc[k], roundKey)
+		}
+	}
+}
+
+func TestXORTables(t *testing.T) {
+	blocks, real := [16][16]byte{}, make([]byte, 16)
+	for i := range blocks {
+		for pos := range blocks[i] {
+			blocks[i][pos] = byte(31*i + 7*pos + i*pos)
+			real[pos] ^= blocks[i][pos]
+		}
+	}
+
+	slice := func(int, int) encoding.Nibble { return encoding.IdentityByte{} }
+	round := func(int) encoding.Nibble { return encoding.IdentityByte{} }
+
+	rs := random.NewSource("XOR Tables", make([]byte, 16))
+	xor := func(pos, gate int) encoding.Nibble {
+		label := make([]byte, 16)
+		label[0], label[1], label[2] = 'X', byte(pos), byte(gate)
+
+		return rs.Shuffle(label)
+	}
+
+	nibbles := BlockNibbleXORTables(slice, xor, round)
+	cases := map[string]BlockXORTables{
+		"Nibble": nibbles,
+		"Byte":   nibbles.Widen(),
+		"Word":   BlockWordXORTables(slice, xor, round),
+	}
+
+	for name, xorTables := range cases {
+		cand := make([]byte, 16)
+		xorTables.SquashBlocks(blocks, cand)
+
+		if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with result for %v XOR tables! %x != %x", name, real, cand)
+		}
+	}
+
+	words, rest := ParseWordXORTables(append(cases["Word"].Serialize(), 0x00))
+	if len(rest) != 1 {
+		t.Fatalf("Parsing word XOR tables left the wrong amount of input! %v", len(rest))
+	}
+
+	cand := make([]byte, 16)
+	words.SquashBlocks(blocks, cand)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result for parsed word XOR tables! %x != %x", real, cand)
+	}
+}
+
+func TestLabel(t *testing.T) {
+	real := []byte{'M', 'B', 8, 3, 17, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	if cand := Label("MB", 8, 3, 17); !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Label accepted a label longer than 16 bytes!")
+		}
+	}()
+	Label("MASK Outside", 1, 2, 3, 4, 5)
+}
+
+func TestOptions(t *testing.T) {
+	opts := NewOptions(WithInputMask(RandomMask), WithDummyRounds(4), WithRNG(bytes.NewReader(make([]byte, SeedSize))))
+
+	if opts.InputMask != RandomMask || opts.OutputMask != IdentityMask {
+		t.Fatalf("Options have the wrong masks! %v, %v", opts.InputMask, opts.OutputMask)
+	} else if !opts.NonlinearEncodings || opts.DummyRounds != 4 {
+		t.Fatalf("Options have the wrong settings!")
+	}
+
+	if seed, err := opts.Seed([]byte{1, 2, 3}); err != nil || !bytes.Equal(seed, []byte{1, 2, 3}) {
+		t.Fatalf("Given seed was replaced! %x", seed)
+	}
+
+	if seed, err := opts.Seed(nil); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(seed, make([]byte, SeedSize)) {
+		t.Fatalf("Seed wasn't read from the RNG! %x", seed)
+	} else if _, err := opts.Seed(nil); err == nil {
+		t.Fatalf("Reading from an exhausted RNG succeeded!")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	if KeySize(10) != 16 || KeySize(12) != 24 || KeySize(14) != 32 || KeySize(11) != 0 {
+		t.Fatalf("KeySize is wrong!")
+	} else if ChowConstruction.String() != "chow" || ConstructionType(200).String() != "ConstructionType(200)" {
+		t.Fatalf("String is wrong! %v, %v", ChowConstruction, ConstructionType(200))
+	}
+
+	in := make([]byte, MaxHeaderSize)
+	n := Header{Version: CurrentVersion, Type: ConstructionType(200)}.Serialize(in)
+
+	if _, err := Load(in[:n]); err == nil {
+		t.Fatalf("Loaded a key of an unregistered type!")
+	}
+
+	Register(ConstructionType(200), func(in []byte) (Construction, error) { return nil, errors.New("Test parser!") })
+	defer func() {
+		delete(registry, ConstructionType(200))
+		if recover() == nil {
+			t.Fatalf("Registering a type twice didn't panic!")
+		}
+	}()
+
+	if _, err := Load(in[:n]); err == nil || err.Error() != "Test parser!" {
+		t.Fatalf("Load didn't use the registered parser! %v", err)
+	}
+
+	Register(ConstructionType(200), nil)
+}
+
+func TestHeader(t *testing.T) {
+	in := make([]byte, MaxHeaderSize)
+
+	for _, size := range []int{0, 16, 24, 32} {
+		real := Header{Version: CurrentVersion, Type: ChowConstruction, Rounds: 18, MAC: true, KeySize: size}
+		n := real.Serialize(in)
+
+		cand, _, err := ParseHeader(in[:n], ChowConstruction)
+		if err != nil {
+			t.Fatal(err)
+		} else if cand.KeySize != size || cand.Rounds != 18 || !cand.MAC || cand.Shuffled {
+			t.Fatalf("Real disagrees with result! %v != %v", real, cand)
+		}
+	}
+
+	// Unknown flags are rejected, not ignored.
+	n := Header{Version: CurrentVersion, Type: ChowConstruction, Rounds: 10}.Serialize(in)
+	for bit := uint(0); bit < 8; bit++ {
+		if flag := byte(1) << bit; flag&(flagMAC|flagShuffled|flagKeySize|flagCompressed) == 0 {
+			in[7] = flag
+			if _, _, err := ParseHeader(in[:n], ChowConstruction); err == nil {
+				t.Fatalf("Parsed a header with unknown flag %x!", flag)
+			}
+		}
+	}
+
+	// Version 1 headers don't record the key size.
+	n = Header{Version: 1, Type: ChowConstruction, Rounds: 10}.Serialize(in)
+	in[7] = 1 << 2
+	if _, _, err := ParseHeader(in[:n], ChowConstruction); err == nil {
+		t.Fatalf("Parsed a version 1 header with a key size!")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatalf("Serialized a header with an invalid key size!")
+		}
+	}()
+	Header{Version: CurrentVersion, Type: ChowConstruction, Rounds: 10, KeySize: 20}.Serialize(in)
+}
+
+func TestDescriptor(t *testing.T) {
+	rs := random.NewSource("Descriptor", make([]byte, 16))
+
+	var inputMask, outputMask encoding.BlockAffine
+	GenerateAffineMasks(&rs, IndependentMasks{RandomAffineMask, RandomMask}, &inputMask, &outputMask)
+
+	marshaled, err := json.Marshal(DescribeEncodings(inputMask, outputMask))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	desc := EncodingsDescriptor{}
+	if err := json.Unmarshal(marshaled, &desc); err != nil {
+		t.Fatal(err)
+	}
+
+	input, output, err := desc.Affine()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := [16]byte{99, 83, 224, 140, 9, 96, 225, 4, 205, 112, 183, 81, 186, 202, 208, 231}
+	if real, cand := inputMask.Encode(in), input.Encode(in); real != cand {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	} else if real, cand := outputMask.Encode(in), output.Encode(in); real != cand {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	// Evaluate the descriptor the way its documentation says to, like a peer in another language would.
+	cand := [16]byte{}
+	for i := 0; i < 128; i++ {
+		parity := byte(0)
+		for j := 0; j < 128; j++ {
+			parity ^= (desc.Input.Matrix[16*i+j/8] >> uint(j%8)) & (in[j/8] >> uint(j%8)) & 1
+		}
+		cand[i/8] |= (parity ^ (desc.Input.Constant[i/8]>>uint(i%8))&1) << uint(i%8)
+	}
+
+	if real := inputMask.Encode(in); real != cand {
+		t.Fatalf("Descriptor doesn't match its documentation! %x != %x", real, cand)
+	}
+
+	desc.Output.Alg = "AES"
+	if _, _, err := desc.Affine(); err == nil {
+		t.Fatalf("Accepted a descriptor with an unknown algorithm!")
+	}
+
+	desc.Input.Matrix = make([]byte, 128*16)
+	if _, err := desc.Input.Affine(); err == nil {
+		t.Fatalf("Accepted a descriptor that isn't invertible!")
+	}
+}
+
+func TestLazyAllocations(t *testing.T) {
+	buff := make([]byte, SliceSize)
+	rs := random.NewSource("Lazy Tables", make([]byte, 16))
+	rs.Stream(nil).Read(buff)
+
+	r := bytes.NewReader(buff)
+	lb, lw, ln := LazyBlock{r, 0}, LazyWord{r, 0}, LazyNibble{r, 0}
+
+	for i := 0; i < 256; i++ {
+		if real, cand := buff[16*i:16*i+16], lb.Get(byte(i)); !bytes.Equal(real, cand[:]) {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		} else if real, cand := buff[4*i:4*i+4], lw.Get(byte(i)); !bytes.Equal(real, cand[:]) {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		} else if real, cand := buff[i/2]>>(4*uint(1-i%2))&0x0f, ln.Get(byte(i)); real != cand {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		}
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		lb.Get(1)
+		lw.Get(2)
+		ln.Get(3)
+	})
+	if allocs != 0 {
+		t.Fatalf("Lazy lookups allocated! %v allocations per run", allocs)
+	}
+}
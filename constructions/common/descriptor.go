@@ -0,0 +1,89 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+)
+
+// AffineEncoding is the algorithm label of an EncodingDescriptor for an affine encoding of a 128-bit block.
+const AffineEncoding = "GF2-AFFINE-128"
+
+// EncodingDescriptor describes one external encoding as plain data, so that the party that applies or strips it can be
+// written in any language. Marshaled with encoding/json, it looks like:
+//
+//	{"alg": "GF2-AFFINE-128", "matrix": "AQAAAAAA...", "constant": "AAAAAAAA..."}
+//
+// The encoding maps a block x to M*x + c over GF(2). A block is a vector of 128 bits, where bit i is bit i%8 (counting
+// from the least significant) of byte i/8. Matrix is M as 128 rows of 16 bytes each, row i first, with the bits of each
+// row numbered like a block; bit i of the output is the parity of row i AND x. Constant is c, 16 bytes. Both are
+// standard base64 with padding in JSON. This is the same layout as chow.SerializeMask.
+type EncodingDescriptor struct {
+	Alg      string `json:"alg"`
+	Matrix   []byte `json:"matrix"`
+	Constant []byte `json:"constant"`
+}
+
+// EncodingsDescriptor describes the input and output encodings of a construction, which computes
+// Output(AES(Input(x))). KeyID optionally names the key they go with, and is omitted from JSON if empty.
+type EncodingsDescriptor struct {
+	KeyID  string             `json:"kid,omitempty"`
+	Input  EncodingDescriptor `json:"input"`
+	Output EncodingDescriptor `json:"output"`
+}
+
+// DescribeEncoding returns the descriptor of an affine encoding.
+func DescribeEncoding(enc encoding.BlockAffine) EncodingDescriptor {
+	out := EncodingDescriptor{
+		Alg:      AffineEncoding,
+		Matrix:   make([]byte, 0, 128*16),
+		Constant: append([]byte{}, enc.BlockAdditive[:]...),
+	}
+
+	for _, row := range enc.Forwards {
+		out.Matrix = append(out.Matrix, row...)
+	}
+
+	return out
+}
+
+// Affine returns the encoding the descriptor describes. It returns an error if the algorithm isn't AffineEncoding, the
+// matrix or constant is the wrong length, or the matrix isn't invertible.
+func (ed EncodingDescriptor) Affine() (enc encoding.BlockAffine, err error) {
+	if ed.Alg != AffineEncoding {
+		return enc, fmt.Errorf("Unknown encoding algorithm %q!", ed.Alg)
+	} else if len(ed.Matrix) != 128*16 || len(ed.Constant) != 16 {
+		return enc, errors.New("Encoding is the wrong size!")
+	}
+
+	linear := matrix.Matrix{}
+	for i := 0; i < 128; i++ {
+		linear = append(linear, matrix.Row(append([]byte{}, ed.Matrix[16*i:16*(i+1)]...)))
+	}
+
+	if _, ok := linear.Invert(); !ok {
+		return enc, errors.New("Encoding isn't invertible!")
+	}
+
+	constant := [16]byte{}
+	copy(constant[:], ed.Constant)
+
+	return encoding.NewBlockAffine(linear, constant), nil
+}
+
+// DescribeEncodings returns the descriptor of a construction's input and output encodings.
+func DescribeEncodings(input, output encoding.BlockAffine) EncodingsDescriptor {
+	return EncodingsDescriptor{Input: DescribeEncoding(input), Output: DescribeEncoding(output)}
+}
+
+// Affine returns the input and output encodings the descriptor describes, or an error if either doesn't parse.
+func (ed EncodingsDescriptor) Affine() (input, output encoding.BlockAffine, err error) {
+	if input, err = ed.Input.Affine(); err != nil {
+		return
+	}
+	output, err = ed.Output.Affine()
+
+	return
+}
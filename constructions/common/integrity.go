@@ -0,0 +1,59 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"errors"
+	"hash"
+	"io"
+)
+
+// NewMAC returns the HMAC-SHA256 instance used to authenticate serialized keys with the given MAC key. Serializers write
+// the header and every table into it, and append its sum to the key.
+func NewMAC(macKey []byte) hash.Hash {
+	return hmac.New(sha256.New, macKey)
+}
+
+// VerifyIntegrity reads a serialized key of the given construction type from r, up to EOF, and checks the MAC at its end
+// with macKey. It returns an error if the key doesn't have a MAC, or if anything in the header or tables was modified.
+//
+// Modified tables are the starting point of fault attacks, so keys loaded from untrusted storage should be verified
+// before they're used. Keys read lazily (with OpenConstruction) can still be modified between verification and use.
+func VerifyIntegrity(r io.Reader, expected ConstructionType, macKey []byte) error {
+	mac := NewMAC(macKey)
+	tw := &trailingWriter{W: mac}
+
+	sr := &StreamReader{R: io.TeeReader(r, tw)}
+	h := sr.ReadHeader(expected)
+	if sr.Err != nil {
+		return sr.Err
+	} else if !h.MAC {
+		return errors.New("Key doesn't have a MAC!")
+	}
+
+	if _, err := io.Copy(tw, r); err != nil {
+		return err
+	} else if len(tw.trailer) < MACSize || !hmac.Equal(mac.Sum(nil), tw.trailer) {
+		return errors.New("Key failed integrity check!")
+	}
+
+	return nil
+}
+
+// trailingWriter forwards everything written to it to W, except for the last MACSize bytes, which it holds back in
+// trailer.
+type trailingWriter struct {
+	W       io.Writer
+	trailer []byte
+}
+
+func (tw *trailingWriter) Write(p []byte) (int, error) {
+	tw.trailer = append(tw.trailer, p...)
+
+	if n := len(tw.trailer) - MACSize; n > 0 {
+		tw.W.Write(tw.trailer[:n])
+		tw.trailer = append(tw.trailer[:0], tw.trailer[n:]...)
+	}
+
+	return len(p), nil
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/random"
+
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+// EncryptionRoundKeys expands a 16, 24, or 32 byte AES key and lays out the round keys the way table-based encryption
+// constructions consume them: every round key but the last has ShiftRows applied, because the T-Boxes of a round read
+// the state after the previous round's ShiftRows has moved each byte. The last round key is added after the last
+// ShiftRows, so it's left alone.
+func EncryptionRoundKeys(key []byte) [][]byte {
+	constr := saes.Construction{key}
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
+
+	for k := 0; k < rounds; k++ {
+		constr.ShiftRows(roundKeys[k])
+	}
+
+	return roundKeys
+}
+
+// DecryptionRoundKeys expands a 16, 24, or 32 byte AES key and lays out the round keys the way table-based decryption
+// constructions consume them: the last round key, which is the first one removed, has UnShiftRows applied.
+func DecryptionRoundKeys(key []byte) [][]byte {
+	constr := saes.Construction{key}
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
+
+	constr.UnShiftRows(roundKeys[rounds])
+
+	return roundKeys
+}
+
+// EncodedRoundKeys is a key schedule where every byte of every round key is stored under its own encoding, for
+// constructions that add round keys with encoded XOR tables instead of folding them into T-Boxes.
+type EncodedRoundKeys struct {
+	Keys      [][]byte          // [round][position] The encoded key byte.
+	Encodings [][]encoding.Byte // [round][position] The encoding the key byte is stored under.
+}
+
+// EncodeRoundKeys encodes byte pos of round key `round` with enc(round, pos). Enc is usually RoundKeyEncoding, or the
+// identity for testing.
+func EncodeRoundKeys(roundKeys [][]byte, enc func(round, pos int) encoding.Byte) (out EncodedRoundKeys) {
+	out.Keys = make([][]byte, len(roundKeys))
+	out.Encodings = make([][]encoding.Byte, len(roundKeys))
+
+	for round, roundKey := range roundKeys {
+		out.Keys[round] = make([]byte, len(roundKey))
+		out.Encodings[round] = make([]encoding.Byte, len(roundKey))
+
+		for pos, k := range roundKey {
+			out.Encodings[round][pos] = enc(round, pos)
+			out.Keys[round][pos] = out.Encodings[round][pos].Encode(k)
+		}
+	}
+
+	return
+}
+
+// Decode returns the round keys with their encodings removed.
+func (erk EncodedRoundKeys) Decode() [][]byte {
+	out := make([][]byte, len(erk.Keys))
+
+	for round, roundKey := range erk.Keys {
+		out[round] = make([]byte, len(roundKey))
+
+		for pos, k := range roundKey {
+			out[round][pos] = erk.Encodings[round][pos].Decode(k)
+		}
+	}
+
+	return out
+}
+
+// RoundKeyEncoding returns a function that gives a random encoding for each byte of each round key, made of two
+// independent nibble encodings so that it can be fed into nibble XOR tables. All randomness is derived from the random
+// source.
+func RoundKeyEncoding(rs *random.Source) func(round, pos int) encoding.Byte {
+	return func(round, pos int) encoding.Byte {
+		left, right := rs.Shuffle(Label("KS", round, pos, 0)), rs.Shuffle(Label("KS", round, pos, 1))
+
+		return encoding.ConcatenatedByte{left, right}
+	}
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"github.com/OpenWhiteBox/primitives/encoding"
 	"github.com/OpenWhiteBox/primitives/matrix"
 	"github.com/OpenWhiteBox/primitives/random"
 )
@@ -12,18 +13,114 @@ const (
 	Outside
 )
 
+// Mask generates one of the external masks of a white-box. The built-in masks are the MaskTypes and SpecifiedMask, but
+// any implementation can be passed in IndependentMasks, to plug in other kinds of masks--sparse ones, byte
+// permutations, or ones provisioned by another system--without changing key generation.
+type Mask interface {
+	// Generate returns the mask x -> linear*x + constant on size-bit blocks, drawing any randomness it needs from rs.
+	// Surface is where the mask goes, so that the input and output masks can be drawn independently. The linear part
+	// must be invertible.
+	Generate(rs *random.Source, surface Surface, size int) (linear matrix.Matrix, constant matrix.Row)
+}
+
 type MaskType int
 
 const (
 	RandomMask MaskType = iota
 	IdentityMask
+	RandomAffineMask
 )
 
+// Generate implements Mask.
+func (mask MaskType) Generate(rs *random.Source, surface Surface, size int) (linear matrix.Matrix, constant matrix.Row) {
+	constant = matrix.NewRow(size)
+
+	switch mask {
+	case IdentityMask:
+		return matrix.GenerateIdentity(size), constant
+	case RandomMask, RandomAffineMask:
+		name := "ASK Inside"
+		if surface == Outside {
+			name = "ASK Outside"
+		}
+
+		linear = rs.Matrix(Label("M"+name), size)
+		if mask == RandomAffineMask {
+			rs.Stream(Label("C" + name)).Read(constant)
+		}
+
+		return linear, constant
+	default:
+		panic("Unrecognized mask type!")
+	}
+}
+
+// SpecifiedMask is an affine mask chosen by the caller, x -> Linear*x + Constant, for when the encoding needs to be
+// provisioned somewhere else independently of the white-box.
+type SpecifiedMask struct {
+	Linear   matrix.Matrix
+	Constant [16]byte
+}
+
+// Generate implements Mask. It returns the mask as given, with the constant cut down to size bits.
+func (mask SpecifiedMask) Generate(rs *random.Source, surface Surface, size int) (matrix.Matrix, matrix.Row) {
+	constant := matrix.NewRow(size)
+	copy(constant, mask.Constant[:])
+
+	return mask.Linear, constant
+}
+
+// ChainedMasks is a mask split between several provisioning parties: it's the composition of one share per party, so no
+// single party knows the whole encoding. Each party's share is generated from its own Mask in Parties, with its own
+// randomness, and applied after the share of the party before it. Key generation writes the shares it used into
+// Shares, in the same order, so a ChainedMasks has to be passed by pointer:
+//
+//	chained := &common.ChainedMasks{Parties: []common.Mask{common.RandomAffineMask, common.RandomAffineMask}}
+//	opts := common.IndependentMasks{chained, common.IdentityMask}
+//	constr, inputMask, outputMask := chow.GenerateEncryptionKeys(key, seed, opts)
+//
+// Then chained.Shares[i] goes to party i. To prepare an input, the parties remove their shares in reverse order, from
+// the last party to the first.
+type ChainedMasks struct {
+	Parties []Mask
+	Shares  []SpecifiedMask
+}
+
+// Generate implements Mask. It panics if there are no parties.
+func (mask *ChainedMasks) Generate(rs *random.Source, surface Surface, size int) (matrix.Matrix, matrix.Row) {
+	if len(mask.Parties) == 0 {
+		panic("Chained mask has no parties!")
+	}
+
+	linear, constant := matrix.GenerateIdentity(size), matrix.NewRow(size)
+	mask.Shares = make([]SpecifiedMask, len(mask.Parties))
+
+	for i, party := range mask.Parties {
+		// Give each party a source of its own, so that parties with the same type of mask get different shares.
+		seed := make([]byte, 16)
+		rs.Stream(Label("CHAIN", int(surface), i)).Read(seed)
+
+		partyRS := random.NewSource("Chained Mask", seed)
+
+		l, c := party.Generate(&partyRS, surface, size)
+		if h, w := l.Size(); h != size || w != size || len(c) != len(constant) {
+			panic("Mask is the wrong size!")
+		}
+
+		mask.Shares[i].Linear = l
+		copy(mask.Shares[i].Constant[:], c)
+
+		linear, constant = l.Compose(linear), l.Mul(constant).Add(c)
+	}
+
+	return linear, constant
+}
+
 type KeyGenerationOpts interface{}
 
 // IndependentMasks generates the input and output masks independently of each other.
 type IndependentMasks struct {
-	Input, Output MaskType
+	Input, Output Mask
 }
 
 // SameMasks puts the exact same mask on the input and output of the white-box.
@@ -32,9 +129,24 @@ type SameMasks MaskType
 // MatchingMasks implies a randomly generated input mask and the inverse mask on the output.
 type MatchingMasks struct{}
 
-// GenerateMasks generates input and output encodings for a white-box AES construction.
+// GenerateMasks generates linear input and output encodings for a white-box AES construction. It panics if opts asks
+// for a mask with a constant part, for constructions that can't support one.
 func GenerateMasks(rs *random.Source, opts KeyGenerationOpts, inputMask, outputMask *matrix.Matrix) {
+	inputAffine, outputAffine := encoding.BlockAffine{}, encoding.BlockAffine{}
+	GenerateAffineMasks(rs, opts, &inputAffine, &outputAffine)
+
+	if inputAffine.BlockAdditive != (encoding.BlockAdditive{}) || outputAffine.BlockAdditive != (encoding.BlockAdditive{}) {
+		panic("Construction doesn't support masks with a constant!")
+	}
+
+	*inputMask, *outputMask = inputAffine.Forwards, outputAffine.Forwards
+}
+
+// GenerateAffineMasks generates affine input and output encodings for a white-box AES construction.
+func GenerateAffineMasks(rs *random.Source, opts KeyGenerationOpts, inputMask, outputMask *encoding.BlockAffine) {
 	switch opts.(type) {
+	case Options:
+		GenerateAffineMasks(rs, opts.(Options).Masks(), inputMask, outputMask)
 	case IndependentMasks:
 		*inputMask = generateMask(rs, opts.(IndependentMasks).Input, Inside)
 		*outputMask = generateMask(rs, opts.(IndependentMasks).Output, Outside)
@@ -45,35 +157,31 @@ func GenerateMasks(rs *random.Source, opts KeyGenerationOpts, inputMask, outputM
 		mask := generateMask(rs, RandomMask, Inside)
 
 		*inputMask = mask
-		*outputMask, _ = mask.Invert()
+		*outputMask = encoding.BlockAffine{
+			encoding.BlockLinear{mask.Backwards, mask.Forwards},
+			encoding.BlockAdditive{},
+		}
 	default:
 		panic("Unrecognized key generation options!")
 	}
 }
 
-func generateMask(rs *random.Source, maskType MaskType, surface Surface) matrix.Matrix {
-	if maskType == RandomMask {
-		label := make([]byte, 16)
-
-		if surface == Inside {
-			copy(label[:], []byte("MASK Inside"))
-			return rs.Matrix(label, 128)
-		} else {
-			copy(label[:], []byte("MASK Outside"))
-			return rs.Matrix(label, 128)
-		}
-	} else { // Identity mask.
-		return matrix.GenerateIdentity(128)
+func generateMask(rs *random.Source, mask Mask, surface Surface) encoding.BlockAffine {
+	linear, constant := mask.Generate(rs, surface, 128)
+	if h, w := linear.Size(); h != 128 || w != 128 {
+		panic("Mask is the wrong size!")
 	}
+
+	var c [16]byte
+	copy(c[:], constant)
+
+	return encoding.NewBlockAffine(linear, c)
 }
 
 // Generate byte/word mixing bijections.
 // TODO: Ensure that blocks are full-rank.
 func MixingBijection(rs *random.Source, size, round, position int) matrix.Matrix {
-	label := make([]byte, 16)
-	label[0], label[1], label[2], label[3], label[4] = 'M', 'B', byte(size), byte(round), byte(position)
-
-	return rs.Matrix(label, size)
+	return rs.Matrix(Label("MB", size, round, position), size)
 }
 
 type BlockMatrix struct {
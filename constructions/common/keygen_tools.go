@@ -74,3 +74,36 @@ func BlockByteXORTables(SliceEncoding, XOREncoding func(int, int) encoding.Byte,
 
 	return
 }
+
+// Generate the XOR Tables for squashing the result of a BlockMatrix, three terms at a time. The gate number of
+// XOREncoding counts the lookups made so far, so it runs from 0 to 3.
+func BlockWordXORTables(SliceEncoding, XOREncoding func(int, int) encoding.Nibble, RoundEncoding func(int) encoding.Nibble) (out WordXORTables) {
+	for pos := 0; pos < 32; pos++ {
+		for gate := 0; gate < 5; gate++ {
+			var first, result encoding.Nibble
+
+			if gate == 0 {
+				first = SliceEncoding(0, pos)
+			} else {
+				first = XOREncoding(pos, gate-1)
+			}
+
+			if gate == 4 {
+				result = RoundEncoding(pos)
+			} else {
+				result = XOREncoding(pos, gate)
+			}
+
+			out[pos][gate] = encoding.DoubleToByteTable{
+				encoding.ConcatenatedDouble{
+					encoding.ConcatenatedByte{first, SliceEncoding(3*gate+1, pos)},
+					encoding.ConcatenatedByte{SliceEncoding(3*gate+2, pos), SliceEncoding(3*gate+3, pos)},
+				},
+				encoding.ConcatenatedByte{encoding.IdentityByte{}, result},
+				WordXORTable{},
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,73 @@
+package common
+
+// Key generation is deterministic: the same key, seed, and options always give the same construction, byte for byte.
+// To keep it that way across refactors and versions, no randomness is drawn from a shared stream in the order the
+// generator happens to run. Instead, the seed is expanded into a random.Source under the name of the construction, and
+// every family of tables draws from its own streams of that source, each named by a label. Reordering generation, or
+// adding a new family, can't change what any other family gets.
+//
+// The source names and labels are part of the serialization format: a construction serialized by one version has to be
+// regenerated exactly from its seed by the next. They must never be changed once released, and new families must use
+// labels that no existing family can produce. The names in use are:
+//
+//   Chow Encryption, Chow Decryption    chow.GenerateEncryptionKeys and GenerateDecryptionKeys
+//   Chow Rerandomization                chow.Construction.Rerandomize
+//   Chow Device Binding                 chow's Opts.Device, seeded from the construction's DB stream and the fingerprint
+//   Xiao Encryption, Xiao Decryption    xiao.GenerateEncryptionKeys and GenerateDecryptionKeys
+//   Ful Construction, Full Decryption   full.GenerateKeys and GenerateDecryptionKeys (the typo is load-bearing)
+//   Toy Construction                    toy.GenerateKeys
+//   Karroumi Encryption                 karroumi.GenerateEncryptionKeys, which draws its tables from chow's families
+//   Karroumi Decryption                 karroumi.GenerateDecryptionKeys, likewise
+//   Implicit Encryption                 implicit.GenerateEncryptionKeys
+//   Implicit Decryption                 implicit.GenerateDecryptionKeys
+//   Luo Encryption, Luo Decryption      luo.GenerateEncryptionKeys and GenerateDecryptionKeys
+//   SR Encryption                       sr.GenerateEncryptionKeys
+//   Chained Mask                        each party of a ChainedMasks, seeded from the construction's CHAIN stream
+//   Test Vectors                        vectors.Generate
+//
+// And the label families, with the indices that follow the family's name, one byte each:
+//
+//   MASK Inside, MASK Outside           the linear part of a random external mask
+//   CASK Inside, CASK Outside           the constant part of a random affine external mask
+//   CHAIN (surface, party)              the seed of one party of a ChainedMasks
+//   MB (size, round, position)          mixing bijections
+//   KS (round, position, nibble)        round key encodings, from RoundKeyEncoding
+//   ME (position, subposition, surface) chow: encodings of the external masks' outputs
+//   X (round, position, gate, surface)  chow: encodings between XOR tables
+//   R (round, position, surface)        chow: encodings of each round's output
+//   T (round, position, subposition)    chow: encodings of the T-Box/Tyi Tables' outputs
+//   MI (round, position, subposition)   chow: encodings of the MB^(-1) Tables' outputs
+//   DR                                  chow: where dummy rounds go
+//   LO                                  chow: the order of shuffled rounds
+//   DB                                  chow: the secret mixed with a device's fingerprint
+//   DP (position)                       chow: the byte bijections binding a construction to a device
+//   WM (position, gate)                 chow: the encodings a watermark's set bits add between the input XOR tables
+//   W (kind, a, b, c)                   chow: fresh encodings from rerandomization (kind is one byte of the name)
+//   AB, AL, AN (position)               chow: affine encodings from rerandomization
+//   SR (kind, layer, position, nibble, index, index>>8)  sr: nibble encodings of the white-box
+//   KD (round)                          karroumi: the dual cipher each round is computed in
+//   IE, IC (round)                      implicit: the linear and constant parts of the encodings between rounds
+//   IU (round)                          implicit: the linear maps mixing each round's equations
+//   IS (round)                          implicit: the self-equivalences of each round's layer of inversions
+//   PB                                  full: the perturbations' polynomials and how they're mixed into the state
+//   Self-Eq                             full and toy: self-equivalences of the S-box layers
+//   (empty)                             full and toy: the constant parts of the external masks; vectors: the inputs
+//
+// Families that read a stream more than once, like DR, read it in a fixed order that's part of the format too.
+
+// Label returns the label of one stream of randomness: the name of a family of tables, followed by the indices of one
+// table in the family, one byte each, padded with zeros to 16 bytes. It panics if they don't fit.
+func Label(family string, indices ...int) []byte {
+	if len(family)+len(indices) > 16 {
+		panic("Label is too long!")
+	}
+
+	out := make([]byte, 16)
+	copy(out, family)
+
+	for i, index := range indices {
+		out[len(family)+i] = byte(index)
+	}
+
+	return out
+}
@@ -0,0 +1,110 @@
+package common
+
+import (
+	"io"
+	"sync"
+
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// scratch holds the buffers that lookups read into. Any buffer passed to an io.ReaderAt escapes to the heap, so reading
+// straight into the caller's output would allocate on every lookup.
+var scratch = sync.Pool{New: func() interface{} { return new([16]byte) }}
+
+// readAt fills p, which is at most 16 bytes, from r at offset off. Table lookups can't return errors, so a failed read
+// panics.
+func readAt(r io.ReaderAt, p []byte, off int64) {
+	buff := scratch.Get().(*[16]byte)
+	if _, err := r.ReadAt(buff[:len(p)], off); err != nil {
+		panic("Reading the key failed!")
+	}
+
+	copy(p, buff[:])
+	scratch.Put(buff)
+}
+
+// LazyBlock is a table.Block whose entries are read from R, starting at Off, as they're needed.
+type LazyBlock struct {
+	R   io.ReaderAt
+	Off int64
+}
+
+func (lb LazyBlock) Get(i byte) (out [16]byte) {
+	readAt(lb.R, out[:], lb.Off+16*int64(i))
+	return
+}
+
+// LazyWord is a table.Word whose entries are read from R, starting at Off, as they're needed.
+type LazyWord struct {
+	R   io.ReaderAt
+	Off int64
+}
+
+func (lw LazyWord) Get(i byte) (out [4]byte) {
+	readAt(lw.R, out[:], lw.Off+4*int64(i))
+	return
+}
+
+// LazyNibble is a table.Nibble whose entries are read from R, starting at Off, as they're needed. Entries are packed
+// two to a byte, like table.ParsedNibble.
+type LazyNibble struct {
+	R   io.ReaderAt
+	Off int64
+}
+
+func (ln LazyNibble) Get(i byte) byte {
+	packed := [1]byte{}
+	readAt(ln.R, packed[:], ln.Off+int64(i/2))
+
+	if i%2 == 0 {
+		return packed[0] >> 4
+	}
+	return packed[0] & 0x0f
+}
+
+// LazyReader hands out lazy tables backed by consecutive regions of an io.ReaderAt, for parsers that don't want to hold
+// a whole key in memory. It's the lazy counterpart of StreamReader.
+type LazyReader struct {
+	R   io.ReaderAt
+	Off int64
+}
+
+// Block returns a lazy table.Block at the current offset and moves past it.
+func (lr *LazyReader) Block() table.Block {
+	out := LazyBlock{lr.R, lr.Off}
+	lr.Off += SliceSize
+
+	return out
+}
+
+// Word returns a lazy table.Word at the current offset and moves past it.
+func (lr *LazyReader) Word() table.Word {
+	out := LazyWord{lr.R, lr.Off}
+	lr.Off += 4 * 256
+
+	return out
+}
+
+// Nibble returns a lazy table.Nibble at the current offset and moves past it.
+func (lr *LazyReader) Nibble() table.Nibble {
+	out := LazyNibble{lr.R, lr.Off}
+	lr.Off += nxtSize
+
+	return out
+}
+
+// BlockNibbleMatrix returns the slices of a block matrix and its XOR tables, laid out as by StreamWriter's
+// WriteBlockMatrix.
+func (lr *LazyReader) BlockNibbleMatrix() (outM [16]table.Block, outXOR NibbleXORTables) {
+	for i := 0; i < 16; i++ {
+		outM[i] = lr.Block()
+	}
+
+	for i := 0; i < 32; i++ {
+		for j := 0; j < 15; j++ {
+			outXOR[i][j] = lr.Nibble()
+		}
+	}
+
+	return
+}
@@ -0,0 +1,86 @@
+package common
+
+import (
+	"crypto/rand"
+	"io"
+)
+
+// Options are the key generation settings shared by every construction. An Options can be passed as the opts of any
+// key generation function that takes a KeyGenerationOpts, in place of IndependentMasks, SameMasks, or MatchingMasks.
+// Every construction applies the masks; the other settings are applied by the constructions that have them and ignored
+// by the rest (see each package). New settings are added here, so they don't change any function's signature.
+//
+// Options should be built with NewOptions, which fills in the defaults. The zero value has no masks at all, which key
+// generation rejects.
+type Options struct {
+	InputMask, OutputMask Mask // The external masks. IdentityMask by default.
+
+	// NonlinearEncodings puts random nonlinear bijections on the values passed between tables, on top of the linear
+	// mixing bijections. True by default. Turning them off leaves only linear encodings, which attacks like the one in
+	// cryptanalysis/luo can see through; it's only useful for studying the attacks.
+	NonlinearEncodings bool
+
+	DummyRounds int // The number of dummy rounds to add, for constructions that support them. None by default.
+
+	// RNG is where a seed is read from, by functions that generate one when they aren't given one. crypto/rand.Reader by
+	// default.
+	RNG io.Reader
+}
+
+// Option changes one setting of an Options.
+type Option func(*Options)
+
+// NewOptions returns the default Options with opts applied in order.
+func NewOptions(opts ...Option) Options {
+	out := Options{
+		InputMask:          IdentityMask,
+		OutputMask:         IdentityMask,
+		NonlinearEncodings: true,
+		RNG:                rand.Reader,
+	}
+
+	for _, opt := range opts {
+		opt(&out)
+	}
+
+	return out
+}
+
+// WithInputMask sets the mask on the input of the white-box.
+func WithInputMask(mask Mask) Option {
+	return func(o *Options) { o.InputMask = mask }
+}
+
+// WithOutputMask sets the mask on the output of the white-box.
+func WithOutputMask(mask Mask) Option {
+	return func(o *Options) { o.OutputMask = mask }
+}
+
+// WithNonlinearEncodings turns the nonlinear encodings between tables on or off.
+func WithNonlinearEncodings(enabled bool) Option {
+	return func(o *Options) { o.NonlinearEncodings = enabled }
+}
+
+// WithDummyRounds sets the number of dummy rounds.
+func WithDummyRounds(n int) Option {
+	return func(o *Options) { o.DummyRounds = n }
+}
+
+// WithRNG sets where seeds are read from.
+func WithRNG(rng io.Reader) Option {
+	return func(o *Options) { o.RNG = rng }
+}
+
+// Masks returns the masks as an IndependentMasks.
+func (o Options) Masks() IndependentMasks {
+	return IndependentMasks{o.InputMask, o.OutputMask}
+}
+
+// Seed returns seed, or a fresh one read from RNG if seed is nil.
+func (o Options) Seed(seed []byte) ([]byte, error) {
+	if seed != nil {
+		return seed, nil
+	}
+
+	return ReadSeed(o.RNG)
+}
@@ -1,14 +1,215 @@
 package common
 
 import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"time"
+
 	"github.com/OpenWhiteBox/primitives/table"
 )
 
 const (
 	SliceSize  = 4096  // = 256*16
 	SlicesSize = 65536 // = 16*SliceSize
+
+	HeaderSize = 8 // = len(magic) + 4, the size of the fixed part of a header.
+
+	MaxHeaderSize = HeaderSize + metadataSize + 255 // The size of the largest possible header.
+	metadataSize  = 9                               // = 8 + 1, the size of the metadata in a version 2 header, not counting the key ID.
+
+	MACSize = sha256.Size // The size of the integrity MAC at the end of a key whose header has the MAC flag set.
 )
 
+// Bits of a header's flags byte.
+const (
+	flagMAC        = 0x01 // The key ends with an integrity MAC.
+	flagShuffled   = 0x02 // The key's tables are stored in a shuffled order.
+	flagKeySize    = 0x0c // Two bits holding the size of the AES key: 1 for 16 bytes, 2 for 24, 3 for 32, or 0 if unknown.
+	flagCompressed = 0x10 // The key's tables are compressed.
+)
+
+// magic is the first four bytes of every versioned white-box key.
+var magic = []byte("OWBX")
+
+// CurrentVersion is the version of the serialization format written by this package.
+const CurrentVersion = 2
+
+// ConstructionType identifies which white-box construction a serialized key belongs to.
+type ConstructionType byte
+
+const (
+	ChowConstruction ConstructionType = iota + 1
+	XiaoConstruction
+	FullConstruction
+	ToyConstruction
+	SpaceConstruction
+	ImplicitConstruction
+	LuoConstruction
+)
+
+// Metadata is optional information about a key, for keeping track of keys once they're deployed. It's stored in the
+// header from version 2 on, and isn't secret.
+type Metadata struct {
+	Created time.Time // When the key was generated, to the second. The zero time means unknown.
+	KeyID   []byte    // An identifier of the caller's choosing, at most 255 bytes long.
+}
+
+// Header is the versioned prefix of a serialized white-box key. It is laid out as:
+//
+//	magic "OWBX" (4 bytes) || version (1 byte) || construction type (1 byte) || rounds (1 byte) || flags (1 byte)
+//
+// Version 1 keys always have flags = 0. From version 2 on, the flags may record the size of the AES key, since dummy
+// rounds keep it from being read off the number of rounds, and whether the tables are compressed. Parsers reject keys
+// with flag bits they don't know, so flags are added without bumping the version: a parser from before a flag existed
+// refuses keys that set it, rather than misreading them. Version 2 headers continue with the metadata:
+//
+//	creation time (8 bytes, Unix seconds, big-endian) || key ID length (1 byte) || key ID
+//
+// The header isn't authenticated on its own: parsers reject malformed headers, but accept any well-formed one, metadata
+// included. Only keys with the MAC flag set cover the header, and only VerifyIntegrity checks it, so keys from untrusted
+// storage need both before their header can be trusted.
+type Header struct {
+	Version byte
+	Type    ConstructionType
+	Rounds  byte
+
+	// MAC is set if the key ends with an HMAC-SHA256 of everything before it, header included. See VerifyIntegrity.
+	MAC bool
+
+	// Shuffled is set if the construction's tables are stored in a shuffled order. The construction records the order at
+	// the start of its tables.
+	Shuffled bool
+
+	// KeySize is the length in bytes of the AES key the construction computes--16, 24, or 32--or 0 if the header doesn't
+	// record it, like every version 1 header.
+	KeySize int
+
+	// Compressed is set if everything between the header and the MAC is compressed, in a way specific to the
+	// construction. Constructions that don't support compression reject keys with it set.
+	Compressed bool
+
+	Metadata
+}
+
+// Size returns the number of bytes the header takes up when serialized.
+func (h Header) Size() int {
+	if h.Version < 2 {
+		return HeaderSize
+	}
+
+	return HeaderSize + metadataSize + len(h.KeyID)
+}
+
+// TrailerSize returns the number of bytes after the tables of a key with this header.
+func (h Header) TrailerSize() int {
+	if h.MAC {
+		return MACSize
+	}
+
+	return 0
+}
+
+// Serialize writes the header into the first h.Size() bytes of dst and returns the number of bytes written. It panics if
+// the key ID is too long, if the key size is invalid, or if a version 1 header records the key size or compression.
+func (h Header) Serialize(dst []byte) int {
+	base := copy(dst, magic)
+	dst[base+0], dst[base+1], dst[base+2], dst[base+3] = h.Version, byte(h.Type), h.Rounds, 0x00
+
+	if h.MAC {
+		dst[base+3] |= flagMAC
+	}
+	if h.Shuffled {
+		dst[base+3] |= flagShuffled
+	}
+
+	switch {
+	case h.KeySize == 0:
+	case h.KeySize != 16 && h.KeySize != 24 && h.KeySize != 32 || h.Version < 2:
+		panic("Key size can't be recorded in the header!")
+	default:
+		dst[base+3] |= byte(h.KeySize/8-1) << 2
+	}
+	if h.Compressed {
+		if h.Version < 2 {
+			panic("Version 1 keys can't be compressed!")
+		}
+
+		dst[base+3] |= flagCompressed
+	}
+
+	if h.Version < 2 {
+		return HeaderSize
+	} else if len(h.KeyID) > 255 {
+		panic("Key ID is too long!")
+	}
+
+	created := int64(0)
+	if !h.Created.IsZero() {
+		created = h.Created.Unix()
+	}
+
+	binary.BigEndian.PutUint64(dst[HeaderSize:], uint64(created))
+	dst[HeaderSize+8] = byte(len(h.KeyID))
+	copy(dst[HeaderSize+metadataSize:], h.KeyID)
+
+	return h.Size()
+}
+
+// HasHeader returns true if in starts with a versioned header. Keys serialized before the header existed (version 0)
+// don't.
+func HasHeader(in []byte) bool {
+	return len(in) >= HeaderSize && bytes.Equal(in[:len(magic)], magic)
+}
+
+// PeekType returns the construction type written in the header of a serialized key, which must have one (see HasHeader),
+// without checking anything else.
+func PeekType(in []byte) ConstructionType {
+	return ConstructionType(in[len(magic)+1])
+}
+
+// ParseHeader parses the header off the front of a serialized key, checks that it's for a construction of the given
+// type in a version we understand, and returns the header and the rest of the key.
+func ParseHeader(in []byte, expected ConstructionType) (h Header, rest []byte, err error) {
+	if !HasHeader(in) {
+		return h, nil, errors.New("Key doesn't have a valid header!")
+	}
+
+	h = Header{
+		Version:    in[4],
+		Type:       ConstructionType(in[5]),
+		Rounds:     in[6],
+		MAC:        in[7]&flagMAC != 0,
+		Shuffled:   in[7]&flagShuffled != 0,
+		Compressed: in[7]&flagCompressed != 0,
+	}
+	if size := int(in[7]&flagKeySize) >> 2; size != 0 {
+		h.KeySize = 8 * (size + 1)
+	}
+
+	if h.Version == 0 || h.Version > CurrentVersion {
+		return h, nil, errors.New("Key has an unsupported version!")
+	} else if in[7]&^(flagMAC|flagShuffled|flagKeySize|flagCompressed) != 0 || (h.Version < 2 && in[7] != 0) {
+		return h, nil, errors.New("Key has unsupported flags!")
+	} else if h.Type != expected {
+		return h, nil, errors.New("Key is for a different construction!")
+	} else if h.Version < 2 {
+		return h, in[HeaderSize:], nil
+	}
+
+	if len(in) < HeaderSize+metadataSize || len(in) < HeaderSize+metadataSize+int(in[HeaderSize+8]) {
+		return h, nil, errors.New("Key doesn't have a valid header!")
+	}
+
+	if created := int64(binary.BigEndian.Uint64(in[HeaderSize:])); created != 0 {
+		h.Created = time.Unix(created, 0).UTC()
+	}
+	h.KeyID = append([]byte{}, in[HeaderSize+metadataSize:HeaderSize+metadataSize+int(in[HeaderSize+8])]...)
+
+	return h, in[h.Size():], nil
+}
+
 func SerializeBlockMatrix(dst []byte, m [16]table.Block, xor BlockXORTables) int {
 	base := 0
 
@@ -45,3 +246,10 @@ func ParseBlockByteMatrix(in []byte) (outM [16]table.Block, outXOR ByteXORTables
 
 	return
 }
+
+func ParseBlockWordMatrix(in []byte) (outM [16]table.Block, outXOR WordXORTables, rest []byte) {
+	outM, rest = ParseBlockSlices(in)
+	outXOR, rest = ParseWordXORTables(rest)
+
+	return
+}
@@ -0,0 +1,136 @@
+package common
+
+import (
+	"crypto/cipher"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Construction is a white-box of any construction with a versioned serialized key, so that code can handle keys without
+// knowing which construction they're from. The Construction types of chow, xiao, full, implicit, luo, and space
+// implement it, as pointers.
+type Construction interface {
+	cipher.Block
+
+	// Serialize serializes the construction into a key that Load can parse.
+	Serialize() []byte
+
+	// Type returns the construction type written in the key's header.
+	Type() ConstructionType
+
+	// KeySize returns the length in bytes of the AES key the construction computes: 16, 24, or 32. It returns 0 if the
+	// construction can't tell, or doesn't compute AES.
+	KeySize() int
+}
+
+// Parser parses a serialized key of one construction type.
+type Parser func(in []byte) (Construction, error)
+
+var (
+	registryMu sync.RWMutex
+	registry   = make(map[ConstructionType]Parser)
+	legacy     = make(map[ConstructionType]Parser)
+)
+
+// Register makes keys of the given construction type loadable with Load. Every package with a Construction registers
+// itself when it's imported, so a program only needs to import the packages of the constructions it wants to load, if
+// only for their side effects. Register panics if the type is already registered.
+func Register(typ ConstructionType, parse Parser) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := registry[typ]; ok {
+		panic("Construction type registered twice!")
+	}
+	registry[typ] = parse
+}
+
+// RegisterLegacy makes keys of the given construction type that were serialized before headers existed (version 0)
+// loadable with Load. Nothing in such a key says what construction it's for, so Load tries every legacy parser on it,
+// and parse must reject keys of any other construction--by their size, for example. RegisterLegacy panics if the type
+// is already registered.
+func RegisterLegacy(typ ConstructionType, parse Parser) {
+	registryMu.Lock()
+	defer registryMu.Unlock()
+
+	if _, ok := legacy[typ]; ok {
+		panic("Construction type registered twice!")
+	}
+	legacy[typ] = parse
+}
+
+// Load parses a serialized key of any registered construction type, read from its header. Keys of every past version of
+// the format are accepted. Keys without a header are parsed by whichever parser registered with RegisterLegacy accepts
+// them. An error is returned if the key's type isn't registered, or it doesn't parse.
+func Load(in []byte) (Construction, error) {
+	if !HasHeader(in) {
+		return loadLegacy(in)
+	}
+	typ := PeekType(in)
+
+	registryMu.RLock()
+	parse, ok := registry[typ]
+	registryMu.RUnlock()
+
+	if !ok {
+		return nil, fmt.Errorf("No construction of type %v is registered!", typ)
+	}
+
+	return parse(in)
+}
+
+// loadLegacy parses a key without a header with the one legacy parser that accepts it. An error is returned if none or
+// more than one does.
+func loadLegacy(in []byte) (Construction, error) {
+	registryMu.RLock()
+	defer registryMu.RUnlock()
+
+	var out Construction
+	for _, parse := range legacy {
+		if constr, err := parse(in); err == nil {
+			if out != nil {
+				return nil, errors.New("Key without a header is ambiguous!")
+			}
+			out = constr
+		}
+	}
+
+	if out == nil {
+		return nil, errors.New("Key doesn't have a valid header!")
+	}
+
+	return out, nil
+}
+
+// String returns the name of the package that implements the construction type.
+func (ct ConstructionType) String() string {
+	switch ct {
+	case ChowConstruction:
+		return "chow"
+	case XiaoConstruction:
+		return "xiao"
+	case FullConstruction:
+		return "full"
+	case ToyConstruction:
+		return "toy"
+	case SpaceConstruction:
+		return "space"
+	case ImplicitConstruction:
+		return "implicit"
+	case LuoConstruction:
+		return "luo"
+	default:
+		return fmt.Sprintf("ConstructionType(%d)", byte(ct))
+	}
+}
+
+// KeySize returns the length in bytes of the AES key with the given number of rounds, or 0 if no AES key has that many.
+func KeySize(rounds int) int {
+	switch rounds {
+	case 10, 12, 14:
+		return 4 * (rounds - 6)
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,38 @@
+package common
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"io"
+)
+
+// SeedSize is the size of the seeds returned by DeriveSeed and ReadSeed.
+const SeedSize = 32
+
+// DeriveSeed derives a seed for key generation from a master secret and a context string, with HKDF-SHA256 (RFC 5869).
+// Different contexts--for example, one per key ID--give independent seeds, so one master secret can safely be used for
+// many keys without ever passing the same seed twice.
+func DeriveSeed(masterSecret, context []byte) []byte {
+	// Extract, with an empty salt.
+	extract := hmac.New(sha256.New, make([]byte, sha256.Size))
+	extract.Write(masterSecret)
+	prk := extract.Sum(nil)
+
+	// Expand. SeedSize is one block of output.
+	expand := hmac.New(sha256.New, prk)
+	expand.Write(context)
+	expand.Write([]byte{0x01})
+
+	return expand.Sum(nil)[:SeedSize]
+}
+
+// ReadSeed reads a seed for key generation from rng. Passing crypto/rand.Reader gives a fresh seed every time, for
+// callers who don't want key generation to be reproducible.
+func ReadSeed(rng io.Reader) ([]byte, error) {
+	seed := make([]byte, SeedSize)
+	if _, err := io.ReadFull(rng, seed); err != nil {
+		return nil, err
+	}
+
+	return seed, nil
+}
@@ -0,0 +1,106 @@
+package common
+
+import (
+	"io"
+
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// StreamWriter wraps an io.Writer for serializers that write many tables in a row. It counts the bytes written and
+// remembers the first error, after which every write is a no-op.
+type StreamWriter struct {
+	W   io.Writer
+	N   int64
+	Err error
+}
+
+// Write writes p to the underlying writer, unless a previous write failed.
+func (sw *StreamWriter) Write(p []byte) {
+	if sw.Err != nil {
+		return
+	}
+
+	n, err := sw.W.Write(p)
+	sw.N += int64(n)
+	sw.Err = err
+}
+
+// WriteHeader writes a versioned header.
+func (sw *StreamWriter) WriteHeader(h Header) {
+	buff := make([]byte, h.Size())
+	h.Serialize(buff)
+	sw.Write(buff)
+}
+
+// WriteBlockMatrix writes the slices of a block matrix and its XOR tables, one table at a time. The output is the same
+// as SerializeBlockMatrix.
+func (sw *StreamWriter) WriteBlockMatrix(m [16]table.Block, xor NibbleXORTables) {
+	for _, slice := range m {
+		sw.Write(table.SerializeBlock(slice))
+	}
+
+	for _, rack := range xor {
+		for _, xorTable := range rack {
+			sw.Write(table.SerializeNibble(xorTable))
+		}
+	}
+}
+
+// StreamReader wraps an io.Reader for parsers that read many tables in a row. It remembers the first error, after which
+// every read returns nil.
+type StreamReader struct {
+	R   io.Reader
+	Err error
+}
+
+// Next reads the next n bytes from the underlying reader into a new slice.
+func (sr *StreamReader) Next(n int) []byte {
+	if sr.Err != nil {
+		return nil
+	}
+
+	out := make([]byte, n)
+	if _, err := io.ReadFull(sr.R, out); err != nil {
+		sr.Err = err
+		return nil
+	}
+
+	return out
+}
+
+// ReadHeader reads a versioned header and checks it like ParseHeader does.
+func (sr *StreamReader) ReadHeader(expected ConstructionType) (h Header) {
+	buff := sr.Next(HeaderSize)
+	if buff == nil {
+		return
+	} else if HasHeader(buff) && buff[4] >= 2 && buff[4] <= CurrentVersion {
+		metadata := sr.Next(metadataSize)
+		if metadata == nil {
+			return
+		}
+
+		buff = append(append(buff, metadata...), sr.Next(int(metadata[8]))...)
+	}
+
+	if sr.Err != nil {
+		return
+	}
+
+	h, _, sr.Err = ParseHeader(buff, expected)
+	return
+}
+
+// ReadBlockNibbleMatrix reads the slices of a block matrix and its XOR tables, as written by WriteBlockMatrix.
+func (sr *StreamReader) ReadBlockNibbleMatrix() (outM [16]table.Block, outXOR NibbleXORTables) {
+	for i := 0; i < 16; i++ {
+		outM[i] = table.ParsedBlock(sr.Next(SliceSize))
+	}
+
+	for i := 0; i < 32; i++ {
+		for j := 0; j < 15; j++ {
+			outXOR[i][j] = table.ParsedNibble(sr.Next(nxtSize))
+		}
+	}
+
+	return
+}
@@ -10,6 +10,9 @@ const (
 
 	bxtSize  = 65536
 	bxtsSize = 15728640
+
+	wxtSize  = 65536
+	wxtsSize = 10485760
 )
 
 type BlockXORTables interface {
@@ -31,6 +34,20 @@ func (bxt ByteXORTable) Get(i [2]byte) (out byte) {
 	return i[0] ^ i[1]
 }
 
+// Computes the XOR of the four nibbles of a 16-bit word. The result is in the low nibble of the output.
+type WordXORTable struct{}
+
+func (wxt WordXORTable) Get(i [2]byte) (out byte) {
+	return (i[0] >> 4) ^ (i[0] & 0xf) ^ (i[1] >> 4) ^ (i[1] & 0xf)
+}
+
+// There are three ways to squash sixteen blocks into one, which trade the size of the tables against the number of
+// lookups:
+//
+//   NibbleXORTables: 480 tables of 128 bytes (61KB), and 480 lookups.
+//   ByteXORTables:   240 tables of 64KB (15MB), and 240 lookups.
+//   WordXORTables:   160 tables of 64KB (10MB), and 160 lookups.
+
 type NibbleXORTables [32][15]table.Nibble // [nibble-wise position][gate number]
 
 func ParseNibbleXORTables(in []byte) (nxts NibbleXORTables, rest []byte) {
@@ -73,6 +90,37 @@ func (nxts NibbleXORTables) Serialize() []byte {
 	return dst
 }
 
+// Widen merges each pair of nibble XOR tables that squash the same byte into one byte XOR table, under the same
+// encodings. The result squashes blocks exactly like nxts, with half as many lookups.
+func (nxts NibbleXORTables) Widen() (out ByteXORTables) {
+	for pos := 0; pos < 16; pos++ {
+		for gate := 0; gate < 15; gate++ {
+			out[pos][gate] = WidenXORTable(nxts[2*pos+0][gate], nxts[2*pos+1][gate])
+		}
+	}
+
+	return
+}
+
+// WidenXORTable merges the nibble XOR tables of the high and low nibbles of a byte into one byte XOR table. The inputs
+// of the nibble tables are laid out as in NibbleXORTables.SquashBlocks: the high nibble of the running sum and the new
+// term for the high table, and the low nibbles for the low one.
+func WidenXORTable(high, low table.Nibble) table.ParsedDoubleToByte {
+	var highT, lowT [256]byte
+	for i := 0; i < 256; i++ {
+		highT[i], lowT[i] = high.Get(byte(i)), low.Get(byte(i))
+	}
+
+	out := make(table.ParsedDoubleToByte, 256*256)
+	for a := 0; a < 256; a++ {
+		for b := 0; b < 256; b++ {
+			out[a<<8|b] = highT[a&0xf0|b>>4]<<4 | lowT[(a<<4|b&0x0f)&0xff]&0x0f
+		}
+	}
+
+	return out
+}
+
 type ByteXORTables [16][15]table.DoubleToByte // [byte-wise position][gate number]
 
 func ParseByteXORTables(in []byte) (bxts ByteXORTables, rest []byte) {
@@ -113,3 +161,62 @@ func (bxts ByteXORTables) Serialize() []byte {
 
 	return dst
 }
+
+// WordXORTables squash blocks a nibble at a time, like NibbleXORTables, but add three new terms to the running sum in
+// each lookup instead of one. The first gate of each position adds up the first four blocks, and each gate after it
+// adds the next three to the sum so far.
+type WordXORTables [32][5]table.DoubleToByte // [nibble-wise position][gate number]
+
+func ParseWordXORTables(in []byte) (wxts WordXORTables, rest []byte) {
+	if in == nil || len(in) < wxtsSize {
+		return wxts, nil
+	}
+
+	for i := 0; i < 32; i++ {
+		for j := 0; j < 5; j++ {
+			loc := 5*i + j
+			wxts[i][j] = table.ParsedDoubleToByte(in[wxtSize*loc : wxtSize*(loc+1)])
+		}
+	}
+
+	return wxts, in[wxtsSize:]
+}
+
+func (wxts WordXORTables) SquashBlocks(blocks [16][16]byte, dst []byte) {
+	var sum [32]byte
+
+	for pos := 0; pos < 32; pos++ {
+		a, b, c, d := nibble(blocks[0], pos), nibble(blocks[1], pos), nibble(blocks[2], pos), nibble(blocks[3], pos)
+		sum[pos] = wxts[pos][0].Get([2]byte{a<<4 | b, c<<4 | d})
+
+		for gate := 1; gate < 5; gate++ {
+			a, b, c := nibble(blocks[3*gate+1], pos), nibble(blocks[3*gate+2], pos), nibble(blocks[3*gate+3], pos)
+			sum[pos] = wxts[pos][gate].Get([2]byte{sum[pos]<<4 | a, b<<4 | c})
+		}
+	}
+
+	for pos := 0; pos < 16; pos++ {
+		dst[pos] = sum[2*pos+0]<<4 | sum[2*pos+1]
+	}
+}
+
+func (wxts WordXORTables) Serialize() []byte {
+	dst, base := make([]byte, wxtsSize), 0
+
+	for _, rack := range wxts {
+		for _, xorTable := range rack {
+			base += copy(dst[base:], table.SerializeDoubleToByte(xorTable))
+		}
+	}
+
+	return dst
+}
+
+// nibble returns the nibble at the given nibble-wise position of a block, high nibble first.
+func nibble(block [16]byte, pos int) byte {
+	if pos%2 == 0 {
+		return block[pos/2] >> 4
+	}
+
+	return block[pos/2] & 0x0f
+}
@@ -0,0 +1,32 @@
+// Package constructions loads serialized white-box keys of every construction in this repository through one path, for
+// services that store keys of more than one construction side by side.
+//
+// Importing it imports every construction with a versioned key format--chow (and so karroumi), xiao, luo, full, space,
+// and implicit--so their parsers are registered with common.Register. Programs that only load some constructions can
+// import those packages and call common.Load directly instead, and skip linking the rest.
+//
+// Keys and their external encodings can also be armored as PEM blocks, for storage and transport as text.
+package constructions
+
+import (
+	"github.com/OpenWhiteBox/AES/constructions/common"
+
+	_ "github.com/OpenWhiteBox/AES/constructions/chow"
+	_ "github.com/OpenWhiteBox/AES/constructions/full"
+	_ "github.com/OpenWhiteBox/AES/constructions/implicit"
+	_ "github.com/OpenWhiteBox/AES/constructions/luo"
+	_ "github.com/OpenWhiteBox/AES/constructions/space"
+	_ "github.com/OpenWhiteBox/AES/constructions/xiao"
+)
+
+// Construction is a parsed white-box key of any construction. Type assert it to the construction's own type, like
+// *chow.Construction, for anything beyond the methods they have in common.
+type Construction = common.Construction
+
+// Parse reads the construction type from the header of a serialized key and parses the key with that construction's
+// parser. Keys in every past version of the format are accepted, including those serialized before headers existed,
+// which are told apart by their size. An error is returned if the key is for an unknown construction, or doesn't
+// parse.
+func Parse(blob []byte) (Construction, error) {
+	return common.Load(blob)
+}
@@ -0,0 +1,153 @@
+package constructions
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/full"
+	"github.com/OpenWhiteBox/AES/constructions/luo"
+	"github.com/OpenWhiteBox/AES/constructions/space"
+)
+
+var (
+	key   = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed  = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+	input = []byte{99, 83, 224, 140, 9, 96, 225, 4, 205, 112, 183, 81, 186, 202, 208, 231}
+)
+
+func TestParse(t *testing.T) {
+	chowConstr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	luoConstr, _, _ := luo.GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	fullConstr, _, _ := full.GenerateKeys(key, seed)
+	spaceConstr := space.GenerateKeys(key, space.Opts{Width: 1})
+
+	for _, real := range []Construction{&chowConstr, &luoConstr, &fullConstr, &spaceConstr} {
+		cand, err := Parse(real.Serialize())
+		if err != nil {
+			t.Fatalf("Parse returned error for %v: %v", real.Type(), err)
+		} else if cand.Type() != real.Type() || cand.KeySize() != real.KeySize() {
+			t.Fatalf("Parsed %v key is a %v with a %v byte key!", real.Type(), cand.Type(), cand.KeySize())
+		}
+
+		a, b := make([]byte, 16), make([]byte, 16)
+		real.Encrypt(a, input)
+		cand.Encrypt(b, input)
+
+		if !bytes.Equal(a, b) {
+			t.Fatalf("Real disagrees with parsed %v key! %x != %x", real.Type(), a, b)
+		}
+	}
+
+	if _, err := Parse(input); err == nil {
+		t.Fatalf("Parsed a key without a header!")
+	}
+}
+
+func TestArmorKey(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	constr.Metadata = common.Metadata{KeyID: []byte("licensee")}
+	serialized := constr.Serialize()
+
+	armored, err := ArmorKey(serialized, map[string]string{"Masks": "identity"})
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.HasPrefix(armored, []byte("-----BEGIN WHITEBOX AES KEY-----\n")) {
+		t.Fatalf("Armored key has the wrong first line! %q", armored[:40])
+	}
+
+	// Armored keys can be pasted into text with other PEM blocks around them.
+	text := append(append([]byte("comment\n-----BEGIN OTHER-----\n\n-----END OTHER-----\n"), armored...), "trailer"...)
+
+	cand, headers, rest, err := DearmorKey(text)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(cand, serialized) {
+		t.Fatalf("Dearmored key disagrees!")
+	} else if headers["Construction"] != "chow" || headers["Key-ID"] != "6c6963656e736565" || headers["Masks"] != "identity" {
+		t.Fatalf("Dearmored key has the wrong headers! %v", headers)
+	} else if string(rest) != "trailer" {
+		t.Fatalf("Dearmoring left the wrong rest! %q", rest)
+	}
+
+	// The headers have to agree with the key.
+	tampered := bytes.Replace(armored, []byte("Construction: chow"), []byte("Construction: xiao"), 1)
+	if _, _, _, err := DearmorKey(tampered); err == nil {
+		t.Fatalf("Dearmored a key with the wrong construction header!")
+	}
+
+	if _, err := ArmorKey(input, nil); err == nil {
+		t.Fatalf("Armored a key without a header!")
+	}
+}
+
+func TestArmorEncodings(t *testing.T) {
+	_, inputMask, outputMask := chow.GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomAffineMask, common.RandomMask})
+
+	armored := ArmorEncodings(inputMask, outputMask, map[string]string{"Key-ID": "6c6963656e736565"})
+
+	input, output, _, err := DearmorEncodings(armored)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(chow.SerializeMask(input), chow.SerializeMask(inputMask)) {
+		t.Fatalf("Dearmored input encoding disagrees!")
+	} else if !bytes.Equal(chow.SerializeMask(output), chow.SerializeMask(outputMask)) {
+		t.Fatalf("Dearmored output encoding disagrees!")
+	}
+
+	// Either block alone isn't enough.
+	if _, _, _, err := DearmorEncodings(armored[:len(armored)/2]); err == nil {
+		t.Fatalf("Dearmored a missing encoding!")
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	current := constr.Serialize()
+	macKey := []byte("MAC key")
+
+	// Rebuild the key as it would have been written by older versions of the format.
+	tables := current[common.HeaderSize+9:]
+	v1 := append([]byte{'O', 'W', 'B', 'X', 1, byte(common.ChowConstruction), 10, 0}, tables...)
+
+	withMAC := constr.SerializeWithMAC(macKey) // Version 1 keys can't have a MAC.
+
+	for i, old := range [][]byte{tables, v1, current} {
+		if cand, err := Parse(old); err != nil {
+			t.Fatalf("Parse returned error for version %v: %v", i, err)
+		} else if cand.Type() != common.ChowConstruction {
+			t.Fatalf("Parsed version %v key is a %v key!", i, cand.Type())
+		}
+
+		cand, err := Migrate(old)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(cand, current) {
+			t.Fatalf("Migrated version %v key disagrees with the current format!", i)
+		}
+
+		cand, err = MigrateWithMAC(old, macKey)
+		if err != nil {
+			t.Fatal(err)
+		} else if err := chow.VerifyIntegrity(bytes.NewReader(cand), macKey); err != nil {
+			t.Fatalf("Migrated version %v key has a bad MAC: %v", i, err)
+		}
+	}
+
+	// Keys with a MAC need the MAC key, and the right one.
+	if _, err := Migrate(withMAC); err == nil {
+		t.Fatalf("Migrated a key with a MAC without the MAC key!")
+	} else if _, err := MigrateWithMAC(withMAC, []byte("wrong")); err == nil {
+		t.Fatalf("Migrated a key with the wrong MAC key!")
+	}
+
+	cand, err := MigrateWithMAC(withMAC, macKey)
+	if err != nil {
+		t.Fatal(err)
+	} else if Version(cand) != common.CurrentVersion || Version(tables) != 0 || Version(v1) != 1 {
+		t.Fatalf("Wrong versions! %v, %v, %v", Version(cand), Version(tables), Version(v1))
+	} else if err := chow.VerifyIntegrity(bytes.NewReader(cand), macKey); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,67 @@
+package full
+
+import (
+	"runtime"
+	"sync"
+)
+
+// minBlocksPerWorker is the smallest batch worth handing to its own goroutine, as in the chow package.
+const minBlocksPerWorker = 16
+
+// EncryptBlocks encrypts every block in src into dst. The length of src must be a multiple of the block size and dst
+// must be at least as long as src. Dst and src may point at the same memory. Large batches are split across up to
+// GOMAXPROCS goroutines, each with its own scratch space.
+func (constr Construction) EncryptBlocks(dst, src []byte) {
+	constr.cryptBlocks(dst, src)
+}
+
+// DecryptBlocks decrypts every block in src into dst, with the same requirements as EncryptBlocks.
+func (constr Construction) DecryptBlocks(dst, src []byte) {
+	constr.cryptBlocks(dst, src)
+}
+
+// cryptBlocks splits src into contiguous runs of blocks and pushes each block through the SPN, with one goroutine per
+// run.
+func (constr *Construction) cryptBlocks(dst, src []byte) {
+	bs := constr.BlockSize()
+	if len(src)%bs != 0 {
+		panic("Input not full blocks!")
+	} else if len(dst) < len(src) {
+		panic("Output smaller than input!")
+	}
+
+	blocks := len(src) / bs
+
+	workers := runtime.GOMAXPROCS(0)
+	if max := blocks / minBlocksPerWorker; max < workers {
+		workers = max
+	}
+
+	if workers <= 1 {
+		constr.cryptRun(dst, src)
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		lo, hi := bs*(w*blocks/workers), bs*((w+1)*blocks/workers)
+
+		go func(lo, hi int) {
+			defer wg.Done()
+			constr.cryptRun(dst[lo:hi], src[lo:hi])
+		}(lo, hi)
+	}
+
+	wg.Wait()
+}
+
+// cryptRun pushes every block in src through the SPN, reusing one scratch space.
+func (constr *Construction) cryptRun(dst, src []byte) {
+	var s scratch
+
+	for i := 0; i < len(src); i += 16 {
+		constr.cryptWith(&s, dst[i:i+16], src[i:i+16])
+	}
+}
@@ -1,5 +1,10 @@
 // Package full implements the full white-box AES construction, with decomposed S-boxes. An attack on this construction
-// is not implemented.
+// is not implemented; cryptanalysis/full runs the generic attacks against it, which fail.
+//
+// Like Chow's construction, it's asymmetric: GenerateKeys generates keys for encryption and GenerateDecryptionKeys
+// generates keys for decryption. Both are evaluated the same way, by pushing the block through the SPN.
+// GeneratePerturbedKeys and GeneratePerturbedDecryptionKeys add Bringer, Chabanne, and Dottax's internal perturbations to
+// the SPN, at the cost of a larger key.
 //
 // http://dl.acm.org/citation.cfm?id=2995314
 package full
@@ -37,11 +42,16 @@ func (ba *blockAffine) compose(in *blockAffine) *blockAffine {
 	}
 }
 
-func (ba *blockAffine) transform(in []byte) []byte {
-	temp := ba.linear.Mul(matrix.Row(in))
-	temp = temp.Add(ba.constant)
+// transformTo applies the transformation to in and writes the result into dst, which must be exactly as long as the
+// output and must not overlap in.
+func (ba *blockAffine) transformTo(dst, in []byte) {
+	copy(dst, ba.constant)
 
-	return []byte(temp)
+	for i, row := range ba.linear {
+		if row.DotProduct(matrix.Row(in)) {
+			dst[i/8] ^= 1 << uint(i%8)
+		}
+	}
 }
 
 func (ba *blockAffine) BlockAffine() encoding.BlockAffine {
@@ -65,6 +75,10 @@ func (ba *blockAffine) serialize(out *[]byte) {
 
 // compress compute the AND of neighboring bits in src and stores the result in dst.
 func compress(dst, src []byte) {
+	for i := range dst {
+		dst[i] = 0
+	}
+
 	for i := 0; i < 8*len(dst); i++ {
 		b1 := src[(2*i+0)/8] >> uint((2*i+0)%8)
 		b2 := src[(2*i+1)/8] >> uint((2*i+1)%8)
@@ -80,20 +94,78 @@ func (constr Construction) BlockSize() int { return 16 }
 
 // Encrypt encrypts the first block in src into dst. Dst and src may point at the same memory.
 func (constr Construction) Encrypt(dst, src []byte) {
-	state := src[:16]
+	constr.crypt(dst, src)
+}
+
+// Decrypt decrypts the first block in src into dst, if the construction was generated with GenerateDecryptionKeys. Dst
+// and src may point at the same memory.
+//
+// The SPN computes whichever direction it was generated for, so Encrypt and Decrypt are the same function.
+func (constr Construction) Decrypt(dst, src []byte) {
+	constr.crypt(dst, src)
+}
+
+// scratch is the working memory of one evaluation of the SPN: temp holds the output of an affine layer, at most
+// 2*compressSize + (stateSize - compressSize) = 128 bytes, and state holds the output of an S-box layer, at most 64. A
+// perturbed construction needs three and two more bytes for each byte of perturbation.
+type scratch struct {
+	temp  [128 + 3*MaxPerturbations]byte
+	state [64 + 2*MaxPerturbations]byte
+}
+
+// crypt pushes the first block in src through the SPN and writes the result to dst.
+func (constr *Construction) crypt(dst, src []byte) {
+	var s scratch
+	constr.cryptWith(&s, dst, src)
+}
 
-	for i, m := range constr[:len(constr)-1] {
-		temp := m.transform(state)
-		state = make([]byte, stateSize[i%4])
+// cryptWith is crypt, with the caller's scratch space, so that it doesn't allocate.
+func (constr *Construction) cryptWith(s *scratch, dst, src []byte) {
+	state := src[:16]
 
-		cs := compressSize[i%4]
-		compress(state[:cs], temp[:2*cs])
-		copy(state[cs:], temp[2*cs:])
+	for i := range constr[:len(constr)-1] {
+		state = constr.layer(s, i, state)
 	}
 
-	state = constr[40].transform(state)
-	copy(dst[:16], state[:16])
+	out := s.temp[:16]
+	constr[40].transformTo(out, state)
+	copy(dst[:16], out)
+}
+
+// layer pushes state through affine layer i and the S-box layer after it, and returns the new state, which is held in
+// s.state.
+func (constr *Construction) layer(s *scratch, i int, state []byte) []byte {
+	m := constr[i]
+
+	ss, cs := sizes(i, constr.perturbations())
+
+	temp := s.temp[:len(m.constant)]
+	m.transformTo(temp, state)
+	state = s.state[:ss]
+
+	compress(state[:cs], temp[:2*cs])
+	copy(state[cs:], temp[2*cs:])
+
+	return state
 }
 
-// Decrypt is not implemented.
-func (constr Construction) Decrypt(_, _ []byte) {}
+// Trace encrypts the first block in src into dst, like Encrypt, and returns the outputs of the first n S-box layers,
+// concatenated: a software execution trace of the block, for side-channel analysis. There are four S-box layers in each
+// round, and 40 in total.
+func (constr Construction) Trace(dst, src []byte, n int) (trace []byte) {
+	var s scratch
+	state := src[:16]
+
+	for i := range constr[:len(constr)-1] {
+		state = constr.layer(&s, i, state)
+		if i < n {
+			trace = append(trace, state...)
+		}
+	}
+
+	out := s.temp[:16]
+	constr[40].transformTo(out, state)
+	copy(dst[:16], out)
+
+	return trace
+}
@@ -2,8 +2,11 @@ package full
 
 import (
 	"bytes"
+	"crypto/aes"
 	"testing"
 
+	"github.com/OpenWhiteBox/AES/constructions/common"
+
 	test_vectors "github.com/OpenWhiteBox/AES/constructions/test"
 )
 
@@ -34,22 +37,203 @@ func TestEncrypt(t *testing.T) {
 	}
 }
 
+func TestDecrypt(t *testing.T) {
+	for n, vec := range test_vectors.GetAESVectors(testing.Short()) {
+		constr, inputMask, outputMask := GenerateDecryptionKeys(vec.Key, vec.Key)
+
+		in, out := [16]byte{}, [16]byte{}
+
+		copy(in[:], vec.Out)
+		in = inputMask.Decode(in) // Apply input encoding.
+
+		constr.Decrypt(out[:], in[:])
+
+		out = outputMask.Decode(out) // Remove output encoding.
+
+		if !bytes.Equal(vec.In, out[:]) {
+			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.In, out)
+		}
+
+		break // Only do one. GenerateDecryptionKeys is as slow as GenerateKeys.
+	}
+}
+
 func TestPersistence(t *testing.T) {
 	constr1, _, _ := GenerateKeys(key, seed)
 
 	serialized := constr1.Serialize()
+	if !common.HasHeader(serialized) || len(serialized) != constr1.Size() {
+		t.Fatalf("Serialized construction has the wrong size or no header! %v != %v", len(serialized), constr1.Size())
+	}
+
 	constr2, err := Parse(serialized)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
 
+	// Keys serialized before the header existed should still parse.
+	constr3, err := Parse(serialized[len(serialized)-fullSize(0):])
+	if err != nil {
+		t.Fatalf("Parse returned error for a headerless key: %v", err)
+	}
+
+	real := make([]byte, 16)
+	constr1.Encrypt(real, input)
+
+	for _, constr := range []Construction{constr2, constr3} {
+		cand := make([]byte, 16)
+		constr.Encrypt(cand, input)
+
+		if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with parsed! %x != %x", real, cand)
+		}
+	}
+}
+
+func TestPerturbed(t *testing.T) {
+	constr1, inputMask, outputMask := GeneratePerturbedKeys(key, seed, 4)
+
+	serialized := constr1.Serialize()
+	if len(serialized) != constr1.Size() || constr1.Size() <= header().Size()+fullSize(0) {
+		t.Fatalf("Serialized construction has the wrong size! %v != %v", len(serialized), constr1.Size())
+	}
+
+	constr2, err := Parse(serialized)
 	if err != nil {
 		t.Fatalf("Parse returned error: %v", err)
 	}
 
-	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+	real := make([]byte, 16)
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+
+	for _, constr := range []Construction{constr1, constr2} {
+		in, cand := [16]byte{}, [16]byte{}
+
+		copy(in[:], input)
+		in = inputMask.Decode(in) // Apply input encoding.
+		constr.Encrypt(cand[:], in[:])
+		cand = outputMask.Decode(cand) // Remove output encoding.
+
+		if !bytes.Equal(real, cand[:]) {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		}
+	}
+}
+
+func TestPerturbedDecrypt(t *testing.T) {
+	constr, inputMask, outputMask := GeneratePerturbedDecryptionKeys(key, seed, 1)
+
+	real, in, cand := make([]byte, 16), [16]byte{}, [16]byte{}
+	c, _ := aes.NewCipher(key)
+	c.Decrypt(real, input)
+
+	copy(in[:], input)
+	in = inputMask.Decode(in) // Apply input encoding.
+	constr.Decrypt(cand[:], in[:])
+	cand = outputMask.Decode(cand) // Remove output encoding.
+
+	if !bytes.Equal(real, cand[:]) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestEncryptBlocks(t *testing.T) {
+	constr, _, _ := GenerateKeys(key, seed)
+
+	src := make([]byte, 16*40)
+	for i := range src {
+		src[i] = byte(i)
+	}
+
+	real := make([]byte, len(src))
+	for i := 0; i < len(src); i += 16 {
+		constr.Encrypt(real[i:i+16], src[i:i+16])
+	}
+
+	cand := make([]byte, len(src))
+	constr.EncryptBlocks(cand, src)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	e := constr.NewEncrypter()
+	e.EncryptBlocks(cand, src)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	} else if e.Blocks != 40 {
+		t.Fatalf("Encrypter counted the wrong number of blocks! %v != 40", e.Blocks)
+	}
+
+	out := make([]byte, 16)
+	allocs := testing.AllocsPerRun(100, func() { e.Encrypt(out, input) })
+	if allocs != 0 {
+		t.Fatalf("Encrypter allocated! %v allocations per run", allocs)
+	}
+}
+
+func FuzzParse(f *testing.F) {
+	constr, _, _ := GenerateKeys(key, seed)
+	serialized := constr.Serialize()
+
+	f.Add(uint32(0), []byte{0xff}, uint32(0))
+	f.Add(uint32(len(serialized)-fullSize(0)), []byte{0x01}, uint32(0))
+	f.Add(uint32(len(serialized)-fullSize(0)+1), []byte{0xff}, uint32(0))
+	f.Add(uint32(len(serialized)-fullSize(0)+2), []byte{0x00, 0x00}, uint32(0))
+	f.Add(uint32(0), []byte{}, uint32(1))
+
+	f.Fuzz(func(t *testing.T, offset uint32, patch []byte, cut uint32) {
+		in := append([]byte{}, serialized...)
+		copy(in[int(offset)%len(in):], patch)
+		in = in[:len(in)-int(cut)%len(in)]
+
+		if constr, err := Parse(in); err == nil {
+			constr.Encrypt(make([]byte, 16), input)
+		}
+	})
+}
+
+func BenchmarkEncrypt(b *testing.B) {
+	constr, _, _ := GenerateKeys(key, seed)
+
+	out := make([]byte, 16)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		constr.Encrypt(out, input)
+	}
+}
+
+// BenchmarkEncryptParallel encrypts with one construction shared between GOMAXPROCS goroutines, like a server handling
+// many streams at once with the same key.
+func BenchmarkEncryptParallel(b *testing.B) {
+	constr, _, _ := GenerateKeys(key, seed)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		out := make([]byte, 16)
+
+		for pb.Next() {
+			constr.Encrypt(out, input)
+		}
+	})
+}
+
+func BenchmarkEncryptBlocks(b *testing.B) {
+	constr, _, _ := GenerateKeys(key, seed)
+
+	buf := make([]byte, 16*1024)
 
-	constr1.Encrypt(cand1, input)
-	constr2.Encrypt(cand2, input)
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
 
-	if !bytes.Equal(cand1, cand2) {
-		t.Fatalf("Real disagrees with parsed! %x != %x", cand1, cand2)
+	for i := 0; i < b.N; i++ {
+		constr.EncryptBlocks(buf, buf)
 	}
 }
@@ -18,7 +18,7 @@ func generateAffineMasks(rs *random.Source) (inputMask, outputMask *blockAffine)
 	var inputLinear, outputLinear matrix.Matrix
 	common.GenerateMasks(rs, common.IndependentMasks{common.RandomMask, common.RandomMask}, &inputLinear, &outputLinear)
 
-	reader := rs.Stream(make([]byte, 16))
+	reader := rs.Stream(common.Label(""))
 
 	inputConstant, outputConstant := matrix.NewRow(128), matrix.NewRow(128)
 	reader.Read(inputConstant[:])
@@ -110,6 +110,17 @@ func generateSelfEquivalence(r io.Reader, stateSize, compressSize int) (a, bInv
 
 // GenerateKeys creates a white-boxed version of the AES key `key`, with any non-determinism generated by `seed`.
 func GenerateKeys(key, seed []byte) (out Construction, inputMask, outputMask encoding.BlockAffine) {
+	return GeneratePerturbedKeys(key, seed, 0)
+}
+
+// GeneratePerturbedKeys is like GenerateKeys, but every S-box layer of the SPN also computes the given number of bytes of
+// random perturbation, which are mixed into AES's state and cancelled by the end. It panics unless perturbations is
+// between 0 and MaxPerturbations; with 0, it's the same as GenerateKeys. Each byte of perturbation adds about 100KB to the
+// key.
+//
+// The perturbations are a reference implementation for attacks to be tried against, not a proven countermeasure:
+// perturbed algebraic white-boxes have been broken, by De Mulder, Wyseur, and Preneel among others.
+func GeneratePerturbedKeys(key, seed []byte, perturbations int) (out Construction, inputMask, outputMask encoding.BlockAffine) {
 	rs := random.NewSource("Ful Construction", seed)
 
 	// Generate two completely random affine transformations, to be put on input and output of SPN.
@@ -120,35 +131,87 @@ func GenerateKeys(key, seed []byte) (out Construction, inputMask, outputMask enc
 	roundKeys := contr.StretchedKey()
 
 	// Generate an SPN which has the input and output masks, but is otherwise un-obfuscated.
-	out[0] = decomposition[0].compose(&blockAffine{
-		linear:   matrix.GenerateIdentity(128),
-		constant: matrix.Row(roundKeys[0]),
-	}).compose(input)
+	out = generateSPN(
+		(&blockAffine{linear: matrix.GenerateIdentity(128), constant: matrix.Row(roundKeys[0])}).compose(input),
+		func(i int) *blockAffine {
+			return &blockAffine{linear: round, constant: matrix.Row(roundKeys[i]).Add(subBytesConst)}
+		},
+		output.compose(&blockAffine{linear: lastRound, constant: matrix.Row(roundKeys[10]).Add(subBytesConst)}),
+	)
+
+	perturb(&rs, &out, perturbations)
+	mixSelfEquivalences(&rs, &out)
+
+	return out, input.BlockAffine(), output.BlockAffine()
+}
+
+// GenerateDecryptionKeys creates a white-boxed version of the AES key `key` for decryption, with any non-determinism
+// generated by `seed`. The construction has the same shape as one for encryption and is evaluated the same way, so
+// either of its Encrypt or Decrypt methods computes outputMask(AES^(-1)(inputMask(x))).
+func GenerateDecryptionKeys(key, seed []byte) (out Construction, inputMask, outputMask encoding.BlockAffine) {
+	return GeneratePerturbedDecryptionKeys(key, seed, 0)
+}
+
+// GeneratePerturbedDecryptionKeys is GenerateDecryptionKeys with perturbations, as in GeneratePerturbedKeys.
+func GeneratePerturbedDecryptionKeys(key, seed []byte, perturbations int) (out Construction, inputMask, outputMask encoding.BlockAffine) {
+	rs := random.NewSource("Full Decryption", seed)
+
+	input, output := generateAffineMasks(&rs)
+
+	contr := saes.Construction{key}
+	roundKeys := contr.StretchedKey()
+
+	// Each round of decryption is undone by an inversion in GF(2^8), preceded by the inverse of the affine layer that
+	// follows the same inversion in encryption. InvSubBytes's constant is the inverse of the last round applied to
+	// SubBytes's.
+	invRound, _ := round.Invert()
+	invLastRound, _ := lastRound.Invert()
+	invSubBytesConst := invLastRound.Mul(subBytesConst)
+
+	out = generateSPN(
+		(&blockAffine{
+			linear:   invLastRound,
+			constant: invLastRound.Mul(matrix.Row(roundKeys[10]).Add(subBytesConst)),
+		}).compose(input),
+		func(i int) *blockAffine {
+			return &blockAffine{
+				linear:   invRound,
+				constant: invRound.Mul(matrix.Row(roundKeys[10-i])).Add(invSubBytesConst),
+			}
+		},
+		output.compose(&blockAffine{linear: matrix.GenerateIdentity(128), constant: matrix.Row(roundKeys[0])}),
+	)
+
+	perturb(&rs, &out, perturbations)
+	mixSelfEquivalences(&rs, &out)
+
+	return out, input.BlockAffine(), output.BlockAffine()
+}
+
+// generateSPN builds an un-obfuscated SPN of ten S-box layers. first is the affine layer before the first S-box layer,
+// middle(i) is the one after the i-th, and last is the one after the tenth.
+func generateSPN(first *blockAffine, middle func(int) *blockAffine, last *blockAffine) (out Construction) {
+	out[0] = decomposition[0].compose(first)
 	copy(out[1:5], decomposition[1:5])
 
 	for i := 1; i < 10; i++ {
-		out[4*i+0] = decomposition[0].compose(&blockAffine{
-			linear:   round,
-			constant: matrix.Row(roundKeys[i]).Add(subBytesConst),
-		}).compose(out[4*i+0])
+		out[4*i+0] = decomposition[0].compose(middle(i)).compose(out[4*i+0])
 		copy(out[4*i+1:4*i+5], decomposition[1:5])
 	}
 
-	out[40] = output.compose(&blockAffine{
-		linear:   lastRound,
-		constant: matrix.Row(roundKeys[10]).Add(subBytesConst),
-	}).compose(out[40])
+	out[40] = last.compose(out[40])
+
+	return
+}
 
-	// Sample self-equivalences of the S-box layer and mix them into adjacent affine layers.
-	label := make([]byte, 16)
-	copy(label, []byte("Self-Eq"))
-	r := rs.Stream(label)
+// mixSelfEquivalences samples self-equivalences of the S-box layer and mixes them into adjacent affine layers.
+func mixSelfEquivalences(rs *random.Source, out *Construction) {
+	r, perturbations := rs.Stream(common.Label("Self-Eq")), out.perturbations()
 
 	for i := 0; i < 40; i++ {
-		a, bInv := generateSelfEquivalence(r, stateSize[i%4], compressSize[i%4])
+		state, compress := sizes(i, perturbations)
+		a, bInv := generateSelfEquivalence(r, state, compress)
 		out[i] = a.compose(out[i])
 		out[i+1] = out[i+1].compose(bInv)
 	}
-
-	return out, input.BlockAffine(), output.BlockAffine()
 }
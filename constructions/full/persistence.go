@@ -2,11 +2,28 @@ package full
 
 import (
 	"errors"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
 )
 
-// Serialize serializes a white-box construction into a byte slice.
+// fullSize returns the size of a serialized construction with the given number of bytes of perturbation, not counting
+// the header. Without perturbations, it's 1091178 bytes.
+func fullSize(perturbations int) (out int) {
+	for i := 0; i < 41; i++ {
+		h, w := layerSize(i, perturbations)
+		out += 2 + 8*h*w + h
+	}
+
+	return out
+}
+
+// Serialize serializes a white-box construction into a byte slice. The output starts with a common.Header, in the same
+// format as the chow and xiao packages' keys, followed by every affine layer in the order they're applied.
 func (constr *Construction) Serialize() []byte {
-	out := make([]byte, 0)
+	h := header()
+
+	out := make([]byte, h.Size(), constr.Size())
+	h.Serialize(out)
 
 	for _, round := range constr {
 		round.serialize(&out)
@@ -15,15 +32,92 @@ func (constr *Construction) Serialize() []byte {
 	return out
 }
 
-// Parse parses a byte array into a white-box construction. It returns an error if the byte slice isn't long enough.
+// Size returns the number of bytes in the serialized construction, header included. It's the same for every key with the
+// same number of perturbations, and is meant for comparing the footprint of this construction against the others.
+func (constr *Construction) Size() int {
+	return header().Size() + fullSize(constr.perturbations())
+}
+
+func header() common.Header {
+	return common.Header{
+		Version: common.CurrentVersion,
+		Type:    common.FullConstruction,
+		Rounds:  10,
+	}
+}
+
+// Parse parses a byte array into a white-box construction. It returns an error if the header is invalid or the byte
+// slice is the wrong length. Keys serialized without a header are still accepted. A MAC at the end of the key is
+// skipped, not checked.
 func Parse(in []byte) (constr Construction, err error) {
-	if len(in) != 1091178 {
+	if common.HasHeader(in) {
+		var h common.Header
+		h, in, err = common.ParseHeader(in, common.FullConstruction)
+		if err != nil {
+			return
+		} else if h.Rounds != 10 || h.Shuffled || h.Compressed || len(in) < h.TrailerSize() {
+			return constr, errors.New("Parsing the key failed!")
+		}
+
+		in = in[:len(in)-h.TrailerSize()]
+	}
+
+	// The number of perturbations is read off the size of the first layer.
+	perturbations := -1
+	if len(in) > 0 {
+		if h, _ := layerSize(0, 0); int(in[0]) >= h && (int(in[0])-h)%3 == 0 {
+			perturbations = (int(in[0]) - h) / 3
+		}
+	}
+
+	if perturbations < 0 || perturbations > MaxPerturbations || len(in) != fullSize(perturbations) {
 		return constr, errors.New("key is the wrong size")
 	}
 
 	for i := 0; i < len(constr); i++ {
+		// The dimensions of each layer are stored in the key, but the SPN only works with the ones it was built with.
+		// Checking them all also means every layer fits in what's left of in.
+		if h, w := layerSize(i, perturbations); int(in[0]) != h || int(in[1]) != w {
+			return Construction{}, errors.New("Parsing the key failed!")
+		}
+
 		constr[i], in = parseBlockAffine(in)
 	}
 
 	return
 }
+
+// layerSize returns the size of the output and input of affine layer i, in bytes, for a construction with the given
+// number of bytes of perturbation.
+func layerSize(i, perturbations int) (out, in int) {
+	out, in = 16, 16
+	if i < 40 {
+		state, compress := sizes(i, perturbations)
+		out = state + compress
+	}
+	if i > 0 {
+		in, _ = sizes(i-1, perturbations)
+	}
+
+	return
+}
+
+func init() {
+	parse := func(in []byte) (common.Construction, error) {
+		constr, err := Parse(in)
+		if err != nil {
+			return nil, err
+		}
+
+		return &constr, nil
+	}
+
+	common.Register(common.FullConstruction, parse)
+	common.RegisterLegacy(common.FullConstruction, parse) // Parse also reads keys serialized without a header.
+}
+
+// Type returns common.FullConstruction. (Necessary to implement common.Construction.)
+func (constr Construction) Type() common.ConstructionType { return common.FullConstruction }
+
+// KeySize returns 16: the construction only computes AES-128.
+func (constr Construction) KeySize() int { return 16 }
@@ -0,0 +1,100 @@
+package full
+
+import (
+	"io"
+
+	"github.com/OpenWhiteBox/primitives/matrix"
+	"github.com/OpenWhiteBox/primitives/random"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// MaxPerturbations is the largest number of bytes of perturbation a construction can carry.
+const MaxPerturbations = 16
+
+// perturbations returns the number of bytes of perturbation the construction carries, read off the size of its first
+// affine layer.
+func (constr *Construction) perturbations() int {
+	state, compress := sizes(0, 0)
+	return (len(constr[0].constant) - state - compress) / 3
+}
+
+// sizes returns the size of the state after S-box layer i and (half of) how many bytes of it go through AND gates, for a
+// construction with the given number of bytes of perturbation. The state carries the perturbation twice: the fresh one
+// computed by the layer's AND gates, and a copy of the previous one, which the next layer needs to cancel it.
+func sizes(i, perturbations int) (state, compress int) {
+	return stateSize[i%4] + 2*perturbations, compressSize[i%4] + perturbations
+}
+
+// randomMatrix returns a random, not necessarily invertible, matrix with the given number of rows and columns.
+func randomMatrix(r io.Reader, rows, cols int) matrix.Matrix {
+	out := matrix.GenerateEmpty(rows, cols)
+	for _, row := range out {
+		r.Read(row)
+	}
+
+	return out
+}
+
+// perturb adds internal perturbations to an un-obfuscated SPN, in the style of Bringer, Chabanne, and Dottax: every
+// S-box layer computes perturbations bytes of random quadratic polynomials of the whole state--AES's and the last
+// perturbation--alongside AES. The previous perturbation is added to the bits of AES's state that skip the AND gates
+// and, since it's carried along, cancelled by the next affine layer. The last layer drops it. Self-equivalences mixed in
+// afterwards hide which AND gates and which bits of the state are AES's.
+//
+// "White Box Cryptography: Another Attempt" by Julien Bringer, Hervé Chabanne, and Emmanuelle Dottax,
+// https://eprint.iacr.org/2006/468
+func perturb(rs *random.Source, out *Construction, perturbations int) {
+	if perturbations < 0 || perturbations > MaxPerturbations {
+		panic("Invalid number of perturbations!")
+	} else if perturbations == 0 {
+		return
+	}
+
+	r, bits := rs.Stream(common.Label("PB")), 8*perturbations
+
+	// unmask takes the input of layer i to AES's state, and prev takes it to the perturbation that was added to it. The
+	// first layer has no previous perturbation, so it makes one up from the input.
+	unmask, prev := matrix.GenerateIdentity(128), randomMatrix(r, bits, 128)
+
+	for i := 0; i < 40; i++ {
+		state, compress := stateSize[i%4], compressSize[i%4]
+		_, inSize := unmask.Size()
+
+		real := out[i].linear.Compose(unmask)
+		mix := randomMatrix(r, 8*(state-compress), bits)
+
+		// The output is the input of AES's AND gates, the input of the perturbation's AND gates, AES's state that skips
+		// them with the previous perturbation added, and a copy of the previous perturbation.
+		linear := append(matrix.Matrix{}, real[:16*compress]...)
+		linear = append(linear, randomMatrix(r, 2*bits, inSize)...)
+		linear = append(linear, real[16*compress:].Add(mix.Compose(prev))...)
+		linear = append(linear, prev...)
+
+		constant := matrix.NewRow(len(linear))
+		copy(constant, out[i].constant[:2*compress])
+		r.Read(constant[2*compress : 2*compress+2*perturbations])
+		copy(constant[2*compress+2*perturbations:], out[i].constant[2*compress:])
+
+		out[i] = &blockAffine{linear: linear, constant: constant}
+
+		// The state after the S-box layer is AES's AND gates, the perturbation's, the rest of AES's state, and the copy.
+		stored, _ := sizes(i, perturbations)
+
+		unmask = matrix.GenerateEmpty(8*state, 8*stored)
+		for j := 0; j < 8*compress; j++ {
+			unmask[j].SetBit(j, true)
+		}
+		for j := 8 * compress; j < 8*state; j++ {
+			unmask[j].SetBit(j+bits, true)
+			copy(unmask[j][state+perturbations:], mix[j-8*compress])
+		}
+
+		prev = matrix.GenerateEmpty(bits, 8*stored)
+		for j := 0; j < bits; j++ {
+			prev[j].SetBit(8*compress+j, true)
+		}
+	}
+
+	out[40] = &blockAffine{linear: out[40].linear.Compose(unmask), constant: out[40].constant}
+}
@@ -0,0 +1,172 @@
+// Package implicit implements a white-box AES construction with implicit round functions, in the style of Ranea,
+// Vandersmissen, and Preneel's implicit implementations. There is no attack on this construction implemented.
+//
+// Every round of AES is one layer of S-boxes between two affine layers, and the only non-linear part of the AES S-box,
+// inversion in GF(2^8), has an implicit description that's quadratic: y = x^(-1) exactly when x^2*y = x and x*y^2 = y
+// (including 0^(-1) = 0). Both sides are bilinear in the bits of x and y, so the round has an implicit function T, 256
+// quadratic equations in the bits of its input and output, that is zero exactly when the output follows from the input.
+// The construction stores T for every round with a random affine encoding on the state between rounds and a random
+// invertible linear map mixing its equations, which keeps it quadratic but hides the S-boxes and round keys. To evaluate
+// a round, the equations are made linear in the output by fixing the input, and solved.
+//
+// Each round's layer of inversions is also re-encoded with a random affine self-equivalence, as in the toy construction:
+// every byte is raised to a power of 2, multiplied by a scalar, and moved, which inversion commutes with up to the
+// inverse scalar. Between rounds these fold into the random encodings, but in the first and last rounds they keep the
+// masks and round keys from fixing which bit of the state goes into which S-box's equations.
+//
+// These are the only self-equivalences used. The paper also uses quadratic self-equivalences of the implicit functions
+// (graph automorphisms) to resist algebraic attacks on affine-encoded implicit functions, and those aren't implemented:
+// every encoding here is affine. This construction is for experimenting with implicit implementations, not for
+// protecting keys.
+//
+// "Implicit White-Box Implementations: White-Boxing ARX Ciphers" by Adrián Ranea, Joachim Vandersmissen, and Bart
+// Preneel, https://eprint.iacr.org/2022/428
+package implicit
+
+import (
+	"encoding/binary"
+	"math/bits"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// vector is a vector of 128 bits, laid out like a block: bit i is bit i%8 of byte i/8, which is bit i%64 of word i/64.
+type vector [2]uint64
+
+func toVector(in []byte) vector {
+	return vector{binary.LittleEndian.Uint64(in[0:]), binary.LittleEndian.Uint64(in[8:])}
+}
+
+func (v vector) bytes() (out [16]byte) {
+	binary.LittleEndian.PutUint64(out[0:], v[0])
+	binary.LittleEndian.PutUint64(out[8:], v[1])
+
+	return
+}
+
+func (v vector) bit(i int) uint64 { return v[i/64] >> uint(i%64) & 1 }
+
+// dot returns the inner product of v and w.
+func (v vector) dot(w vector) uint64 {
+	return uint64(bits.OnesCount64(v[0]&w[0])+bits.OnesCount64(v[1]&w[1])) & 1
+}
+
+// RoundFunction is the implicit function of one round under encodings: the round takes x to the only y with T(x, y) = 0.
+// Equation i of T is
+//
+//	sum_j x_j * (Quadratic[j][i] . y) + LinearX[i] . x + LinearY[i] . y + bit i of Constant
+//
+// where . is the inner product of vectors of 128 bits. None of the equations multiply two bits of x or two bits of y.
+type RoundFunction struct {
+	Quadratic [128][256]vector // [bit of x][equation]
+	LinearX   [256]vector      // [equation]
+	LinearY   [256]vector      // [equation]
+	Constant  [4]uint64
+}
+
+// system is a system of 256 linear equations in 128 unknowns: the first two words of each are the coefficients, and the
+// last is the right-hand side.
+type system [256][3]uint64
+
+// evaluate returns the output of the round on input x.
+func (rf *RoundFunction) evaluate(x vector) vector {
+	var sys system
+
+	for i := range sys {
+		sys[i][0], sys[i][1] = rf.LinearY[i][0], rf.LinearY[i][1]
+		sys[i][2] = rf.Constant[i/64]>>uint(i%64)&1 ^ rf.LinearX[i].dot(x)
+	}
+
+	for j := 0; j < 128; j++ {
+		if x.bit(j) == 0 {
+			continue
+		}
+
+		q := &rf.Quadratic[j]
+		for i := range sys {
+			sys[i][0] ^= q[i][0]
+			sys[i][1] ^= q[i][1]
+		}
+	}
+
+	return sys.solve()
+}
+
+// solve returns a solution of the system, by Gauss-Jordan elimination. The systems of a valid construction always have
+// exactly one solution; otherwise, unknowns that can't be determined are zero.
+func (sys *system) solve() (out vector) {
+	row := 0
+
+	var pivots [128]int
+	for col := range pivots {
+		pivots[col] = -1
+
+		w, bit := col/64, uint64(1)<<uint(col%64)
+
+		r := row
+		for r < len(sys) && sys[r][w]&bit == 0 {
+			r++
+		}
+		if r == len(sys) {
+			continue
+		}
+
+		sys[row], sys[r] = sys[r], sys[row]
+		for i := range sys {
+			if i != row && sys[i][w]&bit != 0 {
+				sys[i][0] ^= sys[row][0]
+				sys[i][1] ^= sys[row][1]
+				sys[i][2] ^= sys[row][2]
+			}
+		}
+
+		pivots[col] = row
+		row++
+	}
+
+	for col, r := range pivots {
+		if r >= 0 {
+			out[col/64] |= sys[r][2] << uint(col%64)
+		}
+	}
+
+	return
+}
+
+// Construction is a white-boxed AES key: one implicit round function for each round of AES.
+type Construction struct {
+	Rounds []RoundFunction
+
+	// Metadata is saved in the header of the serialized construction. Key generation leaves it empty.
+	Metadata common.Metadata
+}
+
+// BlockSize returns the block size of AES. (Necessary to implement cipher.Block.)
+func (constr Construction) BlockSize() int { return 16 }
+
+// Encrypt encrypts the first block in src into dst, if the construction was generated with GenerateEncryptionKeys. Dst
+// and src may point at the same memory.
+func (constr Construction) Encrypt(dst, src []byte) {
+	constr.crypt(dst, src)
+}
+
+// Decrypt decrypts the first block in src into dst, if the construction was generated with GenerateDecryptionKeys. Dst
+// and src may point at the same memory.
+//
+// The round functions compute whichever direction they were generated for, so Encrypt and Decrypt are the same
+// function.
+func (constr Construction) Decrypt(dst, src []byte) {
+	constr.crypt(dst, src)
+}
+
+// crypt pushes the first block in src through every round and writes the result to dst.
+func (constr *Construction) crypt(dst, src []byte) {
+	state := toVector(src)
+
+	for i := range constr.Rounds {
+		state = constr.Rounds[i].evaluate(state)
+	}
+
+	out := state.bytes()
+	copy(dst, out[:])
+}
@@ -0,0 +1,331 @@
+package implicit
+
+import (
+	"io"
+	"math/bits"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+	"github.com/OpenWhiteBox/primitives/number"
+	"github.com/OpenWhiteBox/primitives/random"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+// blockFunc is an affine function on the AES state.
+type blockFunc func([16]byte) [16]byte
+
+// affineOf returns f as an encoding.BlockAffine, by evaluating it on a basis. f must be an invertible affine function.
+func affineOf(f blockFunc) encoding.BlockAffine {
+	constant := f([16]byte{})
+
+	linear := matrix.GenerateEmpty(128, 128)
+	for col := 0; col < 128; col++ {
+		var in [16]byte
+		in[col/8] = 1 << uint(col%8)
+
+		out := f(in)
+		for row := 0; row < 128; row++ {
+			linear[row].SetBit(col, (out[row/8]^constant[row/8])>>uint(row%8)&1 == 1)
+		}
+	}
+
+	return encoding.NewBlockAffine(linear, constant)
+}
+
+// bytewise applies f to every byte of the block.
+func bytewise(in [16]byte, f func(byte) byte) (out [16]byte) {
+	for i := range in {
+		out[i] = f(in[i])
+	}
+
+	return
+}
+
+// products is the multiplication table of GF(2^8). Key generation multiplies field elements millions of times.
+var products = func() (out [256][256]byte) {
+	for x := range out {
+		for y := range out[x] {
+			out[x][y] = byte(number.ByteFieldElem(x).Mul(number.ByteFieldElem(y)))
+		}
+	}
+
+	return
+}()
+
+func square(x byte) byte { return products[x][x] }
+func mul(x, y byte) byte { return products[x][y] }
+
+// tabulate returns the table of f.
+func tabulate(f func(byte) byte) (out [256]byte) {
+	for x := range out {
+		out[x] = f(byte(x))
+	}
+
+	return
+}
+
+// equations evaluates the implicit function of a layer of inversions on u and z: for each byte, the bits of u^2*z + u
+// and then those of u*z^2 + z. All are zero exactly when z is the inverse of u.
+func equations(u, z [16]byte) matrix.Row {
+	out := matrix.NewRow(256)
+	for i := 0; i < 16; i++ {
+		out[2*i+0] = mul(square(u[i]), z[i]) ^ u[i]
+		out[2*i+1] = mul(u[i], square(z[i])) ^ z[i]
+	}
+
+	return out
+}
+
+// implicitRound builds the implicit function of a round that takes x to y = after(inv(before(x))), where inv inverts
+// every byte, and before and after are affine. mix is applied to the equations.
+func implicitRound(before, after blockFunc, mix matrix.Matrix) (out RoundFunction) {
+	afterInv := affineOf(after)
+	g, h := before, func(y [16]byte) [16]byte { return afterInv.Decode(y) }
+
+	t := func(x, y [16]byte) matrix.Row { return mix.Mul(equations(g(x), h(y))) }
+	basis := func(i int) (out [16]byte) {
+		out[i/8] = 1 << uint(i%8)
+		return
+	}
+	toVectors := func(r matrix.Row, dst []vector, bit int) {
+		for i := 0; i < 256; i++ {
+			dst[i][bit/64] |= uint64(r.GetBit(i)) << uint(bit%64)
+		}
+	}
+
+	// The constant and linear terms come from evaluating T on zero and on a basis.
+	zero := t([16]byte{}, [16]byte{})
+	for i := 0; i < 256; i++ {
+		out.Constant[i/64] |= uint64(zero.GetBit(i)) << uint(i%64)
+	}
+
+	for j := 0; j < 128; j++ {
+		toVectors(t(basis(j), [16]byte{}).Add(zero), out.LinearX[:], j)
+		toVectors(t([16]byte{}, basis(j)).Add(zero), out.LinearY[:], j)
+	}
+
+	// The quadratic terms only depend on the linear parts of g and h: the product of the j-th column of g and the k-th
+	// column of h, x_j * y_k, contributes a^2*c and a*c^2 to each byte, where a and c are the columns' bytes.
+	g0, h0 := g([16]byte{}), h([16]byte{})
+
+	var gCols, hCols [128][16]byte
+	for j := 0; j < 128; j++ {
+		gj, hj := g(basis(j)), h(basis(j))
+		for i := 0; i < 16; i++ {
+			gCols[j][i], hCols[j][i] = gj[i]^g0[i], hj[i]^h0[i]
+		}
+	}
+
+	// The equations are mixed eight at a time, from a table of every sum of eight unmixed equations.
+	var mixRows [256][32]byte
+	for i, row := range mix {
+		copy(mixRows[i][:], row)
+	}
+	sums := new([32][256]vector)
+
+	for j := 0; j < 128; j++ {
+		var raw [256]vector // [unmixed equation] The coefficients of y multiplied by x_j.
+
+		for k := 0; k < 128; k++ {
+			for i := 0; i < 16; i++ {
+				a, c := gCols[j][i], hCols[k][i]
+				if a == 0 || c == 0 {
+					continue
+				}
+
+				p1, p2 := mul(square(a), c), mul(a, square(c))
+				for b := 0; b < 8; b++ {
+					raw[16*i+b][k/64] |= uint64(p1>>uint(b)&1) << uint(k%64)
+					raw[16*i+8+b][k/64] |= uint64(p2>>uint(b)&1) << uint(k%64)
+				}
+			}
+		}
+
+		for c := range sums {
+			for v := 1; v < 256; v++ {
+				low := v & -v
+				m := 8*c + bits.TrailingZeros(uint(low))
+				sums[c][v] = vector{sums[c][v^low][0] ^ raw[m][0], sums[c][v^low][1] ^ raw[m][1]}
+			}
+		}
+
+		for i := 0; i < 256; i++ {
+			var sum vector
+			for c, v := range mixRows[i] {
+				sum[0] ^= sums[c][v][0]
+				sum[1] ^= sums[c][v][1]
+			}
+			out.Quadratic[j][i] = sum
+		}
+	}
+
+	return
+}
+
+// frobenius raises x to the power 2^k.
+func frobenius(x byte, k byte) byte {
+	for i := byte(0); i < k; i++ {
+		x = square(x)
+	}
+
+	return x
+}
+
+// selfEquivalence returns a random self-equivalence of the layer of inversions, like toy's: linear a and c with
+// inv(x) = c(inv(a(x))). a raises each byte to a random power of 2, multiplies it by a random non-zero scalar, and moves
+// it to a random position; the inverse picks up the inverse scalar, so c moves each byte back, multiplies it by the same
+// scalar, and undoes the power.
+func selfEquivalence(r io.Reader) (a, c blockFunc) {
+	var perm [16]int // Byte i of the input goes to position perm[i].
+	for i := range perm {
+		perm[i] = i
+	}
+
+	buff := make([]byte, 1)
+	for i := 15; i > 0; {
+		r.Read(buff)
+		if j := int(buff[0] & 0x0f); j <= i {
+			perm[i], perm[j] = perm[j], perm[i]
+			i--
+		}
+	}
+
+	var scalars, frobs [16]byte
+	for i := 0; i < 16; {
+		r.Read(buff)
+		if buff[0] != 0x00 {
+			scalars[i] = buff[0]
+			i++
+		}
+	}
+
+	for i := range frobs {
+		r.Read(buff)
+		frobs[i] = buff[0] & 0x07
+	}
+
+	a = func(x [16]byte) (out [16]byte) {
+		for i := range x {
+			out[perm[i]] = mul(scalars[i], frobenius(x[i], frobs[i]))
+		}
+		return
+	}
+	c = func(z [16]byte) (out [16]byte) {
+		for i := range z {
+			out[i] = frobenius(mul(scalars[i], z[perm[i]]), 8-frobs[i])
+		}
+		return
+	}
+
+	return
+}
+
+// randomEncoding returns the random affine encoding of the state after the given round.
+func randomEncoding(rs *random.Source, round int) encoding.BlockAffine {
+	var constant [16]byte
+	rs.Stream(common.Label("IC", round)).Read(constant[:])
+
+	return encoding.NewBlockAffine(rs.Matrix(common.Label("IE", round), 128), constant)
+}
+
+// generateKeys builds a construction whose round r computes after(r, inv(before(r, x))) on the AES state, with the state
+// between rounds under random affine encodings. The state before the first round is the input after the input mask,
+// plus the first round key, and the state after the last round has the output mask on it. Each round's layer of
+// inversions is also re-encoded with a random self-equivalence, which moves its bytes around and hides which byte of
+// the state each of the equations' S-boxes is on, even in the first and last rounds, where the encodings are fixed by
+// the masks.
+func generateKeys(rs *random.Source, opts common.KeyGenerationOpts, rounds int, firstKey []byte, before, after func(int, [16]byte) [16]byte, out *Construction, inputMask, outputMask *encoding.BlockAffine) {
+	common.GenerateAffineMasks(rs, opts, inputMask, outputMask)
+
+	// encodings[r] takes the encoded state before round r to the AES state.
+	encodings := make([]encoding.BlockAffine, rounds+1)
+	encodings[0] = affineOf(func(x [16]byte) [16]byte {
+		x = inputMask.Encode(x)
+		for i := range x {
+			x[i] ^= firstKey[i]
+		}
+		return x
+	})
+	for round := 1; round < rounds; round++ {
+		encodings[round] = randomEncoding(rs, round)
+	}
+	encodings[rounds] = affineOf(outputMask.Decode)
+
+	out.Rounds = make([]RoundFunction, rounds)
+	for round := 0; round < rounds; round++ {
+		in, next, r := encodings[round], encodings[round+1], round
+		a, c := selfEquivalence(rs.Stream(common.Label("IS", round)))
+
+		out.Rounds[round] = implicitRound(
+			func(x [16]byte) [16]byte { return a(before(r, in.Encode(x))) },
+			func(z [16]byte) [16]byte { return next.Decode(after(r, c(z))) },
+			rs.Matrix(common.Label("IU", round), 256),
+		)
+	}
+}
+
+// GenerateEncryptionKeys creates a white-boxed version of AES with given key for encryption, with any non-determinism
+// generated by seed. The key may be 16, 24, or 32 bytes long, for AES-128, AES-192, or AES-256 respectively. Opts
+// specifies what type of input and output masks we put on the construction and should be in
+// common.{IndependentMasks, SameMasks, MatchingMasks}. The construction computes outputMask(AES(inputMask(x))).
+func GenerateEncryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine) {
+	rs := random.NewSource("Implicit Encryption", seed)
+
+	constr := saes.Construction{key}
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
+
+	// Round r computes SubBytes, ShiftRows, MixColumns (except in the last round), and AddRoundKey. SubBytes is inversion
+	// followed by an affine map, which is SubByte after inversion.
+	subBytes := tabulate(func(b byte) byte { return constr.SubByte(byte(number.ByteFieldElem(b).Invert())) })
+
+	before := func(round int, x [16]byte) [16]byte { return x }
+	after := func(round int, z [16]byte) [16]byte {
+		z = bytewise(z, func(b byte) byte { return subBytes[b] })
+
+		constr.ShiftRows(z[:])
+		if round < rounds-1 {
+			constr.MixColumns(z[:])
+		}
+		constr.AddRoundKey(roundKeys[round+1], z[:])
+
+		return z
+	}
+
+	generateKeys(&rs, opts, rounds, roundKeys[0], before, after, &out, &inputMask, &outputMask)
+
+	return
+}
+
+// GenerateDecryptionKeys creates a white-boxed version of AES with given key for decryption, with any non-determinism
+// generated by seed. The key may be 16, 24, or 32 bytes long, for AES-128, AES-192, or AES-256 respectively. Opts
+// specifies what type of input and output masks we put on the construction and should be in
+// common.{IndependentMasks, SameMasks, MatchingMasks}. The construction computes outputMask(AES^(-1)(inputMask(x))).
+func GenerateDecryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine) {
+	rs := random.NewSource("Implicit Decryption", seed)
+
+	constr := saes.Construction{key}
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
+
+	// Round r computes UnShiftRows, UnSubBytes, AddRoundKey, and UnMixColumns (except in the last round). UnSubBytes is
+	// an affine map followed by inversion, which is inversion after UnSubByte.
+	unSubBytes := tabulate(func(b byte) byte { return byte(number.ByteFieldElem(constr.UnSubByte(b)).Invert()) })
+
+	before := func(round int, x [16]byte) [16]byte {
+		constr.UnShiftRows(x[:])
+		return bytewise(x, func(b byte) byte { return unSubBytes[b] })
+	}
+	after := func(round int, z [16]byte) [16]byte {
+		constr.AddRoundKey(roundKeys[rounds-1-round], z[:])
+		if round < rounds-1 {
+			constr.UnMixColumns(z[:])
+		}
+
+		return z
+	}
+
+	generateKeys(&rs, opts, rounds, roundKeys[rounds], before, after, &out, &inputMask, &outputMask)
+
+	return
+}
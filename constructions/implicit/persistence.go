@@ -0,0 +1,127 @@
+package implicit
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// roundSize is the size of one serialized round function: the quadratic terms, the linear terms in x and then in y, and
+// the constants, as little-endian words.
+const roundSize = 16*128*256 + 16*256 + 16*256 + 32
+
+func (constr *Construction) header() common.Header {
+	return common.Header{
+		Version:  common.CurrentVersion,
+		Type:     common.ImplicitConstruction,
+		Rounds:   byte(len(constr.Rounds)),
+		Metadata: constr.Metadata,
+	}
+}
+
+// Serialize serializes a white-box construction into a byte slice. The output starts with a common.Header, in the same
+// format as the other constructions' keys, followed by each round function.
+func (constr *Construction) Serialize() []byte {
+	h := constr.header()
+
+	out := make([]byte, constr.Size())
+	base := h.Serialize(out)
+
+	for i := range constr.Rounds {
+		rf := &constr.Rounds[i]
+
+		for j := range rf.Quadratic {
+			for _, v := range rf.Quadratic[j] {
+				base = putVector(out, base, v)
+			}
+		}
+		for _, v := range rf.LinearX {
+			base = putVector(out, base, v)
+		}
+		for _, v := range rf.LinearY {
+			base = putVector(out, base, v)
+		}
+		for _, w := range rf.Constant {
+			binary.LittleEndian.PutUint64(out[base:], w)
+			base += 8
+		}
+	}
+
+	return out
+}
+
+// Size returns the number of bytes in the serialized construction, header included.
+func (constr *Construction) Size() int {
+	return constr.header().Size() + len(constr.Rounds)*roundSize
+}
+
+// Parse parses a byte array into a white-box construction. It returns an error if the header is invalid or the byte
+// slice is the wrong length. A MAC at the end of the key is skipped, not checked.
+func Parse(in []byte) (constr Construction, err error) {
+	h, in, err := common.ParseHeader(in, common.ImplicitConstruction)
+	if err != nil {
+		return
+	} else if h.Rounds == 0 || h.Shuffled || h.Compressed || len(in) < h.TrailerSize() {
+		return constr, errors.New("Parsing the key failed!")
+	}
+	in = in[:len(in)-h.TrailerSize()]
+
+	if len(in) != int(h.Rounds)*roundSize {
+		return constr, errors.New("Key is the wrong size!")
+	}
+
+	constr.Rounds = make([]RoundFunction, h.Rounds)
+	constr.Metadata = h.Metadata
+
+	base := 0
+	for i := range constr.Rounds {
+		rf := &constr.Rounds[i]
+
+		for j := range rf.Quadratic {
+			for k := range rf.Quadratic[j] {
+				rf.Quadratic[j][k], base = getVector(in, base)
+			}
+		}
+		for k := range rf.LinearX {
+			rf.LinearX[k], base = getVector(in, base)
+		}
+		for k := range rf.LinearY {
+			rf.LinearY[k], base = getVector(in, base)
+		}
+		for k := range rf.Constant {
+			rf.Constant[k] = binary.LittleEndian.Uint64(in[base:])
+			base += 8
+		}
+	}
+
+	return constr, nil
+}
+
+func putVector(out []byte, base int, v vector) int {
+	b := v.bytes()
+	copy(out[base:], b[:])
+
+	return base + 16
+}
+
+func getVector(in []byte, base int) (vector, int) {
+	return toVector(in[base:]), base + 16
+}
+
+func init() {
+	common.Register(common.ImplicitConstruction, func(in []byte) (common.Construction, error) {
+		constr, err := Parse(in)
+		if err != nil {
+			return nil, err
+		}
+
+		return &constr, nil
+	})
+}
+
+// Type returns common.ImplicitConstruction. (Necessary to implement common.Construction.)
+func (constr Construction) Type() common.ConstructionType { return common.ImplicitConstruction }
+
+// KeySize returns the length of the AES key the construction computes: 16, 24, or 32.
+func (constr Construction) KeySize() int { return common.KeySize(len(constr.Rounds)) }
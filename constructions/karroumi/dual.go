@@ -0,0 +1,151 @@
+package karroumi
+
+import (
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+// aesPoly is the irreducible polynomial that defines AES's field, x^8 + x^4 + x^3 + x + 1.
+const aesPoly = 0x11b
+
+// Dual is a dual cipher of AES: AES computed in another representation of GF(2^8). Its field is defined by the
+// irreducible polynomial Poly, and the isomorphism from AES's field to it sends x to Root, one of the roots of AES's
+// polynomial in the new field. The isomorphism is linear, so every step of AES has a dual that's a conjugate of it:
+// the S-box is Δ∘S∘Δ^(-1), the coefficients of MixColumns and the round keys are mapped by Δ, and the multiplications
+// of MixColumns are done in the new field.
+//
+// There are 30 irreducible polynomials of degree 8 and each has 8 roots of AES's polynomial, so there are 240 duals of
+// this kind, AES included (Poly = 0x11b and Root = 0x02). Karroumi also composes them with affine self-equivalences to
+// get 61,200; those aren't implemented.
+type Dual struct {
+	Poly uint16
+	Root byte
+
+	forwards, backwards [256]byte
+}
+
+// duals is every dual cipher, ordered by polynomial and then by root.
+var duals = findDuals()
+
+// Duals returns the 240 dual ciphers of AES, ordered by polynomial and then by root. The first one is AES.
+func Duals() []Dual {
+	return append([]Dual{}, duals...)
+}
+
+// Encode maps an element of AES's field into the dual's field. (Necessary to implement encoding.Byte.)
+func (d *Dual) Encode(x byte) byte { return d.forwards[x] }
+
+// Decode maps an element of the dual's field back into AES's field. (Necessary to implement encoding.Byte.)
+func (d *Dual) Decode(x byte) byte { return d.backwards[x] }
+
+// Mul multiplies two elements of the dual's field.
+func (d *Dual) Mul(x, y byte) byte { return mulMod(x, y, d.Poly) }
+
+// SubByte is the S-box of the dual cipher.
+func (d *Dual) SubByte(x byte) byte {
+	constr := saes.Construction{}
+	return d.Encode(constr.SubByte(d.Decode(x)))
+}
+
+// UnSubByte is the inverse S-box of the dual cipher.
+func (d *Dual) UnSubByte(x byte) byte {
+	constr := saes.Construction{}
+	return d.Encode(constr.UnSubByte(d.Decode(x)))
+}
+
+// mulMod multiplies two polynomials over GF(2) of degree less than 8, modulo poly, which has degree 8.
+func mulMod(x, y byte, poly uint16) byte {
+	a, out := uint16(x), uint16(0)
+
+	for ; y != 0; y >>= 1 {
+		if y&1 == 1 {
+			out ^= a
+		}
+
+		a <<= 1
+		if a&0x100 != 0 {
+			a ^= poly
+		}
+	}
+
+	return byte(out)
+}
+
+// irreducible returns true if poly, which has degree 8, has no factor of degree 1 to 4.
+func irreducible(poly uint16) bool {
+	for factor := uint16(2); factor < 32; factor++ {
+		if polyMod(poly, factor) == 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// polyMod returns the remainder of the division of the polynomial x by y, over GF(2).
+func polyMod(x, y uint16) uint16 {
+	degree := func(p uint16) int {
+		d := -1
+		for ; p != 0; p >>= 1 {
+			d++
+		}
+		return d
+	}
+
+	for dy := degree(y); degree(x) >= dy; {
+		x ^= y << uint(degree(x)-dy)
+	}
+
+	return x
+}
+
+// newDual returns the dual cipher with the given polynomial and root. Root must be a root of AES's polynomial modulo
+// poly.
+func newDual(poly uint16, root byte) (out Dual) {
+	out.Poly, out.Root = poly, root
+
+	// basis[i] is Root^i, the image of x^i.
+	var basis [8]byte
+	basis[0] = 1
+	for i := 1; i < 8; i++ {
+		basis[i] = mulMod(basis[i-1], root, poly)
+	}
+
+	for x := 0; x < 256; x++ {
+		y := byte(0)
+		for i := uint(0); i < 8; i++ {
+			if x>>i&1 == 1 {
+				y ^= basis[i]
+			}
+		}
+
+		out.forwards[x], out.backwards[y] = y, byte(x)
+	}
+
+	return
+}
+
+// findDuals finds every dual cipher by trying every element of every field as a root of AES's polynomial.
+func findDuals() (out []Dual) {
+	for poly := uint16(0x100); poly < 0x200; poly++ {
+		if !irreducible(poly) {
+			continue
+		}
+
+		for root := 0; root < 256; root++ {
+			// Evaluate x^8 + x^4 + x^3 + x + 1 at root.
+			x, value := byte(1), byte(0)
+			for i := uint(0); i <= 8; i++ {
+				if aesPoly>>i&1 == 1 {
+					value ^= x
+				}
+				x = mulMod(x, byte(root), poly)
+			}
+
+			if value == 0 {
+				out = append(out, newDual(poly, byte(root)))
+			}
+		}
+	}
+
+	return
+}
@@ -0,0 +1,142 @@
+// Package karroumi implements Karroumi's white-box AES construction, which is Chow et al.'s construction where each
+// round is computed in a dual cipher of AES, chosen at random, instead of in AES itself. The tables of a round compute
+// its dual S-box, dual round key, and dual MixColumns, and convert the state to the next round's dual on their output.
+// The constructions are chow.Constructions: only the contents of the tables differ, so they're evaluated, serialized,
+// and hardened with chow's code.
+//
+// The duals were meant to add to the number of keys an attacker has to guess, but each isomorphism between duals is a
+// linear map on each byte of the state, and the tables already hide an unknown linear map on each byte: the mixing
+// bijections. The dual's isomorphisms are absorbed into them, and the construction is no harder to break than Chow's.
+// The attack in cryptanalysis/chow recovers the key unchanged; cryptanalysis/karroumi demonstrates it.
+//
+// "Protecting White-Box AES with Dual Ciphers" by Mohamed Karroumi, https://doi.org/10.1007/978-3-642-24209-0_18
+//
+// "Two Attacks on a White-Box AES Implementation" by Tancrède Lepoint, Matthieu Rivain, Yoni De Mulder, Peter Roelse,
+// and Bart Preneel, https://eprint.iacr.org/2013/455
+package karroumi
+
+import (
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/random"
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+// tBox is a T-Box computed in a dual cipher: its input is converted from the dual in to dual, where the key bytes are
+// added around the S-box, and its output is converted to the dual out. The key bytes are in AES's field.
+type tBox struct {
+	in, dual, out      *Dual
+	keyByte1, keyByte2 byte
+	inverse            bool
+}
+
+func (tb tBox) Get(i byte) byte {
+	return tb.out.Encode(tb.dual.Decode(tb.subByte(i)))
+}
+
+// subByte computes the T-Box, but leaves the output in the table's dual.
+func (tb tBox) subByte(i byte) byte {
+	x := tb.dual.Encode(tb.in.Decode(i)) ^ tb.dual.Encode(tb.keyByte1)
+
+	if tb.inverse {
+		x = tb.dual.UnSubByte(x)
+	} else {
+		x = tb.dual.SubByte(x)
+	}
+
+	return x ^ tb.dual.Encode(tb.keyByte2)
+}
+
+// tBoxTyi is a T-Box composed with a Tyi Table, computed in a dual cipher. The T-Box's output stays in its dual, is
+// multiplied by the column of MixColumns in that dual's field, and is then converted to the dual out.
+type tBoxTyi struct {
+	tBox
+	column [4]byte // In AES's field.
+}
+
+func (tt tBoxTyi) Get(i byte) (out [4]byte) {
+	x := tt.subByte(i)
+
+	for j, c := range tt.column {
+		out[j] = tt.out.Encode(tt.dual.Decode(tt.dual.Mul(tt.dual.Encode(c), x)))
+	}
+
+	return
+}
+
+// chooseDuals picks the dual cipher that each round of a construction is computed in, plus the input and output of the
+// construction, which are in AES's field.
+func chooseDuals(rs *random.Source, rounds int) []*Dual {
+	out := make([]*Dual, rounds+2)
+	out[0], out[rounds+1] = &duals[0], &duals[0]
+
+	buff := make([]byte, 2)
+	for round := 0; round < rounds; round++ {
+		rs.Stream(common.Label("KD", round)).Read(buff)
+		out[round+1] = &duals[(int(buff[0])<<8|int(buff[1]))%len(duals)]
+	}
+
+	return out
+}
+
+// GenerateEncryptionKeys creates a white-boxed version of AES with given key for encryption, with any non-determinism
+// generated by seed. The key may be 16, 24, or 32 bytes long, for AES-128, AES-192, or AES-256 respectively. Opts are as
+// in chow.GenerateEncryptionKeys: masks in common.{IndependentMasks, SameMasks, MatchingMasks}, or a chow.Opts wrapping
+// one of those. The construction computes outputMask(AES(inputMask(x))).
+func GenerateEncryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out chow.Construction, inputMask, outputMask encoding.BlockAffine) {
+	rs := random.NewSource("Karroumi Encryption", seed)
+
+	constr := saes.Construction{key}
+	roundKeys, rounds := common.EncryptionRoundKeys(key), constr.Rounds()
+
+	// domains[round+1] is the dual that round is computed in, and the one its input is in.
+	domains := chooseDuals(&rs, rounds)
+
+	skinny := func(pos int) table.Byte {
+		return tBox{domains[rounds], domains[rounds], domains[rounds+1], roundKeys[rounds-1][pos], roundKeys[rounds][pos], false}
+	}
+
+	wide := func(round, pos int) table.Word {
+		in := domains[round+1]
+		if round == 0 {
+			in = domains[0]
+		}
+
+		return tBoxTyi{
+			tBox{in, domains[round+1], domains[round+2], roundKeys[round][pos], 0x00, false},
+			common.TyiTable(pos % 4).Get(0x01),
+		}
+	}
+
+	return chow.GenerateVariantKeys("Karroumi Encryption", seed, opts, rounds, false, skinny, wide)
+}
+
+// GenerateDecryptionKeys creates a white-boxed version of AES with given key for decryption, with any non-determinism
+// generated by seed. The key may be 16, 24, or 32 bytes long, for AES-128, AES-192, or AES-256 respectively. Opts are as
+// in GenerateEncryptionKeys. The construction computes outputMask(AES^(-1)(inputMask(x))), with Decrypt.
+func GenerateDecryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out chow.Construction, inputMask, outputMask encoding.BlockAffine) {
+	rs := random.NewSource("Karroumi Decryption", seed)
+
+	constr := saes.Construction{key}
+	roundKeys, rounds := common.DecryptionRoundKeys(key), constr.Rounds()
+
+	domains := chooseDuals(&rs, rounds)
+
+	skinny := func(pos int) table.Byte {
+		return tBox{domains[rounds], domains[rounds], domains[rounds+1], 0x00, roundKeys[0][pos], true}
+	}
+
+	wide := func(round, pos int) table.Word {
+		tb := tBox{domains[round+1], domains[round+1], domains[round+2], 0x00, roundKeys[rounds-1-round][pos], true}
+		if round == 0 {
+			tb.in, tb.keyByte1 = domains[0], roundKeys[rounds][pos]
+		}
+
+		return tBoxTyi{tb, common.InvTyiTable(pos % 4).Get(0x01)}
+	}
+
+	return chow.GenerateVariantKeys("Karroumi Decryption", seed, opts, rounds, true, skinny, wide)
+}
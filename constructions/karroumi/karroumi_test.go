@@ -0,0 +1,132 @@
+package karroumi
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/OpenWhiteBox/primitives/number"
+	"github.com/OpenWhiteBox/primitives/random"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+
+	test_vectors "github.com/OpenWhiteBox/AES/constructions/test"
+)
+
+var (
+	key   = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed  = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+	input = []byte{99, 83, 224, 140, 9, 96, 225, 4, 205, 112, 183, 81, 186, 202, 208, 231}
+)
+
+func TestDuals(t *testing.T) {
+	all := Duals()
+
+	if len(all) != 240 {
+		t.Fatalf("Found the wrong number of duals! %v != 240", len(all))
+	} else if all[0].Poly != aesPoly || all[0].Root != 0x02 {
+		t.Fatalf("First dual isn't AES! %x, %x", all[0].Poly, all[0].Root)
+	}
+
+	// Every dual's isomorphism has to commute with multiplication.
+	for _, d := range all {
+		for x := 0; x < 256; x += 7 {
+			for y := 0; y < 256; y += 13 {
+				real := d.Encode(byte(number.ByteFieldElem(x).Mul(number.ByteFieldElem(y))))
+				cand := d.Mul(d.Encode(byte(x)), d.Encode(byte(y)))
+
+				if real != cand {
+					t.Fatalf("Dual (%x, %x) isn't a field isomorphism! %x != %x", d.Poly, d.Root, real, cand)
+				}
+			}
+		}
+	}
+}
+
+func TestChooseDuals(t *testing.T) {
+	rs := random.NewSource("Karroumi Encryption", seed)
+	domains := chooseDuals(&rs, 10)
+
+	if domains[0] != &duals[0] || domains[11] != &duals[0] {
+		t.Fatalf("Input and output of the construction aren't in AES's field!")
+	}
+
+	distinct := make(map[*Dual]bool)
+	for _, d := range domains[1:11] {
+		distinct[d] = true
+	}
+
+	if len(distinct) < 2 {
+		t.Fatalf("Every round is computed in the same dual!")
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	for n, vec := range test_vectors.GetAESVectors(testing.Short()) {
+		constr, inputMask, outputMask := GenerateEncryptionKeys(
+			vec.Key, vec.Key, common.IndependentMasks{common.RandomMask, common.RandomMask},
+		)
+
+		in, out := make([]byte, 16), make([]byte, 16)
+
+		copy(in, vec.In)
+		chow.MaskInput(inputMask, in) // Apply input encoding.
+
+		constr.Encrypt(out, in)
+
+		chow.UnmaskOutput(outputMask, out) // Remove output encoding.
+
+		if !bytes.Equal(vec.Out, out) {
+			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.Out, out)
+		}
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	for n, vec := range test_vectors.GetAESVectors(testing.Short()) {
+		constr, inputMask, outputMask := GenerateDecryptionKeys(
+			vec.Key, vec.Key, common.IndependentMasks{common.RandomMask, common.RandomMask},
+		)
+
+		in, out := make([]byte, 16), make([]byte, 16)
+
+		copy(in, vec.Out)
+		chow.MaskInput(inputMask, in) // Apply input encoding.
+
+		constr.Decrypt(out, in)
+
+		chow.UnmaskOutput(outputMask, out) // Remove output encoding.
+
+		if !bytes.Equal(vec.In, out) {
+			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.In, out)
+		}
+	}
+}
+
+// TestHardening checks that chow's hardening options work on dual ciphers, and that the key survives serialization.
+func TestHardening(t *testing.T) {
+	constr1, inputMask, outputMask := GenerateEncryptionKeys(key, seed, chow.Opts{
+		Masks:         common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask},
+		DummyRounds:   4,
+		ShuffleRounds: true,
+	})
+
+	constr2, err := chow.Parse(constr1.Serialize())
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	copy(cand, input)
+	chow.MaskInput(inputMask, cand)
+	constr2.Encrypt(cand, cand)
+	chow.UnmaskOutput(outputMask, cand)
+
+	plain, _, _ := chow.GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	plain.Encrypt(real, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
@@ -0,0 +1,169 @@
+package luo
+
+import (
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+	"github.com/OpenWhiteBox/primitives/random"
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+// tBox places the output of a T-Box at its position in a word, for the last round, which has no MixColumns step.
+type tBox struct {
+	TBox     table.Byte
+	Position int
+}
+
+func (t tBox) Get(i byte) (out [4]byte) {
+	out[t.Position] = t.TBox.Get(i)
+	return
+}
+
+// permutation returns the matrix that moves byte i of a block to byte perm(i).
+func permutation(perm func(int) int) matrix.Matrix {
+	out := matrix.GenerateEmpty(128, 128)
+
+	for pos := 0; pos < 16; pos++ {
+		for bit := 0; bit < 8; bit++ {
+			out[8*perm(pos)+bit].SetBit(8*pos+bit, true)
+		}
+	}
+
+	return out
+}
+
+// maskSwap returns the block-diagonal matrix of the size-bit mixing bijections of the given round.
+func maskSwap(rs *random.Source, size, round int) (out matrix.Matrix) {
+	out = matrix.GenerateEmpty(128, 128)
+
+	for row := 0; row < 128; row += size {
+		col := row / 8
+		m := common.MixingBijection(rs, size, round, row/size)
+
+		for subRow := 0; subRow < size; subRow++ {
+			copy(out[row+subRow][col:], m[subRow])
+		}
+	}
+
+	return
+}
+
+// generateRoundMaterial creates the TBoxMixCol tables for the given number of rounds. hidden(round, pos) is the
+// unencoded table.
+func generateRoundMaterial(rs *random.Source, out *Construction, rounds int, hidden func(int, int) table.Word) {
+	out.TBoxMixCol = make([][16]table.Word, rounds)
+
+	for round := 0; round < rounds; round++ {
+		for pos := 0; pos < 16; pos++ {
+			out.TBoxMixCol[round][pos] = encoding.WordTable{
+				encoding.NewByteLinear(common.MixingBijection(rs, 8, round, pos)),
+				encoding.InverseWord{
+					encoding.NewWordLinear(common.MixingBijection(rs, 32, round, pos/4)),
+				},
+				hidden(round, pos),
+			}
+		}
+	}
+}
+
+// generateBarriers creates the encoding barriers between rounds that compute ShiftRows and re-encode the state.
+func generateBarriers(rs *random.Source, out *Construction, rounds int, inputMask, outputMask, sr *matrix.Matrix) {
+	out.ShiftRows = make([]matrix.Matrix, rounds)
+	out.ShiftRows[0] = maskSwap(rs, 8, 0).Compose(*sr).Compose(*inputMask)
+
+	for round := 1; round < rounds; round++ {
+		out.ShiftRows[round] = maskSwap(rs, 8, round).Compose(*sr).Compose(maskSwap(rs, 32, round-1))
+	}
+
+	out.FinalMask = outputMask.Compose(maskSwap(rs, 32, rounds-1))
+}
+
+// foldConstants moves the constant parts of the external masks into the first and last round keys, since the barriers
+// can only compute linear transformations. It's the same as in constructions/xiao.
+func foldConstants(first, last []byte, inputMask, outputMask encoding.BlockAffine) {
+	preimage := outputMask.Backwards.Mul(matrix.Row(outputMask.BlockAdditive[:]))
+
+	for pos := 0; pos < 16; pos++ {
+		first[pos] ^= inputMask.BlockAdditive[pos]
+		last[pos] ^= preimage[pos]
+	}
+}
+
+// GenerateEncryptionKeys creates a white-boxed version of the AES key `key` for encryption, with any non-determinism
+// generated by `seed`. The key may be 16, 24, or 32 bytes long, for AES-128, AES-192, or AES-256. Opts specifies what
+// type of input and output masks we put on the construction and should be in common.{IndependentMasks, SameMasks,
+// MatchingMasks}, as in the chow package. The construction computes outputMask(AES(inputMask(x))).
+func GenerateEncryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine) {
+	rs := random.NewSource("Luo Encryption", seed)
+
+	constr := saes.Construction{key}
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
+
+	common.GenerateAffineMasks(&rs, opts, &inputMask, &outputMask)
+	foldConstants(roundKeys[0], roundKeys[rounds], inputMask, outputMask)
+
+	// Apply ShiftRows to every round key but the last.
+	for k := 0; k < rounds; k++ {
+		constr.ShiftRows(roundKeys[k])
+	}
+
+	hidden := func(round, pos int) table.Word {
+		if round == rounds-1 {
+			return tBox{common.TBox{constr, roundKeys[rounds-1][pos], roundKeys[rounds][pos]}, pos % 4}
+		}
+
+		return table.ComposedToWord{
+			common.TBox{Constr: constr, KeyByte1: roundKeys[round][pos]},
+			common.TyiTable(pos % 4),
+		}
+	}
+
+	sr := permutation(common.ShiftRows)
+
+	generateRoundMaterial(&rs, &out, rounds, hidden)
+	generateBarriers(&rs, &out, rounds, &inputMask.Forwards, &outputMask.Forwards, &sr)
+
+	return out, inputMask, outputMask
+}
+
+// GenerateDecryptionKeys creates a white-boxed version of the AES key `key` for decryption, with any non-determinism
+// generated by `seed`. Opts is as in GenerateEncryptionKeys, and the construction computes
+// outputMask(AES^(-1)(inputMask(x))).
+func GenerateDecryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine) {
+	rs := random.NewSource("Luo Decryption", seed)
+
+	constr := saes.Construction{key}
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
+
+	common.GenerateAffineMasks(&rs, opts, &inputMask, &outputMask)
+	foldConstants(roundKeys[rounds], roundKeys[0], inputMask, outputMask)
+
+	// Apply UnShiftRows to the last round key.
+	constr.UnShiftRows(roundKeys[rounds])
+
+	hidden := func(round, pos int) table.Word {
+		switch round {
+		case 0:
+			return table.ComposedToWord{
+				common.InvTBox{constr, roundKeys[rounds][pos], roundKeys[rounds-1][pos]},
+				common.InvTyiTable(pos % 4),
+			}
+		case rounds - 1:
+			return tBox{common.InvTBox{constr, 0x00, roundKeys[0][pos]}, pos % 4}
+		default:
+			return table.ComposedToWord{
+				common.InvTBox{Constr: constr, KeyByte2: roundKeys[rounds-1-round][pos]},
+				common.InvTyiTable(pos % 4),
+			}
+		}
+	}
+
+	sr := permutation(common.UnShiftRows)
+
+	generateRoundMaterial(&rs, &out, rounds, hidden)
+	generateBarriers(&rs, &out, rounds, &inputMask.Forwards, &outputMask.Forwards, &sr)
+
+	return out, inputMask, outputMask
+}
@@ -0,0 +1,78 @@
+// Package luo implements a white-box AES construction in the style of Luo, Lai, and You's, which shrinks the tables of
+// Xiao and Lai's construction from 16-bit inputs to 8-bit ones. There is an attack on this construction implemented in
+// the cryptanalysis/luo package.
+//
+// Like in constructions/xiao, each round starts with a large linear transformation--ShiftRows, with the encodings of
+// the last round's output swapped for those of this round's input--and continues with lookup tables computing the
+// T-Boxes and MixColumns. Here, each table takes one byte of the state under an 8-bit linear mixing bijection and
+// returns its contribution to its column under a 32-bit one, so the four lookups of a column are added with plain XORs.
+// The tables take 160KB for AES-128 instead of Xiao and Lai's 20MB. Every encoding is linear, and that's what the
+// attack exploits.
+//
+// "A New Attempt of White-box AES Implementation" by Rui Luo, Xuejia Lai, and Rong You,
+// https://doi.org/10.1109/SPAC.2014.6982711
+package luo
+
+import (
+	"github.com/OpenWhiteBox/primitives/matrix"
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// Construction is a white-boxed AES key. It has one ShiftRows matrix and one set of TBoxMixCol tables for every round of
+// AES: 10 for AES-128, 12 for AES-192, and 14 for AES-256.
+type Construction struct {
+	ShiftRows  []matrix.Matrix  // [round]
+	TBoxMixCol [][16]table.Word // [round][position]
+
+	FinalMask matrix.Matrix
+
+	// Metadata is saved in the header of the serialized construction. Key generation leaves it empty.
+	Metadata common.Metadata
+}
+
+// BlockSize returns the block size of AES. (Necessary to implement cipher.Block.)
+func (constr Construction) BlockSize() int { return 16 }
+
+// Rounds returns the number of rounds of AES this construction computes: 10, 12, or 14.
+func (constr Construction) Rounds() int { return len(constr.ShiftRows) }
+
+// Encrypt encrypts the first block in src into dst. Dst and src may point at the same memory.
+func (constr Construction) Encrypt(dst, src []byte) {
+	constr.crypt(dst, src)
+}
+
+// Decrypt decrypts the first block in src into dst. Dst and src may point at the same memory.
+func (constr Construction) Decrypt(dst, src []byte) {
+	constr.crypt(dst, src)
+}
+
+func (constr *Construction) crypt(dst, src []byte) {
+	copy(dst, src[:constr.BlockSize()])
+
+	for round := 0; round < len(constr.ShiftRows); round++ {
+		// ShiftRows and re-encoding step.
+		copy(dst, constr.ShiftRows[round].Mul(matrix.Row(dst)))
+
+		// Apply T-Boxes and MixColumns
+		for pos := 0; pos < 16; pos += 4 {
+			stretched := constr.ExpandWord(constr.TBoxMixCol[round][pos:pos+4], dst[pos:pos+4])
+			constr.SquashWords(stretched, dst[pos:pos+4])
+		}
+	}
+
+	copy(dst, constr.FinalMask.Mul(matrix.Row(dst)))
+}
+
+// ExpandWord expands one word of the state matrix with the TBoxMixCol tables.
+func (constr *Construction) ExpandWord(tmc []table.Word, word []byte) [4][4]byte {
+	return [4][4]byte{tmc[0].Get(word[0]), tmc[1].Get(word[1]), tmc[2].Get(word[2]), tmc[3].Get(word[3])}
+}
+
+// SquashWords squashes an expanded word back into one word by XORing its parts together.
+func (constr *Construction) SquashWords(words [4][4]byte, dst []byte) {
+	for pos := 0; pos < 4; pos++ {
+		dst[pos] = words[0][pos] ^ words[1][pos] ^ words[2][pos] ^ words[3][pos]
+	}
+}
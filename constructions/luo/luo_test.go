@@ -0,0 +1,126 @@
+package luo
+
+import (
+	"bytes"
+	"crypto/aes"
+	"testing"
+	"time"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+
+	test_vectors "github.com/OpenWhiteBox/AES/constructions/test"
+)
+
+var (
+	key   = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed  = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+	input = []byte{99, 83, 224, 140, 9, 96, 225, 4, 205, 112, 183, 81, 186, 202, 208, 231}
+)
+
+func TestEncrypt(t *testing.T) {
+	for n, vec := range test_vectors.GetAESVectors(testing.Short()) {
+		constr, inputMask, outputMask := GenerateEncryptionKeys(
+			vec.Key, vec.Key, common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask},
+		)
+
+		in, out := [16]byte{}, [16]byte{}
+
+		copy(in[:], vec.In)
+		in = inputMask.Decode(in) // Apply input encoding.
+
+		constr.Encrypt(out[:], in[:])
+
+		out = outputMask.Decode(out) // Remove output encoding.
+
+		if !bytes.Equal(vec.Out, out[:]) {
+			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.Out, out)
+		}
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	for n, vec := range test_vectors.GetAESVectors(testing.Short()) {
+		constr, inputMask, outputMask := GenerateDecryptionKeys(
+			vec.Key, vec.Key, common.IndependentMasks{common.RandomAffineMask, common.RandomMask},
+		)
+
+		in, out := [16]byte{}, [16]byte{}
+
+		copy(in[:], vec.Out)
+		in = inputMask.Decode(in) // Apply input encoding.
+
+		constr.Decrypt(out[:], in[:])
+
+		out = outputMask.Decode(out) // Remove output encoding.
+
+		if !bytes.Equal(vec.In, out[:]) {
+			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.In, out)
+		}
+	}
+}
+
+func TestEncrypt256(t *testing.T) {
+	key256 := append(append([]byte{}, key...), seed...)
+
+	constr, inputMask, outputMask := GenerateEncryptionKeys(key256, seed, common.SameMasks(common.RandomAffineMask))
+
+	if constr.Rounds() != 14 {
+		t.Fatalf("AES-256 construction has wrong number of rounds! %v != 14", constr.Rounds())
+	}
+
+	in, cand, real := [16]byte{}, [16]byte{}, make([]byte, 16)
+
+	copy(in[:], input)
+	in = inputMask.Decode(in) // Apply input encoding.
+	constr.Encrypt(cand[:], in[:])
+	cand = outputMask.Decode(cand) // Remove output encoding.
+
+	c, _ := aes.NewCipher(key256)
+	c.Encrypt(real, input)
+
+	if !bytes.Equal(real, cand[:]) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestPersistence(t *testing.T) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+	constr1.Metadata = common.Metadata{Created: time.Unix(1500000000, 0).UTC(), KeyID: []byte("licensee")}
+
+	serialized := constr1.Serialize()
+	if len(serialized) != constr1.Size() {
+		t.Fatalf("Size disagrees with the serialized key! %v != %v", constr1.Size(), len(serialized))
+	}
+
+	constr2, err := Parse(serialized)
+	if err != nil {
+		t.Fatalf("Parse returned error: %v", err)
+	} else if !bytes.Equal(constr2.Metadata.KeyID, []byte("licensee")) {
+		t.Fatalf("Parsed construction has the wrong metadata! %q", constr2.Metadata.KeyID)
+	}
+
+	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+
+	constr1.Encrypt(cand1, input)
+	constr2.Encrypt(cand2, input)
+
+	if !bytes.Equal(cand1, cand2) {
+		t.Fatalf("Real disagrees with parsed! %x != %x", cand1, cand2)
+	}
+
+	loaded, err := common.Load(serialized)
+	if err != nil {
+		t.Fatalf("Load returned error: %v", err)
+	} else if loaded.Type() != common.LuoConstruction || loaded.KeySize() != 16 {
+		t.Fatalf("Loaded construction is a %v with a %v byte key!", loaded.Type(), loaded.KeySize())
+	}
+
+	loaded.Encrypt(cand2, input)
+	if !bytes.Equal(cand1, cand2) {
+		t.Fatalf("Real disagrees with loaded! %x != %x", cand1, cand2)
+	}
+
+	if _, err := Parse(serialized[:len(serialized)-1]); err == nil {
+		t.Fatalf("Truncated key was parsed!")
+	}
+}
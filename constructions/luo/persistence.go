@@ -0,0 +1,128 @@
+package luo
+
+import (
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/matrix"
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+const (
+	matrixSize = 16 * 128
+	tmcSize    = 256 * 4
+)
+
+// fullSize returns the size of a serialized construction with the given number of rounds, not counting the header. For
+// AES-128, it's 186368 bytes.
+func fullSize(rounds int) int {
+	return (rounds+1)*matrixSize + rounds*16*tmcSize
+}
+
+func (constr *Construction) header() common.Header {
+	return common.Header{
+		Version:  common.CurrentVersion,
+		Type:     common.LuoConstruction,
+		Rounds:   byte(constr.Rounds()),
+		Metadata: constr.Metadata,
+	}
+}
+
+// Serialize serializes a white-box construction into a byte slice. The output starts with a common.Header, in the same
+// format as the other constructions' keys, followed by every matrix and table in the same order as constructions/xiao.
+func (constr *Construction) Serialize() []byte {
+	h := constr.header()
+
+	out := make([]byte, h.Size(), constr.Size())
+	h.Serialize(out)
+
+	out = append(out, serializeMatrix(constr.FinalMask)...)
+	for _, sr := range constr.ShiftRows {
+		out = append(out, serializeMatrix(sr)...)
+	}
+
+	for _, round := range constr.TBoxMixCol {
+		for _, tmc := range round {
+			out = append(out, table.SerializeWord(tmc)...)
+		}
+	}
+
+	return out
+}
+
+// Size returns the number of bytes in the serialized construction, header included.
+func (constr *Construction) Size() int {
+	return constr.header().Size() + fullSize(constr.Rounds())
+}
+
+// Parse parses a byte array into a white-box construction. It returns an error if the header is invalid or the byte
+// array is the wrong length. A MAC at the end of the key is skipped, not checked.
+func Parse(in []byte) (constr Construction, err error) {
+	h, in, err := common.ParseHeader(in, common.LuoConstruction)
+	if err != nil {
+		return
+	} else if common.KeySize(int(h.Rounds)) == 0 || h.Shuffled || h.Compressed || len(in) < h.TrailerSize() {
+		return constr, errors.New("Parsing the key failed!")
+	}
+	in = in[:len(in)-h.TrailerSize()]
+
+	rounds := int(h.Rounds)
+	if len(in) != fullSize(rounds) {
+		return constr, errors.New("Key is the wrong size!")
+	}
+
+	constr.FinalMask, in = parseMatrix(in)
+
+	constr.ShiftRows = make([]matrix.Matrix, rounds)
+	for i := range constr.ShiftRows {
+		constr.ShiftRows[i], in = parseMatrix(in)
+	}
+
+	constr.TBoxMixCol = make([][16]table.Word, rounds)
+	for i := range constr.TBoxMixCol {
+		for j := range constr.TBoxMixCol[i] {
+			constr.TBoxMixCol[i][j] = table.ParsedWord(in[:tmcSize])
+			in = in[tmcSize:]
+		}
+	}
+
+	constr.Metadata = h.Metadata
+
+	return constr, nil
+}
+
+func serializeMatrix(m matrix.Matrix) []byte {
+	out := make([]byte, 0, matrixSize)
+	for _, row := range m {
+		out = append(out, row...)
+	}
+
+	return out
+}
+
+func parseMatrix(in []byte) (out matrix.Matrix, rest []byte) {
+	out = matrix.Matrix(make([]matrix.Row, 128))
+	for row := range out {
+		out[row] = in[16*row : 16*(row+1)]
+	}
+
+	return out, in[matrixSize:]
+}
+
+func init() {
+	common.Register(common.LuoConstruction, func(in []byte) (common.Construction, error) {
+		constr, err := Parse(in)
+		if err != nil {
+			return nil, err
+		}
+
+		return &constr, nil
+	})
+}
+
+// Type returns common.LuoConstruction. (Necessary to implement common.Construction.)
+func (constr Construction) Type() common.ConstructionType { return common.LuoConstruction }
+
+// KeySize returns the length of the AES key the construction computes: 16, 24, or 32.
+func (constr Construction) KeySize() int { return common.KeySize(constr.Rounds()) }
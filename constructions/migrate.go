@@ -0,0 +1,97 @@
+package constructions
+
+import (
+	"bytes"
+	"errors"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// Version returns the version of the serialization format a key was written in: 0 if it has no header, and up to
+// common.CurrentVersion otherwise.
+func Version(blob []byte) int {
+	if !common.HasHeader(blob) {
+		return 0
+	}
+
+	return int(blob[4])
+}
+
+// Migrate upgrades a key serialized in any past version of the format to the current one, for keys that have to outlive
+// the format they were written in and can't be regenerated. The tables are copied as they are, so the migrated key
+// computes exactly what the old one did; only the header changes. Keys without a header gain one, and older keys gain
+// the size of their AES key where it can be told. A key that's already current is returned unchanged.
+//
+// A key with an integrity MAC can't be migrated without its MAC key, since changing the header invalidates the MAC; use
+// MigrateWithMAC. An error is returned if the key doesn't parse, or the migrated key doesn't compute the same thing.
+func Migrate(blob []byte) ([]byte, error) {
+	return migrate(blob, nil)
+}
+
+// MigrateWithMAC is like Migrate, but checks the key's integrity MAC with macKey, if it has one, and authenticates the
+// migrated key with a new MAC under macKey. Keys without a MAC gain one.
+func MigrateWithMAC(blob, macKey []byte) ([]byte, error) {
+	if macKey == nil {
+		return nil, errors.New("MAC key is missing!")
+	}
+
+	return migrate(blob, macKey)
+}
+
+func migrate(blob, macKey []byte) ([]byte, error) {
+	old, err := Parse(blob)
+	if err != nil {
+		return nil, err
+	}
+
+	// Keys without a header have neither a MAC nor shuffled tables, so serializing them again writes the same tables
+	// under a current header.
+	if !common.HasHeader(blob) {
+		blob = old.Serialize()
+	}
+
+	h, tables, err := common.ParseHeader(blob, common.PeekType(blob))
+	if err != nil {
+		return nil, err
+	} else if h.MAC {
+		if macKey == nil {
+			return nil, errors.New("Key has a MAC, so migrating it needs the MAC key!")
+		} else if err := common.VerifyIntegrity(bytes.NewReader(blob), h.Type, macKey); err != nil {
+			return nil, err
+		}
+
+		tables = tables[:len(tables)-common.MACSize]
+	}
+
+	// Version 1 headers couldn't record the size of the AES key, so record it if the construction can tell.
+	if h.Version < 2 {
+		h.KeySize = old.KeySize()
+	}
+	h.Version, h.MAC = common.CurrentVersion, macKey != nil
+
+	out := make([]byte, h.Size(), h.Size()+len(tables)+h.TrailerSize())
+	h.Serialize(out)
+	out = append(out, tables...)
+
+	if h.MAC {
+		mac := common.NewMAC(macKey)
+		mac.Write(out)
+		out = mac.Sum(out)
+	}
+
+	// The old key can't be recovered if the new one is broken, so make sure it isn't.
+	migrated, err := Parse(out)
+	if err != nil {
+		return nil, err
+	}
+
+	a, b := make([]byte, 16), make([]byte, 16)
+	old.Encrypt(a, a)
+	migrated.Encrypt(b, b)
+
+	if !bytes.Equal(a, b) {
+		return nil, errors.New("Migrated key disagrees with the original!")
+	}
+
+	return out, nil
+}
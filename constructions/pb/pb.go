@@ -0,0 +1,207 @@
+// Package pb encodes white-box keys, their metadata, and their external encodings as the protocol buffer messages in
+// whitebox.proto, for services that already speak protobuf. Peers in other languages compile whitebox.proto with protoc;
+// this package encodes and decodes the wire format itself, so Go programs don't need a protobuf dependency.
+//
+// A Construction message carries the key in the binary format, header included, so it holds exactly what Serialize
+// returns and can't drift from it. The message's other fields repeat the key's header for readers that only need to
+// route or index keys, and are checked against it when the message is unmarshaled.
+package pb
+
+import (
+	"bytes"
+	"errors"
+	"time"
+
+	"github.com/OpenWhiteBox/AES/constructions"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// MarshalMetadata encodes key metadata as a KeyMetadata message.
+func MarshalMetadata(md common.Metadata) []byte {
+	e := encoder{}
+	e.bytes(1, md.KeyID)
+
+	if !md.Created.IsZero() {
+		e.uint(2, uint64(md.Created.Unix()))
+	}
+
+	return e
+}
+
+// UnmarshalMetadata decodes a KeyMetadata message.
+func UnmarshalMetadata(in []byte) (md common.Metadata, err error) {
+	err = decode(in, func(f field) error {
+		switch f.num {
+		case 1:
+			md.KeyID = append([]byte{}, f.b...)
+			return f.want(wireBytes)
+		case 2:
+			if created := int64(f.v); created != 0 {
+				md.Created = time.Unix(created, 0).UTC()
+			}
+			return f.want(wireVarint)
+		}
+
+		return nil
+	})
+
+	return
+}
+
+// MarshalKey encodes a serialized key as a Construction message. An error is returned if the key has no versioned
+// header; keys serialized before headers existed can't be described.
+func MarshalKey(key []byte) ([]byte, error) {
+	if !common.HasHeader(key) {
+		return nil, errors.New("Key doesn't have a valid header!")
+	}
+
+	h, _, err := common.ParseHeader(key, common.PeekType(key))
+	if err != nil {
+		return nil, err
+	}
+
+	e := encoder{}
+	e.uint(1, uint64(h.Version))
+	e.uint(2, uint64(h.Type))
+	e.uint(3, uint64(h.Rounds))
+	e.bool(4, h.MAC)
+	if h.Version >= 2 {
+		e.message(5, MarshalMetadata(h.Metadata))
+	}
+	e.bytes(6, key)
+
+	return e, nil
+}
+
+// UnmarshalKey decodes a Construction message into the serialized key it carries. An error is returned if the message
+// has no key, or its other fields disagree with the key's header.
+func UnmarshalKey(in []byte) ([]byte, error) {
+	var (
+		version, typ, rounds uint64
+		mac                  bool
+		md                   common.Metadata
+		key                  []byte
+	)
+
+	err := decode(in, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			version = f.v
+			return f.want(wireVarint)
+		case 2:
+			typ = f.v
+			return f.want(wireVarint)
+		case 3:
+			rounds = f.v
+			return f.want(wireVarint)
+		case 4:
+			mac = f.v != 0
+			return f.want(wireVarint)
+		case 5:
+			if err = f.want(wireBytes); err != nil {
+				return err
+			}
+			md, err = UnmarshalMetadata(f.b)
+			return err
+		case 6:
+			key = append([]byte{}, f.b...)
+			return f.want(wireBytes)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	} else if !common.HasHeader(key) {
+		return nil, errors.New("Key doesn't have a valid header!")
+	}
+
+	h, _, err := common.ParseHeader(key, common.PeekType(key))
+	if err != nil {
+		return nil, err
+	} else if version != uint64(h.Version) || typ != uint64(h.Type) || rounds != uint64(h.Rounds) || mac != h.MAC {
+		return nil, errors.New("Message disagrees with the key's header!")
+	} else if !bytes.Equal(md.KeyID, h.KeyID) || !md.Created.Equal(h.Created) {
+		return nil, errors.New("Message disagrees with the key's metadata!")
+	}
+
+	return key, nil
+}
+
+// MarshalConstruction serializes a construction and encodes it as a Construction message.
+func MarshalConstruction(constr constructions.Construction) ([]byte, error) {
+	return MarshalKey(constr.Serialize())
+}
+
+// UnmarshalConstruction decodes a Construction message and parses the key it carries with constructions.Parse.
+func UnmarshalConstruction(in []byte) (constructions.Construction, error) {
+	key, err := UnmarshalKey(in)
+	if err != nil {
+		return nil, err
+	}
+
+	return constructions.Parse(key)
+}
+
+// MarshalEncoding encodes one external encoding as an Encoding message.
+func MarshalEncoding(desc common.EncodingDescriptor) []byte {
+	e := encoder{}
+	e.bytes(1, []byte(desc.Alg))
+	e.bytes(2, desc.Matrix)
+	e.bytes(3, desc.Constant)
+
+	return e
+}
+
+// UnmarshalEncoding decodes an Encoding message. The descriptor isn't checked; its Affine method does that.
+func UnmarshalEncoding(in []byte) (desc common.EncodingDescriptor, err error) {
+	err = decode(in, func(f field) error {
+		switch f.num {
+		case 1:
+			desc.Alg = string(f.b)
+		case 2:
+			desc.Matrix = append([]byte{}, f.b...)
+		case 3:
+			desc.Constant = append([]byte{}, f.b...)
+		default:
+			return nil
+		}
+
+		return f.want(wireBytes)
+	})
+
+	return
+}
+
+// MarshalEncodings encodes a construction's input and output encodings as an Encodings message.
+func MarshalEncodings(desc common.EncodingsDescriptor) []byte {
+	e := encoder{}
+	e.bytes(1, []byte(desc.KeyID))
+	e.message(2, MarshalEncoding(desc.Input))
+	e.message(3, MarshalEncoding(desc.Output))
+
+	return e
+}
+
+// UnmarshalEncodings decodes an Encodings message. Like UnmarshalEncoding, it doesn't check the encodings.
+func UnmarshalEncodings(in []byte) (desc common.EncodingsDescriptor, err error) {
+	err = decode(in, func(f field) (err error) {
+		switch f.num {
+		case 1:
+			desc.KeyID = string(f.b)
+		case 2:
+			desc.Input, err = UnmarshalEncoding(f.b)
+		case 3:
+			desc.Output, err = UnmarshalEncoding(f.b)
+		default:
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+		return f.want(wireBytes)
+	})
+
+	return
+}
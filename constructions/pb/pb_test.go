@@ -0,0 +1,145 @@
+package pb
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/OpenWhiteBox/AES/constructions"
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/full"
+	"github.com/OpenWhiteBox/AES/constructions/luo"
+	"github.com/OpenWhiteBox/AES/constructions/space"
+)
+
+var (
+	key   = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed  = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+	input = []byte{99, 83, 224, 140, 9, 96, 225, 4, 205, 112, 183, 81, 186, 202, 208, 231}
+)
+
+func TestMetadata(t *testing.T) {
+	md := common.Metadata{KeyID: []byte("ab"), Created: time.Unix(1, 0).UTC()}
+
+	// Checked by hand against the wire format: field 1 is length-delimited, field 2 a varint.
+	real := []byte{0x0a, 0x02, 'a', 'b', 0x10, 0x01}
+	if cand := MarshalMetadata(md); !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	cand, err := UnmarshalMetadata(real)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(cand.KeyID, md.KeyID) || !cand.Created.Equal(md.Created) {
+		t.Fatalf("Unmarshaled metadata disagrees! %v != %v", cand, md)
+	}
+
+	if cand := MarshalMetadata(common.Metadata{}); len(cand) != 0 {
+		t.Fatalf("Empty metadata isn't empty! %x", cand)
+	}
+}
+
+func TestConstruction(t *testing.T) {
+	chowConstr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	chowConstr.Metadata = common.Metadata{KeyID: []byte("licensee"), Created: time.Unix(1500000000, 0).UTC()}
+	luoConstr, _, _ := luo.GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	fullConstr, _, _ := full.GenerateKeys(key, seed)
+	spaceConstr := space.GenerateKeys(key, space.Opts{Width: 1})
+
+	for _, real := range []constructions.Construction{&chowConstr, &luoConstr, &fullConstr, &spaceConstr} {
+		marshaled, err := MarshalConstruction(real)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// The message has to carry the binary format exactly.
+		serialized, err := UnmarshalKey(marshaled)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(serialized, real.Serialize()) {
+			t.Fatalf("Unmarshaled %v key disagrees with the binary format!", real.Type())
+		}
+
+		cand, err := UnmarshalConstruction(marshaled)
+		if err != nil {
+			t.Fatal(err)
+		} else if cand.Type() != real.Type() {
+			t.Fatalf("Unmarshaled %v key is a %v key!", real.Type(), cand.Type())
+		}
+
+		a, b := make([]byte, 16), make([]byte, 16)
+		real.Encrypt(a, input)
+		cand.Encrypt(b, input)
+
+		if !bytes.Equal(a, b) {
+			t.Fatalf("Real disagrees with unmarshaled %v key! %x != %x", real.Type(), a, b)
+		}
+	}
+
+	if _, err := MarshalKey(input); err == nil {
+		t.Fatalf("Marshaled a key without a header!")
+	}
+}
+
+func TestConstructionMismatch(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+	serialized := constr.Serialize()
+
+	marshaled, err := MarshalKey(serialized)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Fields after the key override the earlier ones, as in any protobuf message.
+	for _, suffix := range [][]byte{
+		{0x10, byte(common.XiaoConstruction)}, // type
+		{0x18, 12},                            // rounds
+		{0x2a, 0x02, 0x0a, 0x00},              // metadata with an empty key ID is fine...
+		{0x2a, 0x03, 0x0a, 0x01, 'x'},         // ...but not one with a different key ID.
+	} {
+		_, err := UnmarshalKey(append(append([]byte{}, marshaled...), suffix...))
+		if ok := bytes.Equal(suffix, []byte{0x2a, 0x02, 0x0a, 0x00}); ok != (err == nil) {
+			t.Fatalf("Wrong result unmarshaling with suffix %x: %v", suffix, err)
+		}
+	}
+
+	// Unknown fields are skipped.
+	if _, err := UnmarshalKey(append([]byte{0x78, 0x05, 0x85, 0x01, 1, 2, 3, 4}, marshaled...)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := UnmarshalKey(marshaled[:len(marshaled)-1]); err == nil {
+		t.Fatalf("Unmarshaled a truncated message!")
+	}
+}
+
+func TestEncodings(t *testing.T) {
+	_, encodings, err := chow.NewCipher(key, seed, chow.WithMasks(common.IndependentMasks{common.RandomAffineMask, common.RandomMask}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	real := common.DescribeEncodings(encodings.Input, encodings.Output)
+	real.KeyID = "licensee"
+
+	cand, err := UnmarshalEncodings(MarshalEncodings(real))
+	if err != nil {
+		t.Fatal(err)
+	} else if cand.KeyID != real.KeyID {
+		t.Fatalf("Real disagrees with result! %q != %q", real.KeyID, cand.KeyID)
+	}
+
+	input, output, err := cand.Affine()
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(chow.SerializeMask(input), chow.SerializeMask(encodings.Input)) {
+		t.Fatalf("Unmarshaled input encoding disagrees!")
+	} else if !bytes.Equal(chow.SerializeMask(output), chow.SerializeMask(encodings.Output)) {
+		t.Fatalf("Unmarshaled output encoding disagrees!")
+	}
+
+	if _, err := UnmarshalEncoding([]byte{0x08, 0x01}); err == nil {
+		t.Fatalf("Unmarshaled a field with the wrong wire type!")
+	}
+}
@@ -0,0 +1,109 @@
+package pb
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// The protobuf wire types used by whitebox.proto, and the two that are skipped if they show up in unknown fields.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+// encoder appends fields to a message in the protobuf wire format. Like proto3, it leaves out fields with their default
+// value.
+type encoder []byte
+
+func (e *encoder) tag(num, typ int) { *e = binary.AppendUvarint(*e, uint64(num<<3|typ)) }
+
+func (e *encoder) uint(num int, v uint64) {
+	if v != 0 {
+		e.tag(num, wireVarint)
+		*e = binary.AppendUvarint(*e, v)
+	}
+}
+
+func (e *encoder) bool(num int, v bool) {
+	if v {
+		e.uint(num, 1)
+	}
+}
+
+func (e *encoder) bytes(num int, v []byte) {
+	if len(v) != 0 {
+		e.message(num, v)
+	}
+}
+
+// message appends an embedded message, even if it's empty, since message fields are set or unset rather than default.
+func (e *encoder) message(num int, v []byte) {
+	e.tag(num, wireBytes)
+	*e = binary.AppendUvarint(*e, uint64(len(v)))
+	*e = append(*e, v...)
+}
+
+// field is one field of a message in the wire format: a varint, or the contents of a length-delimited field.
+type field struct {
+	num, typ int
+	v        uint64
+	b        []byte
+}
+
+// decode calls visit on every field of a message, in order. Unknown fields are passed to visit too, which should ignore
+// them, so that messages from newer schemas can still be read. An error is returned if the message is truncated or
+// uses a wire type that isn't allowed.
+func decode(in []byte, visit func(f field) error) error {
+	for len(in) > 0 {
+		tag, n := binary.Uvarint(in)
+		if n <= 0 || tag>>3 == 0 || tag>>3 > 1<<29-1 {
+			return errors.New("Message has an invalid tag!")
+		}
+		in = in[n:]
+
+		f := field{num: int(tag >> 3), typ: int(tag & 7)}
+
+		switch f.typ {
+		case wireVarint:
+			if f.v, n = binary.Uvarint(in); n <= 0 {
+				return errors.New("Message has an invalid varint!")
+			}
+			in = in[n:]
+		case wireBytes:
+			length, n := binary.Uvarint(in)
+			if n <= 0 || length > uint64(len(in)-n) {
+				return errors.New("Message is truncated!")
+			}
+			f.b, in = in[n:n+int(length)], in[n+int(length):]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if f.typ == wireFixed32 {
+				size = 4
+			}
+
+			if len(in) < size {
+				return errors.New("Message is truncated!")
+			}
+			in = in[size:]
+		default:
+			return errors.New("Message has an unsupported wire type!")
+		}
+
+		if err := visit(f); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// want returns an error if a known field has the wrong wire type.
+func (f field) want(typ int) error {
+	if f.typ != typ {
+		return errors.New("Field has the wrong wire type!")
+	}
+
+	return nil
+}
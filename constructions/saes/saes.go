@@ -1,5 +1,5 @@
-// Package saes implements a reference copy of AES-128.  It's useful for stealing AES' internals or seeing the ways you
-// can garble them without affecting its output.
+// Package saes implements a reference copy of AES, with 128-, 192-, and 256-bit keys.  It's useful for stealing AES'
+// internals or seeing the ways you can garble them without affecting its output.
 package saes
 
 import (
@@ -11,20 +11,35 @@ import (
 var powx = [16]byte{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x1b, 0x36, 0x6c, 0xd8, 0xab, 0x4d, 0x9a, 0x2f}
 
 type Construction struct {
-	// A 16-byte AES key.
+	// A 16-, 24-, or 32-byte AES key.
 	Key []byte
 }
 
 // BlockSize returns the block size of AES. (Necessary to implement cipher.Block.)
 func (constr Construction) BlockSize() int { return 16 }
 
+// Rounds returns the number of rounds of AES used with this construction's key: 10 for AES-128, 12 for AES-192, and 14
+// for AES-256. It panics if the key isn't one of these sizes.
+func (constr Construction) Rounds() int {
+	switch len(constr.Key) {
+	case 16:
+		return 10
+	case 24:
+		return 12
+	case 32:
+		return 14
+	default:
+		panic("Invalid AES key size!")
+	}
+}
+
 // Encrypt encrypts the first block in src into dst. Dst and src may point at the same memory.
 func (constr Construction) Encrypt(dst, src []byte) {
-	roundKeys := constr.StretchedKey()
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
 	copy(dst, src[:constr.BlockSize()])
 
 	constr.AddRoundKey(roundKeys[0], dst)
-	for i := 1; i <= 9; i++ {
+	for i := 1; i < rounds; i++ {
 		constr.SubBytes(dst)
 		constr.ShiftRows(dst)
 		constr.MixColumns(dst)
@@ -33,19 +48,19 @@ func (constr Construction) Encrypt(dst, src []byte) {
 
 	constr.SubBytes(dst)
 	constr.ShiftRows(dst)
-	constr.AddRoundKey(roundKeys[10], dst)
+	constr.AddRoundKey(roundKeys[rounds], dst)
 }
 
 // Decrypt decrypts the first block in src into dst. Dst and src may point at the same memory.
 func (constr Construction) Decrypt(dst, src []byte) {
-	roundKeys := constr.StretchedKey()
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
 	copy(dst, src[:constr.BlockSize()])
 
-	constr.AddRoundKey(roundKeys[10], dst)
+	constr.AddRoundKey(roundKeys[rounds], dst)
 	constr.UnShiftRows(dst)
 	constr.UnSubBytes(dst)
 
-	for i := 9; i >= 1; i-- {
+	for i := rounds - 1; i >= 1; i-- {
 		constr.AddRoundKey(roundKeys[i], dst)
 		constr.UnMixColumns(dst)
 		constr.UnShiftRows(dst)
@@ -57,33 +72,37 @@ func (constr Construction) Decrypt(dst, src []byte) {
 
 func rotw(w uint32) uint32 { return w<<8 | w>>24 }
 
-// StretchedKey implements AES' key schedule. It returns the 11 round keys derived from the master key.
-func (constr *Construction) StretchedKey() [11][]byte {
+// StretchedKey implements AES' key schedule. It returns the Rounds()+1 round keys derived from the master key.
+func (constr *Construction) StretchedKey() [][]byte {
 	var (
-		i         int            = 0
-		temp      uint32         = 0
-		stretched [4 * 11]uint32 // Stretched key
-		split     [11][]byte     // Each round key is combined and its uint32s are turned into 4 bytes
+		i         int    = 0
+		temp      uint32 = 0
+		n                = len(constr.Key) / 4    // Words in the master key.
+		keys             = constr.Rounds() + 1    // Number of round keys.
+		stretched        = make([]uint32, 4*keys) // Stretched key
+		split            = make([][]byte, keys)   // Each round key is combined and its uint32s are turned into 4 bytes
 	)
 
-	for ; i < 4; i++ { // First key-length of stretched is the raw key.
+	for ; i < n; i++ { // First key-length of stretched is the raw key.
 		stretched[i] = (uint32(constr.Key[4*i]) << 24) |
 			(uint32(constr.Key[4*i+1]) << 16) |
 			(uint32(constr.Key[4*i+2]) << 8) |
 			uint32(constr.Key[4*i+3])
 	}
 
-	for ; i < (4 * 11); i++ {
+	for ; i < len(stretched); i++ {
 		temp = stretched[i-1]
 
-		if (i % 4) == 0 {
-			temp = constr.SubWord(rotw(temp)) ^ (uint32(powx[i/4-1]) << 24)
+		if (i % n) == 0 {
+			temp = constr.SubWord(rotw(temp)) ^ (uint32(powx[i/n-1]) << 24)
+		} else if n > 6 && (i%n) == 4 {
+			temp = constr.SubWord(temp)
 		}
 
-		stretched[i] = stretched[i-4] ^ temp
+		stretched[i] = stretched[i-n] ^ temp
 	}
 
-	for j := 0; j < 11; j++ {
+	for j := 0; j < keys; j++ {
 		split[j] = make([]byte, 16)
 
 		for k := 0; k < 4; k++ {
@@ -211,6 +211,52 @@ func TestDecrypt(t *testing.T) {
 	}
 }
 
+func TestEncrypt192(t *testing.T) {
+	// Vector from FIPS 197, Appendix C.2.
+	key := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17,
+	}
+	in := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	out := []byte{0xdd, 0xa9, 0x7c, 0xa4, 0x86, 0x4c, 0xdf, 0xe0, 0x6e, 0xaf, 0x70, 0xa0, 0xec, 0x0d, 0x71, 0x91}
+
+	constr := Construction{key}
+	cand := make([]byte, 16)
+
+	constr.Encrypt(cand, in)
+	if !bytes.Equal(out, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", out, cand)
+	}
+
+	constr.Decrypt(cand, out)
+	if !bytes.Equal(in, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", in, cand)
+	}
+}
+
+func TestEncrypt256(t *testing.T) {
+	// Vector from FIPS 197, Appendix C.3.
+	key := []byte{
+		0x00, 0x01, 0x02, 0x03, 0x04, 0x05, 0x06, 0x07, 0x08, 0x09, 0x0a, 0x0b, 0x0c, 0x0d, 0x0e, 0x0f,
+		0x10, 0x11, 0x12, 0x13, 0x14, 0x15, 0x16, 0x17, 0x18, 0x19, 0x1a, 0x1b, 0x1c, 0x1d, 0x1e, 0x1f,
+	}
+	in := []byte{0x00, 0x11, 0x22, 0x33, 0x44, 0x55, 0x66, 0x77, 0x88, 0x99, 0xaa, 0xbb, 0xcc, 0xdd, 0xee, 0xff}
+	out := []byte{0x8e, 0xa2, 0xb7, 0xca, 0x51, 0x67, 0x45, 0xbf, 0xea, 0xfc, 0x49, 0x90, 0x4b, 0x49, 0x60, 0x89}
+
+	constr := Construction{key}
+	cand := make([]byte, 16)
+
+	constr.Encrypt(cand, in)
+	if !bytes.Equal(out, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", out, cand)
+	}
+
+	constr.Decrypt(cand, out)
+	if !bytes.Equal(in, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", in, cand)
+	}
+}
+
 func TestCBC(t *testing.T) {
 	// Vector stolen from crypto/aes/cbc_aes_test.go
 	key := []byte{0x2b, 0x7e, 0x15, 0x16, 0x28, 0xae, 0xd2, 0xa6, 0xab, 0xf7, 0x15, 0x88, 0x09, 0xcf, 0x4f, 0x3c}
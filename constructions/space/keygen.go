@@ -0,0 +1,56 @@
+package space
+
+import (
+	"crypto/aes"
+)
+
+// Opts chooses the size of the table and the number of rounds of a SPACE key.
+type Opts struct {
+	// Width is the number of bytes of input to the table: 1, 2, or 3. The table has 2^(8*Width) entries of 16-Width
+	// bytes, so it takes 3.75KB, 896KB, or 208MB. Zero means 2 (SPACE-16).
+	Width int
+
+	// Rounds is the number of rounds, or zero for the number recommended for the width: 300 for SPACE-8 and 128 for the
+	// others.
+	Rounds int
+}
+
+// GenerateKeys creates a white-boxed SPACE key from an AES key, which may be 16, 24, or 32 bytes long. It panics if the
+// options are invalid. There's nothing random about the table, so there's no seed.
+func GenerateKeys(key []byte, opts Opts) (out Construction) {
+	if opts.Width == 0 {
+		opts.Width = 2
+	}
+	if opts.Rounds == 0 {
+		opts.Rounds = 128
+		if opts.Width == 1 {
+			opts.Rounds = 300
+		}
+	}
+
+	if opts.Width < 1 || opts.Width > 3 {
+		panic("Width must be 1, 2, or 3 bytes!")
+	} else if opts.Rounds < 1 || opts.Rounds > 0xffff {
+		panic("Invalid number of rounds!")
+	}
+
+	c, err := aes.NewCipher(key)
+	if err != nil {
+		panic("Invalid AES key!")
+	}
+
+	out.Width, out.Rounds = opts.Width, opts.Rounds
+
+	entries, size := 1<<uint(8*opts.Width), 16-opts.Width
+	out.Table = make([]byte, entries*size)
+
+	var in, enc [16]byte
+	for x := 0; x < entries; x++ {
+		in[15], in[14], in[13] = byte(x), byte(x>>8), byte(x>>16)
+
+		c.Encrypt(enc[:], in[:])
+		copy(out.Table[size*x:], enc[:size])
+	}
+
+	return
+}
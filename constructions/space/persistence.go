@@ -0,0 +1,85 @@
+package space
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// paramsSize is the size of the parameters serialized before the table: the width (1 byte) and the number of rounds
+// (2 bytes, big-endian).
+const paramsSize = 3
+
+// header returns the header of a serialized construction. The header's rounds are meant for AES and can't hold SPACE's,
+// so they're always zero; the construction's own parameters follow the header.
+func (constr *Construction) header() common.Header {
+	return common.Header{
+		Version:  common.CurrentVersion,
+		Type:     common.SpaceConstruction,
+		Metadata: constr.Metadata,
+	}
+}
+
+// Serialize serializes a white-box construction into a byte slice. The output starts with a common.Header, in the same
+// format as the other constructions' keys, followed by the width and number of rounds, and then the table.
+func (constr *Construction) Serialize() []byte {
+	h := constr.header()
+
+	out := make([]byte, constr.Size())
+	base := h.Serialize(out)
+
+	out[base] = byte(constr.Width)
+	binary.BigEndian.PutUint16(out[base+1:], uint16(constr.Rounds))
+	copy(out[base+paramsSize:], constr.Table)
+
+	return out
+}
+
+// Size returns the number of bytes in the serialized construction, header included.
+func (constr *Construction) Size() int {
+	return constr.header().Size() + paramsSize + len(constr.Table)
+}
+
+// Parse parses a byte array into a white-box construction. It returns an error if the header or parameters are invalid
+// or the byte slice is the wrong length. A MAC at the end of the key is skipped, not checked. The table points into in.
+func Parse(in []byte) (constr Construction, err error) {
+	h, in, err := common.ParseHeader(in, common.SpaceConstruction)
+	if err != nil {
+		return
+	} else if h.Rounds != 0 || h.Shuffled || h.Compressed || len(in) < paramsSize+h.TrailerSize() {
+		return constr, errors.New("Parsing the key failed!")
+	}
+	in = in[:len(in)-h.TrailerSize()]
+
+	constr.Width, constr.Rounds = int(in[0]), int(binary.BigEndian.Uint16(in[1:]))
+	constr.Metadata = h.Metadata
+
+	if constr.Width < 1 || constr.Width > 3 || constr.Rounds == 0 {
+		return Construction{}, errors.New("Parsing the key failed!")
+	} else if len(in) != paramsSize+(1<<uint(8*constr.Width))*(16-constr.Width) {
+		return Construction{}, errors.New("Key is the wrong size!")
+	}
+
+	constr.Table = in[paramsSize:]
+
+	return constr, nil
+}
+
+func init() {
+	common.Register(common.SpaceConstruction, func(in []byte) (common.Construction, error) {
+		constr, err := Parse(in)
+		if err != nil {
+			return nil, err
+		}
+
+		return &constr, nil
+	})
+}
+
+// Type returns common.SpaceConstruction. (Necessary to implement common.Construction.)
+func (constr Construction) Type() common.ConstructionType { return common.SpaceConstruction }
+
+// KeySize returns 0: SPACE is a cipher of its own, not AES, and the AES key its table was generated with can't be told
+// from the table.
+func (constr Construction) KeySize() int { return 0 }
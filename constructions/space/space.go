@@ -0,0 +1,99 @@
+// Package space implements SPACE, Bogdanov and Isobe's space-hard white-box block cipher. Unlike the other constructions
+// in this repository, it doesn't compute AES: it's a block cipher of its own, built as a Feistel network around one big
+// table, and its white-box implementation is just that table. Recovering the key from the table is as hard as
+// recovering an AES key from chosen plaintexts, which is what makes it secure against key extraction.
+//
+// The point of SPACE is code lifting, which Chow-style constructions don't defend against at all: an attacker who copies
+// the tables out has the key, for every purpose. SPACE's table can't be compressed, because it's the output of AES on
+// every input of its width. An attacker who lifts a fraction of the table can only encrypt or decrypt the blocks whose
+// path through the rounds stays inside that fraction, which for a random block has probability about the fraction to
+// the power of the number of rounds. For example, with SPACE-16's 128 rounds, a quarter of the table gives a 2^(-256)
+// chance of encrypting a random block, and even 15/16ths of the table gives only a 2^(-12) chance.
+//
+// Whoever holds the AES key can compute the same cipher without the table, since each lookup is one AES encryption.
+//
+// "White-Box Cryptography Revisited: Space-Hard Ciphers" by Andrey Bogdanov and Takanori Isobe,
+// https://dl.acm.org/doi/10.1145/2810103.2813699
+package space
+
+import (
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// Construction is a white-boxed SPACE key. Table has one entry for every input of Width bytes, ordered by the input read
+// as a big-endian integer, and each entry is the first 16-Width bytes of AES encrypting the input padded with zeros on
+// the left.
+type Construction struct {
+	Width  int // The number of bytes of input to the table: 1, 2, or 3, for SPACE-8, SPACE-16, or SPACE-24.
+	Rounds int
+	Table  []byte
+
+	// Metadata is saved in the header of the serialized construction. Key generation leaves it empty.
+	Metadata common.Metadata
+}
+
+// BlockSize returns the block size of SPACE. (Necessary to implement cipher.Block.)
+func (constr Construction) BlockSize() int { return 16 }
+
+// lookup returns the table's entry for the input in the first Width bytes of x.
+func (constr *Construction) lookup(x []byte) []byte {
+	index := 0
+	for _, b := range x[:constr.Width] {
+		index = index<<8 | int(b)
+	}
+
+	size := 16 - constr.Width
+	return constr.Table[size*index : size*(index+1)]
+}
+
+// addRound XORs the round counter into the last bytes of x, as a big-endian integer.
+func addRound(x []byte, round int) {
+	x[len(x)-1] ^= byte(round)
+	x[len(x)-2] ^= byte(round >> 8)
+}
+
+// Encrypt encrypts the first block in src into dst. Dst and src may point at the same memory.
+//
+// Every round splits the state into its first Width bytes, x0, and the rest, x1, and replaces it with
+// (F(x0) xor round xor x1) || x0, where F is the table. As in the paper, round counts from 0 to Rounds-1.
+func (constr Construction) Encrypt(dst, src []byte) {
+	var state, next [16]byte
+	copy(state[:], src[:16])
+
+	w := constr.Width
+
+	for round := 0; round < constr.Rounds; round++ {
+		f := constr.lookup(state[:])
+		for i := range f {
+			next[i] = f[i] ^ state[w+i]
+		}
+		addRound(next[:16-w], round)
+		copy(next[16-w:], state[:w])
+
+		state = next
+	}
+
+	copy(dst, state[:])
+}
+
+// Decrypt decrypts the first block in src into dst. Dst and src may point at the same memory.
+func (constr Construction) Decrypt(dst, src []byte) {
+	var state, next [16]byte
+	copy(state[:], src[:16])
+
+	w := constr.Width
+
+	for round := constr.Rounds - 1; round >= 0; round-- {
+		copy(next[:w], state[16-w:])
+
+		f := constr.lookup(next[:])
+		for i := range f {
+			next[w+i] = f[i] ^ state[i]
+		}
+		addRound(next[w:], round)
+
+		state = next
+	}
+
+	copy(dst, state[:])
+}
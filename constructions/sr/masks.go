@@ -0,0 +1,99 @@
+package sr
+
+import (
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/matrix"
+	"github.com/OpenWhiteBox/primitives/random"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// Mask is an affine transformation of a block, x -> Forwards*x + Constant, like the external masks of the chow
+// package but sized to the block. Bit j of word i of the block is bit WordSize*i + j of x.
+type Mask struct {
+	Forwards, Backwards matrix.Matrix
+	Constant            matrix.Row
+
+	WordSize int
+}
+
+// Encode applies the mask to block, in place.
+func (m Mask) Encode(block []byte) {
+	x := m.Forwards.Mul(m.pack(block)).Add(m.Constant)
+	m.unpack(x, block)
+}
+
+// Decode removes the mask from block, in place.
+func (m Mask) Decode(block []byte) {
+	x := m.Backwards.Mul(m.pack(block).Add(m.Constant))
+	m.unpack(x, block)
+}
+
+// pack concatenates the words of a block into a row of bits.
+func (m Mask) pack(block []byte) matrix.Row {
+	n := len(m.Forwards)
+	out := matrix.NewRow(n)
+
+	for i := 0; i < n; i++ {
+		out.SetBit(i, (block[i/m.WordSize]>>uint(i%m.WordSize))&1 == 1)
+	}
+
+	return out
+}
+
+// unpack is the inverse of pack. It writes the words of x into block.
+func (m Mask) unpack(x matrix.Row, block []byte) {
+	n := len(m.Forwards)
+
+	for i := 0; i < n/m.WordSize; i++ {
+		block[i] = 0
+	}
+
+	for i := 0; i < n; i++ {
+		block[i/m.WordSize] |= x.GetBit(i) << uint(i%m.WordSize)
+	}
+}
+
+// generateMasks generates the input and output masks of a white-box from the same options as the chow package's. Masks
+// are generated at the size of the block, so a common.SpecifiedMask must have a linear part of that size, and only the
+// first bytes of its constant are used.
+func generateMasks(rs *random.Source, opts common.KeyGenerationOpts, p Params) (inputMask, outputMask Mask, err error) {
+	switch opts := opts.(type) {
+	case common.Options:
+		return generateMasks(rs, opts.Masks(), p)
+	case common.IndependentMasks:
+		if inputMask, err = generateMask(rs, opts.Input, common.Inside, p); err != nil {
+			return
+		}
+		outputMask, err = generateMask(rs, opts.Output, common.Outside, p)
+	case common.SameMasks:
+		inputMask, err = generateMask(rs, common.MaskType(opts), common.Inside, p)
+		outputMask = inputMask
+	case common.MatchingMasks:
+		inputMask, err = generateMask(rs, common.RandomMask, common.Inside, p)
+		outputMask = Mask{inputMask.Backwards, inputMask.Forwards, matrix.NewRow(p.WordSize * p.BlockSize()), p.WordSize}
+	default:
+		return inputMask, outputMask, errors.New("Unrecognized key generation options!")
+	}
+
+	return
+}
+
+func generateMask(rs *random.Source, mask common.Mask, surface common.Surface, p Params) (Mask, error) {
+	n := p.WordSize * p.BlockSize()
+	out := Mask{WordSize: p.WordSize}
+
+	out.Forwards, out.Constant = mask.Generate(rs, surface, n)
+	if h, w := out.Forwards.Size(); h != n || w != n || len(out.Constant) != n/8 {
+		return out, errors.New("Mask is the wrong size!")
+	}
+
+	backwards, ok := out.Forwards.Invert()
+	if !ok {
+		return out, errors.New("Mask isn't invertible!")
+	}
+	out.Backwards = backwards
+
+	return out, nil
+}
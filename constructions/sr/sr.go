@@ -0,0 +1,279 @@
+// Package sr implements the small scale variants of AES, SR(n, r, c, e). They keep the structure of AES, but shrink its
+// state to r rows and c columns of e-bit words and run it for n rounds, so that attacks can be tried on progressively
+// larger ciphers before running them against the real thing. SR(10, 4, 4, 8) is AES-128.
+//
+// Each word is stored in its own byte, so a block is r*c bytes long, and 4-bit words use the low half of their byte.
+// Keys are the same size as blocks. The last round omits MixColumns, as in AES (the paper calls this variant SR, as
+// opposed to SR*).
+//
+// "Small Scale Variants of the AES" by C. Cid, S. Murphy, and M.J.B. Robshaw,
+// http://www.isg.rhul.ac.uk/~sean/smallAES-fse05.pdf
+package sr
+
+import (
+	"crypto/cipher"
+	"errors"
+
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+// sbox4 is the S-box on 4-bit words: inversion in GF(2^4), followed by an affine transformation with constant 0x6.
+// unSbox4 is its inverse.
+var (
+	sbox4   = [16]byte{0x6, 0xb, 0x5, 0x4, 0x2, 0xe, 0x7, 0xa, 0x9, 0xd, 0xf, 0xc, 0x3, 0x1, 0x0, 0x8}
+	unSbox4 = [16]byte{0xe, 0xd, 0x4, 0xc, 0x3, 0x2, 0x0, 0x6, 0xf, 0x8, 0x7, 0x1, 0xb, 0x9, 0x5, 0xa}
+)
+
+// Params is a parameter set of the small scale AES family.
+type Params struct {
+	Rounds   int // n, from 1 to 10.
+	Rows     int // r, one of 1, 2, or 4.
+	Columns  int // c, one of 1, 2, or 4.
+	WordSize int // e, the size of a word in bits: 4 or 8.
+}
+
+// AES128 is the parameter set of AES-128.
+var AES128 = Params{Rounds: 10, Rows: 4, Columns: 4, WordSize: 8}
+
+// Valid returns an error if the parameters aren't in the small scale AES family.
+func (p Params) Valid() error {
+	if p.Rounds < 1 || p.Rounds > 10 {
+		return errors.New("Number of rounds must be between 1 and 10!")
+	} else if p.Rows != 1 && p.Rows != 2 && p.Rows != 4 {
+		return errors.New("Number of rows must be 1, 2, or 4!")
+	} else if p.Columns != 1 && p.Columns != 2 && p.Columns != 4 {
+		return errors.New("Number of columns must be 1, 2, or 4!")
+	} else if p.WordSize != 4 && p.WordSize != 8 {
+		return errors.New("Word size must be 4 or 8!")
+	}
+
+	return nil
+}
+
+// BlockSize returns the size of a block (and of a key) in bytes, with one word per byte.
+func (p Params) BlockSize() int { return p.Rows * p.Columns }
+
+// Construction is one small scale AES cipher with its key. The parameters aren't checked; use NewCipher, or call Valid
+// first.
+type Construction struct {
+	Params
+
+	// A key of BlockSize() words.
+	Key []byte
+}
+
+// NewCipher returns the small scale AES cipher with parameters p and the given key. It returns an error if the
+// parameters are invalid or the key is the wrong size.
+func NewCipher(p Params, key []byte) (cipher.Block, error) {
+	if err := p.Valid(); err != nil {
+		return nil, err
+	} else if len(key) != p.BlockSize() {
+		return nil, errors.New("Invalid key size!")
+	}
+
+	for _, w := range key {
+		if w>>uint(p.WordSize) != 0 {
+			return nil, errors.New("Key word out of range!")
+		}
+	}
+
+	return Construction{Params: p, Key: key}, nil
+}
+
+// Encrypt encrypts the first block in src into dst. Dst and src may point at the same memory.
+func (constr Construction) Encrypt(dst, src []byte) {
+	roundKeys := constr.StretchedKey()
+	copy(dst, src[:constr.BlockSize()])
+	block := dst[:constr.BlockSize()]
+
+	constr.AddRoundKey(roundKeys[0], block)
+	for i := 1; i <= constr.Rounds; i++ {
+		constr.SubBytes(block)
+		constr.ShiftRows(block)
+		if i != constr.Rounds {
+			constr.MixColumns(block)
+		}
+		constr.AddRoundKey(roundKeys[i], block)
+	}
+}
+
+// Decrypt decrypts the first block in src into dst. Dst and src may point at the same memory.
+func (constr Construction) Decrypt(dst, src []byte) {
+	roundKeys := constr.StretchedKey()
+	copy(dst, src[:constr.BlockSize()])
+	block := dst[:constr.BlockSize()]
+
+	for i := constr.Rounds; i >= 1; i-- {
+		constr.AddRoundKey(roundKeys[i], block)
+		if i != constr.Rounds {
+			constr.UnMixColumns(block)
+		}
+		constr.UnShiftRows(block)
+		constr.UnSubBytes(block)
+	}
+	constr.AddRoundKey(roundKeys[0], block)
+}
+
+// StretchedKey implements the key schedule of small scale AES, which is AES-128's with words in place of bytes and r
+// rows in place of four. It returns the Rounds+1 round keys derived from the master key.
+func (constr *Construction) StretchedKey() [][]byte {
+	r, c := constr.Rows, constr.Columns
+
+	out := make([][]byte, constr.Rounds+1)
+	out[0] = append([]byte{}, constr.Key[:r*c]...)
+
+	rc := byte(0x01) // x^(i-1), the round constant of round i.
+
+	for i := 1; i <= constr.Rounds; i++ {
+		prev, next := out[i-1], make([]byte, r*c)
+
+		// The first column is the previous one plus the last column, rotated up by one word and substituted.
+		for row := 0; row < r; row++ {
+			next[row] = prev[row] ^ constr.SubByte(prev[(c-1)*r+(row+1)%r])
+		}
+		next[0] ^= rc
+
+		for col := 1; col < c; col++ {
+			for row := 0; row < r; row++ {
+				next[col*r+row] = prev[col*r+row] ^ next[(col-1)*r+row]
+			}
+		}
+
+		out[i], rc = next, constr.mul(rc, 0x02)
+	}
+
+	return out
+}
+
+// AddRoundKey XORs roundKey into block.
+func (constr *Construction) AddRoundKey(roundKey, block []byte) {
+	for i := range block {
+		block[i] ^= roundKey[i]
+	}
+}
+
+// SubBytes rewrites each word of block with its image under SubByte.
+func (constr *Construction) SubBytes(block []byte) {
+	for i := range block {
+		block[i] = constr.SubByte(block[i])
+	}
+}
+
+// UnSubBytes rewrites each word of block with its image under UnSubByte.
+func (constr *Construction) UnSubBytes(block []byte) {
+	for i := range block {
+		block[i] = constr.UnSubByte(block[i])
+	}
+}
+
+// SubByte is the S-box on one word: AES' S-box for 8-bit words, and its 4-bit analogue for 4-bit words.
+func (constr *Construction) SubByte(e byte) byte {
+	if constr.WordSize == 4 {
+		return sbox4[e&0x0f]
+	}
+
+	return (&saes.Construction{}).SubByte(e)
+}
+
+// UnSubByte is the inverse of SubByte.
+func (constr *Construction) UnSubByte(e byte) byte {
+	if constr.WordSize == 4 {
+		return unSbox4[e&0x0f]
+	}
+
+	return (&saes.Construction{}).UnSubByte(e)
+}
+
+// ShiftRows rotates row i of block left by i columns.
+func (constr *Construction) ShiftRows(block []byte) {
+	constr.rotateRows(block, 1)
+}
+
+// UnShiftRows is the inverse of ShiftRows.
+func (constr *Construction) UnShiftRows(block []byte) {
+	constr.rotateRows(block, constr.Columns-1)
+}
+
+// rotateRows rotates row i of block left by dir*i columns.
+func (constr *Construction) rotateRows(block []byte, dir int) {
+	r, c := constr.Rows, constr.Columns
+	temp := append([]byte{}, block[:r*c]...)
+
+	for row := 0; row < r; row++ {
+		for col := 0; col < c; col++ {
+			block[col*r+row] = temp[((col+dir*row)%c)*r+row]
+		}
+	}
+}
+
+// MixColumns multiplies each column of block by a fixed matrix: the identity with one row, the circulant matrix with
+// first row (x+1, x) with two rows, and AES' circulant matrix, with first row (x, x+1, 1, 1), with four.
+func (constr *Construction) MixColumns(block []byte) {
+	for i := 0; i < constr.BlockSize(); i += constr.Rows {
+		constr.MixColumn(block[i : i+constr.Rows])
+	}
+}
+
+// UnMixColumns is the inverse of MixColumns.
+func (constr *Construction) UnMixColumns(block []byte) {
+	for i := 0; i < constr.BlockSize(); i += constr.Rows {
+		constr.UnMixColumn(block[i : i+constr.Rows])
+	}
+}
+
+// MixColumn multiplies the first Rows words of slice by the MixColumns matrix.
+func (constr *Construction) MixColumn(slice []byte) {
+	r := constr.Rows
+	temp := append([]byte{}, slice[:r]...)
+
+	for row := 0; row < r; row++ {
+		slice[row] = 0
+		for k := 0; k < r; k++ {
+			slice[row] ^= constr.mul(constr.mixCoeff(row, k), temp[k])
+		}
+	}
+}
+
+// mixCoeff returns the entry of the MixColumns matrix in the given row and column.
+func (constr *Construction) mixCoeff(row, col int) byte {
+	r := constr.Rows
+
+	switch r {
+	case 2:
+		return []byte{0x03, 0x02}[(col-row+r)%r]
+	case 4:
+		return []byte{0x02, 0x03, 0x01, 0x01}[(col-row+r)%r]
+	default:
+		return 0x01
+	}
+}
+
+// UnMixColumn is the inverse of MixColumn. The MixColumns matrix M has M^4 = I in either field, so the inverse is M^3.
+func (constr *Construction) UnMixColumn(slice []byte) {
+	for i := 0; i < 3; i++ {
+		constr.MixColumn(slice)
+	}
+}
+
+// mul multiplies two words in GF(2^e), which is GF(2)[x]/(x^8 + x^4 + x^3 + x + 1) for 8-bit words, as in AES, and
+// GF(2)[x]/(x^4 + x + 1) for 4-bit words.
+func (constr *Construction) mul(a, b byte) byte {
+	mod, top := uint(0x11b), uint(0x100)
+	if constr.WordSize == 4 {
+		mod, top = 0x13, 0x10
+	}
+
+	x, out := uint(a), uint(0)
+	for ; b > 0; b >>= 1 {
+		if b&1 == 1 {
+			out ^= x
+		}
+
+		x <<= 1
+		if x&top != 0 {
+			x ^= mod
+		}
+	}
+
+	return byte(out)
+}
@@ -0,0 +1,196 @@
+package sr
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+
+	test_vectors "github.com/OpenWhiteBox/AES/constructions/test"
+)
+
+var (
+	key   = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed  = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+	input = []byte{99, 83, 224, 140, 9, 96, 225, 4, 205, 112, 183, 81, 186, 202, 208, 231}
+)
+
+// params returns every parameter set in the family with n rounds.
+func params(n int) (out []Params) {
+	for _, r := range []int{1, 2, 4} {
+		for _, c := range []int{1, 2, 4} {
+			for _, e := range []int{4, 8} {
+				out = append(out, Params{Rounds: n, Rows: r, Columns: c, WordSize: e})
+			}
+		}
+	}
+
+	return
+}
+
+func TestAES128(t *testing.T) {
+	for n, vec := range test_vectors.GetAESVectors(testing.Short()) {
+		if len(vec.Key) != 16 {
+			continue
+		}
+
+		constr, err := NewCipher(AES128, vec.Key)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		out := make([]byte, 16)
+		constr.Encrypt(out, vec.In)
+
+		if !bytes.Equal(vec.Out, out) {
+			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.Out, out)
+		}
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	c, _ := aes.NewCipher(key)
+	c.Encrypt(real, input)
+	Construction{AES128, key}.Encrypt(cand, input)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestSubByte(t *testing.T) {
+	constr := Construction{Params: Params{Rounds: 1, Rows: 1, Columns: 1, WordSize: 4}}
+
+	if constr.SubByte(0x00) != 0x06 {
+		t.Fatalf("Affine component of the 4-bit SubByte is wrong!")
+	}
+
+	// The S-box minus its constant, composed with inversion, should be linear.
+	inverse := func(x byte) byte {
+		for y := byte(1); y < 16; y++ {
+			if constr.mul(x, y) == 1 {
+				return y
+			}
+		}
+		return 0
+	}
+	linear := func(x byte) byte { return constr.SubByte(inverse(x)) ^ 0x06 }
+
+	for x := byte(0); x < 16; x++ {
+		if constr.UnSubByte(constr.SubByte(x)) != x {
+			t.Fatalf("UnSubByte isn't the inverse of SubByte at %x!", x)
+		}
+
+		for y := byte(0); y < 16; y++ {
+			if linear(x^y) != linear(x)^linear(y) {
+				t.Fatalf("4-bit SubByte isn't inversion followed by an affine transformation!")
+			}
+		}
+	}
+}
+
+func TestDecrypt(t *testing.T) {
+	for _, p := range params(4) {
+		t.Run(fmt.Sprintf("SR(%v,%v,%v,%v)", p.Rounds, p.Rows, p.Columns, p.WordSize), func(t *testing.T) {
+			key, in := make([]byte, p.BlockSize()), make([]byte, p.BlockSize())
+			rand.Read(key)
+			rand.Read(in)
+
+			mask := byte(1<<uint(p.WordSize) - 1)
+			for i := range key {
+				key[i], in[i] = key[i]&mask, in[i]&mask
+			}
+
+			constr, err := NewCipher(p, key)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			out := make([]byte, p.BlockSize())
+			constr.Encrypt(out, in)
+
+			for _, w := range out {
+				if w&^mask != 0 {
+					t.Fatalf("Encrypt returned a word out of range! %x", out)
+				}
+			}
+
+			constr.Decrypt(out, out)
+
+			if !bytes.Equal(in, out) {
+				t.Fatalf("Decrypt didn't invert Encrypt! %x != %x", in, out)
+			}
+		})
+	}
+}
+
+func TestNewCipher(t *testing.T) {
+	bad := []Params{
+		{Rounds: 0, Rows: 4, Columns: 4, WordSize: 8},
+		{Rounds: 11, Rows: 4, Columns: 4, WordSize: 8},
+		{Rounds: 10, Rows: 3, Columns: 4, WordSize: 8},
+		{Rounds: 10, Rows: 4, Columns: 8, WordSize: 8},
+		{Rounds: 10, Rows: 4, Columns: 4, WordSize: 6},
+	}
+
+	for _, p := range bad {
+		if _, err := NewCipher(p, make([]byte, p.BlockSize())); err == nil {
+			t.Fatalf("NewCipher accepted invalid parameters %v!", p)
+		}
+	}
+
+	p := Params{Rounds: 2, Rows: 2, Columns: 2, WordSize: 4}
+	if _, err := NewCipher(p, make([]byte, 3)); err == nil {
+		t.Fatal("NewCipher accepted a key of the wrong size!")
+	} else if _, err := NewCipher(p, []byte{0, 0, 0x10, 0}); err == nil {
+		t.Fatal("NewCipher accepted a key word out of range!")
+	}
+}
+
+func TestWhiteBox(t *testing.T) {
+	opts := []common.KeyGenerationOpts{
+		common.IndependentMasks{common.IdentityMask, common.IdentityMask},
+		common.IndependentMasks{common.RandomAffineMask, common.RandomMask},
+		common.SameMasks(common.RandomMask),
+		common.MatchingMasks{},
+	}
+
+	for _, p := range append(params(3)[1:], AES128) {
+		for n, opt := range opts {
+			name := fmt.Sprintf("SR(%v,%v,%v,%v)/%v", p.Rounds, p.Rows, p.Columns, p.WordSize, n)
+
+			t.Run(name, func(t *testing.T) {
+				mask := byte(1<<uint(p.WordSize) - 1)
+
+				key, in := make([]byte, p.BlockSize()), make([]byte, p.BlockSize())
+				for i := range key {
+					key[i], in[i] = seed[i%16]&mask, input[i%16]&mask
+				}
+
+				wb, inputMask, outputMask, err := GenerateEncryptionKeys(p, key, seed, opt)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				real := make([]byte, p.BlockSize())
+				Construction{p, key}.Encrypt(real, in)
+
+				cand := append([]byte{}, in...)
+				inputMask.Decode(cand) // Apply input encoding.
+				wb.Encrypt(cand, cand)
+				outputMask.Decode(cand) // Remove output encoding.
+
+				if !bytes.Equal(real, cand) {
+					t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+				}
+			})
+		}
+	}
+
+	if _, _, _, err := GenerateEncryptionKeys(Params{2, 1, 1, 4}, []byte{0}, seed, common.MatchingMasks{}); err == nil {
+		t.Fatal("GenerateEncryptionKeys accepted a block smaller than a byte!")
+	}
+}
@@ -0,0 +1,289 @@
+package sr
+
+import (
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/random"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// WhiteBox is a Chow-style white-box of a small scale AES key, for encryption. It's built like the chow package's
+// construction--T-Boxes with the round keys folded in, followed by nibble XOR tables, with every value passed between
+// tables protected by random 4-bit encodings and the whole thing wrapped in external masks--but without the mixing
+// bijections, and on whatever block size the parameters give, so that generating and studying one takes milliseconds.
+//
+// A WhiteBox computes outputMask(SR(inputMask(x))), where the masks are the ones returned by GenerateEncryptionKeys.
+type WhiteBox struct {
+	Params
+
+	// Layers are applied in order: one to remove the input mask, one per round, and one to apply the output mask.
+	Layers []Layer
+}
+
+// Layer is one step of a white-box. Each word of its output is the XOR of some terms, and each term is a table lookup
+// on one word of its input. The terms are added up by nibble XOR tables, one at a time.
+type Layer struct {
+	Sources [][]int         // [output word][term] The input word that each term looks up.
+	Terms   [][][]byte      // [output word][term] Maps the encoded input word to the encoded term.
+	XOR     [][][][256]byte // [output word][term-1][nibble] Adds the next term to the sum of the ones before it.
+}
+
+// BlockSize returns the block size of the white-boxed cipher. (Necessary to implement cipher.Block.)
+func (wb WhiteBox) BlockSize() int { return wb.Params.BlockSize() }
+
+// Encrypt encrypts the first block in src into dst. Dst and src may point at the same memory. The bits of each word
+// above the word size are ignored.
+func (wb WhiteBox) Encrypt(dst, src []byte) {
+	size, mask := wb.BlockSize(), byte(1<<uint(wb.WordSize)-1)
+
+	state, next := make([]byte, size), make([]byte, size)
+	for i := range state {
+		state[i] = src[i] & mask
+	}
+
+	for _, l := range wb.Layers {
+		l.eval(next, state, wb.WordSize)
+		state, next = next, state
+	}
+
+	copy(dst, state)
+}
+
+// Decrypt panics. A WhiteBox can only encrypt.
+func (wb WhiteBox) Decrypt(dst, src []byte) {
+	panic("White-box can only encrypt!")
+}
+
+// eval applies the layer to the words in src and writes the result to dst.
+func (l *Layer) eval(dst, src []byte, wordSize int) {
+	for q := range dst {
+		acc := l.Terms[q][0][src[l.Sources[q][0]]]
+
+		for k := 1; k < len(l.Terms[q]); k++ {
+			term, sum := l.Terms[q][k][src[l.Sources[q][k]]], byte(0)
+
+			for h := 0; h < wordSize/4; h++ {
+				shift := uint(4 * h)
+				sum |= l.XOR[q][k-1][h][(acc>>shift&0x0f)<<4|term>>shift&0x0f] << shift
+			}
+
+			acc = sum
+		}
+
+		dst[q] = acc
+	}
+}
+
+// GenerateEncryptionKeys creates a white-box of the small scale AES cipher with parameters p and key `key`, with any
+// non-determinism generated by `seed`. Opts specifies the input and output masks, as in the chow package. The block
+// must be a whole number of bytes, which rules out SR(n, 1, 1, 4).
+func GenerateEncryptionKeys(p Params, key, seed []byte, opts common.KeyGenerationOpts) (out WhiteBox, inputMask, outputMask Mask, err error) {
+	if _, err = NewCipher(p, key); err != nil {
+		return
+	} else if (p.WordSize*p.BlockSize())%8 != 0 {
+		return out, inputMask, outputMask, errors.New("Block must be a whole number of bytes!")
+	}
+
+	rs := random.NewSource("SR Encryption", seed)
+
+	inputMask, outputMask, err = generateMasks(&rs, opts, p)
+	if err != nil {
+		return
+	}
+
+	constr := Construction{Params: p, Key: key}
+	roundKeys := constr.StretchedKey()
+	out.Params = p
+
+	// Describe every layer as a list of terms, then turn the terms into tables under random encodings.
+	layers := [][][]term{maskTerms(p, inputMask)}
+	for i := 1; i <= p.Rounds; i++ {
+		layers = append(layers, roundTerms(&constr, roundKeys, i))
+	}
+	layers = append(layers, maskTerms(p, outputMask))
+
+	g := &tableGenerator{rs: &rs, wordSize: p.WordSize}
+	input := identityWords(p.BlockSize())
+
+	for l, terms := range layers {
+		output := identityWords(p.BlockSize())
+		if l != len(layers)-1 {
+			output = g.words(p.BlockSize(), 'L', l, 0)
+		}
+
+		out.Layers = append(out.Layers, g.layer(l, terms, input, output))
+		input = output
+	}
+
+	return
+}
+
+// term is one term of a layer's output word: f applied to the unencoded input word at src.
+type term struct {
+	src int
+	f   func(byte) byte
+}
+
+// maskTerms returns the terms of a layer that applies mask m: word q of the output is the sum, over every input word p,
+// of word q of Forwards times the block holding only word p, plus word q of the constant.
+func maskTerms(params Params, m Mask) [][]term {
+	size := params.BlockSize()
+
+	// contrib[p][w] is the image of the block holding only w at position p, unpacked into words.
+	contrib := make([][][]byte, size)
+	for p := range contrib {
+		contrib[p] = make([][]byte, 1<<uint(params.WordSize))
+
+		for w := range contrib[p] {
+			block := make([]byte, size)
+			block[p] = byte(w)
+
+			m.unpack(m.Forwards.Mul(m.pack(block)), block)
+			contrib[p][w] = block
+		}
+	}
+
+	constant := make([]byte, size)
+	m.unpack(m.Constant, constant)
+
+	out := make([][]term, size)
+	for q := range out {
+		for p := 0; p < size; p++ {
+			q, p := q, p
+
+			out[q] = append(out[q], term{p, func(w byte) byte {
+				if p == 0 {
+					return contrib[p][w][q] ^ constant[q]
+				}
+				return contrib[p][w][q]
+			}})
+		}
+	}
+
+	return out
+}
+
+// roundTerms returns the terms of round i. Word q of the output, in row `row` of column `col`, is the sum over the
+// column after ShiftRows of the MixColumns coefficient times the T-Box of each word. The last round has no MixColumns,
+// so it has one term per word, and the last round key is added in its T-Box.
+func roundTerms(constr *Construction, roundKeys [][]byte, i int) [][]term {
+	r, c := constr.Rows, constr.Columns
+
+	sbox := make([]byte, 1<<uint(constr.WordSize))
+	for x := range sbox {
+		sbox[x] = constr.SubByte(byte(x))
+	}
+
+	out := make([][]term, constr.BlockSize())
+	for col := 0; col < c; col++ {
+		for row := 0; row < r; row++ {
+			q := col*r + row
+
+			if i == constr.Rounds {
+				src := ((col+row)%c)*r + row
+				in, last := roundKeys[i-1][src], roundKeys[i][q]
+
+				out[q] = []term{{src, func(w byte) byte { return sbox[w^in] ^ last }}}
+				continue
+			}
+
+			for j := 0; j < r; j++ {
+				src := ((col+j)%c)*r + j
+				in, coeff := roundKeys[i-1][src], constr.mixCoeff(row, j)
+
+				out[q] = append(out[q], term{src, func(w byte) byte { return constr.mul(coeff, sbox[w^in]) }})
+			}
+		}
+	}
+
+	return out
+}
+
+// wordEncoding is a nibble-wise encoding of a word: encode[h] and decode[h] encode and decode nibble h.
+type wordEncoding struct {
+	encode, decode [2][16]byte
+}
+
+func (we *wordEncoding) Encode(w byte) byte {
+	return we.encode[1][w>>4]<<4 | we.encode[0][w&0x0f]
+}
+
+func (we *wordEncoding) Decode(w byte) byte {
+	return we.decode[1][w>>4]<<4 | we.decode[0][w&0x0f]
+}
+
+func identityWords(n int) []wordEncoding {
+	out := make([]wordEncoding, n)
+	for i := range out {
+		for x := 0; x < 16; x++ {
+			out[i].encode[0][x], out[i].encode[1][x] = byte(x), byte(x)
+			out[i].decode[0][x], out[i].decode[1][x] = byte(x), byte(x)
+		}
+	}
+
+	return out
+}
+
+// tableGenerator builds the tables of a white-box from its terms, under random nibble encodings.
+type tableGenerator struct {
+	rs       *random.Source
+	wordSize int
+}
+
+// words returns n random word encodings, labeled by kind, layer, and position so that each one is drawn independently.
+// For 4-bit words, the high nibble is left unencoded, so that it stays zero.
+func (g *tableGenerator) words(n int, kind byte, layer, pos int) []wordEncoding {
+	out := identityWords(n)
+
+	for i := range out {
+		for h := 0; h < g.wordSize/4; h++ {
+			s := g.rs.Shuffle(common.Label("SR"+string(kind), layer, pos, h, i, i>>8))
+			out[i].encode[h], out[i].decode[h] = s.EncKey, s.DecKey
+		}
+	}
+
+	return out
+}
+
+// layer builds the tables of layer l, which reads words under the encodings in input and writes them under the
+// encodings in output. The terms of each word and the partial sums between the XOR tables get fresh encodings.
+func (g *tableGenerator) layer(l int, terms [][]term, input, output []wordEncoding) (out Layer) {
+	size := len(terms)
+	out.Sources = make([][]int, size)
+	out.Terms = make([][][]byte, size)
+	out.XOR = make([][][][256]byte, size)
+
+	for q, ts := range terms {
+		// Term k is encoded by termEnc[k], and the sum of terms 0 through k by sumEnc[k].
+		termEnc, sumEnc := g.words(len(ts), 'T', l, q), g.words(len(ts), 'X', l, q)
+		sumEnc[len(ts)-1] = output[q]
+		termEnc[0] = sumEnc[0]
+
+		for k, t := range ts {
+			table := make([]byte, 1<<uint(g.wordSize))
+			for x := range table {
+				table[x] = termEnc[k].Encode(t.f(input[t.src].Decode(byte(x))))
+			}
+
+			out.Sources[q] = append(out.Sources[q], t.src)
+			out.Terms[q] = append(out.Terms[q], table)
+
+			if k == 0 {
+				continue
+			}
+
+			xor := make([][256]byte, g.wordSize/4)
+			for h := range xor {
+				for x := 0; x < 256; x++ {
+					a, b := sumEnc[k-1].decode[h][x>>4], termEnc[k].decode[h][x&0x0f]
+					xor[h][x] = sumEnc[k].encode[h][a^b]
+				}
+			}
+
+			out.XOR[q] = append(out.XOR[q], xor)
+		}
+	}
+
+	return
+}
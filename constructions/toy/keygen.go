@@ -17,7 +17,7 @@ func generateAffineMasks(rs *random.Source) (inputMask, outputMask encoding.Bloc
 	var inputLinear, outputLinear matrix.Matrix
 	common.GenerateMasks(rs, common.IndependentMasks{common.RandomMask, common.RandomMask}, &inputLinear, &outputLinear)
 
-	reader := rs.Stream(make([]byte, 16))
+	reader := rs.Stream(common.Label(""))
 
 	var inputConstant, outputConstant [16]byte
 	reader.Read(inputConstant[:])
@@ -136,9 +136,7 @@ func GenerateKeys(key, seed []byte) (out Construction, inputMask, outputMask enc
 	out[10], _ = encoding.DecomposeBlockAffine(encoding.ComposedBlocks{out[10], outputMask})
 
 	// Sample a self-equivalences of the S-box layer and mix them into adjacent affine layers.
-	label := make([]byte, 16)
-	copy(label, []byte("Self-Eq"))
-	r := rs.Stream(label)
+	r := rs.Stream(common.Label("Self-Eq"))
 
 	for i := 1; i < 11; i++ {
 		a, bInv := generateSelfEquivalence(r)
@@ -0,0 +1,176 @@
+// Package vectors generates test vectors for the white-box constructions in this repository, so that independent
+// implementations of their evaluators can be checked against this one.
+//
+// Each set of vectors holds one serialized construction along with everything used to make it: the AES key, the seed,
+// and the external masks. Each vector then gives a block before and after the masks, on both sides of the
+// construction, so a re-implementation can be tested with or without handling the masks itself. The vectors are meant
+// to be written out with encoding/json (see Write), where byte slices appear as base64.
+package vectors
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/random"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/full"
+	"github.com/OpenWhiteBox/AES/constructions/toy"
+	"github.com/OpenWhiteBox/AES/constructions/xiao"
+)
+
+// KeyVectors is a set of test vectors for one white-boxed key.
+type KeyVectors struct {
+	Construction string `json:"construction"` // One of "chow", "xiao", "full", or "toy".
+	Decrypt      bool   `json:"decrypt"`      // Whether the construction computes AES decryption.
+
+	Key  []byte `json:"key"`  // The AES key.
+	Seed []byte `json:"seed"` // The seed the construction was generated with.
+
+	Serialized []byte `json:"serialized"` // The construction, as written by its Serialize method.
+
+	// The external masks, each serialized as the 128 rows of its linear part followed by its 16-byte constant. The
+	// construction computes OutputMask(AES(InputMask(x))).
+	InputMask  []byte `json:"input_mask"`
+	OutputMask []byte `json:"output_mask"`
+
+	Vectors []Vector `json:"vectors"`
+}
+
+// Vector is one block pushed through a construction.
+type Vector struct {
+	Input        []byte `json:"input"`         // The unmasked input to AES (the plaintext, when encrypting).
+	MaskedInput  []byte `json:"masked_input"`  // The input passed to the construction.
+	MaskedOutput []byte `json:"masked_output"` // The output returned by the construction.
+	Output       []byte `json:"output"`        // The unmasked output of AES (the ciphertext, when encrypting).
+}
+
+// Generate generates a construction of the given type with the given key, seed, and options, and n test vectors for it.
+// Opts is passed to the chow and xiao key generators and must be nil for the others. The inputs of the vectors are
+// derived from the seed, so the output is deterministic.
+//
+// Every vector is checked against crypto/aes, and an error is returned if the construction disagrees with it.
+func Generate(typ common.ConstructionType, decrypt bool, key, seed []byte, opts common.KeyGenerationOpts, n int) (out KeyVectors, err error) {
+	g, err := generate(typ, decrypt, key, seed, opts)
+	if err != nil {
+		return
+	}
+
+	real, err := aes.NewCipher(key)
+	if err != nil {
+		return
+	}
+
+	out = KeyVectors{
+		Construction: g.name,
+		Decrypt:      decrypt,
+		Key:          key,
+		Seed:         seed,
+		Serialized:   g.serialized,
+		InputMask:    chow.SerializeMask(g.inputMask),
+		OutputMask:   chow.SerializeMask(g.outputMask),
+	}
+
+	crypt, realCrypt := g.encrypt, real.Encrypt
+	if decrypt {
+		crypt, realCrypt = g.decrypt, real.Decrypt
+	}
+
+	rs := random.NewSource("Test Vectors", seed)
+	stream := rs.Stream(common.Label(""))
+
+	for i := 0; i < n; i++ {
+		v := Vector{make([]byte, 16), make([]byte, 16), make([]byte, 16), make([]byte, 16)}
+		stream.Read(v.Input)
+
+		copy(v.MaskedInput, v.Input)
+		chow.MaskInput(g.inputMask, v.MaskedInput)
+
+		crypt(v.MaskedOutput, v.MaskedInput)
+		realCrypt(v.Output, v.Input)
+
+		cand := append([]byte{}, v.MaskedOutput...)
+		chow.UnmaskOutput(g.outputMask, cand)
+
+		if !bytes.Equal(cand, v.Output) {
+			return out, errors.New("Construction disagrees with AES!")
+		}
+
+		out.Vectors = append(out.Vectors, v)
+	}
+
+	return out, nil
+}
+
+// generated is a freshly generated construction, with everything Generate needs from it.
+type generated struct {
+	name                  string
+	serialized            []byte
+	encrypt, decrypt      func(dst, src []byte)
+	inputMask, outputMask encoding.BlockAffine
+}
+
+func generate(typ common.ConstructionType, decrypt bool, key, seed []byte, opts common.KeyGenerationOpts) (g generated, err error) {
+	if (typ == common.FullConstruction || typ == common.ToyConstruction) && opts != nil {
+		return g, errors.New("Construction doesn't support options!")
+	}
+
+	switch typ {
+	case common.ChowConstruction:
+		var constr chow.Construction
+		if decrypt {
+			constr, g.inputMask, g.outputMask = chow.GenerateDecryptionKeys(key, seed, opts)
+		} else {
+			constr, g.inputMask, g.outputMask = chow.GenerateEncryptionKeys(key, seed, opts)
+		}
+
+		g.name, g.serialized, g.encrypt, g.decrypt = "chow", constr.Serialize(), constr.Encrypt, constr.Decrypt
+	case common.XiaoConstruction:
+		var constr xiao.Construction
+		if decrypt {
+			constr, g.inputMask, g.outputMask = xiao.GenerateDecryptionKeys(key, seed, opts)
+		} else {
+			constr, g.inputMask, g.outputMask = xiao.GenerateEncryptionKeys(key, seed, opts)
+		}
+
+		g.name, g.serialized, g.encrypt, g.decrypt = "xiao", constr.Serialize(), constr.Encrypt, constr.Decrypt
+	case common.FullConstruction:
+		var constr full.Construction
+		if decrypt {
+			constr, g.inputMask, g.outputMask = full.GenerateDecryptionKeys(key, seed)
+		} else {
+			constr, g.inputMask, g.outputMask = full.GenerateKeys(key, seed)
+		}
+
+		g.name, g.serialized, g.encrypt, g.decrypt = "full", constr.Serialize(), constr.Encrypt, constr.Decrypt
+	case common.ToyConstruction:
+		var constr toy.Construction
+		constr, g.inputMask, g.outputMask = toy.GenerateKeys(key, seed)
+
+		// A toy construction decrypts by running its layers backwards, so the masks swap sides and are inverted.
+		if decrypt {
+			inputMask, _ := encoding.DecomposeBlockAffine(encoding.InverseBlock{g.outputMask})
+			outputMask, _ := encoding.DecomposeBlockAffine(encoding.InverseBlock{g.inputMask})
+			g.inputMask, g.outputMask = inputMask, outputMask
+		}
+
+		g.name, g.serialized, g.encrypt, g.decrypt = "toy", constr.Serialize(), constr.Encrypt, constr.Decrypt
+	default:
+		return g, errors.New("Unrecognized construction type!")
+	}
+
+	return
+}
+
+// Write writes sets of test vectors to w as indented JSON.
+func Write(w io.Writer, vs []KeyVectors) error {
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+
+	return enc.Encode(vs)
+}
@@ -0,0 +1,65 @@
+package vectors
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+var (
+	key  = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed = []byte{38, 38, 38, 38, 38, 38, 38, 38, 38, 38, 38, 38, 38, 38, 38, 38}
+)
+
+func TestGenerate(t *testing.T) {
+	for _, decrypt := range []bool{false, true} {
+		opts := common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask}
+
+		kv, err := Generate(common.ChowConstruction, decrypt, key, seed, opts, 4)
+		if err != nil {
+			t.Fatalf("Generate returned error: %v", err)
+		} else if len(kv.Vectors) != 4 {
+			t.Fatalf("Generate returned the wrong number of vectors! %v != 4", len(kv.Vectors))
+		}
+
+		// The vectors should be reproducible from the serialized construction alone.
+		constr, err := chow.Parse(kv.Serialized)
+		if err != nil {
+			t.Fatalf("Parse returned error: %v", err)
+		}
+
+		for _, v := range kv.Vectors {
+			cand := make([]byte, 16)
+			if decrypt {
+				constr.Decrypt(cand, v.MaskedInput)
+			} else {
+				constr.Encrypt(cand, v.MaskedInput)
+			}
+
+			if !bytes.Equal(v.MaskedOutput, cand) {
+				t.Fatalf("Real disagrees with result! %x != %x", v.MaskedOutput, cand)
+			}
+		}
+
+		buff := &bytes.Buffer{}
+		if err := Write(buff, []KeyVectors{kv}); err != nil {
+			t.Fatalf("Write returned error: %v", err)
+		}
+
+		parsed := []KeyVectors{}
+		if err := json.Unmarshal(buff.Bytes(), &parsed); err != nil {
+			t.Fatalf("Written vectors aren't valid JSON: %v", err)
+		} else if !bytes.Equal(parsed[0].InputMask, kv.InputMask) {
+			t.Fatalf("Input mask didn't round-trip through JSON!")
+		}
+	}
+
+	if _, err := Generate(common.ToyConstruction, true, key, seed, nil, 4); err != nil {
+		t.Fatalf("Generate returned error for a decryption toy construction: %v", err)
+	} else if _, err := Generate(common.ToyConstruction, false, key, seed, common.SameMasks(common.IdentityMask), 1); err == nil {
+		t.Fatalf("Generate accepted options for a toy construction!")
+	}
+}
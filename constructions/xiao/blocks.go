@@ -0,0 +1,146 @@
+package xiao
+
+import (
+	"errors"
+	"io"
+	"runtime"
+	"sync"
+)
+
+const (
+	// minBlocksPerWorker is the smallest batch worth handing to its own goroutine, as in the chow package.
+	minBlocksPerWorker = 16
+
+	// writerChunk is the most a Writer encrypts at once, so that large writes don't need an equally large buffer.
+	writerChunk = 64 * 1024
+)
+
+// EncryptBlocks encrypts every block in src into dst. The length of src must be a multiple of the block size and dst
+// must be at least as long as src. Dst and src may point at the same memory. Large batches are split across up to
+// GOMAXPROCS goroutines.
+func (constr Construction) EncryptBlocks(dst, src []byte) {
+	constr.cryptBlocks(dst, src)
+}
+
+// DecryptBlocks decrypts every block in src into dst, with the same requirements as EncryptBlocks.
+func (constr Construction) DecryptBlocks(dst, src []byte) {
+	constr.cryptBlocks(dst, src)
+}
+
+// cryptBlocks splits src into contiguous runs of blocks and calls crypt on each block, with one goroutine per run.
+func (constr *Construction) cryptBlocks(dst, src []byte) {
+	bs := constr.BlockSize()
+	if len(src)%bs != 0 {
+		panic("Input not full blocks!")
+	} else if len(dst) < len(src) {
+		panic("Output smaller than input!")
+	}
+
+	blocks := len(src) / bs
+
+	workers := runtime.GOMAXPROCS(0)
+	if max := blocks / minBlocksPerWorker; max < workers {
+		workers = max
+	}
+
+	if workers <= 1 {
+		for i := 0; i < len(src); i += bs {
+			constr.crypt(dst[i:i+bs], src[i:i+bs])
+		}
+
+		return
+	}
+
+	var wg sync.WaitGroup
+	wg.Add(workers)
+
+	for w := 0; w < workers; w++ {
+		lo, hi := bs*(w*blocks/workers), bs*((w+1)*blocks/workers)
+
+		go func(lo, hi int) {
+			defer wg.Done()
+
+			for i := lo; i < hi; i += bs {
+				constr.crypt(dst[i:i+bs], src[i:i+bs])
+			}
+		}(lo, hi)
+	}
+
+	wg.Wait()
+}
+
+// Writer pushes everything written to it through a construction, block by block, and writes the result to an
+// underlying io.Writer. A construction encrypts and decrypts the same way, so a Writer does whichever the construction
+// was generated for. Writes that don't end on a block boundary keep the remainder until the rest of the block arrives.
+type Writer struct {
+	constr *Construction
+	w      io.Writer
+
+	pending    [16]byte
+	pendingLen int
+
+	buff []byte
+}
+
+// NewWriter returns a Writer that pushes blocks through constr and writes them to w. The construction must outlive the
+// Writer.
+func (constr *Construction) NewWriter(w io.Writer) *Writer {
+	return &Writer{constr: constr, w: w}
+}
+
+// Write pushes the whole blocks in p, along with any remainder of an earlier write, through the construction and writes
+// them to the underlying writer. (Implements io.Writer.)
+func (sw *Writer) Write(p []byte) (n int, err error) {
+	bs := sw.constr.BlockSize()
+
+	// Finish the block left over from the last write.
+	if sw.pendingLen > 0 {
+		k := copy(sw.pending[sw.pendingLen:], p)
+		sw.pendingLen, n = sw.pendingLen+k, k
+
+		if sw.pendingLen < bs {
+			return n, nil
+		}
+
+		sw.constr.crypt(sw.pending[:], sw.pending[:])
+		sw.pendingLen = 0
+
+		if _, err = sw.w.Write(sw.pending[:]); err != nil {
+			return n, err
+		}
+	}
+
+	for len(p)-n >= bs {
+		size := len(p) - n
+		size -= size % bs
+		if size > writerChunk {
+			size = writerChunk
+		}
+
+		if len(sw.buff) < size {
+			sw.buff = make([]byte, size)
+		}
+		chunk := sw.buff[:size]
+
+		sw.constr.cryptBlocks(chunk, p[n:n+size])
+		if _, err = sw.w.Write(chunk); err != nil {
+			return n, err
+		}
+
+		n += size
+	}
+
+	sw.pendingLen = copy(sw.pending[:], p[n:])
+
+	return len(p), nil
+}
+
+// Close checks that everything written has been pushed through the construction. It returns an error if the input
+// didn't end on a block boundary. It doesn't close the underlying writer.
+func (sw *Writer) Close() error {
+	if sw.pendingLen != 0 {
+		return errors.New("Input not full blocks!")
+	}
+
+	return nil
+}
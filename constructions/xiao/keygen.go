@@ -33,9 +33,11 @@ import (
 // 	constr.AddRoundKey(roundKeys[10], dst)
 // }
 
-// generateRoundMaterial creates the TMC (TBox + MixColumns) tables.
-func generateRoundMaterial(rs *random.Source, out *Construction, hidden func(int, int) table.DoubleToWord) {
-	for round := 0; round < 10; round++ {
+// generateRoundMaterial creates the TMC (TBox + MixColumns) tables for the given number of rounds.
+func generateRoundMaterial(rs *random.Source, out *Construction, rounds int, hidden func(int, int) table.DoubleToWord) {
+	out.TBoxMixCol = make([][8]table.DoubleToWord, rounds)
+
+	for round := 0; round < rounds; round++ {
 		for pos := 0; pos < 16; pos += 2 {
 			out.TBoxMixCol[round][pos/2] = encoding.DoubleToWordTable{
 				encoding.NewDoubleLinear(common.MixingBijection(rs, 16, round, pos/2)),
@@ -49,37 +51,56 @@ func generateRoundMaterial(rs *random.Source, out *Construction, hidden func(int
 }
 
 // generateBarriers creates the encoding barriers between rounds that compute ShiftRows and re-encodes data.
-func generateBarriers(rs *random.Source, out *Construction, inputMask, outputMask, sr *matrix.Matrix) {
+func generateBarriers(rs *random.Source, out *Construction, rounds int, inputMask, outputMask, sr *matrix.Matrix) {
 	// Generate the ShiftRows and re-encoding matrices.
+	out.ShiftRows = make([]matrix.Matrix, rounds)
 	out.ShiftRows[0] = maskSwap(rs, 16, 0).Compose(*sr).Compose(*inputMask)
 
-	for round := 1; round < 10; round++ {
+	for round := 1; round < rounds; round++ {
 		out.ShiftRows[round] = maskSwap(rs, 16, round).Compose(*sr).Compose(maskSwap(rs, 32, round-1))
 	}
 
 	// We need to apply a final matrix transformation to convert the double-level encoding to a block-level one.
-	out.FinalMask = outputMask.Compose(maskSwap(rs, 32, 9))
+	out.FinalMask = outputMask.Compose(maskSwap(rs, 32, rounds-1))
+}
+
+// foldConstants moves the constant parts of the external masks into the first and last round keys, since the barriers
+// can only compute linear transformations. The input mask's constant is added to the state right before first, and the
+// output mask's constant right after the output mask's linear part, which is the same as adding its preimage to last.
+func foldConstants(first, last []byte, inputMask, outputMask encoding.BlockAffine) {
+	preimage := outputMask.Backwards.Mul(matrix.Row(outputMask.BlockAdditive[:]))
+
+	for pos := 0; pos < 16; pos++ {
+		first[pos] ^= inputMask.BlockAdditive[pos]
+		last[pos] ^= preimage[pos]
+	}
 }
 
 // GenerateEncryptionKeys creates a white-boxed version of the AES key `key` for encryption, with any non-determinism
-// generated by `seed`.
-func GenerateEncryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask matrix.Matrix) {
+// generated by `seed`. The key may be 16, 24, or 32 bytes long, for AES-128, AES-192, or AES-256. Opts specifies what
+// type of input and output masks we put on the construction and should be in common.{IndependentMasks, SameMasks,
+// MatchingMasks}, as in the chow package. The construction computes
+// outputMask(AES(inputMask(x))).
+func GenerateEncryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine) {
 	rs := random.NewSource("Xiao Encryption", seed)
 
 	constr := saes.Construction{key}
-	roundKeys := constr.StretchedKey()
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
+
+	common.GenerateAffineMasks(&rs, opts, &inputMask, &outputMask)
+	foldConstants(roundKeys[0], roundKeys[rounds], inputMask, outputMask)
 
-	// Apply ShiftRows to round keys 0 to 9.
-	for k := 0; k < 10; k++ {
+	// Apply ShiftRows to every round key but the last.
+	for k := 0; k < rounds; k++ {
 		constr.ShiftRows(roundKeys[k])
 	}
 
 	hidden := func(round, pos int) table.DoubleToWord {
-		if round == 9 {
+		if round == rounds-1 {
 			return tBox{
 				[2]table.Byte{
-					common.TBox{constr, roundKeys[9][pos+0], roundKeys[10][pos+0]},
-					common.TBox{constr, roundKeys[9][pos+1], roundKeys[10][pos+1]},
+					common.TBox{constr, roundKeys[rounds-1][pos+0], roundKeys[rounds][pos+0]},
+					common.TBox{constr, roundKeys[rounds-1][pos+1], roundKeys[rounds][pos+1]},
 				},
 				sideFromPos(pos),
 			}
@@ -95,39 +116,42 @@ func GenerateEncryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (ou
 		}
 	}
 
-	common.GenerateMasks(&rs, opts, &inputMask, &outputMask)
-	generateRoundMaterial(&rs, &out, hidden)
-	generateBarriers(&rs, &out, &inputMask, &outputMask, &shiftRows)
+	generateRoundMaterial(&rs, &out, rounds, hidden)
+	generateBarriers(&rs, &out, rounds, &inputMask.Forwards, &outputMask.Forwards, &shiftRows)
 
 	return out, inputMask, outputMask
 }
 
 // GenerateDecryptionKeys creates a white-boxed version of the AES key `key` for decryption, with any non-determinism
-// generated by `seed`.
-func GenerateDecryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask matrix.Matrix) {
+// generated by `seed`. Opts is as in GenerateEncryptionKeys, and the construction computes
+// outputMask(AES^(-1)(inputMask(x))).
+func GenerateDecryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (out Construction, inputMask, outputMask encoding.BlockAffine) {
 	rs := random.NewSource("Xiao Decryption", seed)
 
 	constr := saes.Construction{key}
-	roundKeys := constr.StretchedKey()
+	roundKeys, rounds := constr.StretchedKey(), constr.Rounds()
+
+	common.GenerateAffineMasks(&rs, opts, &inputMask, &outputMask)
+	foldConstants(roundKeys[rounds], roundKeys[0], inputMask, outputMask)
 
-	// Apply UnShiftRows to round keys 10.
-	constr.UnShiftRows(roundKeys[10])
+	// Apply UnShiftRows to the last round key.
+	constr.UnShiftRows(roundKeys[rounds])
 
 	hidden := func(round, pos int) table.DoubleToWord {
 		if round == 0 {
 			return tBoxMixCol{
 				[2]table.Byte{
-					common.InvTBox{constr, roundKeys[10][pos+0], roundKeys[9][pos+0]},
-					common.InvTBox{constr, roundKeys[10][pos+1], roundKeys[9][pos+1]},
+					common.InvTBox{constr, roundKeys[rounds][pos+0], roundKeys[rounds-1][pos+0]},
+					common.InvTBox{constr, roundKeys[rounds][pos+1], roundKeys[rounds-1][pos+1]},
 				},
 				unMixColumns,
 				sideFromPos(pos),
 			}
-		} else if 0 < round && round < 9 {
+		} else if 0 < round && round < rounds-1 {
 			return tBoxMixCol{
 				[2]table.Byte{
-					common.InvTBox{constr, 0x00, roundKeys[9-round][pos+0]},
-					common.InvTBox{constr, 0x00, roundKeys[9-round][pos+1]},
+					common.InvTBox{constr, 0x00, roundKeys[rounds-1-round][pos+0]},
+					common.InvTBox{constr, 0x00, roundKeys[rounds-1-round][pos+1]},
 				},
 				unMixColumns,
 				sideFromPos(pos),
@@ -143,9 +167,8 @@ func GenerateDecryptionKeys(key, seed []byte, opts common.KeyGenerationOpts) (ou
 		}
 	}
 
-	common.GenerateMasks(&rs, opts, &inputMask, &outputMask)
-	generateRoundMaterial(&rs, &out, hidden)
-	generateBarriers(&rs, &out, &inputMask, &outputMask, &unShiftRows)
+	generateRoundMaterial(&rs, &out, rounds, hidden)
+	generateBarriers(&rs, &out, rounds, &inputMask.Forwards, &outputMask.Forwards, &unShiftRows)
 
 	return out, inputMask, outputMask
 }
@@ -1,69 +1,198 @@
 package xiao
 
 import (
+	"bytes"
+	"crypto/sha256"
 	"errors"
+	"io"
 
 	"github.com/OpenWhiteBox/primitives/matrix"
 	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
 )
 
 const (
-	fullSize = 20994048
-
 	matrixSize = 16 * 128
 	tmcSize    = 65536 * 4
 )
 
-// Serialize serializes a white-box construction into a byte slice.
+// fullSize returns the size of a serialized construction with the given number of rounds, not counting the header. For
+// AES-128, it's 20994048 bytes.
+func fullSize(rounds int) int {
+	return (rounds+1)*matrixSize + rounds*8*tmcSize
+}
+
+// Serialize serializes a white-box construction into a byte slice. The output starts with a common.Header, in the same
+// format as the chow package's keys, followed by every matrix and table in a fixed order.
 func (constr *Construction) Serialize() []byte {
-	out, base := make([]byte, fullSize), 0
+	buff := bytes.NewBuffer(make([]byte, 0, constr.Size()))
+	constr.WriteTo(buff)
+
+	return buff.Bytes()
+}
+
+// Size returns the number of bytes in the serialized construction, header included, without serializing it.
+func (constr *Construction) Size() int {
+	return constr.header().Size() + fullSize(constr.Rounds())
+}
+
+// WriteTo writes the serialized construction to w one table at a time, so that the whole key never has to be buffered
+// in memory. The output is the same as Serialize's. (Implements io.WriterTo.)
+func (constr *Construction) WriteTo(w io.Writer) (int64, error) {
+	sw := &common.StreamWriter{W: w}
+
+	sw.WriteHeader(constr.header())
+	constr.writeTables(sw)
+
+	return sw.N, sw.Err
+}
+
+// SerializeWithMAC is Serialize, but flags the header and appends an HMAC-SHA256 of the whole key under macKey, so that
+// loaders can detect modified keys with VerifyIntegrity. The MAC is ignored by the parsers.
+func (constr *Construction) SerializeWithMAC(macKey []byte) []byte {
+	h := constr.header()
+	h.MAC = true
+
+	buff := bytes.NewBuffer(make([]byte, 0, h.Size()+fullSize(constr.Rounds())+common.MACSize))
+	mac := common.NewMAC(macKey)
+	sw := &common.StreamWriter{W: io.MultiWriter(buff, mac)}
+
+	sw.WriteHeader(h)
+	constr.writeTables(sw)
+	buff.Write(mac.Sum(nil))
 
-	base += serializeMatrix(out[base:], constr.FinalMask)
+	return buff.Bytes()
+}
+
+// VerifyIntegrity reads a serialized construction from r, up to EOF, and checks that it was written by SerializeWithMAC
+// with the same macKey and hasn't been modified since.
+func VerifyIntegrity(r io.Reader, macKey []byte) error {
+	return common.VerifyIntegrity(r, common.XiaoConstruction, macKey)
+}
+
+// Fingerprint returns the SHA-256 hash of the construction's serialized tables, like the chow package's.
+func (constr *Construction) Fingerprint() (out [sha256.Size]byte) {
+	h := sha256.New()
+	constr.writeTables(&common.StreamWriter{W: h})
+
+	copy(out[:], h.Sum(nil))
+	return
+}
+
+func (constr *Construction) header() common.Header {
+	return common.Header{
+		Version:  common.CurrentVersion,
+		Type:     common.XiaoConstruction,
+		Rounds:   byte(constr.Rounds()),
+		Metadata: constr.Metadata,
+	}
+}
+
+// writeTables writes every matrix and table of the construction to sw, in the order Parse expects them.
+func (constr *Construction) writeTables(sw *common.StreamWriter) {
+	sw.Write(serializeMatrix(constr.FinalMask))
 
 	for _, sr := range constr.ShiftRows {
-		base += serializeMatrix(out[base:], sr)
+		sw.Write(serializeMatrix(sr))
 	}
 
 	for _, round := range constr.TBoxMixCol {
 		for _, tmc := range round {
-			base += copy(out[base:], table.SerializeDoubleToWord(tmc))
+			sw.Write(table.SerializeDoubleToWord(tmc))
 		}
 	}
+}
 
-	return out
+// ReadConstruction reads one serialized construction from r. Unlike Parse, it requires a versioned header, and it
+// doesn't read past the end of the construction.
+func ReadConstruction(r io.Reader) (constr Construction, err error) {
+	sr := &common.StreamReader{R: r}
+
+	h := sr.ReadHeader(common.XiaoConstruction)
+	if sr.Err != nil {
+		return constr, sr.Err
+	} else if !validRounds(int(h.Rounds)) || h.Shuffled || h.Compressed {
+		return constr, errors.New("Parsing the key failed!")
+	}
+
+	body := sr.Next(fullSize(int(h.Rounds)))
+	sr.Next(h.TrailerSize())
+
+	if sr.Err != nil {
+		return constr, sr.Err
+	}
+
+	constr, err = parseTables(body, int(h.Rounds))
+	constr.Metadata = h.Metadata
+
+	return
 }
 
-// Parse parses a byte array into a white-box construction. It returns an error if the byte array isn't long enough.
+// Parse parses a byte array into a white-box construction. It returns an error if the header is invalid or the byte
+// array is the wrong length. Keys serialized without a header (version 0) are still accepted. A MAC at the end of the
+// key is skipped, not checked; use VerifyIntegrity for that.
 func Parse(in []byte) (constr Construction, err error) {
-	var rest []byte
+	var metadata common.Metadata
+	rounds := 10 // Keys without a header are always for AES-128.
+
+	if common.HasHeader(in) {
+		var h common.Header
+		h, in, err = common.ParseHeader(in, common.XiaoConstruction)
+		if err != nil {
+			return
+		} else if !validRounds(int(h.Rounds)) || h.Shuffled || h.Compressed || len(in) < h.TrailerSize() {
+			return constr, errors.New("Parsing the key failed!")
+		}
+
+		rounds, metadata, in = int(h.Rounds), h.Metadata, in[:len(in)-h.TrailerSize()]
+	}
+
+	constr, err = parseTables(in, rounds)
+	constr.Metadata = metadata
+
+	return
+}
+
+// parseTables parses the matrices and tables of a construction with the given number of rounds, as written by
+// writeTables.
+func parseTables(in []byte, rounds int) (constr Construction, err error) {
+	if len(in) != fullSize(rounds) {
+		return constr, errors.New("Parsing the key failed!")
+	}
 
+	var rest []byte
 	constr.FinalMask, rest = parseMatrix(in)
 
-	for i, _ := range constr.ShiftRows {
+	constr.ShiftRows = make([]matrix.Matrix, rounds)
+	constr.TBoxMixCol = make([][8]table.DoubleToWord, rounds)
+
+	for i := range constr.ShiftRows {
 		constr.ShiftRows[i], rest = parseMatrix(rest)
 	}
 
-	for i, _ := range constr.TBoxMixCol {
-		for j, _ := range constr.TBoxMixCol[i] {
+	for i := range constr.TBoxMixCol {
+		for j := range constr.TBoxMixCol[i] {
 			constr.TBoxMixCol[i][j] = table.ParsedDoubleToWord(rest[:tmcSize])
 			rest = rest[tmcSize:]
 		}
 	}
 
-	if rest == nil {
-		err = errors.New("Parsing the key failed!")
-	}
+	return constr, nil
+}
 
-	return
+// validRounds returns true if a construction may have the given number of rounds: 10, 12, or 14.
+func validRounds(rounds int) bool {
+	return rounds == 10 || rounds == 12 || rounds == 14
 }
 
-func serializeMatrix(dst []byte, m matrix.Matrix) int {
-	base := 0
+func serializeMatrix(m matrix.Matrix) []byte {
+	out := make([]byte, 0, matrixSize)
 	for _, row := range m {
-		base += copy(dst[base:], row)
+		out = append(out, row...)
 	}
 
-	return base
+	return out
 }
 
 func parseMatrix(in []byte) (out matrix.Matrix, rest []byte) {
@@ -78,3 +207,23 @@ func parseMatrix(in []byte) (out matrix.Matrix, rest []byte) {
 
 	return out, in[matrixSize:]
 }
+
+func init() {
+	parse := func(in []byte) (common.Construction, error) {
+		constr, err := Parse(in)
+		if err != nil {
+			return nil, err
+		}
+
+		return &constr, nil
+	}
+
+	common.Register(common.XiaoConstruction, parse)
+	common.RegisterLegacy(common.XiaoConstruction, parse) // Parse also reads keys serialized without a header.
+}
+
+// Type returns common.XiaoConstruction. (Necessary to implement common.Construction.)
+func (constr Construction) Type() common.ConstructionType { return common.XiaoConstruction }
+
+// KeySize returns the length of the AES key the construction computes: 16, 24, or 32.
+func (constr Construction) KeySize() int { return common.KeySize(constr.Rounds()) }
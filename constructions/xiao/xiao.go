@@ -12,18 +12,28 @@ package xiao
 import (
 	"github.com/OpenWhiteBox/primitives/matrix"
 	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
 )
 
+// Construction is a white-boxed AES key. It has one ShiftRows matrix and one set of TBoxMixCol tables for every round of
+// AES: 10 for AES-128, 12 for AES-192, and 14 for AES-256.
 type Construction struct {
-	ShiftRows  [10]matrix.Matrix
-	TBoxMixCol [10][8]table.DoubleToWord
+	ShiftRows  []matrix.Matrix         // [round]
+	TBoxMixCol [][8]table.DoubleToWord // [round][position]
 
 	FinalMask matrix.Matrix
+
+	// Metadata is saved in the header of the serialized construction. Key generation leaves it empty.
+	Metadata common.Metadata
 }
 
 // BlockSize returns the block size of AES. (Necessary to implement cipher.Block.)
 func (constr Construction) BlockSize() int { return 16 }
 
+// Rounds returns the number of rounds of AES this construction computes: 10, 12, or 14.
+func (constr Construction) Rounds() int { return len(constr.ShiftRows) }
+
 // Encrypt encrypts the first block in src into dst. Dst and src may point at the same memory.
 func (constr Construction) Encrypt(dst, src []byte) {
 	constr.crypt(dst, src)
@@ -37,7 +47,7 @@ func (constr Construction) Decrypt(dst, src []byte) {
 func (constr *Construction) crypt(dst, src []byte) {
 	copy(dst, src)
 
-	for round := 0; round < 10; round++ {
+	for round := 0; round < len(constr.ShiftRows); round++ {
 		// ShiftRows and re-encoding step.
 		copy(dst, constr.ShiftRows[round].Mul(matrix.Row(dst)))
 
@@ -2,9 +2,9 @@ package xiao
 
 import (
 	"bytes"
+	"crypto/aes"
 	"testing"
 
-	"github.com/OpenWhiteBox/primitives/matrix"
 	"github.com/OpenWhiteBox/primitives/table"
 
 	"github.com/OpenWhiteBox/AES/constructions/common"
@@ -56,21 +56,19 @@ func TestTBoxMixCol(t *testing.T) {
 func TestEncrypt(t *testing.T) {
 	for n, vec := range test_vectors.GetAESVectors(testing.Short()) {
 		constr, inputMask, outputMask := GenerateEncryptionKeys(
-			vec.Key, vec.Key, common.IndependentMasks{common.RandomMask, common.RandomMask},
+			vec.Key, vec.Key, common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask},
 		)
 
-		inputInv, _ := inputMask.Invert()
-		outputInv, _ := outputMask.Invert()
+		in, out := [16]byte{}, [16]byte{}
 
-		in, out := make([]byte, 16), make([]byte, 16)
+		copy(in[:], vec.In)
+		in = inputMask.Decode(in) // Apply input encoding.
 
-		copy(in, inputInv.Mul(matrix.Row(vec.In))) // Apply input encoding.
+		constr.Encrypt(out[:], in[:])
 
-		constr.Encrypt(out, in)
+		out = outputMask.Decode(out) // Remove output encoding.
 
-		copy(out, outputInv.Mul(matrix.Row(out))) // Remove output encoding.
-
-		if !bytes.Equal(vec.Out, out) {
+		if !bytes.Equal(vec.Out, out[:]) {
 			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.Out, out)
 		}
 	}
@@ -79,50 +77,195 @@ func TestEncrypt(t *testing.T) {
 func TestDecrypt(t *testing.T) {
 	for n, vec := range test_vectors.GetAESVectors(testing.Short()) {
 		constr, inputMask, outputMask := GenerateDecryptionKeys(
-			vec.Key, vec.Key, common.IndependentMasks{common.RandomMask, common.RandomMask},
+			vec.Key, vec.Key, common.IndependentMasks{common.RandomAffineMask, common.RandomMask},
 		)
 
-		inputInv, _ := inputMask.Invert()
-		outputInv, _ := outputMask.Invert()
-
-		in, out := make([]byte, 16), make([]byte, 16)
+		in, out := [16]byte{}, [16]byte{}
 
-		copy(in, inputInv.Mul(matrix.Row(vec.Out))) // Apply input encoding.
+		copy(in[:], vec.Out)
+		in = inputMask.Decode(in) // Apply input encoding.
 
-		constr.Encrypt(out, in)
+		constr.Decrypt(out[:], in[:])
 
-		copy(out, outputInv.Mul(matrix.Row(out))) // Remove output encoding.
+		out = outputMask.Decode(out) // Remove output encoding.
 
-		if !bytes.Equal(vec.In, out) {
+		if !bytes.Equal(vec.In, out[:]) {
 			t.Fatalf("Real disagrees with result in test vector %v! %x != %x", n, vec.Out, out)
 		}
 	}
 }
 
+func TestEncrypt192(t *testing.T) {
+	key192 := append(append([]byte{}, key...), seed[:8]...)
+
+	constr, inputMask, outputMask := GenerateEncryptionKeys(
+		key192, seed, common.IndependentMasks{common.RandomMask, common.RandomMask},
+	)
+
+	if constr.Rounds() != 12 {
+		t.Fatalf("AES-192 construction has wrong number of rounds! %v != 12", constr.Rounds())
+	}
+
+	in, cand, real := [16]byte{}, [16]byte{}, make([]byte, 16)
+
+	copy(in[:], input)
+	in = inputMask.Decode(in) // Apply input encoding.
+	constr.Encrypt(cand[:], in[:])
+	cand = outputMask.Decode(cand) // Remove output encoding.
+
+	c, _ := aes.NewCipher(key192)
+	c.Encrypt(real, input)
+
+	if !bytes.Equal(real, cand[:]) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestDecrypt256(t *testing.T) {
+	key256 := append(append([]byte{}, key...), seed...)
+
+	constr, inputMask, outputMask := GenerateDecryptionKeys(
+		key256, seed, common.IndependentMasks{common.RandomAffineMask, common.RandomAffineMask},
+	)
+
+	if constr.Rounds() != 14 {
+		t.Fatalf("AES-256 construction has wrong number of rounds! %v != 14", constr.Rounds())
+	}
+
+	in, cand, real := [16]byte{}, [16]byte{}, make([]byte, 16)
+
+	copy(in[:], input)
+	in = inputMask.Decode(in) // Apply input encoding.
+	constr.Decrypt(cand[:], in[:])
+	cand = outputMask.Decode(cand) // Remove output encoding.
+
+	c, _ := aes.NewCipher(key256)
+	c.Decrypt(real, input)
+
+	if !bytes.Equal(real, cand[:]) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestEncryptBlocks(t *testing.T) {
+	constr, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.IdentityMask, common.IdentityMask})
+
+	src := make([]byte, 16*40)
+	for i := range src {
+		src[i] = byte(i)
+	}
+
+	real := make([]byte, len(src))
+	for i := 0; i < len(src); i += 16 {
+		constr.Encrypt(real[i:i+16], src[i:i+16])
+	}
+
+	cand := make([]byte, len(src))
+	constr.EncryptBlocks(cand, src)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	// Write the same input through a Writer, in pieces that don't line up with the blocks.
+	buff := &bytes.Buffer{}
+	w := constr.NewWriter(buff)
+
+	for _, piece := range [][]byte{src[:7], src[7:7], src[7:300], src[300:301], src[301:]} {
+		if n, err := w.Write(piece); err != nil || n != len(piece) {
+			t.Fatalf("Write returned %v, %v for a piece of length %v!", n, err, len(piece))
+		}
+	}
+
+	if err := w.Close(); err != nil {
+		t.Fatalf("Close returned error: %v", err)
+	} else if !bytes.Equal(real, buff.Bytes()) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, buff.Bytes())
+	}
+
+	w.Write(src[:3])
+	if err := w.Close(); err == nil {
+		t.Fatalf("Close didn't return an error for a partial block!")
+	}
+}
+
 func TestPersistence(t *testing.T) {
 	if testing.Short() {
 		t.Skip("Skipping the persistence test in short mode!")
 	}
 
 	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+	constr1.Metadata = common.Metadata{KeyID: []byte("xiao")}
 
 	serialized := constr1.Serialize()
-	constr2, err := Parse(serialized)
+	if !common.HasHeader(serialized) || len(serialized) != constr1.Size() {
+		t.Fatalf("Serialized construction doesn't have a header!")
+	}
 
+	constr2, err := Parse(serialized)
 	if err != nil {
 		t.Fatalf("Parse returned error: %v", err)
+	} else if !bytes.Equal(constr2.Metadata.KeyID, constr1.Metadata.KeyID) {
+		t.Fatalf("Metadata didn't survive serialization!")
 	}
 
-	cand1, cand2 := make([]byte, 16), make([]byte, 16)
+	// Keys serialized before the header existed should still parse.
+	constr3, err := Parse(serialized[len(serialized)-fullSize(10):])
+	if err != nil {
+		t.Fatalf("Parse returned error for a headerless key: %v", err)
+	}
+
+	constr4, err := ReadConstruction(bytes.NewReader(constr1.SerializeWithMAC(key)))
+	if err != nil {
+		t.Fatalf("ReadConstruction returned error: %v", err)
+	} else if err := VerifyIntegrity(bytes.NewReader(constr1.SerializeWithMAC(key)), key); err != nil {
+		t.Fatalf("VerifyIntegrity returned error: %v", err)
+	}
+
+	real := make([]byte, 16)
+	constr1.Encrypt(real, input)
 
-	constr1.Encrypt(cand1, input)
-	constr2.Encrypt(cand2, input)
+	for _, constr := range []Construction{constr2, constr3, constr4} {
+		cand := make([]byte, 16)
+		constr.Encrypt(cand, input)
 
-	if !bytes.Equal(cand1, cand2) {
-		t.Fatalf("Real disagrees with parsed! %x != %x", cand1, cand2)
+		if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with parsed! %x != %x", real, cand)
+		}
 	}
 }
 
+// FuzzParse corrupts a key made of a valid header and tables that are all zero. Generating a real key takes minutes,
+// and every byte of the tables is taken as-is by Parse, so zeros are as good a starting point as any.
+func FuzzParse(f *testing.F) {
+	h := common.Header{Version: common.CurrentVersion, Type: common.XiaoConstruction, Rounds: 10}
+	serialized := make([]byte, h.Size()+fullSize(10))
+	h.Serialize(serialized)
+
+	f.Add(uint32(0), []byte{0xff}, uint32(0))
+	f.Add(uint32(6), []byte{12}, uint32(0))
+	f.Add(uint32(7), []byte{0x03}, uint32(0))
+	f.Add(uint32(h.Size()), []byte{0xff, 0xff}, uint32(0))
+	f.Add(uint32(0), []byte{}, uint32(1))
+
+	f.Fuzz(func(t *testing.T, offset uint32, patch []byte, cut uint32) {
+		in := append([]byte{}, serialized...)
+		copy(in[int(offset)%len(in):], patch)
+		in = in[:len(in)-int(cut)%len(in)]
+
+		dst := make([]byte, 16)
+
+		if constr, err := Parse(in); err == nil {
+			constr.Encrypt(dst, input)
+			constr.Decrypt(dst, input)
+		}
+
+		if constr, err := ReadConstruction(bytes.NewReader(in)); err == nil {
+			constr.Encrypt(dst, input)
+		}
+	})
+}
+
 func BenchmarkGenerateEncryptionKeys(b *testing.B) {
 	for i := 0; i < b.N; i++ {
 		constr, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
@@ -158,3 +301,19 @@ func BenchmarkDeadEncrypt(b *testing.B) {
 		constr2.Encrypt(out, input)
 	}
 }
+
+func BenchmarkDeadEncryptBlocks(b *testing.B) {
+	constr1, _, _ := GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	serialized := constr1.Serialize()
+	constr2, _ := Parse(serialized)
+
+	buf := make([]byte, 16*1024)
+
+	b.SetBytes(int64(len(buf)))
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		constr2.EncryptBlocks(buf, buf)
+	}
+}
@@ -1,54 +1,32 @@
 // Package chow implements a cryptanalysis of Chow et al.'s white-box AES construction.
 //
-// It is built on top of the SAS cryptanalysis in Generic/cryptanalysis/spn.
+// It is built on top of the SAS cryptanalysis in Generic/cryptanalysis/spn, through cryptanalysis/network.
 //
 // http://dl.acm.org/citation.cfm?id=2995314
 package chow
 
 import (
+	"context"
+	"errors"
+	"fmt"
+
 	"github.com/OpenWhiteBox/primitives/encoding"
 
 	"github.com/OpenWhiteBox/AES/constructions/chow"
 	"github.com/OpenWhiteBox/AES/constructions/common"
-	"github.com/OpenWhiteBox/AES/constructions/saes"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/network"
 
-	cspn "github.com/OpenWhiteBox/Generic/constructions/spn"
 	aspn "github.com/OpenWhiteBox/Generic/cryptanalysis/spn"
 )
 
-var powx = [16]byte{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x1b, 0x36, 0x6c, 0xd8, 0xab, 0x4d, 0x9a, 0x2f}
-
-// backOneRound takes round key i and returns round key i-1.
-func backOneRound(roundKey []byte, round int) (out []byte) {
-	out = make([]byte, 16)
-	constr := saes.Construction{}
-
-	// Recover everything except the first word by XORing consecutive blocks.
-	for pos := 4; pos < 16; pos++ {
-		out[pos] = roundKey[pos] ^ roundKey[pos-4]
-	}
-
-	// Recover the first word by XORing the first block of the roundKey with f(last block of roundKey), where f is a
-	// subroutine of AES' key scheduling algorithm.
-	for pos := 0; pos < 4; pos++ {
-		out[pos] = roundKey[pos] ^ constr.SubByte(out[12+(pos+1)%4])
-	}
-	out[0] ^= powx[round-1]
-
-	return
+// tables describes the table network of a construction, for the generic parts of the attack in cryptanalysis/network.
+type tables struct {
+	construction *chow.Construction
 }
 
-// isAS returns true if the given Byte encoding might be an AS structure, with 2 4-bit S-boxes.
-func isAS(in encoding.Byte) bool {
-	temp1, temp2 := byte(0x00), byte(0x00)
+func (t tables) Rounds() int { return len(t.construction.TBoxTyiTable) }
 
-	for x := byte(0); x < 16; x++ {
-		temp1 ^= in.Encode(x)
-		temp2 ^= in.Encode(x << 4)
-	}
-
-	return temp1 == 0 && temp2 == 0
-}
+func (t tables) Round(r int) aspn.Cipher { return round{construction: t.construction, round: r} }
 
 // round isolates one round of encryption with an AES white-box.
 type round struct {
@@ -58,42 +36,124 @@ type round struct {
 
 func (r round) Encrypt(dst, src []byte) {
 	copy(dst[0:16], src[0:16])
+	slot := r.construction.Slot(r.round)
 
 	for pos := 0; pos < 16; pos += 4 {
-		stretched := r.construction.ExpandWord(r.construction.TBoxTyiTable[r.round][pos:pos+4], dst[pos:pos+4])
-		r.construction.SquashWords(r.construction.HighXORTable[r.round][2*pos:2*pos+8], stretched, dst[pos:pos+4])
+		stretched := r.construction.ExpandWord(r.construction.TBoxTyiTable[slot][pos:pos+4], dst[pos:pos+4])
+		r.construction.SquashWords(r.construction.HighXORTable[slot][2*pos:2*pos+8], stretched, dst[pos:pos+4])
 
-		stretched = r.construction.ExpandWord(r.construction.MBInverseTable[r.round][pos:pos+4], dst[pos:pos+4])
-		r.construction.SquashWords(r.construction.LowXORTable[r.round][2*pos:2*pos+8], stretched, dst[pos:pos+4])
+		stretched = r.construction.ExpandWord(r.construction.MBInverseTable[slot][pos:pos+4], dst[pos:pos+4])
+		r.construction.SquashWords(r.construction.LowXORTable[slot][2*pos:2*pos+8], stretched, dst[pos:pos+4])
 	}
 }
 
-// RecoverKey returns the AES key used to generate the given white-box construction.
-func RecoverKey(constr *chow.Construction) []byte {
-	round1, round2 := round{
-		construction: constr,
-		round:        1,
-	}, round{
-		construction: constr,
-		round:        2,
+// RecoverKey runs the whole attack on the given white-box construction and returns the AES key it was generated with.
+// No oracle access or knowledge of the external masks is needed; everything comes from the tables:
+//
+//  1. Dummy rounds (see chow.Opts) are told apart from real rounds by their lack of S-boxes, and the first two
+//     consecutive real rounds after the first one are picked out.
+//  2. Encoding recovery: each of the two rounds is decomposed into an S-box layer, an affine layer, and another S-box
+//     layer, which strips the nibble encodings and the mixing bijections down to unknown affine transformations.
+//  3. The affine layers are disambiguated against MixColumns, which leaves the S-boxes between them equal to AES' up to
+//     a known affine transformation.
+//  4. Round-key extraction: each byte of the round key is the constant that makes the leading S-boxes affine-equivalent
+//     to AES' S-box.
+//  5. Key-schedule inversion: the round key is walked back to the master key.
+//
+// Only AES-128 encryption constructions are supported; the key schedule inversion doesn't apply to longer keys. An error
+// is returned if the construction doesn't have the structure the attack expects.
+func RecoverKey(constr *chow.Construction) ([]byte, error) {
+	return RecoverKeyCtx(context.Background(), constr, Opts{})
+}
+
+// The phases of the attack, as reported to Opts.Progress.
+const (
+	PhaseRepair         = "repair"         // Only with Opts.Unknown or Opts.MaxRepairs. See Repair.
+	PhaseDummyRounds    = "dummy rounds"   // Step 1. Runs a decomposition on every middle round, so it's the longest.
+	PhaseDecomposition  = "decomposition"  // Step 2.
+	PhaseDisambiguation = "disambiguation" // Step 3.
+	PhaseKeyExtraction  = "key extraction" // Steps 4 and 5.
+)
+
+// RecoverKeyCtx is like RecoverKey, but runs on opts.Workers goroutines, reports its progress to opts.Progress, and can
+// be cancelled. If ctx is cancelled, the attack stops at the next step and ctx's error is returned.
+func RecoverKeyCtx(ctx context.Context, constr *chow.Construction, opts Opts) (key []byte, err error) {
+	// The decomposition panics if a round isn't an SPN of the expected shape.
+	defer func() {
+		if r := recover(); r != nil {
+			key, err = nil, fmt.Errorf("Attack failed! %v", r)
+		}
+	}()
+
+	a := &attack{ctx: ctx, opts: opts}
+
+	if opts.Unknown != nil || opts.MaxRepairs > 0 {
+		repaired, err := a.repair(constr)
+		if err != nil {
+			return nil, err
+		}
+		constr = &repaired
+	}
+
+	// Find the dummy rounds, and the first two consecutive real rounds after the first one.
+	rounds := len(constr.TBoxTyiTable)
+	dummy := make([]bool, rounds)
+
+	if err := a.parallel(PhaseDummyRounds, 0, rounds, rounds, func(r int) {
+		dummy[r] = network.IsDummy(tables{constr}, r)
+	}); err != nil {
+		return nil, err
 	}
 
+	dummies, first, aesRound := 0, -1, -1
+	for r := 0; r < rounds; r++ {
+		if dummy[r] {
+			dummies++
+			continue
+		}
+
+		// This is real round r-dummies of AES, counting from zero.
+		if real := r - dummies; first == -1 && real >= 2 && !dummy[r-1] {
+			first, aesRound = r-1, real-1
+		}
+	}
+
+	if constr.Rounds()-dummies != 10 {
+		return nil, errors.New("Only AES-128 constructions are supported!")
+	} else if first == -1 {
+		return nil, errors.New("Construction doesn't have two consecutive real rounds!")
+	}
+
+	return a.recoverKey(constr, first, aesRound)
+}
+
+// DummyRounds returns the indices of the dummy rounds in the middle tables of the construction.
+func DummyRounds(constr *chow.Construction) []int {
+	return network.DummyRounds(tables{constr})
+}
+
+// recoverKey runs the attack on the consecutive middle rounds r and r+1 of the construction, which compute rounds
+// aesRound and aesRound+1 of AES.
+func (a *attack) recoverKey(constr *chow.Construction, r, aesRound int) ([]byte, error) {
 	// Decomposition Phase
-	constr1 := aspn.DecomposeSPN(round1, cspn.SAS)
-	constr2 := aspn.DecomposeSPN(round2, cspn.SAS)
+	var decomposed [2]network.SAS
+
+	if err := a.parallel(PhaseDecomposition, 0, 2, 2, func(i int) {
+		decomposed[i] = network.DecomposeSAS(tables{constr}, r+i)
+	}); err != nil {
+		return nil, err
+	}
+	constr1, constr2 := decomposed[0], decomposed[1]
 
 	var (
 		leading, middle, trailing sboxLayer
-		left, right               = affineLayer(constr1[1].(encoding.BlockAffine)), affineLayer(constr2[1].(encoding.BlockAffine))
+		left, right               = affineLayer(constr1.Affine), affineLayer(constr2.Affine)
 	)
 
 	for pos := 0; pos < 16; pos++ {
-		leading[pos] = constr1[0].(encoding.ConcatenatedBlock)[pos]
-		middle[pos] = encoding.ComposedBytes{
-			constr1[2].(encoding.ConcatenatedBlock)[pos],
-			constr2[0].(encoding.ConcatenatedBlock)[common.ShiftRows(pos)],
-		}
-		trailing[pos] = constr2[2].(encoding.ConcatenatedBlock)[pos]
+		leading[pos] = constr1.Leading[pos]
+		middle[pos] = encoding.ComposedBytes{constr1.Trailing[pos], constr2.Leading[common.ShiftRows(pos)]}
+		trailing[pos] = constr2.Trailing[pos]
 	}
 
 	// Disambiguation Phase
@@ -109,14 +169,24 @@ func RecoverKey(constr *chow.Construction) []byte {
 	// We would push it into the S-boxes here if that wasn't the case.
 
 	// Move the constant off of the input and output of the S-boxes.
-	mcin, mcout := middle.cleanConstant()
+	mcin, mcout, err := middle.cleanConstant(func(f func(int)) error {
+		return a.parallel(PhaseDisambiguation, 0, 16, 20, f)
+	})
+	if err != nil {
+		return nil, err
+	}
 	mcin, mcout = left.Decode(mcin), right.Encode(mcout)
 
 	leading.rightCompose(encoding.DecomposeConcatenatedBlock(encoding.BlockAdditive(mcin)), common.NoShift)
 	trailing.leftCompose(encoding.DecomposeConcatenatedBlock(encoding.BlockAdditive(mcout)), common.NoShift)
 
 	// Move the multiplication off of the input and output of the middle S-boxes.
-	mlin, mlout := middle.cleanLinear()
+	mlin, mlout, err := middle.cleanLinear(func(f func(int)) error {
+		return a.parallel(PhaseDisambiguation, 16, 4, 20, f)
+	})
+	if err != nil {
+		return nil, err
+	}
 
 	leading.rightCompose(mlin, common.NoShift)
 	trailing.leftCompose(mlout, common.NoShift)
@@ -130,20 +200,13 @@ func RecoverKey(constr *chow.Construction) []byte {
 	// Extract the key from the leading S-boxes.
 	key := [16]byte{}
 
-	for pos := 0; pos < 16; pos++ {
-		for guess := 0; guess < 256; guess++ {
-			cand := encoding.ComposedBytes{
-				leading[pos], encoding.ByteAdditive(guess), encoding.InverseByte{sbox{}},
-			}
-
-			if isAS(cand) {
-				key[pos] = byte(guess)
-				break
-			}
-		}
+	if err := a.parallel(PhaseKeyExtraction, 0, 16, 16, func(pos int) {
+		key[pos], _ = network.RoundKeyByte(leading[pos])
+	}); err != nil {
+		return nil, err
 	}
 
 	key = left.Encode(key)
 
-	return backOneRound(backOneRound(key[:], 2), 1)
+	return network.MasterKey(key[:], aesRound+1), nil
 }
@@ -4,7 +4,13 @@ import (
 	"testing"
 
 	"bytes"
+	"context"
 	"crypto/rand"
+	"fmt"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+	"github.com/OpenWhiteBox/primitives/table"
 
 	"github.com/OpenWhiteBox/AES/constructions/chow"
 	"github.com/OpenWhiteBox/AES/constructions/common"
@@ -18,13 +24,127 @@ func TestRecoverKey(t *testing.T) {
 		key, key, common.IndependentMasks{common.RandomMask, common.RandomMask},
 	)
 
-	cand := RecoverKey(&constr)
+	cand, err := RecoverKey(&constr)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if !bytes.Equal(cand, key) {
 		t.Fatalf("Recovered wrong key!\nreal=%x\ncand=%x", key, cand)
 	}
 }
 
+func TestRecoverKeyDummyRounds(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := chow.GenerateEncryptionKeys(key, key, chow.Opts{
+		Masks:       common.IndependentMasks{common.RandomMask, common.RandomMask},
+		DummyRounds: 8,
+	})
+
+	if dummies := DummyRounds(&constr); len(dummies) != 8 {
+		t.Fatalf("Found wrong number of dummy rounds! %v != 8", len(dummies))
+	}
+
+	cand, err := RecoverKey(&constr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(cand, key) {
+		t.Fatalf("Recovered wrong key!\nreal=%x\ncand=%x", key, cand)
+	}
+}
+
+func TestRecoverKeyUnsupported(t *testing.T) {
+	key := make([]byte, 24)
+	rand.Read(key)
+
+	constr, _, _ := chow.GenerateEncryptionKeys(
+		key, key, common.IndependentMasks{common.RandomMask, common.RandomMask},
+	)
+
+	if _, err := RecoverKey(&constr); err == nil {
+		t.Fatalf("RecoverKey accepted an AES-192 construction!")
+	}
+}
+
+func TestRecoverKeyCtx(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := chow.GenerateEncryptionKeys(
+		key, key, common.IndependentMasks{common.RandomMask, common.RandomMask},
+	)
+
+	phases := []string{}
+	cand, err := RecoverKeyCtx(context.Background(), &constr, Opts{Workers: 4, Progress: func(phase string, percent int) {
+		if len(phases) == 0 || phases[len(phases)-1] != phase {
+			phases = append(phases, phase)
+		}
+	}})
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(cand, key) {
+		t.Fatalf("Recovered wrong key!\nreal=%x\ncand=%x", key, cand)
+	}
+
+	real := []string{PhaseDummyRounds, PhaseDecomposition, PhaseDisambiguation, PhaseKeyExtraction}
+	if fmt.Sprint(real) != fmt.Sprint(phases) {
+		t.Fatalf("Wrong phases reported! %v != %v", real, phases)
+	}
+
+	// Cancel the attack as soon as it reaches decomposition.
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err = RecoverKeyCtx(ctx, &constr, Opts{Progress: func(phase string, percent int) {
+		if phase == PhaseDecomposition {
+			cancel()
+		}
+	}})
+	if err != context.Canceled {
+		t.Fatalf("Attack wasn't cancelled! %v", err)
+	}
+}
+
+func TestParallel(t *testing.T) {
+	percents := []int{}
+	a := &attack{ctx: context.Background(), opts: Opts{Workers: 3, Progress: func(phase string, percent int) {
+		percents = append(percents, percent)
+	}}}
+
+	seen := make([]int, 100)
+	if err := a.parallel(PhaseKeyExtraction, 0, 100, 100, func(i int) { seen[i]++ }); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, n := range seen {
+		if n != 1 {
+			t.Fatalf("Step %v ran %v times!", i, n)
+		}
+	}
+	for i := 1; i < len(percents); i++ {
+		if percents[i] < percents[i-1] {
+			t.Fatalf("Progress went backwards! %v", percents)
+		}
+	}
+	if percents[len(percents)-1] != 100 {
+		t.Fatalf("Progress didn't finish at 100%%! %v", percents)
+	}
+
+	if err := a.parallel(PhaseKeyExtraction, 0, 10, 10, func(i int) { panic("Step failed!") }); err == nil {
+		t.Fatalf("A panic wasn't returned as an error!")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	a.ctx = ctx
+
+	if err := a.parallel(PhaseKeyExtraction, 0, 10, 10, func(i int) { t.Fatalf("Cancelled attack kept running!") }); err != context.Canceled {
+		t.Fatalf("Attack wasn't cancelled! %v", err)
+	}
+}
+
 // func TestMakeConstants(t *testing.T) {
 //   MC := gfmatrix.Matrix{
 //     gfmatrix.Row{2, 3, 1, 1},
@@ -83,3 +203,82 @@ func TestRecoverKey(t *testing.T) {
 //   }
 //   fmt.Println("}")
 // }
+
+func TestRecoverMasks(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, inputMask, _ := chow.GenerateEncryptionKeys(
+		key, key, common.IndependentMasks{common.RandomAffineMask, common.IdentityMask},
+	)
+
+	cand, err := RecoverInputMask(&constr, key, encoding.NewBlockAffine(matrix.GenerateIdentity(128), [16]byte{}))
+	if err != nil {
+		t.Fatal(err)
+	} else if x := [16]byte{1, 2, 3}; cand.Encode(x) != inputMask.Encode(x) {
+		t.Fatalf("Recovered wrong input mask!")
+	}
+
+	constr, _, outputMask := chow.GenerateEncryptionKeys(
+		key, key, common.IndependentMasks{common.IdentityMask, common.RandomAffineMask},
+	)
+
+	cand, err = RecoverOutputMask(&constr, key, encoding.NewBlockAffine(matrix.GenerateIdentity(128), [16]byte{}))
+	if err != nil {
+		t.Fatal(err)
+	} else if x := [16]byte{1, 2, 3}; cand.Encode(x) != outputMask.Encode(x) {
+		t.Fatalf("Recovered wrong output mask!")
+	}
+
+	// With the wrong key, the construction isn't AES under affine masks.
+	if _, err := RecoverOutputMask(&constr, make([]byte, 16), cand); err == nil {
+		t.Fatalf("Wrong key wasn't detected!")
+	}
+}
+
+func TestRepair(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := chow.GenerateEncryptionKeys(key, key, common.IndependentMasks{common.RandomMask, common.RandomMask})
+	damaged := constr
+	damaged.HighXORTable = append([][32][3]table.Nibble(nil), constr.HighXORTable...)
+
+	// Lose 24 entries and corrupt 18 more in each of two XOR tables.
+	unknown := func(id chow.TableID, index byte) bool {
+		return id.Kind == chow.HighXORTable && id.Round < 2 && id.Position == 7 && id.Gate == 1 && byte(37*index) < 24
+	}
+	for round := 0; round < 2; round++ {
+		slot := constr.Slot(round)
+		corrupted := make(table.ParsedByte, 256)
+
+		for i := range corrupted {
+			corrupted[i] = constr.HighXORTable[slot][7][1].Get(byte(i))
+			if byte(101*i) < 24 && byte(37*i) >= 24 {
+				corrupted[i] ^= 1
+			}
+		}
+		damaged.HighXORTable[slot][7][1] = corrupted
+	}
+
+	if _, changed, _ := RepairXORTable(constr.HighXORTable[0][0][0], nil); changed != 0 {
+		t.Fatalf("Repair changed an intact XOR table! %v entries changed", changed)
+	}
+
+	if _, err := Repair(&damaged, unknown, 83); err == nil {
+		t.Fatalf("Repair changed more entries than allowed!")
+	}
+
+	repaired, err := Repair(&damaged, unknown, 84)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+	constr.Encrypt(real, key)
+	repaired.Encrypt(cand, key)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
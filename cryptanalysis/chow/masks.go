@@ -0,0 +1,87 @@
+package chow
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+// The external masks of a white-box can't be read off of its tables the way the key can: RecoverKey strips the
+// encodings of two middle rounds, but the masks are merged into the first and last rounds under encodings the attack
+// never looks at. With the key in hand, though, a white-box is just E = outputMask(AES(inputMask(x))), so as soon as one
+// of the masks is known, the other is an affine function of what E computes and can be sampled from oracle access
+// alone. That's the common case in practice: one side of a deployed white-box usually has to be in the clear (the
+// ciphertext that goes on the wire, or the plaintext that's read off of disk), leaving an IdentityMask.
+//
+// If neither mask is known, they're only determined up to each other: any invertible affine inputMask gives a matching
+// outputMask = E(inputMask^(-1)(AES^(-1)(x))), and telling the real pair apart needs the encodings of the first or last
+// round.
+
+// RecoverInputMask returns the input mask of the white-box constr with the given AES key, given its output mask, using
+// constr only as an encryption oracle. The mask returned is the one key generation returned: constr computes
+// outputMask(AES(inputMask(x))). An error is returned if constr isn't AES under affine masks.
+func RecoverInputMask(constr cipher.Block, key []byte, outputMask encoding.BlockAffine) (encoding.BlockAffine, error) {
+	aes := saes.Construction{key}
+
+	return sampleAffine(func(x [16]byte) (out [16]byte) {
+		constr.Encrypt(out[:], x[:])
+		out = outputMask.Decode(out)
+		aes.Decrypt(out[:], out[:])
+
+		return out
+	})
+}
+
+// RecoverOutputMask returns the output mask of the white-box constr with the given AES key, given its input mask, using
+// constr only as an encryption oracle. An error is returned if constr isn't AES under affine masks.
+func RecoverOutputMask(constr cipher.Block, key []byte, inputMask encoding.BlockAffine) (encoding.BlockAffine, error) {
+	aes := saes.Construction{key}
+
+	return sampleAffine(func(x [16]byte) (out [16]byte) {
+		out = x
+		aes.Decrypt(out[:], out[:])
+		out = inputMask.Decode(out)
+		constr.Encrypt(out[:], out[:])
+
+		return out
+	})
+}
+
+// sampleAffine returns f, if f is an invertible affine transformation of the block. It reads the constant part off of
+// f(0) and each column of the linear part off of f at one basis vector, and then checks the result against f at random
+// points.
+func sampleAffine(f func([16]byte) [16]byte) (encoding.BlockAffine, error) {
+	constant := f([16]byte{})
+
+	linear := matrix.GenerateEmpty(128, 128)
+	for col := 0; col < 128; col++ {
+		x := [16]byte{}
+		x[col/8] = 1 << uint(col%8)
+
+		y := f(x)
+		for row := 0; row < 128; row++ {
+			linear[row].SetBit(col, (y[row/8]^constant[row/8])>>uint(row%8)&1 == 1)
+		}
+	}
+
+	if _, ok := linear.Invert(); !ok {
+		return encoding.BlockAffine{}, errors.New("Mask isn't invertible!")
+	}
+	out := encoding.NewBlockAffine(linear, constant)
+
+	for i := 0; i < 16; i++ {
+		x := [16]byte{}
+		rand.Read(x[:])
+
+		if out.Encode(x) != f(x) {
+			return encoding.BlockAffine{}, errors.New("Construction isn't AES under affine masks!")
+		}
+	}
+
+	return out, nil
+}
@@ -0,0 +1,110 @@
+package chow
+
+import (
+	"context"
+	"fmt"
+	"runtime"
+	"sync"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+)
+
+// Opts configures a run of the attack with RecoverKeyCtx.
+type Opts struct {
+	// Workers is the number of goroutines to run the attack on, or zero for runtime.GOMAXPROCS(0). The dummy round search,
+	// the two decompositions, and the brute-force searches on the S-boxes are independent per round or per byte position,
+	// and are spread over the workers.
+	Workers int
+
+	// Progress, if non-nil, is called with the current phase and how far into it the attack is, from 0 to 100 percent.
+	// It's never called concurrently, even with more than one worker.
+	Progress func(phase string, percent int)
+
+	// Unknown, if non-nil, reports which entries of the construction's tables couldn't be read, for example because they
+	// were dumped from a partially-readable process. MaxRepairs is the most entries that may be unknown or corrupted. If
+	// either is set, the XOR tables of the middle rounds are run through Repair before the attack, which fills in the
+	// unknown entries and outvotes the corrupted ones. Only XOR table entries may be unknown.
+	Unknown    func(id chow.TableID, index byte) bool
+	MaxRepairs int
+}
+
+// attack is the state of one run of RecoverKeyCtx.
+type attack struct {
+	ctx  context.Context
+	opts Opts
+}
+
+// report reports that done of the total steps of phase are finished, and returns ctx's error if the attack should stop.
+func (a *attack) report(phase string, done, total int) error {
+	if a.opts.Progress != nil {
+		a.opts.Progress(phase, 100*done/total)
+	}
+
+	return a.ctx.Err()
+}
+
+// parallel calls f(i) for every i in [0, n) on the attack's workers, and returns the first error. A panic in f is
+// returned as an error, and no new calls are started once one fails or ctx is cancelled. Progress is reported as steps
+// base through base+n of total steps in phase, so that several calls can share one phase.
+func (a *attack) parallel(phase string, base, n, total int, f func(i int)) error {
+	workers := a.opts.Workers
+	if workers <= 0 {
+		workers = runtime.GOMAXPROCS(0)
+	}
+	if workers > n {
+		workers = n
+	}
+
+	var (
+		mu         sync.Mutex
+		wg         sync.WaitGroup
+		next, done int
+		err        = a.report(phase, base, total)
+	)
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				mu.Lock()
+				if err != nil || next == n {
+					mu.Unlock()
+					return
+				}
+				i := next
+				next++
+				mu.Unlock()
+
+				callErr := call(f, i)
+
+				mu.Lock()
+				done++
+				if callErr == nil {
+					callErr = a.report(phase, base+done, total)
+				}
+				if err == nil {
+					err = callErr
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+
+	wg.Wait()
+	return err
+}
+
+// call calls f(i), and returns a panic as an error.
+func call(f func(int), i int) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("Attack failed! %v", r)
+		}
+	}()
+
+	f(i)
+	return nil
+}
@@ -0,0 +1,199 @@
+package chow
+
+import (
+	"context"
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+)
+
+// An XOR table computes e(d1(a) ^ d2(b)) from the nibbles a and b, for some nibble encodings d1, d2, and e. That's very
+// redundant: for any rows x and y and columns b and c,
+//
+//	d1(x) ^ d2(c) = (d1(x) ^ d2(b)) ^ (d1(y) ^ d2(c)) ^ (d1(y) ^ d2(b))
+//
+// so entry (x, c) is a fixed function of entries (x, b), (y, c), and (y, b)--the same function for every x, y, b, and c.
+// The function is learned from every quadrangle of entries that are known, by majority vote, and then every entry is
+// re-derived from the 256 quadrangles through it, again by majority vote. Unknown entries are filled in, and corrupted
+// ones are outvoted, as long as most of the table is intact.
+
+// RepairXORTable returns the nibble XOR table t with its unknown and corrupted entries fixed, and how many entries it
+// changed. Unknown, if non-nil, reports which indices of t couldn't be read; they're never looked up. An error is returned
+// if too little of the table is left to tell what it computes.
+func RepairXORTable(t table.Nibble, unknown func(index byte) bool) (table.Nibble, int, error) {
+	var (
+		entry [16][16]byte
+		known [16][16]bool
+	)
+
+	for a := 0; a < 16; a++ {
+		for b := 0; b < 16; b++ {
+			if index := byte(a<<4 | b); unknown == nil || !unknown(index) {
+				entry[a][b], known[a][b] = t.Get(index)&0x0f, true
+			}
+		}
+	}
+
+	// Learn f, where entry (x, c) is f(entry (x, b), entry (y, c), entry (y, b)).
+	votes := make([][16]int, 16*16*16)
+
+	for x := 0; x < 16; x++ {
+		for y := 0; y < 16; y++ {
+			for b := 0; b < 16; b++ {
+				if !known[x][b] || !known[y][b] {
+					continue
+				}
+
+				for c := 0; c < 16; c++ {
+					if known[y][c] && known[x][c] {
+						votes[triple(entry[x][b], entry[y][c], entry[y][b])][entry[x][c]]++
+					}
+				}
+			}
+		}
+	}
+
+	f := make([]int, len(votes))
+	for i := range votes {
+		f[i] = majority(votes[i])
+	}
+
+	// Re-derive every entry.
+	out, changed := make(table.ParsedByte, 256), 0
+
+	for x := 0; x < 16; x++ {
+		for c := 0; c < 16; c++ {
+			tally := [16]int{}
+
+			for y := 0; y < 16; y++ {
+				for b := 0; b < 16; b++ {
+					if !known[x][b] || !known[y][c] || !known[y][b] {
+						continue
+					} else if v := f[triple(entry[x][b], entry[y][c], entry[y][b])]; v >= 0 {
+						tally[v]++
+					}
+				}
+			}
+
+			v := majority(tally)
+			if v < 0 {
+				return nil, 0, errors.New("XOR table can't be repaired!")
+			} else if !known[x][c] || byte(v) != entry[x][c] {
+				changed++
+			}
+
+			out[x<<4|c] = byte(v)
+		}
+	}
+
+	// Every row and column of an XOR table is a permutation.
+	for i := 0; i < 16; i++ {
+		var row, col [16]bool
+
+		for j := 0; j < 16; j++ {
+			row[out[i<<4|j]], col[out[j<<4|i]] = true, true
+		}
+		for j := 0; j < 16; j++ {
+			if !row[j] || !col[j] {
+				return nil, 0, errors.New("XOR table can't be repaired!")
+			}
+		}
+	}
+
+	return out, changed, nil
+}
+
+// triple packs three nibbles into one index.
+func triple(u, v, w byte) int { return int(u)<<8 | int(v)<<4 | int(w) }
+
+// majority returns the nibble with the most votes, or -1 if there are none.
+func majority(votes [16]int) int {
+	best := -1
+
+	for v, n := range votes {
+		if n > 0 && (best == -1 || n > votes[best]) {
+			best = v
+		}
+	}
+
+	return best
+}
+
+// Repair returns a copy of constr with the XOR tables of its middle rounds--the ones the attack reads--run through
+// RepairXORTable. Unknown, if non-nil, reports which entries of which tables couldn't be read. An error is returned if an
+// entry of any other table of the middle rounds is unknown, since only XOR tables have the redundancy to repair them,
+// or if more than maxRepairs entries had to be changed in total. constr isn't modified.
+func Repair(constr *chow.Construction, unknown func(id chow.TableID, index byte) bool, maxRepairs int) (chow.Construction, error) {
+	a := &attack{ctx: context.Background(), opts: Opts{Unknown: unknown, MaxRepairs: maxRepairs}}
+	return a.repair(constr)
+}
+
+// repair is Repair, run on the attack's workers and reporting its progress as PhaseRepair.
+func (a *attack) repair(constr *chow.Construction) (chow.Construction, error) {
+	out := *constr
+	out.HighXORTable = append([][32][3]table.Nibble(nil), constr.HighXORTable...)
+	out.LowXORTable = append([][32][3]table.Nibble(nil), constr.LowXORTable...)
+	out.HighWideXORTable, out.LowWideXORTable = nil, nil
+
+	unknown := a.opts.Unknown
+	if unknown == nil {
+		unknown = func(chow.TableID, byte) bool { return false }
+	}
+
+	rounds := len(constr.TBoxTyiTable)
+	changed, errs := make([]int, rounds), make([]error, rounds)
+
+	for round := 0; round < rounds; round++ {
+		for pos := 0; pos < 16; pos++ {
+			for index := 0; index < 256; index++ {
+				if unknown(chow.TableID{chow.TBoxTyiTable, byte(round), byte(pos), 0}, byte(index)) ||
+					unknown(chow.TableID{chow.MBInverseTable, byte(round), byte(pos), 0}, byte(index)) {
+					return chow.Construction{}, errors.New("Only XOR table entries can be repaired!")
+				}
+			}
+		}
+	}
+
+	err := a.parallel(PhaseRepair, 0, rounds, rounds, func(round int) {
+		slot, r := constr.Slot(round), byte(round)
+
+		for pos := 0; pos < 32; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				for _, kind := range []chow.TableKind{chow.HighXORTable, chow.LowXORTable} {
+					id := chow.TableID{kind, r, byte(pos), byte(gate)}
+
+					tables := &out.HighXORTable[slot]
+					if kind == chow.LowXORTable {
+						tables = &out.LowXORTable[slot]
+					}
+
+					repaired, n, err := RepairXORTable(tables[pos][gate], func(index byte) bool { return unknown(id, index) })
+					if err != nil {
+						errs[round] = err
+						return
+					}
+
+					tables[pos][gate], changed[round] = repaired, changed[round]+n
+				}
+			}
+		}
+	})
+	if err != nil {
+		return chow.Construction{}, err
+	}
+
+	total := 0
+	for round, n := range changed {
+		if errs[round] != nil {
+			return chow.Construction{}, errs[round]
+		}
+		total += n
+	}
+	if total > a.opts.MaxRepairs {
+		return chow.Construction{}, errors.New("Too many table entries are missing or corrupted!")
+	}
+
+	return out, nil
+}
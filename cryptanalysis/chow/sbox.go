@@ -6,33 +6,9 @@ import (
 	"github.com/OpenWhiteBox/primitives/number"
 
 	"github.com/OpenWhiteBox/AES/constructions/common"
-	"github.com/OpenWhiteBox/AES/constructions/saes"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/network"
 )
 
-// sbox is a Byte encoding of AES's "standard" S-box.
-type sbox struct{}
-
-func (sb sbox) Encode(in byte) byte {
-	constr := saes.Construction{}
-	return constr.SubByte(in)
-}
-
-func (s sbox) Decode(in byte) byte {
-	constr := saes.Construction{}
-	return constr.UnSubByte(in)
-}
-
-// invert is a Byte encoding of inversion over GF(2^8)
-type invert struct{}
-
-func (inv invert) Encode(in byte) byte {
-	return byte(number.ByteFieldElem(in).Invert())
-}
-
-func (inv invert) Decode(in byte) byte {
-	return byte(number.ByteFieldElem(in).Invert())
-}
-
 // sboxLayer implements methods for disambiguating an S-box layer of the SPN.
 type sboxLayer encoding.ConcatenatedBlock
 
@@ -65,32 +41,34 @@ func (sbl *sboxLayer) rightCompose(right encoding.ConcatenatedBlock, shift func(
 }
 
 // cleanConstant finds the constant error on the input and output of each middle S-box. It removes it from the S-box and
-// returns it.
+// returns it. The S-boxes are searched independently, with run, which calls its argument on each position.
 //
 // Note: This function will also strip the final addition of 0x63 from AES's "standard" S-box.
-func (sbl *sboxLayer) cleanConstant() (input, output [16]byte) {
-	for pos := 0; pos < 16; pos++ {
+func (sbl *sboxLayer) cleanConstant(run func(func(pos int)) error) (input, output [16]byte, err error) {
+	err = run(func(pos int) {
 		in, out := sbl.findConstant(pos)
 
 		input[pos], output[common.ShiftRows(pos)] = in, out
 		(*sbl)[pos] = encoding.ComposedBytes{
 			encoding.ByteAdditive(in), sbl[pos], encoding.ByteAdditive(out),
 		}
-	}
+	})
 
 	return
 }
 
 // cleanLinear finds the linear error on the input and output of each middle S-box (after the constant error has been
 // removed). It removes it from the S-box (leaving AES's "standard" S-box, without the 0x63 constant addition) and
-// returns it.
-func (sbl *sboxLayer) cleanLinear() (input, output encoding.ConcatenatedBlock) {
-	for pos := 0; pos < 16; pos += 4 {
-		in, out := sbl.findLinear(pos)
+// returns it. The columns are searched independently, with run, which calls its argument on each column.
+func (sbl *sboxLayer) cleanLinear(run func(func(col int)) error) (input, output encoding.ConcatenatedBlock, err error) {
+	if err = run(func(col int) {
+		in, out := sbl.findLinear(4 * col)
 
-		for i := pos; i < pos+4; i++ {
+		for i := 4 * col; i < 4*col+4; i++ {
 			input[i], output[i] = encoding.InverseByte{in}, out
 		}
+	}); err != nil {
+		return
 	}
 
 	for pos := 0; pos < 16; pos++ {
@@ -106,7 +84,7 @@ func (sbl *sboxLayer) cleanLinear() (input, output encoding.ConcatenatedBlock) {
 func (sbl *sboxLayer) findConstant(pos int) (byte, byte) {
 	for b := 0; b < 256; b++ { // Try to guess the constant on the input.
 		correction := encoding.ByteAdditive(b)
-		vec := encoding.ComposedBytes{invert{}, correction, sbl[pos]}
+		vec := encoding.ComposedBytes{network.Inversion{}, correction, sbl[pos]}
 
 		// If the guess was correct, removing the constant and a field inversion from the input will result in an affine
 		// function (the linear error, multiplication by an element of GF(2^8), moves through inversion).
@@ -135,7 +113,7 @@ func (sbl *sboxLayer) findLinear(pos int) (encoding.ByteMultiplication, encoding
 		matrix.Row{0xF8},
 	})
 
-	real := encoding.ComposedBytes{invert{}, sbl[pos]}
+	real := encoding.ComposedBytes{network.Inversion{}, sbl[pos]}
 
 	for a := 1; a < 256; a++ {
 		for c := 1; c < 256; c++ {
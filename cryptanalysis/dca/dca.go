@@ -0,0 +1,165 @@
+// Package dca implements Differential Computation Analysis: a side-channel attack that records which values a white-box
+// reads from its tables while it encrypts, and then runs the statistics of a power analysis on those software traces. It
+// needs no knowledge of how the construction is built, only the traces and the plaintexts that produced them, which is
+// why it's the attack practitioners actually face.
+//
+// The traces are bit vectors, and each key byte is recovered by correlating every bit of them with every bit of the
+// first round's S-box output, S(plaintext ^ key), for each guess of the key byte. Encodings that mix many bits together
+// before they're stored--like Chow's mixing bijections or random external masks--spread that correlation out until it's
+// lost in the noise, so the attack succeeds against some configurations of a construction and not others.
+//
+// "Differential Computation Analysis: Hiding your White-Box Designs is Not Enough" by Joppe W. Bos, Charles Hubain, Wil
+// Michiels, and Philippe Teuwen, https://eprint.iacr.org/2015/753
+package dca
+
+import (
+	"crypto/rand"
+	"math"
+
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+// Traces is a set of execution traces, with the plaintext that produced each one.
+type Traces struct {
+	Plaintexts [][16]byte
+	Samples    [][]byte
+}
+
+// Collect encrypts n random plaintexts with the target and returns their traces.
+func Collect(target Target, n int) (out Traces) {
+	out.Plaintexts, out.Samples = make([][16]byte, n), make([][]byte, n)
+	dst := make([]byte, 16)
+
+	for i := 0; i < n; i++ {
+		rand.Read(out.Plaintexts[i][:])
+		out.Samples[i] = target.Trace(dst, out.Plaintexts[i][:])
+	}
+
+	return
+}
+
+// RecoverKey returns the most likely first round key of the white-box the traces were collected from. For AES-128, that's
+// the key itself.
+func RecoverKey(traces Traces) []byte {
+	out := make([]byte, 16)
+
+	for pos := 0; pos < 16; pos++ {
+		out[pos], _ = RecoverKeyByte(traces, pos)
+	}
+
+	return out
+}
+
+// RecoverKeyByte returns the most likely value of byte pos of the first round key, along with the absolute correlation
+// between the best sample of the traces and the S-box output under that guess. A correlation that stands out from the
+// other guesses' means the attack worked; one near 4/sqrt(len(traces.Samples)) is noise.
+func RecoverKeyByte(traces Traces, pos int) (guess byte, correlation float64) {
+	n := int64(len(traces.Samples))
+	if n == 0 {
+		return 0, 0
+	}
+	bits := 8 * len(traces.Samples[0])
+
+	// count[v] is the number of traces where the plaintext byte is v, and ones[j][v] is how many of those have bit j set.
+	count, ones := [256]int64{}, make([][256]int64, bits)
+
+	for t, trace := range traces.Samples {
+		v := traces.Plaintexts[t][pos]
+		count[v]++
+
+		for i, x := range trace[:bits/8] {
+			for b := 0; b < 8; b++ {
+				if x>>uint(b)&1 == 1 {
+					ones[8*i+b][v]++
+				}
+			}
+		}
+	}
+
+	// The number of traces where S-box output bit b is set under guess k is a convolution of count with the S-box over
+	// XOR, as is the number where it's set along with sample bit j. Both are computed for every guess at once with the
+	// Walsh-Hadamard transform.
+	selected := [8][256]int64{}
+
+	walsh(&count)
+	for b := 0; b < 8; b++ {
+		selected[b] = count
+		multiply(&selected[b], &sboxBits[b])
+		unwalsh(&selected[b])
+	}
+
+	best := 0.0
+
+	for j := 0; j < bits; j++ {
+		set := int64(0)
+		for _, c := range ones[j] {
+			set += c
+		}
+		if set == 0 || set == n {
+			continue // The sample is constant, and can't correlate with anything.
+		}
+
+		walsh(&ones[j])
+
+		for b := 0; b < 8; b++ {
+			both := ones[j]
+			multiply(&both, &sboxBits[b])
+			unwalsh(&both)
+
+			for k := 0; k < 256; k++ {
+				a := selected[b][k]
+				if a == 0 || a == n {
+					continue
+				}
+
+				cov := float64(n*both[k] - a*set)
+				if score := cov * cov / (float64(a*(n-a)) * float64(set*(n-set))); score > best {
+					best, guess = score, byte(k)
+				}
+			}
+		}
+	}
+
+	return guess, math.Sqrt(best)
+}
+
+// sboxBits[b] is the Walsh-Hadamard transform of bit b of AES' S-box.
+var sboxBits = func() (out [8][256]int64) {
+	constr := saes.Construction{}
+
+	for b := 0; b < 8; b++ {
+		for x := 0; x < 256; x++ {
+			out[b][x] = int64(constr.SubByte(byte(x)) >> uint(b) & 1)
+		}
+		walsh(&out[b])
+	}
+
+	return
+}()
+
+// walsh computes the Walsh-Hadamard transform of f in place.
+func walsh(f *[256]int64) {
+	for h := 1; h < 256; h *= 2 {
+		for i := 0; i < 256; i += 2 * h {
+			for j := i; j < i+h; j++ {
+				f[j], f[j+h] = f[j]+f[j+h], f[j]-f[j+h]
+			}
+		}
+	}
+}
+
+// unwalsh computes the inverse Walsh-Hadamard transform of f in place.
+func unwalsh(f *[256]int64) {
+	walsh(f)
+
+	for i := range f {
+		f[i] /= 256
+	}
+}
+
+// multiply sets f to the pointwise product of f and g.
+func multiply(f, g *[256]int64) {
+	for i := range f {
+		f[i] *= g[i]
+	}
+}
@@ -0,0 +1,43 @@
+package dca
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+func TestInstrument(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := chow.GenerateEncryptionKeys(key, key, common.SameMasks(common.IdentityMask))
+	target := Instrument(&constr, 1)
+
+	real, cand := make([]byte, 16), make([]byte, 16)
+	constr.Encrypt(real, key)
+
+	if trace := target.Trace(cand, key); len(trace) != 2*64+2*96 {
+		t.Fatalf("Trace has the wrong length! %v", len(trace))
+	} else if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+}
+
+func TestRecoverKey(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := chow.GenerateEncryptionKeys(key, key, chow.Opts{
+		Masks:            common.SameMasks(common.IdentityMask),
+		MixingBijections: chow.NoMixingBijections,
+	})
+
+	cand := RecoverKey(Collect(Instrument(&constr, 1), 500))
+
+	if !bytes.Equal(key, cand) {
+		t.Fatalf("Recovered wrong key!\nreal=%x\ncand=%x", key, cand)
+	}
+}
@@ -0,0 +1,50 @@
+package dca
+
+import (
+	"sync"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+)
+
+// Target is a white-box that records a software execution trace of each block it encrypts.
+type Target interface {
+	// Trace encrypts the first block in src into dst, like Encrypt, and returns the trace of the encryption.
+	Trace(dst, src []byte) []byte
+}
+
+// chowTarget keeps the values read from the middle tables of the first rounds of a traced Chow construction.
+type chowTarget struct {
+	mu     sync.Mutex
+	constr *chow.TracedConstruction
+	rounds int
+}
+
+// Instrument returns a Target that computes the same thing as constr and traces every value read from the middle tables
+// of its first rounds rounds: the T-Box/Tyi Tables, the MB^(-1) Tables, and the XOR tables after each. These are the
+// rounds that touch the first round key, which is what RecoverKey targets; one is enough for a construction without
+// dummy rounds, but dummy rounds can come first, and then the trace has to be long enough to reach the first real one.
+//
+// constr isn't modified. Trace may be called from any number of goroutines, but only runs one encryption at a time.
+func Instrument(constr *chow.Construction, rounds int) Target {
+	return &chowTarget{constr: chow.NewTracedConstruction(constr), rounds: rounds}
+}
+
+func (ct *chowTarget) Trace(dst, src []byte) (out []byte) {
+	ct.mu.Lock()
+	defer ct.mu.Unlock()
+
+	ct.constr.Encrypt(dst, src)
+
+	for _, l := range ct.constr.Trace() {
+		switch l.Table.Kind {
+		case chow.InputMaskTable, chow.InputXORTable, chow.TBoxOutputMaskTable, chow.OutputXORTable:
+			continue
+		}
+
+		if int(l.Table.Round) < ct.rounds {
+			out = append(out, l.Value()...)
+		}
+	}
+
+	return out
+}
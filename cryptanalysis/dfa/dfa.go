@@ -0,0 +1,156 @@
+// Package dfa implements Differential Fault Analysis of white-box AES: an attacker who can corrupt the tables of a
+// white-box compares its correct and faulty outputs on the same inputs, and solves for the last round key.
+//
+// The attack is Piret and Quisquater's. A fault that changes one byte of the state anywhere between the MixColumns of
+// rounds 8 and 9 is spread by the MixColumns of round 9 into a difference of (2f, f, f, 3f), in some rotation, across
+// one column, which the last round's S-boxes then turn into a difference in four bytes of the ciphertext. Each faulty
+// ciphertext leaves about 2^8 candidates for those four bytes of the last round key, and two are almost always enough to
+// pin them down. Inject and Collect form a harness for producing the faults in a Chow white-box.
+//
+// Nothing about the attack depends on the internal encodings of the construction--only that the ciphertexts are real
+// AES outputs, so a random external output mask stops it. Dummy rounds make it harder to find the round to fault.
+//
+// "A Differential Fault Attack Technique against SPN Structures, with Application to the AES and KHAZAD" by Gilles Piret
+// and Jean-Jacques Quisquater, https://doi.org/10.1007/978-3-540-45238-6_7
+package dfa
+
+import (
+	"errors"
+
+	"github.com/OpenWhiteBox/primitives/number"
+
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/network"
+)
+
+// mixColumn[row] is the column of MixColumns that a difference in the given row of its input is multiplied by.
+var mixColumn = [4][4]byte{{2, 1, 1, 3}, {3, 2, 1, 1}, {1, 3, 2, 1}, {1, 1, 3, 2}}
+
+// Pair is the correct and faulty ciphertext of the same plaintext.
+type Pair struct {
+	Correct, Faulty [16]byte
+}
+
+// positions returns the bytes of the ciphertext that a fault in the given column before the last MixColumns reaches:
+// row r of the column is moved by the last ShiftRows to position positions(col)[r].
+func positions(col int) (out [4]int) {
+	for row := 0; row < 4; row++ {
+		out[row] = 4*((col-row+4)%4) + row
+	}
+
+	return
+}
+
+// column returns the column of the state that the pair's fault was in, or -1 if its difference doesn't look like a
+// fault in a single byte before the last MixColumns.
+func (p Pair) column() int {
+	for col := 0; col < 4; col++ {
+		pos, ok := positions(col), true
+
+		for i := 0; i < 16; i++ {
+			inColumn := i == pos[0] || i == pos[1] || i == pos[2] || i == pos[3]
+			if (p.Correct[i] != p.Faulty[i]) != inColumn {
+				ok = false
+				break
+			}
+		}
+
+		if ok {
+			return col
+		}
+	}
+
+	return -1
+}
+
+// candidates returns every value of the four bytes of the last round key at positions(col) that explains the pair.
+func (p Pair) candidates(col int) map[[4]byte]bool {
+	constr, pos := saes.Construction{}, positions(col)
+
+	// byDiff[row][d] is every guess of key byte pos[row] that gives a difference of d before the last S-box.
+	byDiff := [4][256][]byte{}
+	for row := 0; row < 4; row++ {
+		for k := 0; k < 256; k++ {
+			d := constr.UnSubByte(p.Correct[pos[row]]^byte(k)) ^ constr.UnSubByte(p.Faulty[pos[row]]^byte(k))
+			byDiff[row][d] = append(byDiff[row][d], byte(k))
+		}
+	}
+
+	out := make(map[[4]byte]bool)
+
+	for faultRow := 0; faultRow < 4; faultRow++ {
+		for f := 1; f < 256; f++ {
+			var guesses [4][]byte
+			for row := 0; row < 4; row++ {
+				d := number.ByteFieldElem(mixColumn[faultRow][row]).Mul(number.ByteFieldElem(f))
+				guesses[row] = byDiff[row][d]
+			}
+
+			for _, k0 := range guesses[0] {
+				for _, k1 := range guesses[1] {
+					for _, k2 := range guesses[2] {
+						for _, k3 := range guesses[3] {
+							out[[4]byte{k0, k1, k2, k3}] = true
+						}
+					}
+				}
+			}
+		}
+	}
+
+	return out
+}
+
+// RecoverLastRoundKey returns the last round key of the white-box that the pairs were collected from. Pairs whose
+// ciphertexts are equal, or that differ anywhere other than in the four bytes one column's fault reaches, are ignored.
+// An error is returned if the usable pairs don't determine every byte of the key.
+func RecoverLastRoundKey(pairs []Pair) (key [16]byte, err error) {
+	var found [4]map[[4]byte]bool
+
+	for _, p := range pairs {
+		col := p.column()
+		if col == -1 {
+			continue
+		} else if found[col] != nil && len(found[col]) == 1 {
+			continue
+		}
+
+		cands := p.candidates(col)
+		if found[col] == nil {
+			found[col] = cands
+			continue
+		}
+
+		for cand := range found[col] {
+			if !cands[cand] {
+				delete(found[col], cand)
+			}
+		}
+	}
+
+	for col := 0; col < 4; col++ {
+		if len(found[col]) != 1 {
+			return key, errors.New("Faults don't determine the last round key!")
+		}
+
+		pos := positions(col)
+		for cand := range found[col] {
+			for row := 0; row < 4; row++ {
+				key[pos[row]] = cand[row]
+			}
+		}
+	}
+
+	return key, nil
+}
+
+// RecoverKey returns the AES-128 key of the white-box that the pairs were collected from, by recovering the last round
+// key and walking it back through the key schedule.
+func RecoverKey(pairs []Pair) ([]byte, error) {
+	lastRoundKey, err := RecoverLastRoundKey(pairs)
+	if err != nil {
+		return nil, err
+	}
+
+	return network.MasterKey(lastRoundKey[:], 10), nil
+}
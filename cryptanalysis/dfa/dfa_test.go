@@ -0,0 +1,63 @@
+package dfa
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// collect faults the second to last round of constr once in each column, and returns n pairs from each fault.
+func collect(constr *chow.Construction, n int) (out []Pair) {
+	for col := 0; col < 4; col++ {
+		faulty := Inject(constr, len(constr.TBoxTyiTable)-1, 4*col+col, 0x01)
+		out = append(out, Collect(constr, &faulty, n)...)
+	}
+
+	return
+}
+
+func TestRecoverKey(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := chow.GenerateEncryptionKeys(
+		key, key, common.IndependentMasks{common.RandomMask, common.IdentityMask},
+	)
+
+	cand, err := RecoverKey(collect(&constr, 4))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(key, cand) {
+		t.Fatalf("Recovered wrong key!\nreal=%x\ncand=%x", key, cand)
+	}
+}
+
+func TestOutputMask(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := chow.GenerateEncryptionKeys(
+		key, key, common.IndependentMasks{common.IdentityMask, common.RandomMask},
+	)
+
+	if _, err := RecoverKey(collect(&constr, 4)); err == nil {
+		t.Fatalf("Attack succeeded through a random output mask!")
+	}
+}
+
+func TestInject(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := chow.GenerateEncryptionKeys(key, key, common.SameMasks(common.IdentityMask))
+	Inject(&constr, 0, 0, 0x80)
+
+	if _, ok := constr.TBoxTyiTable[0][0].(flippedWord); ok {
+		t.Fatalf("Inject modified the construction!")
+	}
+}
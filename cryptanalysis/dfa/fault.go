@@ -0,0 +1,55 @@
+package dfa
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+)
+
+// flippedWord is a table where every entry has been swapped with another one: reading index i gets the entry at i^flip.
+type flippedWord struct {
+	table.Word
+	flip byte
+}
+
+func (fw flippedWord) Get(i byte) [4]byte { return fw.Word.Get(i ^ fw.flip) }
+
+// Inject returns a copy of constr with a fault in the T-Box/Tyi Table at the given position of the given middle round,
+// counted in the order the rounds are computed, dummy rounds included. Every entry of the table is swapped with the
+// entry at its index XOR flip, which must be nonzero, so every encryption reads a wrong value out of it. This models an
+// attacker who overwrites the table in memory; the integrity MAC of a serialized key doesn't cover the parsed tables,
+// so it doesn't stop this.
+//
+// A fault in the second to last round of AES--round len(constr.TBoxTyiTable)-1, without dummy rounds--is what
+// RecoverKey needs. constr isn't modified.
+func Inject(constr *chow.Construction, round, pos int, flip byte) chow.Construction {
+	if flip == 0 {
+		panic("Fault doesn't change anything!")
+	}
+
+	out := *constr
+	out.TBoxTyiTable = append([][16]table.Word(nil), constr.TBoxTyiTable...)
+
+	slot := out.Slot(round)
+	out.TBoxTyiTable[slot][pos] = flippedWord{out.TBoxTyiTable[slot][pos], flip}
+
+	return out
+}
+
+// Collect encrypts n random plaintexts with both the correct and the faulty white-box, and returns the ciphertext pairs.
+func Collect(correct, faulty cipher.Block, n int) []Pair {
+	out := make([]Pair, n)
+	src := make([]byte, 16)
+
+	for i := range out {
+		rand.Read(src)
+
+		correct.Encrypt(out[i].Correct[:], src)
+		faulty.Encrypt(out[i].Faulty[:], src)
+	}
+
+	return out
+}
@@ -0,0 +1,177 @@
+// Package estimate answers, for a set of key generation options, which of the attacks in cryptanalysis apply to the
+// white-box they generate and roughly what each would cost. It's meant for security reviews: comparing the estimates for
+// two sets of options shows what turning an option on buys, and what it doesn't.
+//
+// The estimates are for the attacks as implemented here, not the best attacks known, and work factors are orders of
+// magnitude: the log2 of the number of basic operations (table evaluations or S-box lookups), rounded. Whether an attack
+// applies is decided from which encodings the options leave on the data it needs, not by running it.
+package estimate
+
+import (
+	"math"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// Estimate is what one attack would take against a white-box.
+type Estimate struct {
+	Attack  string  // The package implementing the attack.
+	Applies bool    // Whether the attack is expected to recover the key.
+	Work    float64 // log2 of the number of operations the attack takes, if it applies.
+	Data    int     // The number of traces or faulty ciphertexts the attack needs, if any.
+	Reason  string  // Why the attack does or doesn't apply.
+}
+
+// Chow estimates the attacks on a Chow white-box of a key of the given length in bytes, generated with opts: either a
+// chow.Opts, a common.Options, or just the masks, as passed to chow.GenerateEncryptionKeys.
+func Chow(keySize int, opts common.KeyGenerationOpts) []Estimate {
+	var hardening chow.Opts
+	switch o := opts.(type) {
+	case chow.Opts:
+		hardening = o
+	case common.Options:
+		hardening = chow.FromOptions(o)
+	default:
+		hardening = chow.Opts{Masks: opts}
+	}
+
+	rounds := keySize/4 + 6
+	middle := rounds - 1 + hardening.DummyRounds
+
+	inputClear, outputClear := clearMasks(hardening.Masks)
+	if hardening.Naked {
+		inputClear, outputClear = true, true
+	}
+
+	return []Estimate{
+		chowBGE(keySize, middle),
+		chowDCA(hardening, inputClear),
+		chowDFA(keySize, middle, hardening, outputClear),
+		chowMasks(keySize, inputClear, outputClear),
+	}
+}
+
+// Xiao estimates the attacks on a Xiao-Lai white-box of a key of the given length in bytes. None of the options change
+// the estimate yet; the argument is there so that new hardening options can.
+func Xiao(keySize int, opts common.KeyGenerationOpts) []Estimate {
+	if keySize != 16 {
+		return []Estimate{{Attack: "cryptanalysis/xiao", Reason: "Only AES-128 is supported."}}
+	}
+
+	// One ASA decomposition of a round with 16-bit S-boxes, which dominates everything after it.
+	return []Estimate{{
+		Attack: "cryptanalysis/xiao", Applies: true, Work: 32,
+		Reason: "Every round is one ASA structure, whatever the masks.",
+	}}
+}
+
+// clearMasks returns whether the input and output of a white-box generated with masks are left without an external
+// mask.
+func clearMasks(masks common.KeyGenerationOpts) (input, output bool) {
+	switch m := masks.(type) {
+	case common.Options:
+		return clearMasks(m.Masks())
+	case common.IndependentMasks:
+		return isIdentity(m.Input), isIdentity(m.Output)
+	case common.SameMasks:
+		return common.MaskType(m) == common.IdentityMask, common.MaskType(m) == common.IdentityMask
+	default:
+		return false, false
+	}
+}
+
+func isIdentity(mask common.Mask) bool {
+	m, ok := mask.(common.MaskType)
+	return ok && m == common.IdentityMask
+}
+
+// chowBGE estimates cryptanalysis/chow, which decomposes every middle round to find the dummies and then two more
+// times, each decomposition costing about 2^21.
+func chowBGE(keySize, middle int) Estimate {
+	out := Estimate{Attack: "cryptanalysis/chow"}
+
+	if keySize != 16 {
+		out.Reason = "Only AES-128 is supported."
+		return out
+	}
+
+	out.Applies, out.Work = true, round(21+math.Log2(float64(middle+2)))
+	out.Reason = "Only needs the tables, whatever the masks. Dummy rounds cost one more decomposition each."
+
+	return out
+}
+
+// chowDCA estimates cryptanalysis/dca, which correlates 500 traces of the first round's tables against every guess of
+// every key byte.
+func chowDCA(hardening chow.Opts, inputClear bool) Estimate {
+	out := Estimate{Attack: "cryptanalysis/dca"}
+
+	if !inputClear {
+		out.Reason = "The input mask mixes every plaintext byte into every S-box input."
+		return out
+	} else if !hardening.Naked && hardening.MixingBijections != chow.NoMixingBijections {
+		out.Reason = "The mixing bijections spread each S-box output bit over the whole word before it's stored."
+		return out
+	}
+
+	// Without knowing where the dummy rounds are, the traces have to reach past all of them.
+	traced := 1 + hardening.DummyRounds
+	bits := 8 * 320 * traced
+
+	out.Applies, out.Data = true, 500
+	out.Work = round(math.Log2(float64(16 * bits * 9 * 2048)))
+	out.Reason = "Only nibble encodings protect the first round's S-box outputs. Dummy rounds lengthen the traces."
+
+	return out
+}
+
+// chowDFA estimates cryptanalysis/dfa, which needs two faulty ciphertexts in each column of the second to last round.
+func chowDFA(keySize, middle int, hardening chow.Opts, outputClear bool) Estimate {
+	out := Estimate{Attack: "cryptanalysis/dfa"}
+
+	if keySize != 16 {
+		out.Reason = "Only AES-128 is supported."
+		return out
+	} else if !outputClear {
+		out.Reason = "The output mask hides which bytes of the ciphertext a fault changed."
+		return out
+	}
+
+	// With dummy rounds or shuffled rounds, the round to fault has to be found by trying them.
+	tries := 1
+	if hardening.DummyRounds > 0 || hardening.ShuffleRounds {
+		tries = middle
+	}
+
+	out.Applies, out.Data = true, 8*tries
+	out.Work = round(math.Log2(float64(8 * tries * 4 * 256 * 2)))
+	out.Reason = "The ciphertexts are real AES outputs. Dummy and shuffled rounds multiply the faults needed."
+
+	return out
+}
+
+// chowMasks estimates RecoverInputMask and RecoverOutputMask from cryptanalysis/chow, once the key is known.
+func chowMasks(keySize int, inputClear, outputClear bool) Estimate {
+	out := Estimate{Attack: "cryptanalysis/chow masks"}
+
+	if keySize != 16 {
+		out.Reason = "Needs the key, which is only recovered for AES-128."
+		return out
+	} else if !inputClear && !outputClear {
+		out.Reason = "With both masks random, they're only determined up to each other."
+		return out
+	} else if inputClear && outputClear {
+		out.Reason = "There are no masks to recover."
+		return out
+	}
+
+	// 145 encryptions, of about 2^12 table lookups each.
+	out.Applies, out.Work = true, round(math.Log2(145)+12)
+	out.Reason = "One mask is the identity, so the other is sampled from 145 encryptions."
+
+	return out
+}
+
+// round rounds a work factor to the nearest bit.
+func round(x float64) float64 { return math.Floor(x + 0.5) }
@@ -0,0 +1,62 @@
+package estimate
+
+import (
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+// applies returns which of the estimates apply, by attack.
+func applies(estimates []Estimate) map[string]bool {
+	out := make(map[string]bool)
+	for _, e := range estimates {
+		out[e.Attack] = e.Applies
+	}
+
+	return out
+}
+
+func TestChow(t *testing.T) {
+	random := common.IndependentMasks{common.RandomMask, common.RandomMask}
+
+	cases := []struct {
+		keySize          int
+		opts             common.KeyGenerationOpts
+		bge, dca, dfa, m bool
+	}{
+		{16, random, true, false, false, false},
+		{32, random, false, false, false, false},
+		{16, common.IndependentMasks{common.IdentityMask, common.RandomMask}, true, false, false, true},
+		{16, chow.Opts{Masks: common.IndependentMasks{common.RandomMask, common.IdentityMask}}, true, false, true, true},
+		{16, chow.Opts{Masks: common.SameMasks(common.IdentityMask), MixingBijections: chow.NoMixingBijections}, true, true, true, false},
+		{16, chow.Opts{Masks: random, Naked: true}, true, true, true, false},
+		{16, common.IndependentMasks{&common.ChainedMasks{}, common.RandomMask}, true, false, false, false},
+	}
+
+	for i, c := range cases {
+		got := applies(Chow(c.keySize, c.opts))
+
+		if got["cryptanalysis/chow"] != c.bge || got["cryptanalysis/dca"] != c.dca || got["cryptanalysis/dfa"] != c.dfa ||
+			got["cryptanalysis/chow masks"] != c.m {
+			t.Fatalf("Case %v has the wrong attacks! %v", i, got)
+		}
+	}
+}
+
+func TestDummyRounds(t *testing.T) {
+	masks := common.SameMasks(common.IdentityMask)
+
+	without := Chow(16, chow.Opts{Masks: masks})
+	with := Chow(16, chow.Opts{Masks: masks, DummyRounds: 8})
+
+	for i := range without {
+		if with[i].Applies && with[i].Work < without[i].Work {
+			t.Fatalf("Dummy rounds made %v cheaper! %v < %v", with[i].Attack, with[i].Work, without[i].Work)
+		}
+	}
+
+	if with[2].Data <= without[2].Data {
+		t.Fatalf("Dummy rounds didn't make DFA need more faults! %v <= %v", with[2].Data, without[2].Data)
+	}
+}
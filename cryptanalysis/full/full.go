@@ -0,0 +1,77 @@
+// Package full runs the generic attacks in cryptanalysis against the "full" construction, which claims to resist them.
+// It doesn't implement an attack of its own; its tests are a regression suite, asserting that each attack that applies
+// fails, so that a change to the construction that weakens it is caught. Instrument and Inject are the harnesses that
+// connect the construction to the attacks.
+//
+// Where each attack stands:
+//
+//   - cryptanalysis/dca fails. The random input mask mixes every plaintext bit into every bit of the first S-box layer,
+//     and the random self-equivalences between layers do the same to everything after it, so no bit of a trace
+//     correlates with an S-box output of AES.
+//   - cryptanalysis/dfa fails. A fault anywhere is spread across the whole ciphertext by the random output mask, so no
+//     pair looks like a fault in one column. It also fails with the output mask peeled off: a flipped bit in an affine
+//     layer only changes the AND gates it feeds when their other input is set, so the faults it causes in the real
+//     state change from one encryption to the next, and never take the shape the attack needs.
+//   - RecoverInputMask and RecoverOutputMask from cryptanalysis/chow succeed, but only given the key and the other mask,
+//     which isn't an attack: the masks of the full construction are always both random.
+//   - cryptanalysis/chow, cryptanalysis/xiao, and cryptanalysis/network don't apply. Their decompositions look for
+//     layers of 8-bit S-boxes, and the full construction's only nonlinear parts are 2-bit AND gates, spread across four
+//     layers per round.
+//   - cryptanalysis/stats doesn't apply, since the construction has no lookup tables.
+package full
+
+import (
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/full"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/dca"
+)
+
+// target traces the S-box layers of the first rounds of a full construction.
+type target struct {
+	constr *full.Construction
+	layers int
+}
+
+// Instrument returns a dca.Target that computes the same thing as constr and traces the output of every S-box layer of
+// its first rounds rounds. One is enough to reach the first round key, which is what dca.RecoverKey targets. constr
+// isn't modified, and Trace may be called from any number of goroutines.
+func Instrument(constr *full.Construction, rounds int) dca.Target {
+	return target{constr: constr, layers: 4 * rounds}
+}
+
+func (t target) Trace(dst, src []byte) []byte {
+	return t.constr.Trace(dst, src, t.layers)
+}
+
+// Inject returns a copy of constr with a fault in the constant of the given affine layer, counted from 0 to 40 in the
+// order they're applied: the given bit of the layer's output is flipped on every encryption. There are four affine
+// layers in each round, followed by one last one. This models an attacker who overwrites the key in memory; it's done
+// on the serialized key, since that's the memory the attacker has. constr isn't modified.
+func Inject(constr *full.Construction, layer, bit int) full.Construction {
+	serialized := constr.Serialize()
+
+	_, in, err := common.ParseHeader(serialized, common.FullConstruction)
+	if err != nil {
+		panic(err)
+	}
+
+	// Each layer is serialized as its height and width in bytes, then its rows, then its constant.
+	offset := len(serialized) - len(in)
+	for i := 0; i < layer; i++ {
+		h, w := int(serialized[offset]), int(serialized[offset+1])
+		offset += 2 + 8*h*w + h
+	}
+
+	h, w := int(serialized[offset]), int(serialized[offset+1])
+	if bit < 0 || bit >= 8*h {
+		panic("Fault is outside of the layer!")
+	}
+	serialized[offset+2+8*h*w+bit/8] ^= 1 << uint(bit%8)
+
+	out, err := full.Parse(serialized)
+	if err != nil {
+		panic(err)
+	}
+
+	return out
+}
@@ -0,0 +1,129 @@
+package full
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+
+	"github.com/OpenWhiteBox/AES/constructions/full"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/chow"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/dca"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/dfa"
+)
+
+var (
+	key  = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+)
+
+// unmasked is a white-box with its output mask removed.
+type unmasked struct {
+	full.Construction
+	outputMask encoding.BlockAffine
+}
+
+func (u unmasked) Encrypt(dst, src []byte) {
+	u.Construction.Encrypt(dst, src)
+
+	var out [16]byte
+	copy(out[:], dst)
+	out = u.outputMask.Decode(out)
+	copy(dst, out[:])
+}
+
+func TestInstrument(t *testing.T) {
+	constr, _, _ := full.GenerateKeys(key, seed)
+	target := Instrument(&constr, 1)
+
+	in := make([]byte, 16)
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	constr.Encrypt(real, in)
+	trace := target.Trace(cand, in)
+
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	} else if len(trace) != 56+36+32+64 {
+		t.Fatalf("Trace is the wrong length! %v", len(trace))
+	}
+}
+
+func TestInject(t *testing.T) {
+	constr, _, _ := full.GenerateKeys(key, seed)
+	faulty := Inject(&constr, 35, 5)
+
+	in := make([]byte, 16)
+	real, cand := make([]byte, 16), make([]byte, 16)
+
+	constr.Encrypt(real, in)
+	faulty.Encrypt(cand, in)
+
+	if bytes.Equal(real, cand) {
+		t.Fatalf("Fault didn't change the output!")
+	}
+}
+
+func TestDCA(t *testing.T) {
+	constr, _, _ := full.GenerateKeys(key, seed)
+
+	traces := dca.Collect(Instrument(&constr, 1), 500)
+	if cand := dca.RecoverKey(traces); bytes.Equal(cand, key) {
+		t.Fatalf("DCA recovered the key! %x", cand)
+	}
+}
+
+func TestDCAPerturbed(t *testing.T) {
+	constr, _, _ := full.GeneratePerturbedKeys(key, seed, 4)
+
+	traces := dca.Collect(Instrument(&constr, 1), 500)
+	if cand := dca.RecoverKey(traces); bytes.Equal(cand, key) {
+		t.Fatalf("DCA recovered the key from a perturbed construction! %x", cand)
+	}
+}
+
+func TestDFA(t *testing.T) {
+	constr, _, outputMask := full.GenerateKeys(key, seed)
+
+	// The layers of the last two rounds, where the faults the attack wants are.
+	for layer := 32; layer < 40; layer++ {
+		for bit := 0; bit < 8; bit++ {
+			faulty := Inject(&constr, layer, bit)
+
+			pairs := dfa.Collect(constr, faulty, 16)
+			if cand, err := dfa.RecoverLastRoundKey(pairs); err == nil {
+				t.Fatalf("DFA recovered a key from a fault in layer %v, bit %v! %x", layer, bit, cand)
+			}
+
+			pairs = dfa.Collect(unmasked{constr, outputMask}, unmasked{faulty, outputMask}, 16)
+			if cand, err := dfa.RecoverLastRoundKey(pairs); err == nil {
+				t.Fatalf("DFA recovered a key from a fault in layer %v, bit %v, without the output mask! %x", layer, bit, cand)
+			}
+		}
+	}
+}
+
+func TestMasks(t *testing.T) {
+	constr, inputMask, outputMask := full.GenerateKeys(key, seed)
+
+	identity := encoding.NewBlockAffine(matrix.GenerateIdentity(128), [16]byte{})
+	if _, err := chow.RecoverInputMask(constr, key, identity); err == nil {
+		t.Fatalf("RecoverInputMask succeeded without the output mask!")
+	}
+
+	// Given the key and the output mask, the input mask is only a linear algebra problem.
+	cand, err := chow.RecoverInputMask(constr, key, outputMask)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 16; i++ {
+		x := [16]byte{}
+		x[i] = byte(17 * (i + 1))
+
+		if real, got := inputMask.Encode(x), cand.Encode(x); real != got {
+			t.Fatalf("Real disagrees with result! %x != %x", real, got)
+		}
+	}
+}
@@ -0,0 +1,31 @@
+// Package karroumi implements a cryptanalysis of Karroumi's white-box AES construction, by reducing it to Chow et al.'s.
+//
+// Each round of the construction is computed in a dual cipher of AES, and the state is converted between duals by the
+// tables. Every conversion is an isomorphism between two representations of GF(2^8), which is a linear map on each byte,
+// so it's absorbed into the 8-bit mixing bijections that Chow's construction already puts around every byte of the
+// state. From the outside, the tables are those of a Chow construction with different mixing bijections, and the
+// attack in cryptanalysis/chow recovers the key without knowing which duals were used: the decomposition of a round
+// into S-box and affine layers strips them along with the rest of the encodings.
+//
+// "Two Attacks on a White-Box AES Implementation" by Tancrède Lepoint, Matthieu Rivain, Yoni De Mulder, Peter Roelse,
+// and Bart Preneel, https://eprint.iacr.org/2013/455
+package karroumi
+
+import (
+	"context"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+
+	chowattack "github.com/OpenWhiteBox/AES/cryptanalysis/chow"
+)
+
+// RecoverKey runs the attack on Chow's construction against the given Karroumi construction and returns the AES key it
+// was generated with. The same restrictions apply: only AES-128 encryption constructions are supported.
+func RecoverKey(constr *chow.Construction) ([]byte, error) {
+	return chowattack.RecoverKey(constr)
+}
+
+// RecoverKeyCtx is like RecoverKey, but takes the options of cryptanalysis/chow's RecoverKeyCtx.
+func RecoverKeyCtx(ctx context.Context, constr *chow.Construction, opts chowattack.Opts) ([]byte, error) {
+	return chowattack.RecoverKeyCtx(ctx, constr, opts)
+}
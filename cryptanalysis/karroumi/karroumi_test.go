@@ -0,0 +1,48 @@
+package karroumi
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/karroumi"
+)
+
+func TestRecoverKey(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := karroumi.GenerateEncryptionKeys(
+		key, key, common.IndependentMasks{common.RandomMask, common.RandomMask},
+	)
+
+	cand, err := RecoverKey(&constr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(cand, key) {
+		t.Fatalf("Recovered wrong key!\nreal=%x\ncand=%x", key, cand)
+	}
+}
+
+func TestRecoverKeyDummyRounds(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr, _, _ := karroumi.GenerateEncryptionKeys(key, key, chow.Opts{
+		Masks:       common.IndependentMasks{common.RandomMask, common.RandomMask},
+		DummyRounds: 4,
+	})
+
+	cand, err := RecoverKey(&constr)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !bytes.Equal(cand, key) {
+		t.Fatalf("Recovered wrong key!\nreal=%x\ncand=%x", key, cand)
+	}
+}
@@ -0,0 +1,193 @@
+// Package luo implements a cryptanalysis of the construction in constructions/luo, by linear decoding analysis: a
+// gray-box attack, like cryptanalysis/dca, that only needs execution traces and the plaintexts that produced them.
+//
+// Every encoding in the construction is linear, so every bit the first round's tables return is a fixed XOR of bits of
+// the S-box outputs of the first round, S(plaintext ^ key). Conversely, each of those bits is a fixed XOR of bits of the
+// trace. For each byte of the key, the attack guesses its value, predicts the S-box output bits of every trace, and
+// checks whether the predictions are in the span of the trace's bits by Gaussian elimination. Only the right guess is,
+// once there are more traces than the trace has bits. Unlike DCA, no statistics are involved, so linear mixing of any
+// width doesn't help; only nonlinear encodings do.
+//
+// Like DCA, the attack predicts the S-box outputs from the plaintext, so it needs a construction without an external
+// input mask.
+//
+// "How to Reveal the Secrets of an Obscure White-Box Implementation" by Louis Goubin, Pascal Paillier, Matthieu Rivain,
+// and Junwei Wang, https://eprint.iacr.org/2018/098
+package luo
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/OpenWhiteBox/primitives/matrix"
+
+	"github.com/OpenWhiteBox/AES/constructions/luo"
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/dca"
+)
+
+// target traces the first round of a construction.
+type target struct {
+	constr *luo.Construction
+}
+
+// Instrument returns a dca.Target that computes the same thing as constr and traces the output of every table lookup of
+// its first round. constr isn't modified, and Trace may be called from any number of goroutines.
+func Instrument(constr *luo.Construction) dca.Target {
+	return target{constr}
+}
+
+func (t target) Trace(dst, src []byte) []byte {
+	state := t.constr.ShiftRows[0].Mul(matrix.Row(src[:16]))
+
+	out := make([]byte, 0, 64)
+	for pos := 0; pos < 16; pos += 4 {
+		for _, word := range t.constr.ExpandWord(t.constr.TBoxMixCol[0][pos:pos+4], state[pos:pos+4]) {
+			out = append(out, word[:]...)
+		}
+	}
+
+	t.constr.Encrypt(dst, src)
+
+	return out
+}
+
+// RecoverKey runs the whole attack on the given construction and returns the AES key it was generated with. Only
+// AES-128 encryption constructions without an input mask are supported. An error is returned if the attack fails.
+func RecoverKey(constr *luo.Construction) ([]byte, error) {
+	if constr.Rounds() != 10 {
+		return nil, errors.New("Only AES-128 constructions are supported!")
+	}
+
+	target := Instrument(constr)
+
+	// One trace per bit of the trace, plus the constant, plus a margin so that wrong guesses are never in the span.
+	bits := 8 * len(target.Trace(make([]byte, 16), make([]byte, 16)))
+
+	return RecoverKeyFromTraces(dca.Collect(target, bits+1+64))
+}
+
+// RecoverKeyFromTraces returns the first round key of the white-box the traces were collected from, which for AES-128
+// is the key itself. An error is returned if a byte of the key has no guess whose predictions are in the span of the
+// traces, or more than one, which means there were too few traces or the encodings aren't linear.
+func RecoverKeyFromTraces(traces dca.Traces) ([]byte, error) {
+	span := newSpan(traces)
+	out := make([]byte, 16)
+
+	for pos := 0; pos < 16; pos++ {
+		candidates := 0
+
+		for guess := 0; guess < 256; guess++ {
+			ok := true
+
+			for b := uint(0); b < 8 && ok; b++ {
+				prediction := make(vector, len(span.basis[0]))
+				for t, plaintext := range traces.Plaintexts {
+					prediction.set(t, sbox[plaintext[pos]^byte(guess)]>>b&1)
+				}
+
+				ok = span.contains(prediction)
+			}
+
+			if ok {
+				out[pos] = byte(guess)
+				candidates++
+			}
+		}
+
+		if candidates != 1 {
+			return nil, fmt.Errorf("Attack failed! Found %v candidates for key byte %v.", candidates, pos)
+		}
+	}
+
+	return out, nil
+}
+
+// sbox is AES' S-box.
+var sbox = func() (out [256]byte) {
+	constr := saes.Construction{}
+	for x := 0; x < 256; x++ {
+		out[x] = constr.SubByte(byte(x))
+	}
+
+	return
+}()
+
+// vector is a vector of bits, one for each trace.
+type vector []uint64
+
+func (v vector) set(i int, bit byte) { v[i/64] |= uint64(bit) << uint(i%64) }
+
+func (v vector) get(i int) bool { return v[i/64]>>uint(i%64)&1 == 1 }
+
+func (v vector) isZero() bool {
+	for _, w := range v {
+		if w != 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// span is the span of the bits of a set of traces and the constant, in echelon form: each vector of the basis has a
+// pivot that's zero in every vector after it.
+type span struct {
+	basis  []vector
+	pivots []int
+}
+
+// newSpan computes the span of the columns of the traces: vector j is bit j of every trace. The constant vector, all
+// ones, is included, so that affine combinations of the bits are in the span too.
+func newSpan(traces dca.Traces) (out span) {
+	n, words := len(traces.Samples), (len(traces.Samples)+63)/64
+
+	constant := make(vector, words)
+	for t := 0; t < n; t++ {
+		constant.set(t, 1)
+	}
+	out.add(constant)
+
+	for j := 0; j < 8*len(traces.Samples[0]); j++ {
+		column := make(vector, words)
+		for t, sample := range traces.Samples {
+			column.set(t, sample[j/8]>>uint(j%8)&1)
+		}
+
+		out.add(column)
+	}
+
+	return
+}
+
+// reduce removes every basis vector's pivot from v.
+func (s *span) reduce(v vector) {
+	for i, b := range s.basis {
+		if v.get(s.pivots[i]) {
+			for k := range v {
+				v[k] ^= b[k]
+			}
+		}
+	}
+}
+
+// add adds v to the span, if it isn't already in it. v is modified.
+func (s *span) add(v vector) {
+	s.reduce(v)
+	if v.isZero() {
+		return
+	}
+
+	pivot := 0
+	for !v.get(pivot) {
+		pivot++
+	}
+
+	s.basis, s.pivots = append(s.basis, v), append(s.pivots, pivot)
+}
+
+// contains returns true if v is in the span. v is modified.
+func (s *span) contains(v vector) bool {
+	s.reduce(v)
+	return v.isZero()
+}
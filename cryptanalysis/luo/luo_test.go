@@ -0,0 +1,42 @@
+package luo
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/luo"
+)
+
+var (
+	key  = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+)
+
+func TestRecoverKey(t *testing.T) {
+	constr, _, _ := luo.GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.IdentityMask, common.RandomMask})
+
+	cand, err := RecoverKey(&constr)
+	if err != nil {
+		t.Fatalf("RecoverKey returned error: %v", err)
+	} else if !bytes.Equal(key, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", key, cand)
+	}
+}
+
+func TestInputMask(t *testing.T) {
+	constr, _, _ := luo.GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	if _, err := RecoverKey(&constr); err == nil {
+		t.Fatalf("RecoverKey succeeded against a construction with an input mask!")
+	}
+}
+
+func TestAES256(t *testing.T) {
+	key256 := append(append([]byte{}, key...), seed...)
+	constr, _, _ := luo.GenerateEncryptionKeys(key256, seed, common.SameMasks(common.IdentityMask))
+
+	if _, err := RecoverKey(&constr); err == nil {
+		t.Fatalf("RecoverKey accepted an AES-256 construction!")
+	}
+}
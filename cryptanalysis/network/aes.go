@@ -0,0 +1,92 @@
+package network
+
+import (
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/number"
+
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+var powx = [16]byte{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x1b, 0x36, 0x6c, 0xd8, 0xab, 0x4d, 0x9a, 0x2f}
+
+// SBox is a Byte encoding of AES's "standard" S-box.
+type SBox struct{}
+
+func (sb SBox) Encode(in byte) byte {
+	constr := saes.Construction{}
+	return constr.SubByte(in)
+}
+
+func (sb SBox) Decode(in byte) byte {
+	constr := saes.Construction{}
+	return constr.UnSubByte(in)
+}
+
+// Inversion is a Byte encoding of inversion over GF(2^8), the nonlinear part of AES' S-box.
+type Inversion struct{}
+
+func (inv Inversion) Encode(in byte) byte {
+	return byte(number.ByteFieldElem(in).Invert())
+}
+
+func (inv Inversion) Decode(in byte) byte {
+	return byte(number.ByteFieldElem(in).Invert())
+}
+
+// IsAS returns true if the given Byte encoding might be an AS structure, with 2 4-bit S-boxes.
+func IsAS(in encoding.Byte) bool {
+	temp1, temp2 := byte(0x00), byte(0x00)
+
+	for x := byte(0); x < 16; x++ {
+		temp1 ^= in.Encode(x)
+		temp2 ^= in.Encode(x << 4)
+	}
+
+	return temp1 == 0 && temp2 == 0
+}
+
+// RoundKeyByte returns the constant added to the output of AES' S-box in the given S-box, which must be an AS
+// structure followed by the S-box and the constant: the one guess that, removed along with the S-box, leaves only an AS
+// structure. In an SAS decomposition, it's the round key byte pushed back through the affine layer. The second return
+// value is false if no guess works.
+func RoundKeyByte(leading encoding.Byte) (byte, bool) {
+	for guess := 0; guess < 256; guess++ {
+		cand := encoding.ComposedBytes{leading, encoding.ByteAdditive(guess), encoding.InverseByte{SBox{}}}
+
+		if IsAS(cand) {
+			return byte(guess), true
+		}
+	}
+
+	return 0, false
+}
+
+// BackOneRound takes AES-128 round key i and returns round key i-1.
+func BackOneRound(roundKey []byte, round int) (out []byte) {
+	out = make([]byte, 16)
+	constr := saes.Construction{}
+
+	// Recover everything except the first word by XORing consecutive blocks.
+	for pos := 4; pos < 16; pos++ {
+		out[pos] = roundKey[pos] ^ roundKey[pos-4]
+	}
+
+	// Recover the first word by XORing the first block of the roundKey with f(last block of roundKey), where f is a
+	// subroutine of AES' key scheduling algorithm.
+	for pos := 0; pos < 4; pos++ {
+		out[pos] = roundKey[pos] ^ constr.SubByte(out[12+(pos+1)%4])
+	}
+	out[0] ^= powx[round-1]
+
+	return
+}
+
+// MasterKey takes AES-128 round key i and walks it back through the key schedule to the key.
+func MasterKey(roundKey []byte, round int) []byte {
+	out := roundKey
+	for ; round > 0; round-- {
+		out = BackOneRound(out, round)
+	}
+
+	return out
+}
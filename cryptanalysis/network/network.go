@@ -0,0 +1,86 @@
+// Package network is the construction-agnostic part of the attacks on table-based white-box AES. An attack on a new
+// construction describes the construction's table network with the Network interface--how to run each of its rounds in
+// isolation--and gets the rest from here: decomposing rounds into S-box and affine layers with the SPN cryptanalysis in
+// Generic/cryptanalysis/spn, recognizing AES' S-box among the recovered S-boxes, telling dummy rounds apart from real
+// ones, extracting round key bytes, and inverting the key schedule. What's left to write is the disambiguation of the
+// affine layers, which depends on how the construction encodes MixColumns.
+//
+// cryptanalysis/chow and cryptanalysis/xiao are written on top of this package.
+package network
+
+import (
+	"github.com/OpenWhiteBox/primitives/encoding"
+
+	cspn "github.com/OpenWhiteBox/Generic/constructions/spn"
+	aspn "github.com/OpenWhiteBox/Generic/cryptanalysis/spn"
+)
+
+// Network describes the table network of a white-box.
+type Network interface {
+	// Rounds returns the number of rounds that Round can isolate, dummy rounds included.
+	Rounds() int
+
+	// Round returns round r of the white-box in isolation: the function of the 16-byte state computed by only that
+	// round's tables, with all of its encodings still on.
+	Round(r int) aspn.Cipher
+}
+
+// SAS is a round decomposed into a layer of S-boxes, an affine layer, and another layer of S-boxes. The S-boxes of a
+// round of AES are somewhere in Leading, up to affine transformations that are also spread across the other two layers.
+type SAS struct {
+	Leading, Trailing encoding.ConcatenatedBlock
+	Affine            encoding.BlockAffine
+}
+
+// ASA is a round decomposed into an affine layer, a layer of S-boxes, and another affine layer.
+type ASA struct {
+	First, Last encoding.BlockAffine
+	Middle      encoding.ConcatenatedBlock
+}
+
+// DecomposeSAS decomposes round r of the network. It panics if the round isn't an SAS structure.
+func DecomposeSAS(n Network, r int) SAS {
+	decomposed := aspn.DecomposeSPN(n.Round(r), cspn.SAS)
+
+	return SAS{
+		Leading:  decomposed[0].(encoding.ConcatenatedBlock),
+		Affine:   decomposed[1].(encoding.BlockAffine),
+		Trailing: decomposed[2].(encoding.ConcatenatedBlock),
+	}
+}
+
+// DecomposeASA decomposes round r of the network. It panics if the round isn't an ASA structure.
+func DecomposeASA(n Network, r int) ASA {
+	decomposed := aspn.DecomposeSPN(n.Round(r), cspn.ASA)
+
+	return ASA{
+		First:  decomposed[0].(encoding.BlockAffine),
+		Middle: decomposed[1].(encoding.ConcatenatedBlock),
+		Last:   decomposed[2].(encoding.BlockAffine),
+	}
+}
+
+// IsDummy returns true if round r of the network is a dummy round. The leading S-boxes of a real round include AES'
+// S-box, while a dummy round's are only made of the 4-bit encodings and an affine transformation.
+func IsDummy(n Network, r int) bool {
+	leading := DecomposeSAS(n, r).Leading
+
+	for pos := 0; pos < 16; pos++ {
+		if !IsAS(leading[pos]) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// DummyRounds returns the indices of the dummy rounds of the network.
+func DummyRounds(n Network) (out []int) {
+	for r := 0; r < n.Rounds(); r++ {
+		if IsDummy(n, r) {
+			out = append(out, r)
+		}
+	}
+
+	return
+}
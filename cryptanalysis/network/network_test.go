@@ -0,0 +1,41 @@
+package network
+
+import (
+	"bytes"
+	"crypto/rand"
+	"testing"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+func TestMasterKey(t *testing.T) {
+	key := make([]byte, 16)
+	rand.Read(key)
+
+	constr := saes.Construction{key}
+	roundKeys := constr.StretchedKey()
+
+	for round := range roundKeys {
+		if cand := MasterKey(roundKeys[round], round); !bytes.Equal(key, cand) {
+			t.Fatalf("Recovered wrong key from round key %v!\nreal=%x\ncand=%x", round, key, cand)
+		}
+	}
+}
+
+func TestRoundKeyByte(t *testing.T) {
+	if IsAS(SBox{}) {
+		t.Fatalf("AES' S-box looks like an AS structure!")
+	} else if !IsAS(encoding.IdentityByte{}) {
+		t.Fatalf("The identity doesn't look like an AS structure!")
+	}
+
+	for k := 0; k < 256; k += 17 {
+		leading := encoding.ComposedBytes{SBox{}, encoding.ByteAdditive(k)}
+
+		if cand, ok := RoundKeyByte(leading); !ok || cand != byte(k) {
+			t.Fatalf("Recovered wrong key byte! %x != %x", k, cand)
+		}
+	}
+}
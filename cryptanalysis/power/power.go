@@ -0,0 +1,275 @@
+// Package power simulates the power consumption of a white-box running on real hardware, so that countermeasures
+// against power analysis can be studied in software, without a device or an oscilloscope. It's the gray-box
+// counterpart of cryptanalysis/dca: instead of the exact values a white-box reads from its tables, an attacker only
+// gets a noisy measurement of how many bits of each were set.
+//
+// A Simulator turns every table lookup of an encryption into one sample: the Hamming weight of the value read, plus
+// Gaussian noise. RecoverKey runs a correlation power analysis (CPA) on the simulated traces, correlating every sample
+// with the Hamming weight of the first round's S-box output, HW(S(plaintext ^ key)), under each guess of each key byte.
+//
+// FixedVsRandom and Specific assess leakage instead of attacking: they run Welch's t-test on the samples of each table,
+// and report which tables of the construction leak, and how badly.
+//
+// "Correlation Power Analysis with a Leakage Model" by Eric Brier, Christophe Clavier, and Francis Olivier,
+// https://doi.org/10.1007/978-3-540-28632-5_2
+package power
+
+import (
+	"crypto/rand"
+	"math"
+	mathrand "math/rand"
+	"sync"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/dca"
+)
+
+// Leaker is a white-box that reports the value of every table lookup of each block it encrypts.
+type Leaker interface {
+	// Leak encrypts the first block in src into dst, like Encrypt, and returns the output of every table lookup it made,
+	// in order.
+	Leak(dst, src []byte) [][]byte
+}
+
+// Namer is implemented by Leakers that know which table each lookup they report is from. A white-box makes the same
+// lookups for every block, only with different values, so the names are the same for every trace.
+type Namer interface {
+	// Names returns the name of the table of every lookup Leak reports, in the same order.
+	Names() []string
+}
+
+// chowLeaker reports the lookups of a traced Chow construction.
+type chowLeaker struct {
+	mu     sync.Mutex
+	constr *chow.TracedConstruction
+	rounds int
+	all    bool
+}
+
+// Chow returns a Leaker that computes the same thing as constr and reports the lookups of its input tables and of the
+// middle tables of its first rounds rounds, or of every table if rounds is at least constr.Rounds(). constr isn't
+// modified. Leak may be called from any number of goroutines, but only runs one encryption at a time.
+func Chow(constr *chow.Construction, rounds int) Leaker {
+	return &chowLeaker{constr: chow.NewTracedConstruction(constr), rounds: rounds, all: rounds >= constr.Rounds()}
+}
+
+func (cl *chowLeaker) Leak(dst, src []byte) (out [][]byte) {
+	for _, l := range cl.lookups(dst, src) {
+		out = append(out, l.Value())
+	}
+
+	return out
+}
+
+// Names returns the name of the table of every lookup Leak reports, as chow.TableID formats it.
+func (cl *chowLeaker) Names() (out []string) {
+	for _, l := range cl.lookups(make([]byte, 16), make([]byte, 16)) {
+		out = append(out, l.Table.String())
+	}
+
+	return out
+}
+
+// lookups encrypts the first block in src into dst and returns the lookups Leak reports.
+func (cl *chowLeaker) lookups(dst, src []byte) (out chow.Trace) {
+	cl.mu.Lock()
+	defer cl.mu.Unlock()
+
+	cl.constr.Encrypt(dst, src)
+
+	for _, l := range cl.constr.Trace() {
+		switch l.Table.Kind {
+		case chow.InputMaskTable, chow.InputXORTable:
+		case chow.TBoxOutputMaskTable, chow.OutputXORTable:
+			if !cl.all {
+				continue
+			}
+		default:
+			if int(l.Table.Round) >= cl.rounds {
+				continue
+			}
+		}
+
+		out = append(out, l)
+	}
+
+	return out
+}
+
+// targetLeaker reports every byte of a dca.Target's trace as its own lookup.
+type targetLeaker struct {
+	target dca.Target
+}
+
+// FromTarget returns a Leaker that reports each byte of target's traces as the output of one lookup, for
+// constructions that are instrumented for cryptanalysis/dca but don't have a Leaker of their own, like the ones in
+// cryptanalysis/full and cryptanalysis/luo.
+func FromTarget(target dca.Target) Leaker {
+	return targetLeaker{target}
+}
+
+func (tl targetLeaker) Leak(dst, src []byte) [][]byte {
+	trace := tl.target.Trace(dst, src)
+
+	out := make([][]byte, len(trace))
+	for i := range trace {
+		out[i] = trace[i : i+1]
+	}
+
+	return out
+}
+
+// Simulator records simulated power traces of a white-box. It must not be used from more than one goroutine at a time.
+type Simulator struct {
+	leaker Leaker
+	noise  float64
+	rng    *mathrand.Rand
+}
+
+// NewSimulator returns a Simulator of the given white-box, which adds Gaussian noise with standard deviation noise to
+// every sample. The noise is generated from seed, so the same seed and plaintexts always give the same traces.
+func NewSimulator(leaker Leaker, noise float64, seed int64) *Simulator {
+	return &Simulator{leaker: leaker, noise: noise, rng: mathrand.New(mathrand.NewSource(seed))}
+}
+
+// Trace encrypts the first block in src into dst and returns its simulated power trace: one sample for every table
+// lookup, the Hamming weight of the value read plus noise.
+func (s *Simulator) Trace(dst, src []byte) []float64 {
+	leaks := s.leaker.Leak(dst, src)
+
+	out := make([]float64, len(leaks))
+	for i, leak := range leaks {
+		out[i] = float64(hammingWeight(leak)) + s.noise*s.rng.NormFloat64()
+	}
+
+	return out
+}
+
+// Traces is a set of simulated power traces, with the plaintext that produced each one.
+type Traces struct {
+	Plaintexts [][16]byte
+	Samples    [][]float64
+}
+
+// Collect encrypts n random plaintexts with the simulator and returns their traces.
+func Collect(s *Simulator, n int) (out Traces) {
+	out.Plaintexts, out.Samples = make([][16]byte, n), make([][]float64, n)
+	dst := make([]byte, 16)
+
+	for i := 0; i < n; i++ {
+		rand.Read(out.Plaintexts[i][:])
+		out.Samples[i] = s.Trace(dst, out.Plaintexts[i][:])
+	}
+
+	return
+}
+
+// RecoverKey returns the most likely first round key of the white-box the traces were collected from. For AES-128, that's
+// the key itself.
+func RecoverKey(traces Traces) []byte {
+	out := make([]byte, 16)
+
+	for pos := 0; pos < 16; pos++ {
+		out[pos], _ = RecoverKeyByte(traces, pos)
+	}
+
+	return out
+}
+
+// RecoverKeyByte returns the most likely value of byte pos of the first round key, along with the absolute correlation
+// between the best sample of the traces and HW(S(plaintext ^ guess)). As in cryptanalysis/dca, a correlation that
+// stands out from the other guesses' means the attack worked; one near 4/sqrt(len(traces.Samples)) is noise.
+func RecoverKeyByte(traces Traces, pos int) (guess byte, correlation float64) {
+	n := float64(len(traces.Samples))
+	if n == 0 {
+		return 0, 0
+	}
+	m := len(traces.Samples[0])
+
+	// The hypothesis only depends on the plaintext byte, so the traces are summed up by its value first: count[v] traces
+	// have plaintext byte v, and the samples of those add up to sums[v].
+	count, sums := [256]float64{}, make([][]float64, 256)
+	for v := range sums {
+		sums[v] = make([]float64, m)
+	}
+
+	sum, squares := make([]float64, m), make([]float64, m)
+
+	for t, trace := range traces.Samples {
+		v := traces.Plaintexts[t][pos]
+		count[v]++
+
+		for j, x := range trace[:m] {
+			sums[v][j] += x
+			sum[j] += x
+			squares[j] += x * x
+		}
+	}
+
+	best := 0.0
+
+	for k := 0; k < 256; k++ {
+		var h [256]float64
+		hSum, hSquares := 0.0, 0.0
+
+		for v := 0; v < 256; v++ {
+			h[v] = float64(sboxWeights[v^k])
+			hSum += count[v] * h[v]
+			hSquares += count[v] * h[v] * h[v]
+		}
+
+		hVar := n*hSquares - hSum*hSum
+		if hVar == 0 {
+			continue
+		}
+
+		for j := 0; j < m; j++ {
+			xVar := n*squares[j] - sum[j]*sum[j]
+			if xVar <= 0 {
+				continue // The sample is constant, and can't correlate with anything.
+			}
+
+			cross := 0.0
+			for v := 0; v < 256; v++ {
+				cross += h[v] * sums[v][j]
+			}
+
+			if score := math.Abs(n*cross-hSum*sum[j]) / math.Sqrt(hVar*xVar); score > best {
+				best, guess = score, byte(k)
+			}
+		}
+	}
+
+	return guess, best
+}
+
+// hammingWeight returns the number of bits set in x.
+func hammingWeight(x []byte) (out int) {
+	for _, b := range x {
+		for ; b != 0; b &= b - 1 {
+			out++
+		}
+	}
+
+	return
+}
+
+// sbox is AES' S-box.
+var sbox = func() (out [256]byte) {
+	constr := saes.Construction{}
+	for x := 0; x < 256; x++ {
+		out[x] = constr.SubByte(byte(x))
+	}
+
+	return
+}()
+
+// sboxWeights[x] is the Hamming weight of AES' S-box at x.
+var sboxWeights = func() (out [256]int) {
+	for x := 0; x < 256; x++ {
+		out[x] = hammingWeight(sbox[x : x+1])
+	}
+
+	return
+}()
@@ -0,0 +1,133 @@
+package power
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/dca"
+)
+
+var (
+	key  = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+)
+
+func TestSimulator(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	in := make([]byte, 16)
+	real, cand := make([]byte, 16), make([]byte, 16)
+	constr.Encrypt(real, in)
+
+	// Without noise, every sample is the Hamming weight of a lookup.
+	trace := NewSimulator(Chow(&constr, constr.Rounds()), 0, 1).Trace(cand, in)
+	if !bytes.Equal(real, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+	}
+
+	leaks := Chow(&constr, constr.Rounds()).Leak(cand, in)
+	if len(trace) != len(leaks) {
+		t.Fatalf("Trace is the wrong length! %v != %v", len(trace), len(leaks))
+	}
+	for i, leak := range leaks {
+		if trace[i] != float64(hammingWeight(leak)) {
+			t.Fatalf("Sample %v is wrong! %v != %v", i, trace[i], hammingWeight(leak))
+		}
+	}
+
+	// The same seed gives the same noise.
+	a := NewSimulator(Chow(&constr, 1), 2, 7).Trace(cand, in)
+	b := NewSimulator(Chow(&constr, 1), 2, 7).Trace(cand, in)
+	for i := range a {
+		if a[i] != b[i] {
+			t.Fatalf("Simulators with the same seed disagree! %v != %v", a[i], b[i])
+		}
+	}
+}
+
+func TestFromTarget(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.SameMasks(common.IdentityMask))
+
+	in := make([]byte, 16)
+	trace := dca.Instrument(&constr, 1).Trace(make([]byte, 16), in)
+	leaks := FromTarget(dca.Instrument(&constr, 1)).Leak(make([]byte, 16), in)
+
+	if len(trace) != len(leaks) {
+		t.Fatalf("Leaker reported the wrong number of lookups! %v != %v", len(leaks), len(trace))
+	}
+}
+
+func TestRecoverKey(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, chow.Opts{Naked: true})
+
+	traces := Collect(NewSimulator(Chow(&constr, 1), 1, 1), 500)
+	if cand := RecoverKey(traces); !bytes.Equal(key, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", key, cand)
+	}
+}
+
+func TestRecoverKeyMasked(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	traces := Collect(NewSimulator(Chow(&constr, 1), 1, 1), 500)
+	if cand := RecoverKey(traces); bytes.Equal(key, cand) {
+		t.Fatalf("CPA recovered the key through a random input mask! %x", cand)
+	}
+}
+
+func TestNames(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+	leaker := Chow(&constr, 2)
+
+	names := leaker.(Namer).Names()
+	if leaks := leaker.Leak(make([]byte, 16), make([]byte, 16)); len(names) != len(leaks) {
+		t.Fatalf("Leaker reported the wrong number of names! %v != %v", len(names), len(leaks))
+	}
+}
+
+func TestFixedVsRandom(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	report := FixedVsRandom(NewSimulator(Chow(&constr, 1), 1, 1), make([]byte, 16), 200)
+	if len(report.Leaking()) == 0 {
+		t.Fatalf("No table leaks!")
+	}
+
+	buf := &bytes.Buffer{}
+	if n, err := report.WriteTo(buf); err != nil {
+		t.Fatal(err)
+	} else if n != int64(buf.Len()) {
+		t.Fatalf("WriteTo reported the wrong length! %v != %v", n, buf.Len())
+	} else if lines := bytes.Count(buf.Bytes(), []byte("\n")); lines != len(report)+1 {
+		t.Fatalf("Report has the wrong number of lines! %v != %v", lines, len(report)+1)
+	}
+}
+
+func TestSpecific(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, chow.Opts{Naked: true})
+
+	// Every T-box of the first round leaks its S-box output.
+	leaking := make(map[string]bool)
+	for _, res := range Specific(NewSimulator(Chow(&constr, 1), 1, 1), key, 500).Leaking() {
+		leaking[res.Table] = true
+	}
+
+	for pos := 0; pos < 16; pos++ {
+		name := chow.TableID{Kind: chow.TBoxTyiTable, Round: 0, Position: byte(pos)}.String()
+		if !leaking[name] {
+			t.Fatalf("%v doesn't leak!", name)
+		}
+	}
+
+	// With a random input mask, only the input mask's tables, which read the plaintext itself, leak.
+	constr, _, _ = chow.GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	for _, res := range Specific(NewSimulator(Chow(&constr, 1), 1, 1), key, 500).Leaking() {
+		if !strings.HasPrefix(res.Table, "InputMask[") {
+			t.Fatalf("%v leaks through a random input mask!", res.Table)
+		}
+	}
+}
@@ -0,0 +1,220 @@
+package power
+
+import (
+	"bufio"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"math"
+)
+
+// Threshold is the absolute value of Welch's t-statistic above which a sample is considered to leak, as in the Test
+// Vector Leakage Assessment (TVLA) methodology.
+//
+// "A testing methodology for side-channel resistance validation" by Gilbert Goodwill, Benjamin Jun, Josh Jaffe, and
+// Pankaj Rohatgi, NIST Non-Invasive Attack Testing Workshop, 2011
+const Threshold = 4.5
+
+// Result is the outcome of a t-test on the samples of one table.
+type Result struct {
+	Table string  // The table's name, from the Leaker's Names, or the index of the sample if it doesn't have any.
+	T     float64 // Welch's t-statistic. For a table with more than one sample, the largest in absolute value.
+}
+
+// Leaks returns true if the t-statistic is past Threshold.
+func (r Result) Leaks() bool { return math.Abs(r.T) > Threshold }
+
+// Report is the outcome of a leakage assessment: one Result for every table, in the order they're first looked up.
+type Report []Result
+
+// Leaking returns the results of the tables that leak.
+func (r Report) Leaking() (out Report) {
+	for _, res := range r {
+		if res.Leaks() {
+			out = append(out, res)
+		}
+	}
+
+	return out
+}
+
+// WriteTo writes the report as text, one table per line with its t-statistic, and the tables that leak marked.
+func (r Report) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	for _, res := range r {
+		mark := ""
+		if res.Leaks() {
+			mark = " leaks"
+		}
+
+		fmt.Fprintf(bw, "%-28v %10.2f%v\n", res.Table, res.T, mark)
+	}
+	fmt.Fprintf(bw, "%v of %v tables leak\n", len(r.Leaking()), len(r))
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// FixedVsRandom runs TVLA's non-specific test: n traces of the fixed plaintext and n of random ones, interleaved so that
+// nothing but the plaintext tells them apart, and a t-test between the two sets on every sample.
+//
+// The test finds every table whose output depends on the plaintext at all. White-boxes are deterministic, with no fresh
+// randomness to hide that dependence, so it flags nearly every table of any construction, given enough traces; the
+// t-statistics say how strongly each leaks. Specific tells the tables that leak the key apart from the rest.
+func FixedVsRandom(s *Simulator, fixed []byte, n int) Report {
+	names := s.names()
+	runs := [2]*welch{newWelch(len(names), 1), newWelch(len(names), 1)}
+
+	dst, random := make([]byte, 16), make([]byte, 16)
+
+	for i := 0; i < n; i++ {
+		runs[i%2].add(s.Trace(dst, fixed[:16]), func(int) int { return 0 })
+
+		rand.Read(random)
+		runs[i%2].add(s.Trace(dst, random), func(int) int { return 1 })
+	}
+
+	return report(names, runs)
+}
+
+// Specific runs TVLA's specific test for the S-box outputs of the first round: n traces of random plaintexts, split by
+// each bit of each byte of S(plaintext ^ key) in turn, and a t-test between the halves of every split on every sample.
+// A table leaks if any of the splits of its samples do. For AES-128, key is the AES key, and otherwise it's the first
+// round key.
+//
+// Any table that reads a byte of the plaintext itself, like an input mask's, leaks too: a function of the plaintext byte
+// is a function of the S-box output. Those are only a problem if their outputs aren't encoded.
+func Specific(s *Simulator, key []byte, n int) Report {
+	names := s.names()
+	runs := [2]*welch{newWelch(len(names), 16*8), newWelch(len(names), 16*8)}
+
+	dst, plaintext := make([]byte, 16), make([]byte, 16)
+	bit := func(split int) int { return int(sbox[plaintext[split/8]^key[split/8]] >> uint(split%8) & 1) }
+
+	for i := 0; i < n; i++ {
+		rand.Read(plaintext)
+		runs[i%2].add(s.Trace(dst, plaintext), bit)
+	}
+
+	return report(names, runs)
+}
+
+// names returns the name of every sample of the simulator's traces.
+func (s *Simulator) names() []string {
+	if namer, ok := s.leaker.(Namer); ok {
+		return namer.Names()
+	}
+
+	out := make([]string, len(s.leaker.Leak(make([]byte, 16), make([]byte, 16))))
+	for i := range out {
+		out[i] = fmt.Sprint(i)
+	}
+
+	return out
+}
+
+// welch accumulates Welch's t-test on every sample of a set of traces, for a number of ways of splitting the traces
+// into two sets.
+type welch struct {
+	count           [][2]float64   // [split][set]
+	sum, squares    [][2][]float64 // [split][set][sample]
+	samples, splits int
+}
+
+func newWelch(samples, splits int) *welch {
+	w := &welch{
+		count: make([][2]float64, splits), sum: make([][2][]float64, splits), squares: make([][2][]float64, splits),
+		samples: samples, splits: splits,
+	}
+
+	for i := 0; i < splits; i++ {
+		for set := 0; set < 2; set++ {
+			w.sum[i][set], w.squares[i][set] = make([]float64, samples), make([]float64, samples)
+		}
+	}
+
+	return w
+}
+
+// add adds a trace to the set that set(split) gives for every split.
+func (w *welch) add(trace []float64, set func(split int) int) {
+	for i := 0; i < w.splits; i++ {
+		s := set(i)
+		w.count[i][s]++
+
+		sum, squares := w.sum[i][s], w.squares[i][s]
+		for j, x := range trace[:w.samples] {
+			sum[j] += x
+			squares[j] += x * x
+		}
+	}
+}
+
+// t returns the t-statistic of sample j under the given split.
+func (w *welch) t(split, j int) float64 {
+	n0, n1 := w.count[split][0], w.count[split][1]
+	if n0 < 2 || n1 < 2 {
+		return 0
+	}
+
+	mean0, mean1 := w.sum[split][0][j]/n0, w.sum[split][1][j]/n1
+	var0 := (w.squares[split][0][j] - n0*mean0*mean0) / (n0 - 1)
+	var1 := (w.squares[split][1][j] - n1*mean1*mean1) / (n1 - 1)
+
+	diff, denom := mean0-mean1, math.Sqrt(math.Max(var0/n0+var1/n1, 0))
+	if math.Abs(diff) < 1e-9 {
+		return 0
+	} else if denom == 0 {
+		return math.Copysign(math.Inf(1), diff) // Two different constants: a leak with no noise to hide it.
+	}
+
+	return diff / denom
+}
+
+// report collects the largest t-statistic of each table, over its samples and every split. With a hundred thousand
+// t-tests, a few pass Threshold by chance, so as TVLA prescribes, the traces are divided into two independent runs and a
+// sample only counts as leaking if it does in both, in the same direction. Its t-statistic is the smaller of the two.
+func report(names []string, runs [2]*welch) (out Report) {
+	index := make(map[string]int)
+
+	for j, name := range names {
+		i, ok := index[name]
+		if !ok {
+			i, index[name] = len(out), len(out)
+			out = append(out, Result{Table: name})
+		}
+
+		for split := 0; split < runs[0].splits; split++ {
+			t0, t1 := runs[0].t(split, j), runs[1].t(split, j)
+			if t0*t1 <= 0 {
+				continue
+			}
+
+			t := t0
+			if math.Abs(t1) < math.Abs(t0) {
+				t = t1
+			}
+
+			if math.Abs(t) > math.Abs(out[i].T) {
+				out[i].T = t
+			}
+		}
+	}
+
+	return out
+}
+
+// countingWriter counts the bytes written through it, for WriteTo.
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+
+	return n, err
+}
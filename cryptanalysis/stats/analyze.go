@@ -0,0 +1,105 @@
+package stats
+
+import (
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+)
+
+// Report is the profile of one table of a construction, or of one byte of its output if it gives more than one.
+type Report struct {
+	Table  chow.TableID
+	Output int // The byte of the table's output that was profiled.
+
+	Profile
+	Leaks []string // The ways the table is distinguishable from random, if any. See Profile.Leaks.
+}
+
+// column returns one byte of the output of a table with a wider output, as a table.Byte, given that byte of each entry.
+func column(entry func(x int) byte) table.ParsedByte {
+	out := make(table.ParsedByte, 256)
+	for x := range out {
+		out[x] = entry(x)
+	}
+
+	return out
+}
+
+// Analyze profiles every table of constr with a one-byte index: each of the nibble XOR tables, and each byte of the
+// output of the others. The wide XOR tables, which are indexed by two bytes, are skipped. Tables are identified the way
+// chow.NewTracedConstruction identifies them, with middle rounds in the order they're computed.
+func Analyze(constr *chow.Construction) (out []Report) {
+	add := func(id chow.TableID, output int, t table.Byte, outputs int) {
+		p := NewProfile(t, outputs)
+		out = append(out, Report{Table: id, Output: output, Profile: p, Leaks: p.Leaks(outputs)})
+	}
+
+	addBlock := func(kind chow.TableKind, tables [16]table.Block) {
+		for pos, t := range tables {
+			var entries [256][16]byte
+			for x := 0; x < 256; x++ {
+				entries[x] = t.Get(byte(x))
+			}
+
+			for i := 0; i < 16; i++ {
+				add(chow.TableID{kind, 0, byte(pos), 0}, i, column(func(x int) byte { return entries[x][i] }), 256)
+			}
+		}
+	}
+
+	addWord := func(kind chow.TableKind, round int, tables [16]table.Word) {
+		for pos, t := range tables {
+			var entries [256][4]byte
+			for x := 0; x < 256; x++ {
+				entries[x] = t.Get(byte(x))
+			}
+
+			for i := 0; i < 4; i++ {
+				add(chow.TableID{kind, byte(round), byte(pos), 0}, i, column(func(x int) byte { return entries[x][i] }), 256)
+			}
+		}
+	}
+
+	addXOR := func(kind chow.TableKind, round int, tables [][]table.Nibble) {
+		for pos := range tables {
+			for gate, t := range tables[pos] {
+				add(chow.TableID{kind, byte(round), byte(pos), byte(gate)}, 0, t, 16)
+			}
+		}
+	}
+
+	addBlock(chow.InputMaskTable, constr.InputMask)
+	addXOR(chow.InputXORTable, 0, nibbles15(constr.InputXORTables))
+
+	for round := range constr.TBoxTyiTable {
+		slot := constr.Slot(round)
+
+		addWord(chow.TBoxTyiTable, round, constr.TBoxTyiTable[slot])
+		addXOR(chow.HighXORTable, round, nibbles3(constr.HighXORTable[slot]))
+		addWord(chow.MBInverseTable, round, constr.MBInverseTable[slot])
+		addXOR(chow.LowXORTable, round, nibbles3(constr.LowXORTable[slot]))
+	}
+
+	addBlock(chow.TBoxOutputMaskTable, constr.TBoxOutputMask)
+	addXOR(chow.OutputXORTable, 0, nibbles15(constr.OutputXORTables))
+
+	return out
+}
+
+func nibbles15(in [32][15]table.Nibble) [][]table.Nibble {
+	out := make([][]table.Nibble, 32)
+	for pos := range in {
+		out[pos] = in[pos][:]
+	}
+
+	return out
+}
+
+func nibbles3(in [32][3]table.Nibble) [][]table.Nibble {
+	out := make([][]table.Nibble, 32)
+	for pos := range in {
+		out[pos] = in[pos][:]
+	}
+
+	return out
+}
@@ -0,0 +1,191 @@
+package stats
+
+import (
+	"math"
+
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// falsePositive is the probability that a random function trips one of the checks in Leaks.
+const falsePositive = 1.0 / (1 << 20)
+
+// Entropy returns the Shannon entropy, in bits, of the output of a table with the given counts on a uniformly random
+// input. It's 4 for a balanced table.Nibble and 8 for a bijective table.Byte.
+func Entropy(counts [256]int) float64 {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+
+	out := 0.0
+	for _, c := range counts {
+		if c > 0 {
+			p := float64(c) / float64(total)
+			out -= p * math.Log2(p)
+		}
+	}
+
+	return out
+}
+
+// LinearBias returns the largest correlation, in absolute value, between a nonzero linear combination of the input bits of
+// t and a nonzero linear combination of its output bits, of which there are log2(outputs). It's 1 if some output bit is
+// an affine function of the input, which is what XOR tables without encodings give away.
+func LinearBias(t table.Byte, outputs int) float64 {
+	t, best := readAll(t), int64(0)
+
+	for mask := 1; mask < outputs; mask++ {
+		var f [256]int64
+		for x := 0; x < 256; x++ {
+			if parity(t.Get(byte(x)) & byte(mask)) {
+				f[x] = -1
+			} else {
+				f[x] = 1
+			}
+		}
+		walsh(&f)
+
+		for _, w := range f[1:] {
+			if w < 0 {
+				w = -w
+			}
+			if w > best {
+				best = w
+			}
+		}
+	}
+
+	return float64(best) / 256
+}
+
+// DifferentialUniformity returns the largest number of inputs x, for any nonzero difference a and any difference b, such
+// that t(x) ^ t(x ^ a) = b. It's 256 if some difference in the input always gives the same difference in the output.
+func DifferentialUniformity(t table.Byte) int {
+	outputs := readAll(t)
+
+	best := 0
+	for a := 1; a < 256; a++ {
+		var counts [256]int
+		for x := 0; x < 256; x++ {
+			counts[outputs[x]^outputs[x^a]]++
+		}
+
+		for _, c := range counts {
+			if c > best {
+				best = c
+			}
+		}
+	}
+
+	return best
+}
+
+// Profile is every statistic of a table that this package computes.
+type Profile struct {
+	Entropy                float64
+	ChiSquared             float64
+	LinearBias             float64
+	DifferentialUniformity int
+}
+
+// NewProfile returns the profile of t, which has the given number of possible outputs: 16 for a table.Nibble and 256 for
+// a table.Byte. Every entry of t is read exactly once.
+func NewProfile(t table.Byte, outputs int) Profile {
+	t = readAll(t)
+	counts := Counts(t)
+
+	return Profile{
+		Entropy:                Entropy(counts),
+		ChiSquared:             ChiSquared(counts, outputs),
+		LinearBias:             LinearBias(t, outputs),
+		DifferentialUniformity: DifferentialUniformity(t),
+	}
+}
+
+// Leaks returns the ways the profile of a table with the given number of possible outputs is distinguishable from that
+// of a uniformly random function, or nil if it isn't. Each statistic is compared against a limit that a random function
+// exceeds with probability about 2^-20; only excesses are reported, since a table built from bijective encodings is
+// supposed to be more balanced than random.
+func (p Profile) Leaks(outputs int) (out []string) {
+	chi, bias, uniformity := limits(outputs)
+
+	if p.ChiSquared > chi {
+		out = append(out, "unbalanced outputs")
+	}
+	if p.LinearBias > bias {
+		out = append(out, "linear bias")
+	}
+	if p.DifferentialUniformity > uniformity {
+		out = append(out, "differential bias")
+	}
+
+	return out
+}
+
+// limits returns the largest chi-squared statistic, linear bias, and differential uniformity that a random function
+// from bytes to the given number of outputs is likely to have.
+func limits(outputs int) (chi, bias float64, uniformity int) {
+	bits := math.Log2(float64(outputs))
+
+	// The Wilson-Hilferty approximation of the chi-squared distribution, with outputs-1 degrees of freedom.
+	df, z := float64(outputs-1), 4.76
+	chi = df * math.Pow(1-2/(9*df)+z*math.Sqrt(2/(9*df)), 3)
+
+	// Hoeffding's bound on each of the 255*(outputs-1) Walsh coefficients, a sum of 256 signs.
+	masks := 255 * float64(outputs-1)
+	bias = math.Sqrt(512*math.Log(2*masks/falsePositive)) / 256
+
+	// Each of the 255*outputs entries of the difference table counts both inputs of each of 128 pairs, each of which
+	// lands on the entry with probability 1/outputs.
+	entries, q := 255*float64(outputs), math.Pow(2, -bits)
+	for pairs := 0; pairs <= 128; pairs++ {
+		if entries*binomialTail(128, pairs+1, q) <= falsePositive {
+			return chi, bias, 2 * pairs
+		}
+	}
+
+	return chi, bias, 256
+}
+
+// binomialTail returns the probability of at least k successes in n trials that each succeed with probability q.
+func binomialTail(n, k int, q float64) float64 {
+	out := 0.0
+	for i := k; i <= n; i++ {
+		a, _ := math.Lgamma(float64(n + 1))
+		b, _ := math.Lgamma(float64(i + 1))
+		c, _ := math.Lgamma(float64(n - i + 1))
+
+		out += math.Exp(a - b - c + float64(i)*math.Log(q) + float64(n-i)*math.Log(1-q))
+	}
+
+	return out
+}
+
+// readAll returns a copy of t that's cheap to read, for tables whose entries are computed on every lookup.
+func readAll(t table.Byte) table.ParsedByte {
+	out := make(table.ParsedByte, 256)
+	for x := 0; x < 256; x++ {
+		out[x] = t.Get(byte(x))
+	}
+
+	return out
+}
+
+func parity(x byte) bool {
+	x ^= x >> 4
+	x ^= x >> 2
+	x ^= x >> 1
+
+	return x&1 == 1
+}
+
+// walsh computes the Walsh-Hadamard transform of f in place.
+func walsh(f *[256]int64) {
+	for h := 1; h < 256; h *= 2 {
+		for i := 0; i < 256; i += 2 * h {
+			for j := i; j < i+h; j++ {
+				f[j], f[j+h] = f[j]+f[j+h], f[j]-f[j+h]
+			}
+		}
+	}
+}
@@ -0,0 +1,116 @@
+// Package stats implements the frequency and collision distinguishers from early analyses of encoded tables. They look
+// only at which outputs a table gives and which inputs share them, so they see straight through any encoding of the
+// output--a bijection relabels outputs, but can't change how many inputs land on each one, or which inputs collide.
+//
+// A table built correctly from bijective encodings is balanced: every output is hit equally often, and the table says
+// nothing on its own. A table whose encodings aren't bijections, or that computes a function that isn't balanced, shows
+// it in its counts. And tables that compute the same function under different output encodings have the same collisions,
+// so they can be bucketed together even though no two entries match. Use these to check that a new encoding scheme
+// doesn't leak before building anything on it.
+//
+// Beyond counting, NewProfile measures a table's entropy and its linear and differential profiles, and Leaks compares
+// them against what a random function would give. Analyze does that for every table of a Chow construction. Every Chow
+// construction has tables that a random function wouldn't: its XOR tables compute XOR under 4-bit encodings, which are
+// too small to hide much, and that's the structure the published attacks start from. What the analysis is for is
+// comparing constructions--which tables a new option flags, or stops flagging--and finding tables that are fully linear
+// or unbalanced when they shouldn't be.
+//
+// table.Nibble and table.Byte have the same method set, so every function here takes either.
+package stats
+
+import (
+	"sort"
+
+	"github.com/OpenWhiteBox/primitives/table"
+)
+
+// Counts returns how many of the 256 inputs of t give each output.
+func Counts(t table.Byte) (out [256]int) {
+	for x := 0; x < 256; x++ {
+		out[t.Get(byte(x))]++
+	}
+
+	return
+}
+
+// Signature returns the frequency signature of a table with the given counts: the number of inputs that give each
+// output it ever gives, from most to least. It's unchanged by any encoding of the table's input or output.
+func Signature(counts [256]int) []int {
+	out := []int{}
+	for _, c := range counts {
+		if c > 0 {
+			out = append(out, c)
+		}
+	}
+
+	sort.Sort(sort.Reverse(sort.IntSlice(out)))
+	return out
+}
+
+// ChiSquared returns the chi-squared statistic of the counts of a table with the given number of possible outputs
+// against the uniform distribution: 16 for a table.Nibble and 256 for a table.Byte. It's zero for a balanced table. With
+// outputs-1 degrees of freedom, anything over about 1.5 times that number is suspicious.
+func ChiSquared(counts [256]int, outputs int) float64 {
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+
+	expected, out := float64(total)/float64(outputs), 0.0
+	for _, c := range counts[:outputs] {
+		out += (float64(c) - expected) * (float64(c) - expected) / expected
+	}
+
+	return out
+}
+
+// Balanced returns true if every one of the given number of possible outputs of t is given by the same number of
+// inputs.
+func Balanced(t table.Byte, outputs int) bool {
+	counts := Counts(t)
+
+	for _, c := range counts[:outputs] {
+		if c != 256/outputs {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Partition returns the partition of the inputs of t by which ones collide: out[x] is the smallest input that gives the
+// same output as x. It's unchanged by any encoding of the output.
+func Partition(t table.Byte) (out [256]byte) {
+	first := make(map[byte]byte)
+
+	for x := 0; x < 256; x++ {
+		y := t.Get(byte(x))
+		if _, ok := first[y]; !ok {
+			first[y] = byte(x)
+		}
+
+		out[x] = first[y]
+	}
+
+	return
+}
+
+// Buckets groups the given tables by their collisions: the tables in each bucket have the same Partition, so they compute
+// the same function of their input up to an encoding of the output. Each bucket lists the indices of its tables in
+// order, and buckets are ordered by their first table.
+func Buckets(tables []table.Byte) (out [][]int) {
+	index := make(map[[256]byte]int)
+
+	for i, t := range tables {
+		p := Partition(t)
+
+		if b, ok := index[p]; ok {
+			out[b] = append(out[b], i)
+		} else {
+			index[p] = len(out)
+			out = append(out, []int{i})
+		}
+	}
+
+	return
+}
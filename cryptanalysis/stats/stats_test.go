@@ -0,0 +1,128 @@
+package stats
+
+import (
+	"crypto/sha256"
+	"testing"
+
+	"github.com/OpenWhiteBox/primitives/table"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+	"github.com/OpenWhiteBox/AES/constructions/saes"
+)
+
+var (
+	key  = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+)
+
+type tableFunc func(byte) byte
+
+func (tf tableFunc) Get(x byte) byte { return tf(x) }
+
+func TestXORTables(t *testing.T) {
+	constr, _, _ := chow.GenerateEncryptionKeys(key, seed, common.IndependentMasks{common.RandomMask, common.RandomMask})
+
+	for round := range constr.HighXORTable {
+		for pos := 0; pos < 32; pos++ {
+			for gate := 0; gate < 3; gate++ {
+				if xt := constr.HighXORTable[round][pos][gate]; !Balanced(xt, 16) || ChiSquared(Counts(xt), 16) != 0 {
+					t.Fatalf("XOR table isn't balanced! round=%v pos=%v gate=%v", round, pos, gate)
+				}
+			}
+		}
+	}
+}
+
+func TestLeakyEncoding(t *testing.T) {
+	// An XOR table whose output encoding isn't a bijection: two outputs are merged into one.
+	leaky := tableFunc(func(x byte) byte {
+		if y := x>>4 ^ x&0x0f; y != 15 {
+			return y
+		}
+		return 0
+	})
+
+	if Balanced(leaky, 16) {
+		t.Fatalf("Leaky table is balanced!")
+	} else if ChiSquared(Counts(leaky), 16) < 15*1.5 {
+		t.Fatalf("Leaky table passes the chi-squared test! %v", ChiSquared(Counts(leaky), 16))
+	}
+
+	sig := Signature(Counts(leaky))
+	if len(sig) != 15 || sig[0] != 32 || sig[1] != 16 {
+		t.Fatalf("Leaky table has the wrong signature! %v", sig)
+	}
+}
+
+func TestBuckets(t *testing.T) {
+	xor := func(x byte) byte { return x>>4 ^ x&0x0f }
+	and := func(x byte) byte { return x >> 4 & x }
+
+	tables := []table.Byte{
+		tableFunc(xor),
+		tableFunc(and),
+		tableFunc(func(x byte) byte { return 15 - xor(x) }), // xor under an output encoding.
+		tableFunc(func(x byte) byte { return and(x) ^ 3 }),  // and under an output encoding.
+	}
+
+	buckets := Buckets(tables)
+	if len(buckets) != 2 || len(buckets[0]) != 2 || buckets[0][1] != 2 || buckets[1][1] != 3 {
+		t.Fatalf("Tables were bucketed wrong! %v", buckets)
+	}
+}
+
+func TestProfile(t *testing.T) {
+	// A random function, and AES' S-box, which is further from linear than a random function.
+	random := tableFunc(func(x byte) byte { return sha256.Sum256([]byte{x})[0] })
+	aes := saes.Construction{}
+	sbox := tableFunc(func(x byte) byte { return aes.SubByte(x) })
+
+	for name, tbl := range map[string]table.Byte{"random": random, "S-box": sbox} {
+		if leaks := NewProfile(tbl, 256).Leaks(256); leaks != nil {
+			t.Fatalf("%v table is distinguishable from random! %v", name, leaks)
+		}
+	}
+
+	randomNibble := tableFunc(func(x byte) byte { return random.Get(x) & 0x0f })
+	if leaks := NewProfile(randomNibble, 16).Leaks(16); leaks != nil {
+		t.Fatalf("Random nibble table is distinguishable from random! %v", leaks)
+	}
+
+	if p := NewProfile(sbox, 256); p.Entropy != 8 || p.LinearBias != 0.125 || p.DifferentialUniformity != 4 {
+		t.Fatalf("S-box has the wrong profile! %+v", p)
+	}
+
+	// An XOR table without encodings is linear.
+	xor := tableFunc(func(x byte) byte { return x>>4 ^ x&0x0f })
+	p := NewProfile(xor, 16)
+
+	if p.Entropy != 4 || p.LinearBias != 1 || p.DifferentialUniformity != 256 {
+		t.Fatalf("XOR table has the wrong profile! %+v", p)
+	} else if leaks := p.Leaks(16); len(leaks) != 2 {
+		t.Fatalf("XOR table has the wrong leaks! %v", leaks)
+	}
+}
+
+func TestAnalyze(t *testing.T) {
+	masks := common.IndependentMasks{common.RandomMask, common.RandomMask}
+
+	// Count the XOR tables of the middle rounds that are linear.
+	linear := func(opts chow.Opts) (n int) {
+		constr, _, _ := chow.GenerateEncryptionKeys(key, seed, opts)
+
+		for _, r := range Analyze(&constr) {
+			if (r.Table.Kind == chow.HighXORTable || r.Table.Kind == chow.LowXORTable) && r.LinearBias == 1 {
+				n++
+			}
+		}
+
+		return n
+	}
+
+	if n := linear(chow.Opts{Masks: masks}); n != 0 {
+		t.Fatalf("Encoded XOR tables are linear! %v", n)
+	} else if n := linear(chow.Opts{Masks: masks, Naked: true}); n != 9*2*32*3 {
+		t.Fatalf("Not every naked XOR table is linear! %v", n)
+	}
+}
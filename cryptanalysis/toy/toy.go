@@ -4,33 +4,14 @@
 package toy
 
 import (
+	"bytes"
+
 	"github.com/OpenWhiteBox/primitives/encoding"
 
-	"github.com/OpenWhiteBox/AES/constructions/saes"
 	"github.com/OpenWhiteBox/AES/constructions/toy"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/network"
 )
 
-var powx = [16]byte{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x1b, 0x36, 0x6c, 0xd8, 0xab, 0x4d, 0x9a, 0x2f}
-
-// backOneRound takes round key i and returns round key i-1.
-func backOneRound(roundKey [16]byte, round int) (out [16]byte) {
-	constr := saes.Construction{}
-
-	// Recover everything except the first word by XORing consecutive blocks.
-	for pos := 4; pos < 16; pos++ {
-		out[pos] = roundKey[pos] ^ roundKey[pos-4]
-	}
-
-	// Recover the first word by XORing the first block of the roundKey with f(last block of roundKey), where f is a
-	// subroutine of AES' key scheduling algorithm.
-	for pos := 0; pos < 4; pos++ {
-		out[pos] = roundKey[pos] ^ constr.SubByte(out[12+(pos+1)%4])
-	}
-	out[0] ^= powx[round-1]
-
-	return
-}
-
 // RecoverKey returns the AES key used to generate the given white-box construction.
 func RecoverKey(constr *toy.Construction) []byte {
 	var (
@@ -90,9 +71,8 @@ func RecoverKey(constr *toy.Construction) []byte {
 				encoding.InverseBlock{aux1.BlockLinear}, guess, round,
 			}.Encode(key2)
 
-			if cand1 == backOneRound(cand2, 2) {
-				sol := backOneRound(cand1, 1)
-				return sol[:]
+			if bytes.Equal(cand1[:], network.BackOneRound(cand2[:], 2)) {
+				return network.BackOneRound(cand1[:], 1)
 			}
 		}
 	}
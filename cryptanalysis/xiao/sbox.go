@@ -5,22 +5,9 @@ import (
 	"github.com/OpenWhiteBox/primitives/equivalence"
 	"github.com/OpenWhiteBox/primitives/matrix"
 
-	"github.com/OpenWhiteBox/AES/constructions/saes"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/network"
 )
 
-// sbox is a Byte encoding of AES's "standard" S-box.
-type sbox struct{}
-
-func (sbox sbox) Encode(in byte) byte {
-	constr := saes.Construction{}
-	return constr.SubByte(in)
-}
-
-func (sbox sbox) Decode(in byte) byte {
-	constr := saes.Construction{}
-	return constr.UnSubByte(in)
-}
-
 // sboxLayer implements methods for disambiguating an S-box layer of the SPN.
 type sboxLayer encoding.ConcatenatedBlock
 
@@ -67,7 +54,7 @@ func (sbl *sboxLayer) whiten() (mask [16]byte) {
 // cleanLinear finds the linear error on the input and output of each middle S-box. It removes it from the S-box and
 // returns it. After this function is applied, all S-boxes will be equal to the whitened standard S-box, Sbar.
 func (sbl *sboxLayer) cleanLinear() (in, out encoding.ConcatenatedBlock) {
-	Sbar := encoding.ComposedBytes{encoding.ByteAdditive(0x52), sbox{}}
+	Sbar := encoding.ComposedBytes{encoding.ByteAdditive(0x52), network.SBox{}}
 
 	for pos := 0; pos < 16; pos++ {
 		eqs := equivalence.FindLinear((*sbl)[pos], Sbar, 1)
@@ -1,42 +1,24 @@
 // Package xiao implements a cryptanalysis of the Xiao and Lai's white-box AES constructions.
 //
-// It is built on top of the ASA cryptanalysis from Generic/cryptanalysis/spn.
+// It is built on top of the ASA cryptanalysis from Generic/cryptanalysis/spn, through cryptanalysis/network, and
+// follows De Mulder, Roelse, and Preneel's linear equivalence attack on the construction.
 //
 // http://dl.acm.org/citation.cfm?id=2995314
 package xiao
 
 import (
+	"errors"
+	"fmt"
+
 	"github.com/OpenWhiteBox/primitives/encoding"
 
 	"github.com/OpenWhiteBox/AES/constructions/saes"
 	"github.com/OpenWhiteBox/AES/constructions/xiao"
+	"github.com/OpenWhiteBox/AES/cryptanalysis/network"
 
-	cspn "github.com/OpenWhiteBox/Generic/constructions/spn"
 	aspn "github.com/OpenWhiteBox/Generic/cryptanalysis/spn"
 )
 
-var powx = [16]byte{0x01, 0x02, 0x04, 0x08, 0x10, 0x20, 0x40, 0x80, 0x1b, 0x36, 0x6c, 0xd8, 0xab, 0x4d, 0x9a, 0x2f}
-
-// backOneRound takes round key i and returns round key i-1.
-func backOneRound(roundKey []byte, round int) (out []byte) {
-	out = make([]byte, 16)
-	constr := saes.Construction{}
-
-	// Recover everything except the first word by XORing consecutive blocks.
-	for pos := 4; pos < 16; pos++ {
-		out[pos] = roundKey[pos] ^ roundKey[pos-4]
-	}
-
-	// Recover the first word by XORing the first block of the roundKey with f(last block of roundKey), where f is a
-	// subroutine of AES' key scheduling algorithm.
-	for pos := 0; pos < 4; pos++ {
-		out[pos] = roundKey[pos] ^ constr.SubByte(out[12+(pos+1)%4])
-	}
-	out[0] ^= powx[round-1]
-
-	return
-}
-
 // shiftrows implements a Block encoding over the ShiftRows operation.
 type shiftrows struct{}
 
@@ -58,6 +40,15 @@ func (sr shiftrows) Decode(in [16]byte) (out [16]byte) {
 	return
 }
 
+// tables describes the table network of a construction, for the generic parts of the attack in cryptanalysis/network.
+type tables struct {
+	construction *xiao.Construction
+}
+
+func (t tables) Rounds() int { return t.construction.Rounds() }
+
+func (t tables) Round(r int) aspn.Cipher { return round{construction: t.construction, round: r} }
+
 // round isolates one round of encryption with an AES white-box.
 type round struct {
 	construction *xiao.Construction
@@ -73,19 +64,36 @@ func (r round) Encrypt(dst, src []byte) {
 	}
 }
 
-// RecoverKey returns the AES key used to generate the given white-box construction.
-func RecoverKey(constr *xiao.Construction) []byte {
-	round1 := round{
-		construction: constr,
-		round:        1,
+// RecoverKey runs the whole attack on the given white-box construction and returns the AES key it was generated with.
+// Like the attack on Chow et al.'s construction, it only needs the tables:
+//
+//  1. Decomposition: the second round is decomposed into an affine layer, an S-box layer, and another affine layer,
+//     which strips the mixing bijections down to unknown affine transformations.
+//  2. Disambiguation: the affine layers are put in block-diagonal form and the S-boxes are cleaned until they're equal
+//     to AES', up to the noise of their self-equivalences, which is then searched off against MixColumns.
+//  3. Key extraction: the constant part of the leading affine layer is the round key, which is walked back to the
+//     master key.
+//
+// Only AES-128 constructions are supported; the key schedule inversion doesn't apply to longer keys. An error is
+// returned if the construction doesn't have the structure the attack expects.
+func RecoverKey(constr *xiao.Construction) (key []byte, err error) {
+	if constr.Rounds() != 10 {
+		return nil, errors.New("Only AES-128 constructions are supported!")
 	}
 
+	// The decomposition panics if the round isn't an SPN of the expected shape.
+	defer func() {
+		if r := recover(); r != nil {
+			key, err = nil, fmt.Errorf("Attack failed! %v", r)
+		}
+	}()
+
 	// Decomposition Phase
-	constr1 := aspn.DecomposeSPN(round1, cspn.ASA)
+	constr1 := network.DecomposeASA(tables{constr}, 1)
 
 	var (
-		first, last = affineLayer(constr1[0].(encoding.BlockAffine)), affineLayer(constr1[2].(encoding.BlockAffine))
-		middle      = sboxLayer(constr1[1].(encoding.ConcatenatedBlock))
+		first, last = affineLayer(constr1.First), affineLayer(constr1.Last)
+		middle      = sboxLayer(constr1.Middle)
 	)
 
 	// Disambiguation Phase
@@ -141,5 +149,5 @@ func RecoverKey(constr *xiao.Construction) []byte {
 	//   true
 
 	roundKey := shiftrows{}.Decode(first.BlockAdditive)
-	return backOneRound(roundKey[:], 1)
+	return network.MasterKey(roundKey[:], 1), nil
 }
@@ -23,9 +23,25 @@ func TestRecoverKey(t *testing.T) {
 		t.Fatalf("xiao.Parse returned error: %v", err)
 	}
 
-	cand := RecoverKey(&constr2)
+	cand, err := RecoverKey(&constr2)
+	if err != nil {
+		t.Fatal(err)
+	}
 
 	if !bytes.Equal(key, cand) {
 		t.Fatal("Generated key does not equal recovered key!")
 	}
 }
+
+func TestRecoverKeyUnsupported(t *testing.T) {
+	key := make([]byte, 32)
+	rand.Read(key)
+
+	constr, _, _ := xiao.GenerateEncryptionKeys(
+		key, key, common.IndependentMasks{common.RandomMask, common.RandomMask},
+	)
+
+	if _, err := RecoverKey(&constr); err == nil {
+		t.Fatalf("Attack on AES-256 didn't return an error!")
+	}
+}
@@ -0,0 +1,97 @@
+package modes
+
+import (
+	"hash"
+)
+
+// cmac is CMAC (OMAC1, RFC 4493) over a white-boxed block cipher.
+type cmac struct {
+	b      Block
+	k1, k2 [16]byte // The subkeys, for a final block that's full or padded.
+
+	x   [16]byte // The chaining value: the encryption of every block processed so far.
+	buf []byte   // The unprocessed end of the message, up to a whole block, since the last block is treated differently.
+}
+
+// NewCMAC returns a hash.Hash computing CMAC (OMAC1, RFC 4493) with the key of b, which should wrap an encryption
+// construction. Tags are 16 bytes long, and should be compared with hmac.Equal.
+//
+// Every block, the subkey derivation included, is encrypted through b, so its encodings are stripped before the
+// construction's output is chained into anything. The subkeys are derived from AES(0) and are kept in memory
+// unencoded, like the chaining value: they authenticate messages, but don't reveal the AES key.
+func NewCMAC(b Block) hash.Hash {
+	c := &cmac{b: b, buf: make([]byte, 0, 16)}
+
+	l := [16]byte{}
+	b.Encrypt(l[:], l[:])
+
+	c.k1 = double(l)
+	c.k2 = double(c.k1)
+
+	return c
+}
+
+// double multiplies a block by x in GF(2^128), with the polynomial x^128 + x^7 + x^2 + x + 1.
+func double(in [16]byte) (out [16]byte) {
+	for i := 0; i < 15; i++ {
+		out[i] = in[i]<<1 | in[i+1]>>7
+	}
+	out[15] = in[15] << 1
+
+	// Reduce without branching on the secret top bit.
+	out[15] ^= 0x87 & -(in[0] >> 7)
+
+	return
+}
+
+func (c *cmac) Write(p []byte) (int, error) {
+	n := len(p)
+
+	for len(p) > 0 {
+		// A full buffer is only processed once more data arrives, because the last block is treated differently.
+		if len(c.buf) == 16 {
+			c.process(c.buf)
+			c.buf = c.buf[:0]
+		}
+
+		m := copy(c.buf[len(c.buf):16], p)
+		c.buf, p = c.buf[:len(c.buf)+m], p[m:]
+	}
+
+	return n, nil
+}
+
+// process chains one full block into the chaining value.
+func (c *cmac) process(block []byte) {
+	for i := range c.x {
+		c.x[i] ^= block[i]
+	}
+	c.b.Encrypt(c.x[:], c.x[:])
+}
+
+// Sum appends the tag of the message written so far to in. It doesn't change the state, so more can be written after.
+func (c *cmac) Sum(in []byte) []byte {
+	last := [16]byte{}
+	copy(last[:], c.buf)
+
+	subkey := c.k1
+	if len(c.buf) < 16 {
+		last[len(c.buf)] = 0x80
+		subkey = c.k2
+	}
+
+	x := c.x
+	for i := range x {
+		x[i] ^= last[i] ^ subkey[i]
+	}
+	c.b.Encrypt(x[:], x[:])
+
+	return append(in, x[:]...)
+}
+
+func (c *cmac) Reset() {
+	c.x, c.buf = [16]byte{}, c.buf[:0]
+}
+
+func (c *cmac) Size() int      { return 16 }
+func (c *cmac) BlockSize() int { return 16 }
@@ -0,0 +1,176 @@
+package modes
+
+import (
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"sync"
+)
+
+// NonceSize is the size of the nonces taken by a Counter. The rest of each counter block is a 32-bit block counter.
+const NonceSize = 12
+
+// Counter is counter mode over one white-boxed key, with the nonce management that NewCTR leaves to the caller. Each
+// message gets its own nonce, and its keystream is the encryption of nonce || counter for a 32-bit big-endian counter
+// starting at 0, the same as crypto/cipher.NewCTR with that IV. Every block goes through b, so the keystream has the
+// construction's output encoding stripped before it's XORed into the message.
+//
+// Counters refuse to hand out the keystream of a nonce for encryption twice, and a stream stops before its counter
+// wraps, so no counter block is ever encrypted twice for as long as the process runs. The nonces are remembered per AES
+// key, not per Counter: every Counter over the same key, through whichever construction or Block, shares them. A key
+// reused across restarts still needs nonces from NewNonce to stay apart. Remembering the nonces costs 12 bytes per
+// message, and they're never forgotten. A Counter is safe for concurrent use.
+type Counter struct {
+	b      Block
+	nonces *nonceSet
+}
+
+// nonceSet is the nonces used with one AES key.
+type nonceSet struct {
+	mu   sync.Mutex
+	used map[[NonceSize]byte]bool // False while a nonce is only reserved by NewNonce, true once it's been used.
+}
+
+// keyNonce is never handed out for encryption. NewCounter identifies an AES key by the first block of its keystream.
+var keyNonce = [NonceSize]byte{0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}
+
+var (
+	noncesMu sync.Mutex
+	nonces   = make(map[[16]byte]*nonceSet) // AES key's first block of keystream under keyNonce -> nonces used.
+)
+
+// NewCounter returns a Counter encrypting with b, which should wrap an encryption construction. Only encryption is
+// needed for both directions.
+func NewCounter(b Block) *Counter {
+	id := [16]byte{}
+	copy(id[:], keyNonce[:])
+	b.Encrypt(id[:], id[:])
+
+	noncesMu.Lock()
+	defer noncesMu.Unlock()
+
+	set, ok := nonces[id]
+	if !ok {
+		set = &nonceSet{used: map[[NonceSize]byte]bool{keyNonce: true}}
+		nonces[id] = set
+	}
+
+	return &Counter{b: b, nonces: set}
+}
+
+// NewNonce reads a random nonce from crypto/rand that hasn't been used or reserved with this key, and reserves it. The
+// first call to Stream with the nonce, on any Counter over the key, uses it up.
+func (c *Counter) NewNonce() ([]byte, error) {
+	for {
+		nonce := make([]byte, NonceSize)
+		if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+			return nil, err
+		}
+		key := [NonceSize]byte(nonce)
+
+		c.nonces.mu.Lock()
+		_, taken := c.nonces.used[key]
+		if !taken {
+			c.nonces.used[key] = false
+		}
+		c.nonces.mu.Unlock()
+
+		if !taken {
+			return nonce, nil
+		}
+	}
+}
+
+// Stream returns a cipher.Stream which encrypts one message under the given nonce. An error is returned if the nonce
+// isn't NonceSize bytes long, or if it was already used with this key. The stream panics if it's asked for more than
+// 2^32 blocks of keystream.
+func (c *Counter) Stream(nonce []byte) (cipher.Stream, error) {
+	if len(nonce) != NonceSize {
+		return nil, errors.New("Nonce is the wrong size!")
+	}
+	key := [NonceSize]byte(nonce)
+
+	c.nonces.mu.Lock()
+	defer c.nonces.mu.Unlock()
+
+	if c.nonces.used[key] {
+		return nil, errors.New("Nonce was already used!")
+	}
+	c.nonces.used[key] = true
+
+	return c.stream(key), nil
+}
+
+// XORKeyStream encrypts src into dst under the given nonce, like Stream(nonce).XORKeyStream(dst, src).
+func (c *Counter) XORKeyStream(dst, src, nonce []byte) error {
+	s, err := c.Stream(nonce)
+	if err != nil {
+		return err
+	}
+
+	s.XORKeyStream(dst, src)
+	return nil
+}
+
+// DecryptStream returns a cipher.Stream which decrypts one message encrypted under the given nonce. Decryption doesn't
+// use up the nonce, so it's allowed any number of times; don't encrypt with the stream it returns. An error is returned
+// if the nonce isn't NonceSize bytes long.
+func (c *Counter) DecryptStream(nonce []byte) (cipher.Stream, error) {
+	if len(nonce) != NonceSize {
+		return nil, errors.New("Nonce is the wrong size!")
+	}
+
+	return c.stream([NonceSize]byte(nonce)), nil
+}
+
+// Decrypt decrypts src into dst under the given nonce, like DecryptStream(nonce).XORKeyStream(dst, src).
+func (c *Counter) Decrypt(dst, src, nonce []byte) error {
+	s, err := c.DecryptStream(nonce)
+	if err != nil {
+		return err
+	}
+
+	s.XORKeyStream(dst, src)
+	return nil
+}
+
+// stream returns the keystream of nonce.
+func (c *Counter) stream(nonce [NonceSize]byte) *counterStream {
+	s := &counterStream{b: c.b, pos: 16}
+	copy(s.block[:], nonce[:])
+
+	return s
+}
+
+// counterStream is the keystream of one nonce.
+type counterStream struct {
+	b Block
+
+	block     [16]byte // The next counter block: nonce || counter.
+	blocks    uint64   // The number of counter blocks encrypted so far.
+	keystream [16]byte
+	pos       int // The number of bytes of keystream already used.
+}
+
+func (s *counterStream) XORKeyStream(dst, src []byte) {
+	if len(dst) < len(src) {
+		panic("Output smaller than input!")
+	}
+
+	for i := range src {
+		if s.pos == 16 {
+			if s.blocks == 1<<32 {
+				panic("Counter space exhausted!")
+			}
+
+			s.b.Encrypt(s.keystream[:], s.block[:])
+			binary.BigEndian.PutUint32(s.block[NonceSize:], uint32(s.blocks+1))
+			s.blocks, s.pos = s.blocks+1, 0
+		}
+
+		dst[i] = src[i] ^ s.keystream[s.pos]
+		s.pos++
+	}
+}
@@ -0,0 +1,192 @@
+package modes
+
+import (
+	"encoding/binary"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// digits are the numerals of FF1's string methods, in order, as in strconv.
+const digits = "0123456789abcdefghijklmnopqrstuvwxyz"
+
+// FF1 is the FF1 format-preserving encryption scheme (NIST SP 800-38G) over a white-boxed key. It encrypts strings of
+// numerals in some radix--card numbers, account numbers, and other tokens--into strings of the same length and radix.
+//
+// FF1 is a Feistel network whose round function is a CBC-MAC of the key, computed through b, so the construction's
+// encodings are stripped before its output is used as a round value. Only the round function uses the key, and only to
+// encrypt, so b wraps an encryption construction for both directions.
+type FF1 struct {
+	b     Block
+	radix int
+}
+
+// NewFF1 returns FF1 over b for numerals in the given radix, between 2 and 65536.
+func NewFF1(b Block, radix int) (FF1, error) {
+	if radix < 2 || radix > 1<<16 {
+		return FF1{}, errors.New("Radix must be between 2 and 65536!")
+	}
+
+	return FF1{b, radix}, nil
+}
+
+// Encrypt encrypts a string of numerals, each less than the radix, under the given tweak. Strings must be at least two
+// numerals long and have at least a million possible values, so that the Feistel network is secure. An error is
+// returned if the numerals or the tweak aren't valid.
+func (f FF1) Encrypt(x []uint16, tweak []byte) ([]uint16, error) {
+	return f.crypt(x, tweak, false)
+}
+
+// Decrypt decrypts a string of numerals encrypted under the given tweak, undoing Encrypt.
+func (f FF1) Decrypt(x []uint16, tweak []byte) ([]uint16, error) {
+	return f.crypt(x, tweak, true)
+}
+
+// EncryptString is like Encrypt, but for strings written with the first radix characters of 0-9 and then a-z, like
+// strconv. The radix must be at most 36.
+func (f FF1) EncryptString(x string, tweak []byte) (string, error) {
+	return f.cryptString(x, tweak, false)
+}
+
+// DecryptString decrypts a string encrypted with EncryptString under the given tweak.
+func (f FF1) DecryptString(x string, tweak []byte) (string, error) {
+	return f.cryptString(x, tweak, true)
+}
+
+func (f FF1) cryptString(x string, tweak []byte, decrypt bool) (string, error) {
+	if f.radix > len(digits) {
+		return "", errors.New("Radix is too large to write as a string!")
+	}
+
+	numerals := make([]uint16, len(x))
+	for i := 0; i < len(x); i++ {
+		d := strings.IndexByte(digits[:f.radix], x[i])
+		if d < 0 {
+			return "", errors.New("String has a character that isn't a numeral!")
+		}
+		numerals[i] = uint16(d)
+	}
+
+	out, err := f.crypt(numerals, tweak, decrypt)
+	if err != nil {
+		return "", err
+	}
+
+	res := make([]byte, len(out))
+	for i, d := range out {
+		res[i] = digits[d]
+	}
+
+	return string(res), nil
+}
+
+func (f FF1) crypt(x []uint16, tweak []byte, decrypt bool) ([]uint16, error) {
+	n, t := len(x), len(tweak)
+	radix := big.NewInt(int64(f.radix))
+
+	if n < 2 || uint64(n) > 0xffffffff || new(big.Int).Exp(radix, big.NewInt(int64(n)), nil).Cmp(big.NewInt(1000000)) < 0 {
+		return nil, errors.New("String is too short to encrypt securely, or too long!")
+	} else if uint64(t) > 0xffffffff {
+		return nil, errors.New("Tweak is too long!")
+	}
+	for _, d := range x {
+		if int(d) >= f.radix {
+			return nil, errors.New("Numeral is larger than the radix!")
+		}
+	}
+
+	u, v := n/2, n-n/2
+	a, b := f.num(x[:u]), f.num(x[u:])
+
+	// The byte lengths of the larger half as a number, and of the round value.
+	modU := new(big.Int).Exp(radix, big.NewInt(int64(u)), nil)
+	modV := new(big.Int).Exp(radix, big.NewInt(int64(v)), nil)
+	bLen := (new(big.Int).Sub(modV, big.NewInt(1)).BitLen() + 7) / 8
+	dLen := 4*((bLen+3)/4) + 4
+
+	p := make([]byte, 16, 16+t+16+bLen)
+	p[0], p[1], p[2] = 1, 2, 1
+	p[3], p[4], p[5] = byte(f.radix>>16), byte(f.radix>>8), byte(f.radix)
+	p[6], p[7] = 10, byte(u)
+	binary.BigEndian.PutUint32(p[8:], uint32(n))
+	binary.BigEndian.PutUint32(p[12:], uint32(t))
+
+	// q = tweak || zeros || round || NUM(B), padded so that p || q is a whole number of blocks.
+	q := append(p, tweak...)
+	q = append(q, make([]byte, (16-(t+bLen+1)%16)%16)...)
+	roundPos := len(q)
+	q = append(q, make([]byte, 1+bLen)...)
+
+	// Encryption feeds B to the round function and adds its output to A; decryption runs the rounds backwards.
+	y := new(big.Int)
+	for j := 0; j < 10; j++ {
+		i, in := j, b
+		if decrypt {
+			i, in = 9-j, a
+		}
+
+		q[roundPos] = byte(i)
+		in.FillBytes(q[roundPos+1:])
+		y.SetBytes(f.round(q, dLen))
+
+		mod := modU
+		if i%2 == 1 {
+			mod = modV
+		}
+
+		if decrypt {
+			c := new(big.Int).Sub(b, y)
+			a, b = c.Mod(c, mod), a
+		} else {
+			c := new(big.Int).Add(a, y)
+			a, b = b, c.Mod(c, mod)
+		}
+	}
+
+	return append(f.str(a, u), f.str(b, v)...), nil
+}
+
+// round is the round function of FF1: the CBC-MAC of in, extended to size bytes by encrypting it XORed with counters.
+func (f FF1) round(in []byte, size int) []byte {
+	r := [16]byte{}
+	for i := 0; i < len(in); i += 16 {
+		for j := range r {
+			r[j] ^= in[i+j]
+		}
+		f.b.Encrypt(r[:], r[:])
+	}
+
+	out := append(make([]byte, 0, size+15), r[:]...)
+	for i := 1; len(out) < size; i++ {
+		block := r
+		binary.BigEndian.PutUint64(block[8:], binary.BigEndian.Uint64(block[8:])^uint64(i))
+		f.b.Encrypt(block[:], block[:])
+
+		out = append(out, block[:]...)
+	}
+
+	return out[:size]
+}
+
+// num returns the number written by a string of numerals, most significant first.
+func (f FF1) num(x []uint16) *big.Int {
+	out, radix := new(big.Int), big.NewInt(int64(f.radix))
+	for _, d := range x {
+		out.Mul(out, radix).Add(out, big.NewInt(int64(d)))
+	}
+
+	return out
+}
+
+// str writes a number as a string of m numerals, most significant first.
+func (f FF1) str(x *big.Int, m int) []uint16 {
+	out, radix := make([]uint16, m), big.NewInt(int64(f.radix))
+	x, d := new(big.Int).Set(x), new(big.Int)
+
+	for i := m - 1; i >= 0; i-- {
+		x.DivMod(x, radix, d)
+		out[i] = uint16(d.Int64())
+	}
+
+	return out
+}
@@ -0,0 +1,16 @@
+package modes
+
+import (
+	"crypto/cipher"
+)
+
+// NewGCM returns a cipher.AEAD which seals/opens using b in Galois/Counter mode with the standard nonce and tag sizes.
+// Both the CTR keystream and the GHASH key, H = AES(0), are computed by the white-boxed construction, so b only needs to
+// wrap an encryption construction.
+func NewGCM(b Block) (cipher.AEAD, error) { return cipher.NewGCM(b) }
+
+// NewGCMWithNonceSize is like NewGCM, but accepts nonces of the given length. Only use this to interoperate with
+// existing systems that use non-standard nonce lengths.
+func NewGCMWithNonceSize(b Block, size int) (cipher.AEAD, error) {
+	return cipher.NewGCMWithNonceSize(b, size)
+}
@@ -0,0 +1,161 @@
+package modes
+
+import (
+	"crypto/subtle"
+	"encoding/binary"
+	"errors"
+)
+
+var (
+	kwIV  = []byte{0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6, 0xa6} // The initial value of KW, from RFC 3394.
+	kwpIV = []byte{0xa6, 0x59, 0x59, 0xa6}                         // The first half of the initial value of KWP, from RFC 5649.
+)
+
+// Wrap wraps a key with AES key wrap (KW, RFC 3394), using b, which must wrap an encryption construction. The key must
+// be a multiple of 8 bytes long, and at least 16; WrapPad takes keys of any length. The wrapped key is 8 bytes longer.
+//
+// Every step of the wrapping chain goes through b, so the construction's encodings are stripped before one step's
+// output feeds the next.
+func Wrap(b Block, key []byte) ([]byte, error) {
+	if len(key) < 16 || len(key)%8 != 0 {
+		return nil, errors.New("Key to wrap must be a multiple of 8 bytes long, and at least 16!")
+	}
+
+	return wrap(b, kwIV, key), nil
+}
+
+// Unwrap unwraps a key wrapped by Wrap, using b, which must wrap a decryption construction with the same key. An error
+// is returned if the wrapped key is the wrong length or fails its integrity check.
+func Unwrap(b Block, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 24 || len(wrapped)%8 != 0 {
+		return nil, errors.New("Wrapped key is the wrong length!")
+	}
+
+	iv, key := unwrap(b, wrapped)
+	if subtle.ConstantTimeCompare(iv, kwIV) != 1 {
+		return nil, errors.New("Wrapped key failed integrity check!")
+	}
+
+	return key, nil
+}
+
+// WrapPad wraps a key of any non-zero length with AES key wrap with padding (KWP, RFC 5649), using b, which must wrap
+// an encryption construction. The wrapped key is the key's length rounded up to a multiple of 8, plus 8.
+func WrapPad(b Block, key []byte) ([]byte, error) {
+	if len(key) == 0 || uint64(len(key)) > 0xffffffff {
+		return nil, errors.New("Key to wrap must be between 1 and 2^32-1 bytes long!")
+	}
+
+	iv := make([]byte, 8)
+	copy(iv, kwpIV)
+	binary.BigEndian.PutUint32(iv[4:], uint32(len(key)))
+
+	padded := make([]byte, (len(key)+7)/8*8)
+	copy(padded, key)
+
+	// A key that fits in one half-block is encrypted in a single block, instead of going through the wrapping chain.
+	if len(padded) == 8 {
+		out := append(iv, padded...)
+		b.Encrypt(out, out)
+
+		return out, nil
+	}
+
+	return wrap(b, iv, padded), nil
+}
+
+// UnwrapPad unwraps a key wrapped by WrapPad, using b, which must wrap a decryption construction with the same key. An
+// error is returned if the wrapped key is the wrong length or fails its integrity check.
+func UnwrapPad(b Block, wrapped []byte) ([]byte, error) {
+	if len(wrapped) < 16 || len(wrapped)%8 != 0 {
+		return nil, errors.New("Wrapped key is the wrong length!")
+	}
+
+	var iv, padded []byte
+	if len(wrapped) == 16 {
+		out := make([]byte, 16)
+		b.Decrypt(out, wrapped)
+
+		iv, padded = out[:8], out[8:]
+	} else {
+		iv, padded = unwrap(b, wrapped)
+	}
+
+	// Check the initial value, the length, and that the padding is zero, all without branching on which went wrong.
+	// The subtle functions only take 31-bit integers, so the top bit of the length is checked on its own.
+	length := int(binary.BigEndian.Uint32(iv[4:]) & 0x7fffffff)
+	good := subtle.ConstantTimeCompare(iv[:4], kwpIV) & subtle.ConstantTimeByteEq(iv[4]>>7, 0)
+	good &= subtle.ConstantTimeLessOrEq(len(padded)-7, length) & subtle.ConstantTimeLessOrEq(length, len(padded))
+
+	for i := len(padded) - 7; i < len(padded); i++ {
+		isPadding := subtle.ConstantTimeLessOrEq(length, i)
+		good &= subtle.ConstantTimeSelect(isPadding, subtle.ConstantTimeByteEq(padded[i], 0), 1)
+	}
+
+	if good != 1 {
+		return nil, errors.New("Wrapped key failed integrity check!")
+	}
+
+	return padded[:length], nil
+}
+
+// wrap is the wrapping process W of RFC 3394, with the given initial value, on a key of at least two half-blocks.
+func wrap(b Block, iv, key []byte) []byte {
+	n := len(key) / 8
+
+	out := make([]byte, 8+len(key))
+	copy(out, iv)
+	copy(out[8:], key)
+
+	a, block := out[:8], make([]byte, 16)
+	for j := 0; j < 6; j++ {
+		for i := 1; i <= n; i++ {
+			r := out[8*i : 8*(i+1)]
+
+			copy(block, a)
+			copy(block[8:], r)
+			b.Encrypt(block, block)
+
+			copy(a, block[:8])
+			xorCounter(a, uint64(n*j+i))
+			copy(r, block[8:])
+		}
+	}
+
+	return out
+}
+
+// unwrap undoes wrap, returning the initial value it finds, for the caller to check, and the key.
+func unwrap(b Block, wrapped []byte) (iv, key []byte) {
+	n := len(wrapped)/8 - 1
+
+	out := make([]byte, len(wrapped))
+	copy(out, wrapped)
+
+	a, block := out[:8], make([]byte, 16)
+	for j := 5; j >= 0; j-- {
+		for i := n; i >= 1; i-- {
+			r := out[8*i : 8*(i+1)]
+
+			xorCounter(a, uint64(n*j+i))
+			copy(block, a)
+			copy(block[8:], r)
+			b.Decrypt(block, block)
+
+			copy(a, block[:8])
+			copy(r, block[8:])
+		}
+	}
+
+	return out[:8], out[8:]
+}
+
+// xorCounter XORs the big-endian encoding of t into a.
+func xorCounter(a []byte, t uint64) {
+	temp := [8]byte{}
+	binary.BigEndian.PutUint64(temp[:], t)
+
+	for i := range temp {
+		a[i] ^= temp[i]
+	}
+}
@@ -0,0 +1,97 @@
+// Package modes implements the standard modes of operation (CTR, CBC, OFB, CFB) over white-boxed block ciphers whose
+// inputs and outputs carry external encodings.
+//
+// The stock modes in crypto/cipher assume the block cipher computes plain AES, so handing them a white-boxed
+// Construction directly XORs encoded keystream into the plaintext and chains encoded ciphertexts into the next block.
+// Wrapping the construction in a Block first moves the encodings to the boundary of each block cipher call, where they
+// belong.
+//
+// Padding is part of the plaintext, so it goes on before the input encoding and comes off after the output encoding is
+// stripped. EncryptCBC and DecryptCBC pad and unpad with PKCS#7 or ANSI X.923 padding in that order.
+//
+// NewCMAC authenticates messages with the same white-boxed key, so that no raw AES key is needed for that either, and
+// Wrap and WrapPad wrap content keys with it (RFC 3394 and RFC 5649). XTS encrypts disk sectors under two white-boxed
+// keys, and SIV is a misuse-resistant AEAD for when nonces can't be trusted to be unique. FF1 is format-preserving
+// encryption, for tokenizing card numbers and the like.
+package modes
+
+import (
+	"crypto/cipher"
+
+	"github.com/OpenWhiteBox/primitives/encoding"
+	"github.com/OpenWhiteBox/primitives/matrix"
+)
+
+// Block is a white-boxed block cipher along with the external encodings on its input and output. Construction is
+// expected to compute Out.Encode(AES(In.Encode(x))), which is how every key generator in this repository describes its
+// masks.
+//
+// Block implements cipher.Block and computes unencoded AES, so it may be used anywhere crypto/cipher expects a block
+// cipher.
+type Block struct {
+	Construction cipher.Block
+	In, Out      encoding.Block
+}
+
+// NewBlock wraps constr, with the given input and output encodings, like the affine masks returned by the chow, toy, and
+// full key generators.
+func NewBlock(constr cipher.Block, in, out encoding.Block) Block {
+	return Block{constr, in, out}
+}
+
+// NewLinearBlock wraps constr, where the input and output encodings are the linear masks returned by the xiao key
+// generators.
+func NewLinearBlock(constr cipher.Block, inputMask, outputMask matrix.Matrix) Block {
+	return Block{constr, encoding.NewBlockLinear(inputMask), encoding.NewBlockLinear(outputMask)}
+}
+
+// BlockSize returns the block size of AES. (Necessary to implement cipher.Block.)
+func (b Block) BlockSize() int { return 16 }
+
+// Encrypt encrypts the first block in src into dst, removing the construction's encodings. Dst and src may point at the
+// same memory.
+func (b Block) Encrypt(dst, src []byte) {
+	temp := [16]byte{}
+	copy(temp[:], src)
+
+	temp = b.In.Decode(temp)
+	b.Construction.Encrypt(temp[:], temp[:])
+	temp = b.Out.Decode(temp)
+
+	copy(dst, temp[:])
+}
+
+// Decrypt decrypts the first block in src into dst, removing the construction's encodings. The construction must be
+// one that computes decryption. Dst and src may point at the same memory.
+func (b Block) Decrypt(dst, src []byte) {
+	temp := [16]byte{}
+	copy(temp[:], src)
+
+	temp = b.In.Decode(temp)
+	b.Construction.Decrypt(temp[:], temp[:])
+	temp = b.Out.Decode(temp)
+
+	copy(dst, temp[:])
+}
+
+// NewCTR returns a cipher.Stream which encrypts/decrypts using b in counter mode. Only an encryption construction is
+// needed for both directions. Keeping IVs from repeating is up to the caller; a Counter does it instead.
+func NewCTR(b Block, iv []byte) cipher.Stream { return cipher.NewCTR(b, iv) }
+
+// NewOFB returns a cipher.Stream which encrypts/decrypts using b in output feedback mode. Only an encryption
+// construction is needed for both directions.
+func NewOFB(b Block, iv []byte) cipher.Stream { return cipher.NewOFB(b, iv) }
+
+// NewCFBEncrypter returns a cipher.Stream which encrypts using b in cipher feedback mode.
+func NewCFBEncrypter(b Block, iv []byte) cipher.Stream { return cipher.NewCFBEncrypter(b, iv) }
+
+// NewCFBDecrypter returns a cipher.Stream which decrypts using b in cipher feedback mode. Like NewCFBEncrypter, it only
+// uses b's Encrypt method, so b should wrap an encryption construction.
+func NewCFBDecrypter(b Block, iv []byte) cipher.Stream { return cipher.NewCFBDecrypter(b, iv) }
+
+// NewCBCEncrypter returns a cipher.BlockMode which encrypts using b in cipher block chaining mode.
+func NewCBCEncrypter(b Block, iv []byte) cipher.BlockMode { return cipher.NewCBCEncrypter(b, iv) }
+
+// NewCBCDecrypter returns a cipher.BlockMode which decrypts using b in cipher block chaining mode. b must wrap a
+// decryption construction, like the one returned by chow.GenerateDecryptionKeys.
+func NewCBCDecrypter(b Block, iv []byte) cipher.BlockMode { return cipher.NewCBCDecrypter(b, iv) }
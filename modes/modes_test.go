@@ -0,0 +1,594 @@
+package modes
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"encoding/hex"
+	"testing"
+
+	"github.com/OpenWhiteBox/AES/constructions/chow"
+	"github.com/OpenWhiteBox/AES/constructions/common"
+)
+
+var (
+	key  = []byte{72, 101, 108, 108, 111, 32, 87, 111, 114, 108, 100, 33, 33, 33, 33, 33}
+	seed = []byte{38, 41, 142, 156, 29, 181, 23, 194, 21, 250, 223, 183, 210, 168, 214, 145}
+	iv   = []byte{99, 83, 224, 140, 9, 96, 225, 4, 205, 112, 183, 81, 186, 202, 208, 231}
+)
+
+var opts = common.IndependentMasks{common.RandomMask, common.RandomMask}
+
+func encryptionBlock() Block {
+	constr, inputMask, outputMask := chow.GenerateEncryptionKeys(key, seed, opts)
+	return NewBlock(constr, inputMask, outputMask)
+}
+
+func decryptionBlock() Block {
+	constr, inputMask, outputMask := chow.GenerateDecryptionKeys(key, seed, opts)
+	return NewBlock(constr, inputMask, outputMask)
+}
+
+func plaintext(n int) []byte {
+	out := make([]byte, n)
+	for i := range out {
+		out[i] = byte(3 * i)
+	}
+
+	return out
+}
+
+func TestBlock(t *testing.T) {
+	real, _ := aes.NewCipher(key)
+	enc, dec := encryptionBlock(), decryptionBlock()
+
+	in := plaintext(16)
+	cand, want := make([]byte, 16), make([]byte, 16)
+
+	real.Encrypt(want, in)
+	enc.Encrypt(cand, in)
+	if !bytes.Equal(want, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", want, cand)
+	}
+
+	dec.Decrypt(cand, cand)
+	if !bytes.Equal(in, cand) {
+		t.Fatalf("Decryption disagrees with original! %x != %x", in, cand)
+	}
+}
+
+func TestStreams(t *testing.T) {
+	real, _ := aes.NewCipher(key)
+	enc := encryptionBlock()
+
+	modes := []struct {
+		name       string
+		real, cand cipher.Stream
+	}{
+		{"CTR", cipher.NewCTR(real, iv), NewCTR(enc, iv)},
+		{"OFB", cipher.NewOFB(real, iv), NewOFB(enc, iv)},
+		{"CFB", cipher.NewCFBEncrypter(real, iv), NewCFBEncrypter(enc, iv)},
+	}
+
+	in := plaintext(100)
+
+	for _, mode := range modes {
+		want, cand := make([]byte, len(in)), make([]byte, len(in))
+		mode.real.XORKeyStream(want, in)
+		mode.cand.XORKeyStream(cand, in)
+
+		if !bytes.Equal(want, cand) {
+			t.Fatalf("Real disagrees with result in %v mode! %x != %x", mode.name, want, cand)
+		}
+	}
+
+	ct := make([]byte, len(in))
+	NewCFBEncrypter(enc, iv).XORKeyStream(ct, in)
+	NewCFBDecrypter(enc, iv).XORKeyStream(ct, ct)
+
+	if !bytes.Equal(in, ct) {
+		t.Fatalf("CFB decryption disagrees with original! %x != %x", in, ct)
+	}
+}
+
+func TestCBC(t *testing.T) {
+	real, _ := aes.NewCipher(key)
+	enc, dec := encryptionBlock(), decryptionBlock()
+
+	in := plaintext(64)
+	want, cand := make([]byte, len(in)), make([]byte, len(in))
+
+	cipher.NewCBCEncrypter(real, iv).CryptBlocks(want, in)
+	NewCBCEncrypter(enc, iv).CryptBlocks(cand, in)
+
+	if !bytes.Equal(want, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", want, cand)
+	}
+
+	NewCBCDecrypter(dec, iv).CryptBlocks(cand, cand)
+
+	if !bytes.Equal(in, cand) {
+		t.Fatalf("Decryption disagrees with original! %x != %x", in, cand)
+	}
+}
+
+func TestGCM(t *testing.T) {
+	real, _ := aes.NewCipher(key)
+	realAEAD, _ := cipher.NewGCM(real)
+
+	candAEAD, err := NewGCM(encryptionBlock())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	nonce, in, data := iv[:candAEAD.NonceSize()], plaintext(100), []byte("additional data")
+
+	want := realAEAD.Seal(nil, nonce, in, data)
+	cand := candAEAD.Seal(nil, nonce, in, data)
+
+	if !bytes.Equal(want, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", want, cand)
+	}
+
+	opened, err := candAEAD.Open(nil, nonce, cand, data)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(in, opened) {
+		t.Fatalf("Decryption disagrees with original! %x != %x", in, opened)
+	}
+
+	cand[0] ^= 1
+	if _, err := candAEAD.Open(nil, nonce, cand, data); err == nil {
+		t.Fatalf("Open accepted a modified ciphertext!")
+	}
+}
+
+func TestPadding(t *testing.T) {
+	for _, p := range []Padding{PKCS7, X923} {
+		for n := 0; n <= 32; n++ {
+			in := plaintext(n)
+
+			padded := p.Pad(in)
+			if len(padded)%16 != 0 || len(padded) <= n || len(padded) > n+16 {
+				t.Fatalf("Padded %v bytes to %v bytes!", n, len(padded))
+			}
+
+			cand, err := p.Unpad(padded)
+			if err != nil {
+				t.Fatal(err)
+			} else if !bytes.Equal(in, cand) {
+				t.Fatalf("Unpadded disagrees with original! %x != %x", in, cand)
+			}
+		}
+	}
+
+	// Padding bytes that were tampered with, out-of-range lengths, and partial blocks are rejected.
+	for _, padded := range [][]byte{
+		append(plaintext(12), 4, 4, 5, 4),
+		append(plaintext(15), 0),
+		append(plaintext(15), 17),
+		plaintext(15),
+		nil,
+	} {
+		if _, err := PKCS7.Unpad(padded); err == nil {
+			t.Fatalf("Accepted invalid padding! %x", padded)
+		}
+	}
+
+	if _, err := X923.Unpad(append(plaintext(12), 0, 1, 0, 4)); err == nil {
+		t.Fatalf("Accepted invalid padding!")
+	} else if _, err := X923.Unpad(append(plaintext(12), 4, 4, 4, 4)); err == nil {
+		t.Fatalf("Accepted PKCS#7 padding as ANSI X.923 padding!")
+	}
+}
+
+func TestPaddedCBC(t *testing.T) {
+	real, _ := aes.NewCipher(key)
+	in := plaintext(100)
+
+	// The padding has to go on the plaintext, not on anything with the encodings applied.
+	want := PKCS7.Pad(in)
+	cipher.NewCBCEncrypter(real, iv).CryptBlocks(want, want)
+
+	cand := EncryptCBC(encryptionBlock(), iv, in, PKCS7)
+	if !bytes.Equal(want, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", want, cand)
+	}
+
+	opened, err := DecryptCBC(decryptionBlock(), iv, cand, PKCS7)
+	if err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(in, opened) {
+		t.Fatalf("Decryption disagrees with original! %x != %x", in, opened)
+	}
+
+	if _, err := DecryptCBC(decryptionBlock(), iv, cand, X923); err == nil {
+		t.Fatalf("Decrypted with the wrong padding!")
+	} else if _, err := DecryptCBC(decryptionBlock(), iv, cand[:50], PKCS7); err == nil {
+		t.Fatalf("Decrypted a partial block!")
+	}
+}
+
+func TestCMAC(t *testing.T) {
+	// Test vectors from RFC 4493, with the key white-boxed under random masks.
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	msg, _ := hex.DecodeString("6bc1bee22e409f96e93d7e117393172aae2d8a571e03ac9c9eb76fac45af8e5130c81c46a35ce411e5fbc1191a0a52eff69f2445df4f9b17ad2b417be66c3710")
+
+	constr, inputMask, outputMask := chow.GenerateEncryptionKeys(key, seed, opts)
+	mac := NewCMAC(NewBlock(constr, inputMask, outputMask))
+
+	for _, vector := range []struct {
+		n   int
+		tag string
+	}{
+		{0, "bb1d6929e95937287fa37d129b756746"},
+		{16, "070a16b46b4d4144f79bdd9dd04a287c"},
+		{40, "dfa66747de9ae63030ca32611497c827"},
+		{64, "51f0bebf7e3b9d92fc49741779363cfe"},
+	} {
+		// Writing in uneven pieces shouldn't change anything.
+		mac.Reset()
+		for i := 0; i < vector.n; i += 7 {
+			mac.Write(msg[i:min(i+7, vector.n)])
+		}
+
+		if cand := hex.EncodeToString(mac.Sum(nil)); cand != vector.tag {
+			t.Fatalf("Real disagrees with result for %v bytes! %v != %v", vector.n, vector.tag, cand)
+		}
+	}
+}
+
+func TestKeyWrap(t *testing.T) {
+	// Test vectors from RFC 3394 and RFC 5649, with the keys white-boxed under random masks.
+	vectors := []struct {
+		kek, key, wrapped string
+		pad               bool
+	}{
+		{"000102030405060708090a0b0c0d0e0f", "00112233445566778899aabbccddeeff", "1fa68b0a8112b447aef34bd8fb5a7b829d3e862371d2cfe5", false},
+		{"000102030405060708090a0b0c0d0e0f1011121314151617", "00112233445566778899aabbccddeeff0001020304050607", "031d33264e15d33268f24ec260743edce1c6c7ddee725a936ba814915c6762d2", false},
+		{"5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "c37b7e6492584340bed12207808941155068f738", "138bdeaa9b8fa7fc61f97742e72248ee5ae6ae5360d1ae6a5f54f373fa543b6a", true},
+		{"5840df6e29b02af1ab493b705bf16ea1ae8338f4dcc176a8", "466f7250617369", "afbeb0f07dfbf5419200f2ccb50bb24f", true},
+	}
+
+	for _, vector := range vectors {
+		kek, _ := hex.DecodeString(vector.kek)
+		key, _ := hex.DecodeString(vector.key)
+		real, _ := hex.DecodeString(vector.wrapped)
+
+		constr, inputMask, outputMask := chow.GenerateEncryptionKeys(kek, seed, opts)
+		enc := NewBlock(constr, inputMask, outputMask)
+		constr, inputMask, outputMask = chow.GenerateDecryptionKeys(kek, seed, opts)
+		dec := NewBlock(constr, inputMask, outputMask)
+
+		wrap, unwrap := Wrap, Unwrap
+		if vector.pad {
+			wrap, unwrap = WrapPad, UnwrapPad
+		}
+
+		cand, err := wrap(enc, key)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		}
+
+		unwrapped, err := unwrap(dec, cand)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(key, unwrapped) {
+			t.Fatalf("Unwrapped key disagrees with original! %x != %x", key, unwrapped)
+		}
+
+		cand[len(cand)-1] ^= 1
+		if _, err := unwrap(dec, cand); err == nil {
+			t.Fatalf("Unwrapped a modified key!")
+		}
+	}
+
+	enc := encryptionBlock()
+	if _, err := Wrap(enc, make([]byte, 20)); err == nil {
+		t.Fatalf("Wrapped a key that isn't a multiple of 8 bytes without padding!")
+	} else if _, err := WrapPad(enc, nil); err == nil {
+		t.Fatalf("Wrapped an empty key!")
+	}
+}
+
+func TestCounter(t *testing.T) {
+	real, _ := aes.NewCipher(key)
+	ctr := NewCounter(encryptionBlock())
+
+	nonce, err := ctr.NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	in := plaintext(100)
+	want, cand := make([]byte, len(in)), make([]byte, len(in))
+
+	cipher.NewCTR(real, append(append([]byte{}, nonce...), 0, 0, 0, 0)).XORKeyStream(want, in)
+
+	// The message can be encrypted in uneven pieces.
+	stream, err := ctr.Stream(nonce)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.XORKeyStream(cand[:7], in[:7])
+	stream.XORKeyStream(cand[7:], in[7:])
+
+	if !bytes.Equal(want, cand) {
+		t.Fatalf("Real disagrees with result! %x != %x", want, cand)
+	}
+
+	// A nonce can't be used twice to encrypt, even by a different Counter over the same key, but decrypting doesn't use
+	// it up.
+	if err := ctr.XORKeyStream(cand, cand, nonce); err == nil {
+		t.Fatalf("Reused a nonce!")
+	} else if err := NewCounter(encryptionBlock()).XORKeyStream(cand, cand, nonce); err == nil {
+		t.Fatalf("Reused a nonce with a different Counter!")
+	} else if err := NewCounter(encryptionBlock()).Decrypt(cand, cand, nonce); err != nil {
+		t.Fatal(err)
+	} else if !bytes.Equal(in, cand) {
+		t.Fatalf("Decryption disagrees with original! %x != %x", in, cand)
+	}
+
+	if _, err := ctr.Stream(nonce[:8]); err == nil {
+		t.Fatalf("Accepted a nonce of the wrong size!")
+	} else if _, err := ctr.DecryptStream(nonce[:8]); err == nil {
+		t.Fatalf("Accepted a nonce of the wrong size!")
+	} else if _, err := ctr.Stream(keyNonce[:]); err == nil {
+		t.Fatalf("Encrypted under the nonce that identifies the key!")
+	}
+
+	// Counters over a different key have nonces of their own.
+	otherKey := append([]byte{}, key...)
+	otherKey[0] ^= 1
+	constr, inputMask, outputMask := chow.GenerateEncryptionKeys(otherKey, seed, opts)
+
+	if err := NewCounter(NewBlock(constr, inputMask, outputMask)).XORKeyStream(cand, in, nonce); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCounterNonces(t *testing.T) {
+	ctrs := []*Counter{NewCounter(encryptionBlock()), NewCounter(encryptionBlock())}
+
+	// NewNonce reserves its nonces for the key, across Counters and goroutines.
+	results := make(chan []byte)
+	for i := 0; i < 8; i++ {
+		go func(ctr *Counter) {
+			for j := 0; j < 64; j++ {
+				nonce, err := ctr.NewNonce()
+				if err != nil {
+					panic(err)
+				}
+				results <- nonce
+			}
+		}(ctrs[i%2])
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 8*64; i++ {
+		nonce := <-results
+
+		if seen[string(nonce)] {
+			t.Fatalf("NewNonce returned a nonce twice! %x", nonce)
+		}
+		seen[string(nonce)] = true
+
+		ctrs[0].nonces.mu.Lock()
+		used, ok := ctrs[0].nonces.used[[NonceSize]byte(nonce)]
+		ctrs[0].nonces.mu.Unlock()
+
+		if !ok || used {
+			t.Fatalf("NewNonce didn't reserve its nonce! %x", nonce)
+		}
+	}
+
+	// A reserved nonce is used up by its first Stream, on whichever Counter.
+	nonce, err := ctrs[0].NewNonce()
+	if err != nil {
+		t.Fatal(err)
+	} else if _, err := ctrs[1].Stream(nonce); err != nil {
+		t.Fatal(err)
+	} else if _, err := ctrs[0].Stream(nonce); err == nil {
+		t.Fatalf("Reused a reserved nonce!")
+	}
+}
+
+func TestXTS(t *testing.T) {
+	// Test vectors from IEEE 1619, with the keys white-boxed under random masks.
+	vectors := []struct {
+		data, tweak string
+		sector      uint64
+		in, out     string
+	}{
+		{
+			"00000000000000000000000000000000", "00000000000000000000000000000000", 0,
+			"0000000000000000000000000000000000000000000000000000000000000000",
+			"917cf69ebd68b2ec9b9fe9a3eadda692cd43d2f59598ed858c02c2652fbf922e",
+		},
+		{
+			"11111111111111111111111111111111", "22222222222222222222222222222222", 0x3333333333,
+			"4444444444444444444444444444444444444444444444444444444444444444",
+			"c454185e6a16936e39334038acef838bfb186fff7480adc4289382ecd6d394f0",
+		},
+	}
+
+	for _, vector := range vectors {
+		dataKey, _ := hex.DecodeString(vector.data)
+		tweakKey, _ := hex.DecodeString(vector.tweak)
+		in, _ := hex.DecodeString(vector.in)
+		real, _ := hex.DecodeString(vector.out)
+
+		constr, inputMask, outputMask := chow.GenerateEncryptionKeys(tweakKey, seed, opts)
+		tweak := NewBlock(constr, inputMask, outputMask)
+		constr, inputMask, outputMask = chow.GenerateEncryptionKeys(dataKey, seed, opts)
+		enc := NewXTS(NewBlock(constr, inputMask, outputMask), tweak)
+		constr, inputMask, outputMask = chow.GenerateDecryptionKeys(dataKey, seed, opts)
+		dec := NewXTS(NewBlock(constr, inputMask, outputMask), tweak)
+
+		cand := make([]byte, len(in))
+		enc.Encrypt(cand, in, vector.sector)
+		if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		}
+
+		dec.Decrypt(cand, cand, vector.sector)
+		if !bytes.Equal(in, cand) {
+			t.Fatalf("Decryption disagrees with original! %x != %x", in, cand)
+		}
+	}
+
+	// With ciphertext stealing, the partial block at the end of the ciphertext is stolen from the encryption of the
+	// last full block of plaintext, as if there were nothing after it. Every length of sector decrypts back to itself.
+	enc, dec := NewXTS(encryptionBlock(), encryptionBlock()), NewXTS(decryptionBlock(), encryptionBlock())
+	for n := 16; n <= 48; n++ {
+		in, cand := plaintext(n), make([]byte, n)
+
+		enc.Encrypt(cand, in, uint64(n))
+
+		if tail := n % 16; tail != 0 {
+			full := make([]byte, n-tail)
+			enc.Encrypt(full, in[:n-tail], uint64(n))
+
+			if !bytes.Equal(cand[n-tail:], full[n-tail-16:n-16]) {
+				t.Fatalf("Stolen ciphertext disagrees for %v bytes! %x != %x", n, full[n-tail-16:n-16], cand[n-tail:])
+			}
+		}
+
+		dec.Decrypt(cand, cand, uint64(n))
+
+		if !bytes.Equal(in, cand) {
+			t.Fatalf("Decryption disagrees with original for %v bytes! %x != %x", n, in, cand)
+		}
+	}
+}
+
+func TestSIV(t *testing.T) {
+	// Test vectors from RFC 5297, with the two halves of the key white-boxed under random masks.
+	vectors := []struct {
+		key     string
+		data    []string
+		in, out string
+	}{
+		{
+			"fffefdfcfbfaf9f8f7f6f5f4f3f2f1f0f0f1f2f3f4f5f6f7f8f9fafbfcfdfeff",
+			[]string{"101112131415161718191a1b1c1d1e1f2021222324252627"},
+			"112233445566778899aabbccddee",
+			"85632d07c6e8f37f950acd320a2ecc9340c02b9690c4dc04daef7f6afe5c",
+		},
+		{
+			"7f7e7d7c7b7a79787776757473727170404142434445464748494a4b4c4d4e4f",
+			[]string{
+				"00112233445566778899aabbccddeeffdeaddadadeaddadaffeeddccbbaa99887766554433221100",
+				"102030405060708090a0",
+				"09f911029d74e35bd84156c5635688c0", // The nonce.
+			},
+			"7468697320697320736f6d6520706c61696e7465787420746f20656e6372797074207573696e67205349562d414553",
+			"7bdb6e3b432667eb06f4d14bff2fbd0fcb900f2fddbe404326601965c889bf17dba77ceb094fa663b7a3f748ba8af829ea64ad544a272e9c485b62a3fd5c0d",
+		},
+	}
+
+	for _, vector := range vectors {
+		key, _ := hex.DecodeString(vector.key)
+		in, _ := hex.DecodeString(vector.in)
+		real, _ := hex.DecodeString(vector.out)
+
+		data := make([][]byte, len(vector.data))
+		for i, ad := range vector.data {
+			data[i], _ = hex.DecodeString(ad)
+		}
+
+		constr, inputMask, outputMask := chow.GenerateEncryptionKeys(key[:16], seed, opts)
+		mac := NewBlock(constr, inputMask, outputMask)
+		constr, inputMask, outputMask = chow.GenerateEncryptionKeys(key[16:], seed, opts)
+		siv := NewSIV(mac, NewBlock(constr, inputMask, outputMask))
+
+		cand := siv.Seal(nil, in, data...)
+		if !bytes.Equal(real, cand) {
+			t.Fatalf("Real disagrees with result! %x != %x", real, cand)
+		}
+
+		opened, err := siv.Open(nil, cand, data...)
+		if err != nil {
+			t.Fatal(err)
+		} else if !bytes.Equal(in, opened) {
+			t.Fatalf("Decryption disagrees with original! %x != %x", in, opened)
+		}
+
+		cand[len(cand)-1] ^= 1
+		if _, err := siv.Open(nil, cand, data...); err == nil {
+			t.Fatalf("Open accepted a modified ciphertext!")
+		}
+		cand[len(cand)-1] ^= 1
+
+		if _, err := siv.Open(nil, cand, data[1:]...); err == nil {
+			t.Fatalf("Open accepted the wrong associated data!")
+		}
+	}
+}
+
+func TestFF1(t *testing.T) {
+	// Sample vectors from NIST for FF1-AES128, with the key white-boxed under random masks.
+	key, _ := hex.DecodeString("2b7e151628aed2a6abf7158809cf4f3c")
+	constr, inputMask, outputMask := chow.GenerateEncryptionKeys(key, seed, opts)
+	b := NewBlock(constr, inputMask, outputMask)
+
+	vectors := []struct {
+		radix   int
+		tweak   string
+		in, out string
+	}{
+		{10, "", "0123456789", "2433477484"},
+		{10, "39383736353433323130", "0123456789", "6124200773"},
+		{36, "3737373770717273373737", "0123456789abcdefghi", "a9tv40mll9kdu509eum"},
+	}
+
+	for _, vector := range vectors {
+		tweak, _ := hex.DecodeString(vector.tweak)
+
+		ff1, err := NewFF1(b, vector.radix)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cand, err := ff1.EncryptString(vector.in, tweak)
+		if err != nil {
+			t.Fatal(err)
+		} else if cand != vector.out {
+			t.Fatalf("Real disagrees with result! %v != %v", vector.out, cand)
+		}
+
+		cand, err = ff1.DecryptString(cand, tweak)
+		if err != nil {
+			t.Fatal(err)
+		} else if cand != vector.in {
+			t.Fatalf("Decryption disagrees with original! %v != %v", vector.in, cand)
+		}
+	}
+
+	ff1, _ := NewFF1(b, 10)
+	if _, err := ff1.EncryptString("12345", nil); err == nil {
+		t.Fatalf("Encrypted a string with too few possible values!")
+	} else if _, err := ff1.EncryptString("012345678a", nil); err == nil {
+		t.Fatalf("Encrypted a string with a numeral larger than the radix!")
+	} else if _, err := NewFF1(b, 1); err == nil {
+		t.Fatalf("Accepted a radix of 1!")
+	}
+
+	// Odd lengths and large radices go through the numeral methods.
+	ff1, _ = NewFF1(b, 1<<16)
+	in := []uint16{65535, 0, 12345}
+
+	cand, err := ff1.Encrypt(in, []byte("tweak"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cand, err = ff1.Decrypt(cand, []byte("tweak"))
+	if err != nil {
+		t.Fatal(err)
+	} else if cand[0] != in[0] || cand[1] != in[1] || cand[2] != in[2] {
+		t.Fatalf("Decryption disagrees with original! %v != %v", in, cand)
+	}
+}
@@ -0,0 +1,85 @@
+package modes
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+// Padding is a scheme for padding messages to a whole number of blocks. Padding is part of the plaintext: it's added
+// before the plaintext reaches the construction's input encoding on encryption, and removed after the output encoding
+// has been stripped on decryption. EncryptCBC and DecryptCBC do both in the right order.
+type Padding int
+
+const (
+	PKCS7 Padding = iota // Every padding byte is the number of padding bytes (RFC 5652).
+	X923                 // The padding bytes are zero, except for the last, which is the number of padding bytes.
+)
+
+// Pad returns a copy of in with between 1 and 16 bytes of padding appended, so that its length is a multiple of 16.
+func (p Padding) Pad(in []byte) []byte {
+	n := 16 - len(in)%16
+
+	filler := byte(n)
+	if p == X923 {
+		filler = 0
+	}
+
+	out := append(make([]byte, 0, len(in)+n), in...)
+	for i := 0; i < n-1; i++ {
+		out = append(out, filler)
+	}
+
+	return append(out, byte(n))
+}
+
+// Unpad returns in with its padding removed, as a subslice of in. The padding is checked in constant time, so that an
+// attacker who can submit ciphertexts can't learn where it went wrong from how long checking took. An error is
+// returned if in isn't a non-empty multiple of 16 bytes long, or its padding is invalid.
+func (p Padding) Unpad(in []byte) ([]byte, error) {
+	if len(in) == 0 || len(in)%16 != 0 {
+		return nil, errors.New("Padded input isn't a multiple of the block size!")
+	}
+
+	last := in[len(in)-16:]
+	n := int(last[15])
+
+	filler := byte(n)
+	if p == X923 {
+		filler = 0
+	}
+
+	good := subtle.ConstantTimeLessOrEq(1, n) & subtle.ConstantTimeLessOrEq(n, 16)
+	for i := 0; i < 15; i++ {
+		isPadding := subtle.ConstantTimeLessOrEq(16-n, i)
+		good &= subtle.ConstantTimeSelect(isPadding, subtle.ConstantTimeByteEq(last[i], filler), 1)
+	}
+
+	if good != 1 {
+		return nil, errors.New("Invalid padding!")
+	}
+
+	return in[:len(in)-n], nil
+}
+
+// EncryptCBC pads plaintext and encrypts it using b in cipher block chaining mode, returning a new slice. b must wrap an
+// encryption construction.
+func EncryptCBC(b Block, iv, plaintext []byte, p Padding) []byte {
+	out := p.Pad(plaintext)
+	NewCBCEncrypter(b, iv).CryptBlocks(out, out)
+
+	return out
+}
+
+// DecryptCBC decrypts ciphertext using b in cipher block chaining mode and removes its padding, returning a new slice. b
+// must wrap a decryption construction. An error is returned if the ciphertext isn't a whole number of blocks or its
+// padding is invalid.
+func DecryptCBC(b Block, iv, ciphertext []byte, p Padding) ([]byte, error) {
+	if len(ciphertext) == 0 || len(ciphertext)%16 != 0 {
+		return nil, errors.New("Ciphertext isn't a multiple of the block size!")
+	}
+
+	out := make([]byte, len(ciphertext))
+	NewCBCDecrypter(b, iv).CryptBlocks(out, ciphertext)
+
+	return p.Unpad(out)
+}
@@ -0,0 +1,115 @@
+package modes
+
+import (
+	"crypto/subtle"
+	"errors"
+)
+
+// SIV is AES-SIV (RFC 5297), a deterministic, misuse-resistant AEAD, over two white-boxed keys: MAC, the white-box of
+// the first half of the SIV key, and CTR, the white-box of the second half. Both wrap encryption constructions, even to
+// open. Repeating a nonce, or using none, only reveals whether the same message was sealed twice, so SIV fits
+// environments where nonces can't be trusted to be unique.
+//
+// The tag is computed with CMAC and the message encrypted in counter mode, both through the Blocks, so the
+// constructions' encodings are stripped before the tag becomes the counter and before the keystream is used.
+type SIV struct {
+	MAC, CTR Block
+}
+
+// NewSIV returns AES-SIV with the given white-boxes of the two halves of the key.
+func NewSIV(mac, ctr Block) SIV {
+	return SIV{mac, ctr}
+}
+
+// Seal encrypts and authenticates plaintext and authenticates each of the given associated data, appending the 16-byte
+// synthetic IV and then the ciphertext to dst. Like RFC 5297, a nonce is passed as the last associated data. At most
+// 126 pieces of associated data are allowed; Seal panics if there are more.
+func (s SIV) Seal(dst, plaintext []byte, data ...[]byte) []byte {
+	if len(data) > 126 {
+		panic("Too many pieces of associated data!")
+	}
+
+	v := s.s2v(plaintext, data)
+
+	out := append(dst, v[:]...)
+	out = append(out, make([]byte, len(plaintext))...)
+	NewCTR(s.CTR, counter(v)).XORKeyStream(out[len(out)-len(plaintext):], plaintext)
+
+	return out
+}
+
+// Open decrypts and authenticates a ciphertext sealed with the same associated data, in the same order, and appends the
+// plaintext to dst. An error is returned, and nothing appended, if the ciphertext was modified or the associated data
+// is wrong.
+func (s SIV) Open(dst, ciphertext []byte, data ...[]byte) ([]byte, error) {
+	if len(ciphertext) < 16 {
+		return nil, errors.New("Ciphertext is too short!")
+	} else if len(data) > 126 {
+		return nil, errors.New("Too many pieces of associated data!")
+	}
+
+	v := [16]byte{}
+	copy(v[:], ciphertext)
+
+	plaintext := make([]byte, len(ciphertext)-16)
+	NewCTR(s.CTR, counter(v)).XORKeyStream(plaintext, ciphertext[16:])
+
+	if cand := s.s2v(plaintext, data); subtle.ConstantTimeCompare(v[:], cand[:]) != 1 {
+		return nil, errors.New("Ciphertext failed authentication!")
+	}
+
+	return append(dst, plaintext...), nil
+}
+
+// s2v is the S2V function of RFC 5297, over the associated data and then the plaintext.
+func (s SIV) s2v(plaintext []byte, data [][]byte) (v [16]byte) {
+	mac := NewCMAC(s.MAC)
+
+	sum := func(in []byte) (out [16]byte) {
+		mac.Reset()
+		mac.Write(in)
+		mac.Sum(out[:0])
+
+		return
+	}
+
+	d := sum(make([]byte, 16))
+	for _, ad := range data {
+		d = double(d)
+
+		tag := sum(ad)
+		for i := range d {
+			d[i] ^= tag[i]
+		}
+	}
+
+	var last []byte
+	if len(plaintext) >= 16 {
+		// XOR d into the end of the plaintext.
+		last = append([]byte{}, plaintext...)
+		for i := range d {
+			last[len(last)-16+i] ^= d[i]
+		}
+	} else {
+		d = double(d)
+
+		last = make([]byte, 16)
+		copy(last, plaintext)
+		last[len(plaintext)] = 0x80
+
+		for i := range d {
+			last[i] ^= d[i]
+		}
+	}
+
+	return sum(last)
+}
+
+// counter returns the initial counter block of the CTR encryption: the synthetic IV with the top bit of each of its
+// last two 32-bit words cleared, so that implementations with 32- or 64-bit counters agree.
+func counter(v [16]byte) []byte {
+	v[8] &= 0x7f
+	v[12] &= 0x7f
+
+	return v[:]
+}
@@ -0,0 +1,103 @@
+package modes
+
+import (
+	"encoding/binary"
+)
+
+// XTS is XTS-AES (IEEE 1619) over two white-boxed keys, for encrypting disk sectors or file blocks in place. Data is
+// the white-box of the data key and Tweak the white-box of the tweak key, which must be a different key. Each sector
+// is encrypted under a tweak derived from its number, so identical sectors encrypt differently, and ciphertexts keep
+// the length of their plaintexts.
+//
+// The tweak is only ever encrypted, so Tweak always wraps an encryption construction. Data wraps an encryption
+// construction to encrypt sectors and a decryption construction to decrypt them, like a Block.
+type XTS struct {
+	Data, Tweak Block
+}
+
+// NewXTS returns XTS-AES with the given data and tweak white-boxes.
+func NewXTS(data, tweak Block) XTS {
+	return XTS{data, tweak}
+}
+
+// Encrypt encrypts one sector from src into dst. Sectors that aren't a multiple of 16 bytes long are encrypted with
+// ciphertext stealing. Dst and src may point at the same memory. Encrypt panics if the sector is shorter than a block,
+// or dst is shorter than src.
+func (x XTS) Encrypt(dst, src []byte, sector uint64) {
+	x.crypt(dst, src, sector, x.Data.Encrypt, false)
+}
+
+// Decrypt decrypts one sector from src into dst, undoing Encrypt. Dst and src may point at the same memory. Decrypt
+// panics if the sector is shorter than a block, or dst is shorter than src.
+func (x XTS) Decrypt(dst, src []byte, sector uint64) {
+	x.crypt(dst, src, sector, x.Data.Decrypt, true)
+}
+
+func (x XTS) crypt(dst, src []byte, sector uint64, data func(dst, src []byte), decrypt bool) {
+	if len(src) < 16 {
+		panic("Sector is shorter than a block!")
+	} else if len(dst) < len(src) {
+		panic("Output smaller than input!")
+	}
+
+	tweak := [16]byte{}
+	binary.LittleEndian.PutUint64(tweak[:], sector)
+	x.Tweak.Encrypt(tweak[:], tweak[:])
+
+	// The last full block is left for ciphertext stealing if there's a partial block after it.
+	full, tail := len(src)/16, len(src)%16
+	if tail != 0 {
+		full--
+	}
+
+	for i := 0; i < full; i++ {
+		xex(dst[16*i:16*(i+1)], src[16*i:16*(i+1)], tweak, data)
+		tweak = mulAlpha(tweak)
+	}
+
+	if tail == 0 {
+		return
+	}
+
+	// Decryption undoes the last two blocks in the opposite order, so it needs the tweaks in the opposite order too.
+	first, second := tweak, mulAlpha(tweak)
+	if decrypt {
+		first, second = second, first
+	}
+
+	last, partial := 16*full, 16*(full+1)
+
+	block := [16]byte{}
+	xex(block[:], src[last:partial], first, data)
+
+	stolen := [16]byte{}
+	copy(stolen[:], src[partial:])
+	copy(stolen[tail:], block[tail:])
+
+	copy(dst[partial:], block[:tail])
+	xex(dst[last:partial], stolen[:], second, data)
+}
+
+// xex encrypts or decrypts one block under a tweak: data(src ^ tweak) ^ tweak.
+func xex(dst, src []byte, tweak [16]byte, data func(dst, src []byte)) {
+	block := [16]byte{}
+	for i := range block {
+		block[i] = src[i] ^ tweak[i]
+	}
+
+	data(block[:], block[:])
+
+	for i := range block {
+		dst[i] = block[i] ^ tweak[i]
+	}
+}
+
+// mulAlpha multiplies a tweak by the primitive element of GF(2^128), in XTS's little-endian bit order.
+func mulAlpha(in [16]byte) (out [16]byte) {
+	for i := 15; i > 0; i-- {
+		out[i] = in[i]<<1 | in[i-1]>>7
+	}
+	out[0] = in[0]<<1 ^ 0x87&-(in[15]>>7)
+
+	return
+}